@@ -0,0 +1,438 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	auditUtil "github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/response"
+)
+
+const (
+	ActionSearchUsers = "admin.users.search"
+	ActionViewUser    = "admin.user.view"
+	ActionDisableUser = "admin.user.disable"
+	ActionRestoreUser = "admin.user.restore"
+	ActionLogoutUser  = "admin.user.logout"
+	ActionResetMFA    = "admin.user.mfa_reset"
+	ActionChangeRole  = "admin.user.role"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type API struct {
+	store     *store.Store
+	validator *validator.Validate
+	log       *logger.Logger
+}
+
+func New(store *store.Store, validator *validator.Validate, log *logger.Logger) *API {
+	return &API{
+		store:     store,
+		validator: validator,
+		log:       log,
+	}
+}
+
+type GetResponse struct {
+	User    models.User       `json:"user"`
+	Actions []models.AuditLog `json:"actions"`
+}
+
+// @Summary		Search Users
+// @Description	Search users by name or email as an admin or support agent. Disabled and deleted users are included unless filtered by status
+// @Tags			Admin
+// @Accept			x-www-form-urlencoded
+// @Produce		json
+// @Param			Query	query		SearchQueryParams	true	"SearchQueryParams"
+// @Success		200		{object}	response.Response{data=[]models.User}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/admin/users [get]
+func (api *API) Search(w http.ResponseWriter, r *http.Request) {
+	query := SearchQueryParams{
+		Query:  r.FormValue("query"),
+		Role:   r.FormValue("role"),
+		Status: r.FormValue("status"),
+		Limit:  r.FormValue("limit"),
+		Offset: r.FormValue("offset"),
+	}
+
+	if err := api.validator.Struct(query); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if query.Limit != "" {
+		limit, _ = strconv.Atoi(query.Limit)
+		limit = max(1, min(limit, maxSearchLimit))
+	}
+
+	offset := 0
+	if query.Offset != "" {
+		offset, _ = strconv.Atoi(query.Offset)
+		offset = max(0, offset)
+	}
+
+	actor := auth.MustPrincipalFromContext(r.Context()).User
+
+	users, err := api.store.Users.Search(r.Context(), store.UserSearch{
+		Query:  query.Query,
+		Role:   query.Role,
+		Status: query.Status,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	for i := range users {
+		users[i].Redact()
+	}
+
+	err = api.audit(api.store, r, actor.ID, nil, ActionSearchUsers, nil, map[string]any{"query": query.Query, "role": query.Role, "status": query.Status, "results": len(users)})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Users have been searched by %s", actor.ID)
+
+	response.HTTPResponse(w, users)
+}
+
+// @Summary		Get User
+// @Description	Get any user, including disabled and deleted users, along with the admin actions taken on them
+// @Tags			Admin
+// @Produce		json
+// @Param			Path	path		UserPathParams	true	"UserPathParams"
+// @Success		200		{object}	response.Response{data=GetResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/admin/users/{user_id} [get]
+func (api *API) Get(w http.ResponseWriter, r *http.Request) {
+	actor, target := api.getTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	actions, err := api.store.Audit.Search(r.Context(), auditUtil.Filter{UserID: &target.ID, Action: "admin", Limit: 50})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	err = api.audit(api.store, r, actor.ID, &target.ID, ActionViewUser, nil, nil)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has been retrieved by %s", target.ID, actor.ID)
+
+	target.Redact()
+
+	response.HTTPResponse(w, GetResponse{
+		User:    *target,
+		Actions: actions,
+	})
+}
+
+// @Summary		Disable User
+// @Description	Disable a user, which blocks their logins and signs them out everywhere
+// @Tags			Admin
+// @Produce		json
+// @Param			Path	path		UserPathParams	true	"UserPathParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/admin/users/{user_id}/disable [post]
+func (api *API) Disable(w http.ResponseWriter, r *http.Request) {
+	actor, target := api.getTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	if actor.ID == target.ID {
+		response.GenericBadRequestError(w, fmt.Errorf("You can not disable your own account"))
+		return
+	}
+
+	if target.DisabledAt != nil {
+		response.GenericBadRequestError(w, fmt.Errorf("User is already disabled"))
+		return
+	}
+
+	err := api.act(r, actor.ID, target.ID, ActionDisableUser, map[string]any{"disabled": false}, map[string]any{"disabled": true}, func(tx *store.Store) error {
+		return tx.Users.Disable(r.Context(), target.ID)
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has been disabled by %s", target.ID, actor.ID)
+
+	response.HTTPResponse(w, "User has been disabled")
+}
+
+// @Summary		Restore User
+// @Description	Restore a disabled or deleted user
+// @Tags			Admin
+// @Produce		json
+// @Param			Path	path		UserPathParams	true	"UserPathParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/admin/users/{user_id}/restore [post]
+func (api *API) Restore(w http.ResponseWriter, r *http.Request) {
+	actor, target := api.getTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	if target.DisabledAt == nil && target.Active {
+		response.GenericBadRequestError(w, fmt.Errorf("User is not disabled or deleted"))
+		return
+	}
+
+	before := map[string]any{"disabled": target.DisabledAt != nil, "deleted": !target.Active}
+	after := map[string]any{"disabled": false, "deleted": false}
+
+	err := api.act(r, actor.ID, target.ID, ActionRestoreUser, before, after, func(tx *store.Store) error {
+		return tx.Users.Reinstate(r.Context(), target.ID)
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has been restored by %s", target.ID, actor.ID)
+
+	response.HTTPResponse(w, "User has been restored")
+}
+
+// @Summary		Force Logout
+// @Description	Sign a user out of every session by invalidating their access and refresh tokens
+// @Tags			Admin
+// @Produce		json
+// @Param			Path	path		UserPathParams	true	"UserPathParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/admin/users/{user_id}/logout [post]
+func (api *API) Logout(w http.ResponseWriter, r *http.Request) {
+	actor, target := api.getTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	err := api.act(r, actor.ID, target.ID, ActionLogoutUser, nil, nil, func(tx *store.Store) error {
+		return tx.Users.RevokeSessions(r.Context(), target.ID)
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has been logged out by %s", target.ID, actor.ID)
+
+	response.HTTPResponse(w, "User has been logged out")
+}
+
+// @Summary		Reset MFA
+// @Description	Turn off MFA for a user who has lost their authenticator and recovery codes
+// @Tags			Admin
+// @Produce		json
+// @Param			Path	path		UserPathParams	true	"UserPathParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/admin/users/{user_id}/mfa/reset [post]
+func (api *API) ResetMFA(w http.ResponseWriter, r *http.Request) {
+	actor, target := api.getTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	if !target.MFAEnabled {
+		response.GenericBadRequestError(w, fmt.Errorf("MFA is not enabled"))
+		return
+	}
+
+	err := api.act(r, actor.ID, target.ID, ActionResetMFA, map[string]any{"mfa_enabled": true}, map[string]any{"mfa_enabled": false}, func(tx *store.Store) error {
+		if err := tx.Users.DisableMFA(r.Context(), target.ID); err != nil {
+			return err
+		}
+
+		return tx.RecoveryCodes.Replace(r.Context(), target.ID, nil)
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "MFA for user %s has been reset by %s", target.ID, actor.ID)
+
+	response.HTTPResponse(w, "MFA has been reset")
+}
+
+// @Summary		Change Role
+// @Description	Change the role of a user who ranks below you to another role below your own. The change applies to their existing sessions straight away
+// @Tags			Admin
+// @Accept			json
+// @Produce		json
+// @Param			Path	path		UserPathParams		true	"UserPathParams"
+// @Param			Body	body		PutRoleBodyParams	true	"PutRoleBodyParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/admin/users/{user_id}/role [put]
+func (api *API) PutRole(w http.ResponseWriter, r *http.Request) {
+	var body PutRoleBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	actor, target := api.getTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	if actor.ID == target.ID {
+		response.GenericBadRequestError(w, fmt.Errorf("You can not change your own role"))
+		return
+	}
+
+	if target.Role == body.Role {
+		response.GenericBadRequestError(w, fmt.Errorf("User already has the %s role", body.Role))
+		return
+	}
+
+	if !auth.Outranks(actor.Role, body.Role) {
+		response.GenericForbiddenError(w, fmt.Errorf("The %s role can only be given by a higher role", body.Role))
+		return
+	}
+
+	err := api.act(r, actor.ID, target.ID, ActionChangeRole, map[string]any{"role": target.Role}, map[string]any{"role": body.Role}, func(tx *store.Store) error {
+		return tx.Users.SetRole(r.Context(), target.ID, body.Role)
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Role of user %s has been changed from %s to %s by %s", target.ID, target.Role, body.Role, actor.ID)
+
+	response.HTTPResponse(w, "Role has been changed")
+}
+
+// getTarget loads the acting user and the user named in the path. The target is looked up regardless of its state, so admins can act on disabled and deleted users.
+// Other users are only returned when they rank below the actor, so support can't sign out an admin and admins can't act on each other.
+func (api *API) getTarget(w http.ResponseWriter, r *http.Request) (*models.User, *models.User) {
+	path := UserPathParams{
+		UserID: r.PathValue("user_id"),
+	}
+
+	if err := api.validator.Struct(path); err != nil {
+		response.GenericValidationError(w, err)
+		return nil, nil
+	}
+
+	actor := auth.MustPrincipalFromContext(r.Context()).User
+
+	targetID, err := uuid.Parse(path.UserID)
+	if err != nil {
+		response.GenericBadRequestError(w, fmt.Errorf("User does not exist"))
+		return nil, nil
+	}
+
+	target, err := api.store.Users.Find(r.Context(), targetID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("User does not exist"))
+			return nil, nil
+		}
+
+		response.GenericServerError(w, err)
+		return nil, nil
+	}
+
+	if target.ID != actor.ID && !auth.Outranks(actor.Role, target.Role) {
+		response.GenericForbiddenError(w, fmt.Errorf("User with the %s role can only be managed by a higher role", target.Role))
+		return nil, nil
+	}
+
+	return actor, target
+}
+
+// act changes the target user and records the action in the same transaction, so no change goes unaudited
+func (api *API) act(r *http.Request, actorID uuid.UUID, targetID uuid.UUID, action string, before map[string]any, after map[string]any, change func(tx *store.Store) error) error {
+	return api.store.Tx(r.Context(), func(tx *store.Store) error {
+		if err := change(tx); err != nil {
+			return err
+		}
+
+		return api.audit(tx, r, actorID, &targetID, action, before, after)
+	})
+}
+
+// audit records an admin action in the history of the target user through the repositories given, which are a transaction when the action changes the user
+func (api *API) audit(repositories *store.Store, r *http.Request, actorID uuid.UUID, targetID *uuid.UUID, action string, before map[string]any, after map[string]any) error {
+	record := auditUtil.Record{
+		ActorID: &actorID,
+		UserID:  targetID,
+		Action:  action,
+		Before:  before,
+		After:   after,
+	}
+
+	if targetID != nil {
+		record.TargetType = auditUtil.TargetUser
+		record.TargetID = targetID
+	}
+
+	return repositories.Audit.Append(r.Context(), auditUtil.FromRequest(r, record))
+}
@@ -0,0 +1,347 @@
+package admin_test
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/go-faker/faker/v4"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/api/resource/admin"
+	"github.com/ushiradineth/koano-api/api/resource/auth"
+	"github.com/ushiradineth/koano-api/api/resource/user"
+	"github.com/ushiradineth/koano-api/api/router"
+	"github.com/ushiradineth/koano-api/store"
+	authUtil "github.com/ushiradineth/koano-api/util/auth"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/test"
+	"github.com/ushiradineth/koano-api/util/validator"
+)
+
+var (
+	adminAccessToken   string
+	adminRefreshToken  string
+	adminID            string
+	supportAccessToken string
+	supportID          string
+	otherAdminToken    string
+	otherAdminID       string
+	accessToken        string
+	refreshToken       string
+	user1ID            string
+	repositories       *store.Store
+	userAPI            *user.API
+	authAPI            *auth.API
+	adminAPI           *admin.API
+)
+
+var adminUser user.PostBodyParams = user.PostBodyParams{
+	Name:     faker.Name(),
+	Email:    faker.Email(),
+	Password: "UPlow1234!@#",
+}
+
+var supportUser user.PostBodyParams = user.PostBodyParams{
+	Name:     faker.Name(),
+	Email:    faker.Email(),
+	Password: "UPlow1234!@#",
+}
+
+var otherAdminUser user.PostBodyParams = user.PostBodyParams{
+	Name:     faker.Name(),
+	Email:    faker.Email(),
+	Password: "UPlow1234!@#",
+}
+
+var user1 user.PostBodyParams = user.PostBodyParams{
+	Name:     faker.Name(),
+	Email:    faker.Email(),
+	Password: "UPlow1234!@#",
+}
+
+var adminAuth auth.AuthenticateBodyParams = auth.AuthenticateBodyParams{
+	Email:    adminUser.Email,
+	Password: adminUser.Password,
+}
+
+var supportAuth auth.AuthenticateBodyParams = auth.AuthenticateBodyParams{
+	Email:    supportUser.Email,
+	Password: supportUser.Password,
+}
+
+var otherAdminAuth auth.AuthenticateBodyParams = auth.AuthenticateBodyParams{
+	Email:    otherAdminUser.Email,
+	Password: otherAdminUser.Password,
+}
+
+var user1Auth auth.AuthenticateBodyParams = auth.AuthenticateBodyParams{
+	Email:    user1.Email,
+	Password: user1.Password,
+}
+
+func TestInit(t *testing.T) {
+	t.Run("Initiate Dependencies", func(t *testing.T) {
+		err := godotenv.Load("../../../.env")
+		if err != nil {
+			log.Println("Failed to load env")
+		}
+
+		repositories = test.NewStore()
+		v := validator.New()
+		l := logger.New()
+		m := mail.NewLogMailer(l)
+
+		userAPI = user.New(repositories, v, l, m, test.NewConfig())
+		authAPI = auth.New(repositories, v, l, m, test.NewConfig())
+		adminAPI = admin.New(repositories, v, l)
+
+		for _, body := range []user.PostBodyParams{adminUser, supportUser, otherAdminUser, user1} {
+			test.CreateUserHelper(userAPI, t, body, http.StatusOK, response.StatusSuccess)
+		}
+
+		test.AuthenticateUserHelper(authAPI, t, adminAuth, http.StatusOK, response.StatusSuccess, &adminID, &adminAccessToken, &adminRefreshToken)
+		test.AuthenticateUserHelper(authAPI, t, supportAuth, http.StatusOK, response.StatusSuccess, &supportID, &supportAccessToken, &refreshToken)
+		test.AuthenticateUserHelper(authAPI, t, otherAdminAuth, http.StatusOK, response.StatusSuccess, &otherAdminID, &otherAdminToken, &refreshToken)
+		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+
+		t.Run("Promote admin and support users", func(t *testing.T) {
+			assert.NoError(t, repositories.Users.SetRole(context.Background(), uuid.MustParse(adminID), authUtil.RoleAdmin))
+			assert.NoError(t, repositories.Users.SetRole(context.Background(), uuid.MustParse(otherAdminID), authUtil.RoleAdmin))
+			assert.NoError(t, repositories.Users.SetRole(context.Background(), uuid.MustParse(supportID), authUtil.RoleSupport))
+		})
+	})
+}
+
+func TestPermissions(t *testing.T) {
+	search := router.Permitted(repositories.Users, authUtil.PermissionUsersRead, adminAPI.Search)
+	disable := router.Permitted(repositories.Users, authUtil.PermissionUsersDisable, adminAPI.Disable)
+
+	t.Run("Regular user is forbidden", func(t *testing.T) {
+		test.ScopedRequestHelper(search, t, http.MethodGet, "/admin/users", http.StatusForbidden, response.StatusFail, accessToken)
+	})
+
+	t.Run("Token issued before promotion is forbidden", func(t *testing.T) {
+		test.ScopedRequestHelper(search, t, http.MethodGet, "/admin/users", http.StatusForbidden, response.StatusFail, adminAccessToken)
+	})
+
+	t.Run("Authenticate promoted users", func(t *testing.T) {
+		test.AuthenticateUserHelper(authAPI, t, adminAuth, http.StatusOK, response.StatusSuccess, &adminID, &adminAccessToken, &adminRefreshToken)
+		test.AuthenticateUserHelper(authAPI, t, otherAdminAuth, http.StatusOK, response.StatusSuccess, &otherAdminID, &otherAdminToken, &refreshToken)
+		test.AuthenticateUserHelper(authAPI, t, supportAuth, http.StatusOK, response.StatusSuccess, &supportID, &supportAccessToken, &refreshToken)
+	})
+
+	t.Run("Admin is permitted", func(t *testing.T) {
+		test.ScopedRequestHelper(search, t, http.MethodGet, "/admin/users", http.StatusOK, response.StatusSuccess, adminAccessToken)
+	})
+
+	t.Run("Support is permitted to read users", func(t *testing.T) {
+		test.ScopedRequestHelper(search, t, http.MethodGet, "/admin/users", http.StatusOK, response.StatusSuccess, supportAccessToken)
+	})
+
+	t.Run("Support is forbidden from disabling users", func(t *testing.T) {
+		test.AdminActionHelper(disable, t, "/admin/users/{user_id}/disable", http.StatusForbidden, response.StatusFail, user1ID, supportAccessToken)
+	})
+
+	t.Run("Missing token is unauthenticated", func(t *testing.T) {
+		test.ScopedRequestHelper(search, t, http.MethodGet, "/admin/users", http.StatusUnauthorized, response.StatusFail, "")
+	})
+}
+
+func TestRanks(t *testing.T) {
+	t.Run("Support can not view an admin", func(t *testing.T) {
+		test.AdminGetUserHelper(adminAPI, t, http.StatusForbidden, response.StatusFail, nil, adminID, supportAccessToken)
+	})
+
+	t.Run("Admin can not disable another admin", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Disable, t, "/admin/users/{user_id}/disable", http.StatusForbidden, response.StatusFail, otherAdminID, adminAccessToken)
+	})
+
+	t.Run("Admin can not restore another admin", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Restore, t, "/admin/users/{user_id}/restore", http.StatusForbidden, response.StatusFail, otherAdminID, adminAccessToken)
+	})
+
+	t.Run("Support can not force an admin to logout", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Logout, t, "/admin/users/{user_id}/logout", http.StatusForbidden, response.StatusFail, adminID, supportAccessToken)
+		test.GetUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, adminUser, adminID, adminAccessToken)
+	})
+
+	t.Run("Support can not reset the MFA of an admin", func(t *testing.T) {
+		assert.NoError(t, repositories.Users.SetTOTPSecret(context.Background(), uuid.MustParse(otherAdminID), "JBSWY3DPEHPK3PXP"))
+		assert.NoError(t, repositories.Users.EnableMFA(context.Background(), uuid.MustParse(otherAdminID)))
+		test.AdminActionHelper(adminAPI.ResetMFA, t, "/admin/users/{user_id}/mfa/reset", http.StatusForbidden, response.StatusFail, otherAdminID, supportAccessToken)
+
+		user, err := repositories.Users.Find(context.Background(), uuid.MustParse(otherAdminID))
+		assert.NoError(t, err)
+		assert.True(t, user.MFAEnabled)
+	})
+
+	t.Run("Admin can not demote another admin", func(t *testing.T) {
+		test.PutRoleHelper(adminAPI, t, admin.PutRoleBodyParams{Role: authUtil.RoleUser}, http.StatusForbidden, response.StatusFail, otherAdminID, adminAccessToken)
+	})
+
+	t.Run("Admin can not promote a user to admin", func(t *testing.T) {
+		test.PutRoleHelper(adminAPI, t, admin.PutRoleBodyParams{Role: authUtil.RoleAdmin}, http.StatusForbidden, response.StatusFail, user1ID, adminAccessToken)
+	})
+}
+
+func TestSearchHandler(t *testing.T) {
+	t.Run("Search by email", func(t *testing.T) {
+		test.SearchUsersHelper(adminAPI, t, admin.SearchQueryParams{Query: user1.Email}, http.StatusOK, response.StatusSuccess, 1, adminAccessToken)
+	})
+
+	t.Run("Search by role", func(t *testing.T) {
+		test.SearchUsersHelper(adminAPI, t, admin.SearchQueryParams{Query: supportUser.Email, Role: authUtil.RoleSupport}, http.StatusOK, response.StatusSuccess, 1, adminAccessToken)
+		test.SearchUsersHelper(adminAPI, t, admin.SearchQueryParams{Query: user1.Email, Role: authUtil.RoleSupport}, http.StatusOK, response.StatusSuccess, 0, adminAccessToken)
+	})
+
+	t.Run("Wildcards are matched literally", func(t *testing.T) {
+		test.SearchUsersHelper(adminAPI, t, admin.SearchQueryParams{Query: "%_%"}, http.StatusOK, response.StatusSuccess, 0, adminAccessToken)
+	})
+
+	t.Run("Status is invalid", func(t *testing.T) {
+		test.SearchUsersHelper(adminAPI, t, admin.SearchQueryParams{Status: "banned"}, http.StatusBadRequest, response.StatusFail, 0, adminAccessToken)
+	})
+
+	t.Run("Limit is invalid", func(t *testing.T) {
+		test.SearchUsersHelper(adminAPI, t, admin.SearchQueryParams{Limit: "ten"}, http.StatusBadRequest, response.StatusFail, 0, adminAccessToken)
+	})
+}
+
+func TestDisableHandler(t *testing.T) {
+	t.Run("Admin can not disable themselves", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Disable, t, "/admin/users/{user_id}/disable", http.StatusBadRequest, response.StatusFail, adminID, adminAccessToken)
+	})
+
+	t.Run("Disable user", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Disable, t, "/admin/users/{user_id}/disable", http.StatusOK, response.StatusSuccess, user1ID, adminAccessToken)
+	})
+
+	t.Run("User is already disabled", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Disable, t, "/admin/users/{user_id}/disable", http.StatusBadRequest, response.StatusFail, user1ID, adminAccessToken)
+	})
+
+	t.Run("Disabled user is signed out", func(t *testing.T) {
+		test.GetUserHelper(userAPI, t, http.StatusUnauthorized, response.StatusFail, user1, user1ID, accessToken)
+	})
+
+	t.Run("Disabled user can not authenticate", func(t *testing.T) {
+		var id, access, refresh string
+		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusUnauthorized, response.StatusFail, &id, &access, &refresh)
+	})
+
+	t.Run("Search disabled users", func(t *testing.T) {
+		test.SearchUsersHelper(adminAPI, t, admin.SearchQueryParams{Query: user1.Email, Status: "disabled"}, http.StatusOK, response.StatusSuccess, 1, adminAccessToken)
+	})
+
+	t.Run("Restore user", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Restore, t, "/admin/users/{user_id}/restore", http.StatusOK, response.StatusSuccess, user1ID, adminAccessToken)
+	})
+
+	t.Run("User is not disabled", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Restore, t, "/admin/users/{user_id}/restore", http.StatusBadRequest, response.StatusFail, user1ID, adminAccessToken)
+	})
+
+	t.Run("Restored user can authenticate", func(t *testing.T) {
+		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+	})
+
+	t.Run("User does not exist", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Disable, t, "/admin/users/{user_id}/disable", http.StatusBadRequest, response.StatusFail, uuid.NewString(), adminAccessToken)
+	})
+
+	t.Run("UUID is invalid", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Disable, t, "/admin/users/{user_id}/disable", http.StatusBadRequest, response.StatusFail, "not_an_uuid", adminAccessToken)
+	})
+}
+
+func TestLogoutHandler(t *testing.T) {
+	t.Run("Support can force a logout", func(t *testing.T) {
+		logout := router.Permitted(repositories.Users, authUtil.PermissionSessionsRevoke, adminAPI.Logout)
+		test.AdminActionHelper(logout, t, "/admin/users/{user_id}/logout", http.StatusOK, response.StatusSuccess, user1ID, supportAccessToken)
+	})
+
+	t.Run("Access token is invalidated", func(t *testing.T) {
+		test.GetUserHelper(userAPI, t, http.StatusUnauthorized, response.StatusFail, user1, user1ID, accessToken)
+	})
+
+	t.Run("User can sign in again", func(t *testing.T) {
+		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		test.GetUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user1, user1ID, accessToken)
+	})
+}
+
+func TestResetMFAHandler(t *testing.T) {
+	t.Run("MFA is not enabled", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.ResetMFA, t, "/admin/users/{user_id}/mfa/reset", http.StatusBadRequest, response.StatusFail, user1ID, supportAccessToken)
+	})
+
+	t.Run("Reset MFA", func(t *testing.T) {
+		assert.NoError(t, repositories.Users.SetTOTPSecret(context.Background(), uuid.MustParse(user1ID), "JBSWY3DPEHPK3PXP"))
+		assert.NoError(t, repositories.Users.EnableMFA(context.Background(), uuid.MustParse(user1ID)))
+		test.AdminActionHelper(adminAPI.ResetMFA, t, "/admin/users/{user_id}/mfa/reset", http.StatusOK, response.StatusSuccess, user1ID, supportAccessToken)
+	})
+
+	t.Run("User can authenticate without MFA", func(t *testing.T) {
+		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+	})
+}
+
+func TestPutRoleHandler(t *testing.T) {
+	t.Run("Role is invalid", func(t *testing.T) {
+		test.PutRoleHelper(adminAPI, t, admin.PutRoleBodyParams{Role: "superuser"}, http.StatusBadRequest, response.StatusFail, user1ID, adminAccessToken)
+	})
+
+	t.Run("Admin can not change their own role", func(t *testing.T) {
+		test.PutRoleHelper(adminAPI, t, admin.PutRoleBodyParams{Role: authUtil.RoleUser}, http.StatusBadRequest, response.StatusFail, adminID, adminAccessToken)
+	})
+
+	t.Run("Support is forbidden from changing roles", func(t *testing.T) {
+		putRole := router.Permitted(repositories.Users, authUtil.PermissionUsersRole, adminAPI.PutRole)
+		test.ScopedRequestHelper(putRole, t, http.MethodPut, "/admin/users/"+user1ID+"/role", http.StatusForbidden, response.StatusFail, supportAccessToken)
+	})
+
+	t.Run("Demote support user", func(t *testing.T) {
+		test.PutRoleHelper(adminAPI, t, admin.PutRoleBodyParams{Role: authUtil.RoleUser}, http.StatusOK, response.StatusSuccess, supportID, adminAccessToken)
+	})
+
+	t.Run("Demotion applies to existing tokens", func(t *testing.T) {
+		search := router.Permitted(repositories.Users, authUtil.PermissionUsersRead, adminAPI.Search)
+		test.ScopedRequestHelper(search, t, http.MethodGet, "/admin/users", http.StatusForbidden, response.StatusFail, supportAccessToken)
+	})
+}
+
+func TestGetHandler(t *testing.T) {
+	t.Run("Actions are audited", func(t *testing.T) {
+		want := []string{admin.ActionResetMFA, admin.ActionLogoutUser, admin.ActionRestoreUser, admin.ActionDisableUser}
+		test.AdminGetUserHelper(adminAPI, t, http.StatusOK, response.StatusSuccess, want, user1ID, adminAccessToken)
+	})
+
+	t.Run("Viewing a user is audited", func(t *testing.T) {
+		want := []string{admin.ActionViewUser, admin.ActionResetMFA, admin.ActionLogoutUser, admin.ActionRestoreUser, admin.ActionDisableUser}
+		test.AdminGetUserHelper(adminAPI, t, http.StatusOK, response.StatusSuccess, want, user1ID, adminAccessToken)
+	})
+
+	t.Run("Deleted users are visible", func(t *testing.T) {
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user1ID, accessToken)
+		test.SearchUsersHelper(adminAPI, t, admin.SearchQueryParams{Query: user1.Email, Status: "deleted"}, http.StatusOK, response.StatusSuccess, 1, adminAccessToken)
+	})
+
+	t.Run("Restore deleted user", func(t *testing.T) {
+		test.AdminActionHelper(adminAPI.Restore, t, "/admin/users/{user_id}/restore", http.StatusOK, response.StatusSuccess, user1ID, adminAccessToken)
+		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+	})
+}
+
+func TestCleanUp(t *testing.T) {
+	t.Run("Delete users", func(t *testing.T) {
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user1ID, accessToken)
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, supportID, supportAccessToken)
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, otherAdminID, otherAdminToken)
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, adminID, adminAccessToken)
+	})
+}
@@ -0,0 +1,17 @@
+package admin
+
+type UserPathParams struct {
+	UserID string `json:"user_id" validate:"required,uuid"`
+}
+
+type SearchQueryParams struct {
+	Query  string `json:"query" validate:"omitempty,max=255"`
+	Role   string `json:"role" validate:"omitempty,oneof=user support admin"`
+	Status string `json:"status" validate:"omitempty,oneof=active disabled deleted"`
+	Limit  string `json:"limit" validate:"omitempty,number"`
+	Offset string `json:"offset" validate:"omitempty,number"`
+}
+
+type PutRoleBodyParams struct {
+	Role string `json:"role" validate:"required,oneof=user support admin"`
+}
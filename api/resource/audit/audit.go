@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/store"
+	auditUtil "github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/response"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+type API struct {
+	store     *store.Store
+	validator *validator.Validate
+	log       *logger.Logger
+}
+
+func New(store *store.Store, validator *validator.Validate, log *logger.Logger) *API {
+	return &API{
+		store:     store,
+		validator: validator,
+		log:       log,
+	}
+}
+
+// @Summary		Get User Audit Log
+// @Description	Get the history of changes to the authenticated user's account and data, newest first. Filtering by action matches the action itself or a group of actions, such as event for event.create. Changes made by admins are included without the IP and user agent they came from
+// @Tags			Audit
+// @Accept			x-www-form-urlencoded
+// @Produce		json
+// @Param			Query	query		GetUserAuditQueryParams	true	"GetUserAuditQueryParams"
+// @Success		200		{object}	response.Response{data=[]models.AuditLog}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/audit [get]
+func (api *API) GetUserAudit(w http.ResponseWriter, r *http.Request) {
+	query := GetUserAuditQueryParams{
+		Action: r.FormValue("action"),
+		Limit:  r.FormValue("limit"),
+		Offset: r.FormValue("offset"),
+	}
+
+	if err := api.validator.Struct(query); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	limit, offset := page(query.Limit, query.Offset)
+
+	entries, err := api.store.Audit.Search(r.Context(), auditUtil.Filter{
+		UserID: &user.ID,
+		Action: query.Action,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	for i := range entries {
+		entries[i].RedactFor(user.ID)
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Audit log for user %s has been retrieved", user.ID)
+
+	response.HTTPResponse(w, entries)
+}
+
+// @Summary		Search Audit Log
+// @Description	Search the whole audit log as an admin, newest first. Filtering by action matches the action itself or a group of actions, such as admin for every admin action
+// @Tags			Admin
+// @Accept			x-www-form-urlencoded
+// @Produce		json
+// @Param			Query	query		SearchQueryParams	true	"SearchQueryParams"
+// @Success		200		{object}	response.Response{data=[]models.AuditLog}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/admin/audit [get]
+func (api *API) Search(w http.ResponseWriter, r *http.Request) {
+	query := SearchQueryParams{
+		UserID:     r.FormValue("user_id"),
+		ActorID:    r.FormValue("actor_id"),
+		Action:     r.FormValue("action"),
+		TargetType: r.FormValue("target_type"),
+		Limit:      r.FormValue("limit"),
+		Offset:     r.FormValue("offset"),
+	}
+
+	if err := api.validator.Struct(query); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	actor := auth.MustPrincipalFromContext(r.Context()).User
+
+	limit, offset := page(query.Limit, query.Offset)
+
+	entries, err := api.store.Audit.Search(r.Context(), auditUtil.Filter{
+		UserID:     optionalID(query.UserID),
+		ActorID:    optionalID(query.ActorID),
+		Action:     query.Action,
+		TargetType: query.TargetType,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Audit log has been searched by %s", actor.ID)
+
+	response.HTTPResponse(w, entries)
+}
+
+// @Summary		Verify Audit Log
+// @Description	Check the hash chain of the whole audit log. An invalid chain reports the first entry which was changed or follows a removed entry. Keeping the head hash elsewhere also shows whether entries were removed from the end
+// @Tags			Admin
+// @Produce		json
+// @Success		200	{object}	response.Response{data=audit.Verification}
+// @Failure		401	{object}	response.Error
+// @Failure		403	{object}	response.Error
+// @Failure		500	{object}	response.Error
+// @Security		BearerAuth
+// @Router			/admin/audit/verify [get]
+func (api *API) Verify(w http.ResponseWriter, r *http.Request) {
+	actor := auth.MustPrincipalFromContext(r.Context()).User
+
+	verification, err := api.store.Audit.Verify(r.Context())
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if !verification.Valid {
+		api.log.Error.PrintfContext(r.Context(), "Audit log chain is broken at entry %d", *verification.BrokenAt)
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Audit log has been verified by %s", actor.ID)
+
+	response.HTTPResponse(w, verification)
+}
+
+func page(limitParam string, offsetParam string) (int, int) {
+	limit := defaultLimit
+	if limitParam != "" {
+		limit, _ = strconv.Atoi(limitParam)
+		limit = max(1, min(limit, maxLimit))
+	}
+
+	offset := 0
+	if offsetParam != "" {
+		offset, _ = strconv.Atoi(offsetParam)
+		offset = max(0, offset)
+	}
+
+	return limit, offset
+}
+
+// optionalID parses an ID which has already been validated, an empty ID matches everyone
+func optionalID(id string) *uuid.UUID {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+
+	return &parsed
+}
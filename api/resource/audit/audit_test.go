@@ -0,0 +1,222 @@
+package audit_test
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/go-faker/faker/v4"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/api/resource/admin"
+	"github.com/ushiradineth/koano-api/api/resource/audit"
+	"github.com/ushiradineth/koano-api/api/resource/auth"
+	"github.com/ushiradineth/koano-api/api/resource/event"
+	"github.com/ushiradineth/koano-api/api/resource/user"
+	"github.com/ushiradineth/koano-api/api/router"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	auditUtil "github.com/ushiradineth/koano-api/util/audit"
+	authUtil "github.com/ushiradineth/koano-api/util/auth"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/test"
+	"github.com/ushiradineth/koano-api/util/validator"
+)
+
+var (
+	adminAccessToken string
+	adminID          string
+	accessToken      string
+	refreshToken     string
+	user1ID          string
+	eventID          string
+	repositories     *store.Store
+	userAPI          *user.API
+	authAPI          *auth.API
+	eventAPI         *event.API
+	adminAPI         *admin.API
+	auditAPI         *audit.API
+)
+
+var adminUser user.PostBodyParams = user.PostBodyParams{
+	Name:     faker.Name(),
+	Email:    faker.Email(),
+	Password: "UPlow1234!@#",
+}
+
+var user1 user.PostBodyParams = user.PostBodyParams{
+	Name:     faker.Name(),
+	Email:    faker.Email(),
+	Password: "UPlow1234!@#",
+}
+
+var event1 event.EventBodyParams = event.EventBodyParams{
+	Title:     "Audited event",
+	StartTime: "2024-01-02T15:04:05Z",
+	EndTime:   "2024-01-02T16:04:05Z",
+	Timezone:  "Asia/Colombo",
+	Repeated:  "never",
+}
+
+func TestInit(t *testing.T) {
+	t.Run("Initiate Dependencies", func(t *testing.T) {
+		err := godotenv.Load("../../../.env")
+		if err != nil {
+			log.Println("Failed to load env")
+		}
+
+		repositories = test.NewStore()
+		v := validator.New()
+		l := logger.New()
+		m := mail.NewLogMailer(l)
+
+		userAPI = user.New(repositories, v, l, m, test.NewConfig())
+		authAPI = auth.New(repositories, v, l, m, test.NewConfig())
+		eventAPI = event.New(repositories, v, l)
+		adminAPI = admin.New(repositories, v, l)
+		auditAPI = audit.New(repositories, v, l)
+
+		test.CreateUserHelper(userAPI, t, adminUser, http.StatusOK, response.StatusSuccess)
+		test.CreateUserHelper(userAPI, t, user1, http.StatusOK, response.StatusSuccess)
+		test.AuthenticateUserHelper(authAPI, t, auth.AuthenticateBodyParams{Email: user1.Email, Password: user1.Password}, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+
+		test.AuthenticateUserHelper(authAPI, t, auth.AuthenticateBodyParams{Email: adminUser.Email, Password: adminUser.Password}, http.StatusOK, response.StatusSuccess, &adminID, &adminAccessToken, &refreshToken)
+		assert.NoError(t, repositories.Users.SetRole(context.Background(), uuid.MustParse(adminID), authUtil.RoleAdmin))
+		test.AuthenticateUserHelper(authAPI, t, auth.AuthenticateBodyParams{Email: adminUser.Email, Password: adminUser.Password}, http.StatusOK, response.StatusSuccess, &adminID, &adminAccessToken, &refreshToken)
+	})
+}
+
+func TestGetUserAuditHandler(t *testing.T) {
+	t.Run("Event changes are recorded", func(t *testing.T) {
+		test.CreateEventHelper(eventAPI, t, event1, http.StatusOK, response.StatusSuccess, &eventID, accessToken)
+
+		updated := event1
+		updated.Title = "Renamed event"
+		test.UpdateEventHelper(eventAPI, t, updated, http.StatusOK, response.StatusSuccess, eventID, accessToken)
+		test.DeleteEventHelper(eventAPI, t, http.StatusOK, response.StatusSuccess, eventID, accessToken)
+
+		entries := test.GetUserAuditHelper(auditAPI, t, "event", http.StatusOK, response.StatusSuccess, accessToken)
+
+		actions := []string{}
+		for _, entry := range entries {
+			actions = append(actions, entry.Action)
+		}
+		assert.Equal(t, []string{auditUtil.ActionEventDelete, auditUtil.ActionEventUpdate, auditUtil.ActionEventCreate}, actions)
+	})
+
+	t.Run("Updates record only the changed fields", func(t *testing.T) {
+		entries := test.GetUserAuditHelper(auditAPI, t, auditUtil.ActionEventUpdate, http.StatusOK, response.StatusSuccess, accessToken)
+		if !assert.Len(t, entries, 1) {
+			return
+		}
+
+		assert.JSONEq(t, `{"title":"Audited event"}`, string(entries[0].Before))
+		assert.JSONEq(t, `{"title":"Renamed event"}`, string(entries[0].After))
+		assert.Equal(t, eventID, entries[0].TargetID.String())
+	})
+
+	t.Run("Account changes and logins are recorded", func(t *testing.T) {
+		assert.Len(t, test.GetUserAuditHelper(auditAPI, t, auditUtil.ActionUserCreate, http.StatusOK, response.StatusSuccess, accessToken), 1)
+		assert.NotEmpty(t, test.GetUserAuditHelper(auditAPI, t, auditUtil.ActionLogin, http.StatusOK, response.StatusSuccess, accessToken))
+	})
+
+	t.Run("Failed login is recorded", func(t *testing.T) {
+		var id, token string
+		test.AuthenticateUserHelper(authAPI, t, auth.AuthenticateBodyParams{Email: user1.Email, Password: "wrong password"}, http.StatusUnauthorized, response.StatusFail, &id, &token, &refreshToken)
+
+		entries := test.GetUserAuditHelper(auditAPI, t, auditUtil.ActionLoginFailed, http.StatusOK, response.StatusSuccess, accessToken)
+		if assert.Len(t, entries, 1) {
+			assert.Nil(t, entries[0].ActorID)
+		}
+	})
+
+	t.Run("Admin actions are recorded without their origin", func(t *testing.T) {
+		test.AdminGetUserHelper(adminAPI, t, http.StatusOK, response.StatusSuccess, []string{}, user1ID, adminAccessToken)
+
+		entries := test.GetUserAuditHelper(auditAPI, t, "admin", http.StatusOK, response.StatusSuccess, accessToken)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, admin.ActionViewUser, entries[0].Action)
+			assert.Equal(t, adminID, entries[0].ActorID.String())
+			assert.Empty(t, entries[0].IP, "IP of the admin should not be shown to the user")
+			assert.Empty(t, entries[0].UserAgent)
+		}
+	})
+
+	t.Run("History of other users is not included", func(t *testing.T) {
+		for _, entry := range test.GetUserAuditHelper(auditAPI, t, "", http.StatusOK, response.StatusSuccess, accessToken) {
+			assert.Equal(t, user1ID, entry.UserID.String())
+		}
+	})
+
+	t.Run("Token is invalid", func(t *testing.T) {
+		test.GetUserAuditHelper(auditAPI, t, "", http.StatusUnauthorized, response.StatusFail, "invalid_token")
+	})
+}
+
+func TestSearchHandler(t *testing.T) {
+	search := router.Permitted(repositories.Users, authUtil.PermissionAuditRead, auditAPI.Search)
+
+	t.Run("Regular user is forbidden", func(t *testing.T) {
+		test.SearchAuditHelper(search, t, audit.SearchQueryParams{}, http.StatusForbidden, response.StatusFail, accessToken)
+	})
+
+	t.Run("Search by actor", func(t *testing.T) {
+		entries := test.SearchAuditHelper(search, t, audit.SearchQueryParams{ActorID: adminID, Action: "admin"}, http.StatusOK, response.StatusSuccess, adminAccessToken)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, user1ID, entries[0].UserID.String())
+		}
+	})
+
+	t.Run("Search by user and target", func(t *testing.T) {
+		entries := test.SearchAuditHelper(search, t, audit.SearchQueryParams{UserID: user1ID, TargetType: auditUtil.TargetEvent}, http.StatusOK, response.StatusSuccess, adminAccessToken)
+		assert.Len(t, entries, 3)
+	})
+
+	t.Run("Limit is applied", func(t *testing.T) {
+		entries := test.SearchAuditHelper(search, t, audit.SearchQueryParams{Limit: "2"}, http.StatusOK, response.StatusSuccess, adminAccessToken)
+		assert.Len(t, entries, 2)
+	})
+
+	t.Run("UUID is invalid", func(t *testing.T) {
+		test.SearchAuditHelper(search, t, audit.SearchQueryParams{UserID: "not_an_uuid"}, http.StatusBadRequest, response.StatusFail, adminAccessToken)
+	})
+}
+
+func TestVerifyHandler(t *testing.T) {
+	verify := router.Permitted(repositories.Users, authUtil.PermissionAuditRead, auditAPI.Verify)
+
+	t.Run("Chain is valid", func(t *testing.T) {
+		test.VerifyAuditHelper(verify, t, http.StatusOK, response.StatusSuccess, true, adminAccessToken)
+	})
+
+	t.Run("Changed entry breaks the chain", func(t *testing.T) {
+		auditLog := repositories.Audit.(*store.MemoryAuditRepository)
+
+		var seq int64
+		for _, entry := range auditLog.Entries() {
+			if entry.UserID != nil && entry.UserID.String() == user1ID && entry.Action == auditUtil.ActionUserCreate {
+				seq = entry.Seq
+			}
+		}
+
+		auditLog.Edit(seq, func(entry *models.AuditLog) { entry.IP = "127.0.0.2" })
+		defer auditLog.Edit(seq, func(entry *models.AuditLog) { entry.IP = "" })
+
+		test.VerifyAuditHelper(verify, t, http.StatusOK, response.StatusSuccess, false, adminAccessToken)
+	})
+
+	t.Run("Regular user is forbidden", func(t *testing.T) {
+		test.VerifyAuditHelper(verify, t, http.StatusForbidden, response.StatusFail, false, accessToken)
+	})
+}
+
+func TestCleanUp(t *testing.T) {
+	t.Run("Delete users", func(t *testing.T) {
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user1ID, accessToken)
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, adminID, adminAccessToken)
+	})
+}
@@ -0,0 +1,16 @@
+package audit
+
+type GetUserAuditQueryParams struct {
+	Action string `json:"action" validate:"omitempty,max=64"`
+	Limit  string `json:"limit" validate:"omitempty,number"`
+	Offset string `json:"offset" validate:"omitempty,number"`
+}
+
+type SearchQueryParams struct {
+	UserID     string `json:"user_id" validate:"omitempty,uuid"`
+	ActorID    string `json:"actor_id" validate:"omitempty,uuid"`
+	Action     string `json:"action" validate:"omitempty,max=64"`
+	TargetType string `json:"target_type" validate:"omitempty,max=32"`
+	Limit      string `json:"limit" validate:"omitempty,number"`
+	Offset     string `json:"offset" validate:"omitempty,number"`
+}
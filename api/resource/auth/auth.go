@@ -1,61 +1,118 @@
 package auth
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/jmoiron/sqlx"
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/config"
 	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
 	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/lockout"
 	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/metrics"
+	"github.com/ushiradineth/koano-api/util/oidc"
+	"github.com/ushiradineth/koano-api/util/password"
+	"github.com/ushiradineth/koano-api/util/request"
 	"github.com/ushiradineth/koano-api/util/response"
 	"github.com/ushiradineth/koano-api/util/user"
+	"github.com/ushiradineth/koano-api/util/webauthn"
 )
 
 type API struct {
-	db        *sqlx.DB
+	store     *store.Store
 	validator *validator.Validate
 	log       *logger.Logger
+	mailer    mail.Mailer
+	limiter   *lockout.Limiter
+	providers map[string]*oidc.Provider
+	webauthn  webauthn.Config
+	policy    password.Policy
+	cookies   auth.CookieConfig
+
+	appURL                   string
+	requireEmailVerification bool
+	restorePeriod            time.Duration
 }
 
-func New(db *sqlx.DB, validator *validator.Validate, log *logger.Logger) *API {
+func New(store *store.Store, validator *validator.Validate, log *logger.Logger, mailer mail.Mailer, cfg *config.Config) *API {
+	limiter := lockout.New(store.LoginAttempts, lockout.DefaultPolicy)
+	limiter.OnLockout(func(l lockout.Lockout) {
+		metrics.Lockouts.WithLabelValues(l.Scope).Inc()
+		log.Warn.Printf("Login for %s %s has been locked until %s after %d failed attempts", l.Scope, l.Identifier, l.LockedUntil.Format(time.RFC3339), l.FailedCount)
+
+		if l.Scope != lockout.ScopeAccount {
+			return
+		}
+
+		body := fmt.Sprintf("We have temporarily locked sign in to your Koano account after %d failed attempts. You can try again after %s.\n\nIf this wasn't you, consider changing your password once you are able to sign in.", l.FailedCount, l.LockedUntil.Format(time.RFC1123))
+		if err := mailer.Send(l.Identifier, "Your account has been temporarily locked", body); err != nil {
+			log.Error.Printf("Failed to send lockout email to %s: %v", l.Identifier, err)
+		}
+	})
+
 	return &API{
-		db:        db,
+		store:     store,
 		validator: validator,
 		log:       log,
+		mailer:    mailer,
+		limiter:   limiter,
+		providers: oidc.NewProviders(cfg.OIDC, &http.Client{Timeout: 10 * time.Second}),
+		webauthn:  cfg.WebAuthn,
+		policy:    cfg.Password.Policy,
+		cookies:   cfg.Cookies,
+
+		appURL:                   cfg.AppURL,
+		requireEmailVerification: cfg.RequireEmailVerification,
+		restorePeriod:            cfg.AccountRestorePeriod,
 	}
 }
 
+// AuthenticateResponse leaves out the tokens in cookie sessions, where they are set as cookies instead
 type AuthenticateResponse struct {
 	User         models.User `json:"user"`
-	AccessToken  string      `json:"access_token"`
+	AccessToken  string      `json:"access_token,omitempty"`
 	TokenType    string      `json:"token_type"`
 	ExpiresIn    int64       `json:"expires_in"`
 	ExpiresAt    int64       `json:"expires_at"`
-	RefreshToken string      `json:"refresh_token"`
+	RefreshToken string      `json:"refresh_token,omitempty"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
 }
 
 type RefreshTokenResponse struct {
-	AccessToken  string `json:"access_token"`
+	AccessToken  string `json:"access_token,omitempty"`
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int64  `json:"expires_in"`
 	ExpiresAt    int64  `json:"expires_at"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
 // @Summary		Authenticate User
-// @Description	Authenticate User with the parameters sent with the request
+// @Description	Authenticate User with the parameters sent with the request. Users with MFA enabled receive an MFAChallengeResponse to complete with /auth/mfa/verify instead of the token pair, and users who deleted their account within the grace period receive a RestoreChallengeResponse to complete with /auth/restore. Browser clients can send X-Session-Mode: cookie, with this or any other sign in, to receive the tokens as HttpOnly cookies instead. Requests authenticated by those cookies which change state must send the koano_csrf_token cookie back in the X-CSRF-Token header
 // @Tags			Auth
 // @Accept			json
 // @Produce		json
-// @Param			Body	body		AuthenticateBodyParams	true	"AuthenticateBodyParams"
+// @Param			X-Session-Mode	header		string					false	"Set to cookie for a cookie session"
+// @Param			Body			body		AuthenticateBodyParams	true	"AuthenticateBodyParams"
 // @Success		200		{object}	response.Response{data=AuthenticateResponse}
 // @Failure		400		{object}	response.Error
 // @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		429		{object}	response.Error
 // @Failure		500		{object}	response.Error
 // @Router			/auth/login [post]
 func (api *API) Authenticate(w http.ResponseWriter, r *http.Request) {
@@ -70,10 +127,23 @@ func (api *API) Authenticate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := user.GetUserByEmail(body.Email, api.db)
+	// Checked before touching the password hash so locked out callers can't keep the CPU busy with password hashing
+	reservation, ok := api.checkLockout(w, r, body.Email)
+	if !ok {
+		return
+	}
+	defer api.releaseLockout(r, reservation)
+
+	user, err := api.store.Users.GetByEmail(r.Context(), body.Email)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			response.GenericBadRequestError(w, fmt.Errorf("User by email %s not found", body.Email))
+		if errors.Is(err, store.ErrNotFound) {
+			if api.offerRestore(w, r, body, reservation) {
+				return
+			}
+
+			// Answered like a wrong password so the response doesn't tell whether the email is registered
+			api.failLogin(r.Context(), "password", reservation)
+			response.HTTPError(w, http.StatusUnauthorized, "Invalid Credentials", response.StatusFail)
 			return
 		}
 
@@ -81,53 +151,55 @@ func (api *API) Authenticate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if user == nil {
-		return
+	// Users who sign in through a provider or magic link may not have a password
+	valid, rehashed := false, ""
+	if user.Password != nil {
+		valid, rehashed = auth.CheckPasswordHash(body.Password, *user.Password)
+	} else {
+		auth.VerifyWithoutHash(body.Password)
 	}
 
-	valid := auth.CheckPasswordHash(body.Password, user.Password)
-
 	if !valid {
+		api.failLogin(r.Context(), "password", reservation)
+
+		if err := api.store.Audit.Append(context.WithoutCancel(r.Context()), audit.FromRequest(r, audit.Record{UserID: &user.ID, Action: audit.ActionLoginFailed, TargetType: audit.TargetUser, TargetID: &user.ID, After: map[string]any{"method": "password"}})); err != nil {
+			api.log.Error.PrintfContext(r.Context(), "Failed to audit failed login of user %s: %v", user.ID, err)
+		}
+
 		response.HTTPError(w, http.StatusUnauthorized, "Invalid Credentials", response.StatusFail)
 		return
 	}
 
-	accessToken, expiresIn, expiresAt, err := auth.NewAccessToken(user.ID, user.Name, user.Email)
-	if err != nil {
-		response.GenericServerError(w, err)
-		return
+	// With MFA the failures are kept until the second factor passes, so a known password can't reset the lockout on guessing it
+	if !user.MFAEnabled {
+		api.succeedLockout(r, reservation, user.ID)
 	}
 
-	refreshToken, err := auth.NewRefreshToken()
-	if err != nil {
-		response.GenericServerError(w, err)
-		return
+	if rehashed != "" {
+		if err := api.store.Users.RehashPassword(r.Context(), user.ID, *user.Password, rehashed); err != nil {
+			api.log.Error.PrintfContext(r.Context(), "Failed to upgrade the password hash of user %s: %v", user.ID, err)
+		} else {
+			api.log.Info.PrintfContext(r.Context(), "Password hash of user %s has been upgraded", user.ID)
+		}
 	}
 
-	user.Password = "redacted"
-
-	authenticateResponse := AuthenticateResponse{
-		User:         *user,
-		AccessToken:  accessToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    expiresIn,
-		ExpiresAt:    expiresAt,
-		RefreshToken: refreshToken,
+	if api.requireEmailVerification && !user.EmailVerified {
+		response.HTTPError(w, http.StatusForbidden, "Email address has not been verified", response.StatusFail)
+		return
 	}
 
-	api.log.Info.Printf("User %s has been authenticated", user.ID)
-
-	response.HTTPResponse(w, authenticateResponse)
+	api.completeLogin(w, r, user, "password")
 }
 
 // @Summary		Refresh Access Token
-// @Description	Refresh Access Token with the parameters sent with the request based on the request based on the JWT
+// @Description	Refresh Access Token with the parameters sent with the request based on the request based on the JWT. Cookie sessions are refreshed from their cookies without a body. The refresh token is exchanged for a new one, using it again signs out every session of the user
 // @Tags			Auth
 // @Accept			json
 // @Produce		json
-// @Param			Body	body		RefreshTokenBodyParams	true	"RefreshTokenBodyParams"
+// @Param			Body	body		RefreshTokenBodyParams	false	"RefreshTokenBodyParams"
 // @Success		200		{object}	response.Response{data=RefreshTokenResponse}
 // @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
 // @Failure		500		{object}	response.Error
 // @Security		BearerAuth
 // @Router			/auth/refresh [post]
@@ -138,8 +210,12 @@ func (api *API) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A cookie session is refreshed from its cookies, a bearer token in the header means the client manages its own tokens
 	var body RefreshTokenBodyParams
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	cookieSession := r.Header.Get("Authorization") == "" && auth.GetRefreshTokenCookie(r) != ""
+	if cookieSession {
+		body.RefreshToken = auth.GetRefreshTokenCookie(r)
+	} else if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		response.GenericValidationError(w, err)
 		return
 	}
@@ -151,13 +227,34 @@ func (api *API) RefreshToken(w http.ResponseWriter, r *http.Request) {
 
 	accessTokenClaim := auth.ParseExpiredAccessToken(w, accessToken)
 	if accessTokenClaim == nil {
+		metrics.Refresh(metrics.OutcomeFailure)
+		return
+	}
+
+	refreshTokenClaim := auth.ParseRefreshToken(w, body.RefreshToken)
+	if refreshTokenClaim == nil {
+		metrics.Refresh(metrics.OutcomeFailure)
 		return
 	}
 
-	user, err := user.GetUserByEmail(accessTokenClaim.Email, api.db)
+	// Both tokens have to belong to the same user, so a refresh token can't be paired with the access token of someone else
+	if refreshTokenClaim.Subject != accessTokenClaim.Id.String() {
+		metrics.Refresh(metrics.OutcomeFailure)
+		response.GenericUnauthenticatedError(w)
+		return
+	}
+
+	refreshTokenID, err := uuid.Parse(refreshTokenClaim.StandardClaims.Id)
+	if err != nil {
+		metrics.Refresh(metrics.OutcomeFailure)
+		response.GenericUnauthenticatedError(w)
+		return
+	}
+
+	user, err := api.store.Users.GetByID(r.Context(), accessTokenClaim.Id)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			response.GenericBadRequestError(w, fmt.Errorf("User by email %s not found", accessTokenClaim.Email))
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("User %s not found", accessTokenClaim.Id))
 			return
 		}
 
@@ -165,22 +262,41 @@ func (api *API) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if user == nil {
+	// Revoking the sessions of the user, such as by changing the password, bumps the version and invalidates both tokens
+	if accessTokenClaim.TokenVersion != user.TokenVersion || refreshTokenClaim.TokenVersion != user.TokenVersion {
+		metrics.Refresh(metrics.OutcomeFailure)
+		response.GenericUnauthenticatedError(w)
 		return
 	}
 
-	refreshTokenClaim := auth.ParseRefreshToken(w, body.RefreshToken)
-	if refreshTokenClaim == nil {
+	// Each refresh token is exchanged once. One used again has been copied, so every session of the user is revoked as it can't be told which copy is legitimate.
+	if err := api.store.RefreshTokens.Use(r.Context(), refreshTokenID, user.ID, time.Unix(refreshTokenClaim.ExpiresAt, 0)); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			metrics.Refresh(metrics.OutcomeFailure)
+			api.log.Warn.PrintfContext(r.Context(), "Refresh token %s of user %s has been used again, revoking their sessions", refreshTokenID, user.ID)
+
+			if err := api.store.Users.RevokeSessions(context.WithoutCancel(r.Context()), user.ID); err != nil {
+				api.log.Error.PrintfContext(r.Context(), "Failed to revoke the sessions of user %s: %v", user.ID, err)
+			}
+
+			response.GenericUnauthenticatedError(w)
+			return
+		}
+
+		response.GenericServerError(w, err)
 		return
 	}
 
-	newAccessToken, expiresIn, expiresAt, err := auth.NewAccessToken(user.ID, user.Name, user.Email)
+	// The session keeps the time the user signed in, refreshing it is not signing in again
+	authTime := time.Unix(refreshTokenClaim.AuthTime, 0)
+
+	newAccessToken, expiresIn, expiresAt, err := auth.NewAccessToken(user.ID, user.Name, user.Email, user.Role, user.TokenVersion, authTime)
 	if err != nil {
 		response.GenericServerError(w, err)
 		return
 	}
 
-	newRefreshToken, err := auth.NewRefreshToken()
+	newRefreshToken, err := auth.NewRefreshToken(user.ID, user.TokenVersion, authTime)
 	if err != nil {
 		response.GenericServerError(w, err)
 		return
@@ -194,13 +310,24 @@ func (api *API) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		RefreshToken: newRefreshToken,
 	}
 
-	api.log.Info.Printf("Access Token for user %s has been refreshed", user.ID)
+	if cookieSession {
+		if err := auth.SetSessionCookies(w, api.cookies, newAccessToken, newRefreshToken); err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		refreshTokenResponse.AccessToken = ""
+		refreshTokenResponse.RefreshToken = ""
+	}
+
+	metrics.Refresh(metrics.OutcomeSuccess)
+	api.log.Info.PrintfContext(r.Context(), "Access Token for user %s has been refreshed", user.ID)
 
 	response.HTTPResponse(w, refreshTokenResponse)
 }
 
 // @Summary		Update User Password
-// @Description	Update authenticated user's Password with the parameters sent with the request based on the JWT
+// @Description	Update authenticated user's Password with the parameters sent with the request based on the JWT. Every session of the user is signed out, including the one making the request
 // @Tags			Auth
 // @Accept			json
 // @Produce		json
@@ -223,29 +350,388 @@ func (api *API) PutPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	violations, err := api.policy.Check(body.Password, user.Name, user.Email)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if len(violations) > 0 {
+		response.GenericPasswordPolicyError(w, violations)
+		return
+	}
+
+	password, err := auth.HashPassword(body.Password)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if err := api.store.Users.SetPassword(r.Context(), user.ID, password); err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionPasswordSet, TargetType: audit.TargetUser, TargetID: &user.ID})
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has updated their password", user.ID)
+
+	response.HTTPResponse(w, "Password has being updated")
+}
+
+// @Summary		Verify Email
+// @Description	Verify the email address of a user with the token sent in the verification link. Pending email changes are applied once verified
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		VerifyEmailBodyParams	true	"VerifyEmailBodyParams"
+// @Success		200		{object}	response.Response{data=models.User}
+// @Failure		400		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/auth/verify-email [post]
+func (api *API) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var body VerifyEmailBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
 	if err := api.validator.Struct(body); err != nil {
 		response.GenericValidationError(w, err)
 		return
 	}
 
-	user := user.GetUserFromJWT(r, w, api.db)
-	if user == nil {
+	verificationClaim := auth.ParseEmailVerificationToken(w, body.Token)
+	if verificationClaim == nil {
 		return
 	}
 
-	password, err := auth.HashPassword(body.Password)
+	existingUser, err := api.store.Users.GetByID(r.Context(), verificationClaim.Id)
 	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("User by id %s not found", verificationClaim.Id.String()))
+			return
+		}
+
 		response.GenericServerError(w, err)
 		return
 	}
 
-	_, err = api.db.Exec("UPDATE users SET password=$1 WHERE id=$2", password, user.ID)
+	if verificationClaim.Email != existingUser.Email {
+		if existingUser.PendingEmail == nil || verificationClaim.Email != *existingUser.PendingEmail {
+			response.GenericBadRequestError(w, fmt.Errorf("Verification token is no longer valid"))
+			return
+		}
+
+		emailInUse, err := api.store.Users.IsEmailInUse(r.Context(), verificationClaim.Email, existingUser.ID)
+		if err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		if emailInUse {
+			response.GenericBadRequestError(w, fmt.Errorf("Email already in use"))
+			return
+		}
+	}
+
+	// Verifying the pending email promotes it to the current email, verifying the current email leaves any pending change untouched
+	verifiedUser, err := api.store.Users.VerifyEmail(r.Context(), existingUser.ID, verificationClaim.Email)
 	if err != nil {
 		response.GenericServerError(w, err)
 		return
 	}
 
-	api.log.Info.Printf("User %s has updated their password", user.ID)
+	verifiedUser.Redact()
+	existingUser.Redact()
 
-	response.HTTPResponse(w, "Password has being updated")
+	before, after, err := audit.Diff(existingUser, verifiedUser)
+	if err != nil {
+		api.log.Error.PrintfContext(r.Context(), "Failed to diff user %s: %v", verifiedUser.ID, err)
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, verifiedUser.ID, audit.Record{Action: audit.ActionEmailVerify, TargetType: audit.TargetUser, TargetID: &verifiedUser.ID, Before: before, After: after})
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has verified their email", verifiedUser.ID)
+
+	response.HTTPResponse(w, verifiedUser)
+}
+
+// @Summary		Resend Verification Email
+// @Description	Resend the verification link for the pending email of the authenticated user, or for the current email if it has not been verified
+// @Tags			Auth
+// @Produce		json
+// @Success		200	{object}	response.Response{data=string}
+// @Failure		400	{object}	response.Error
+// @Failure		401	{object}	response.Error
+// @Failure		500	{object}	response.Error
+// @Security		BearerAuth
+// @Router			/auth/verify-email/resend [post]
+func (api *API) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	existingUser := auth.MustPrincipalFromContext(r.Context()).User
+
+	email := existingUser.Email
+	if existingUser.PendingEmail != nil {
+		email = *existingUser.PendingEmail
+	} else if existingUser.EmailVerified {
+		response.GenericBadRequestError(w, fmt.Errorf("Email address is already verified"))
+		return
+	}
+
+	if err := user.SendEmailVerification(api.appURL, existingUser.ID, email, api.mailer); err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Verification email has been resent to user %s", existingUser.ID)
+
+	response.HTTPResponse(w, "Verification email has been sent")
+}
+
+// completeLogin issues the token pair for an authenticated user, or an MFA challenge if the user has MFA enabled. The method is recorded in the audit log once the login succeeds.
+func (api *API) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, method string) {
+	if user.MFAEnabled {
+		challengeID := uuid.New()
+		challengeToken, expiresIn, err := auth.NewMFAChallengeToken(user.ID, challengeID)
+		if err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		challenge := models.MFAChallenge{ID: challengeID, UserID: user.ID, ExpiresAt: time.Now().Add(time.Duration(expiresIn) * time.Second)}
+		if err := api.store.MFAChallenges.Create(r.Context(), challenge); err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		api.log.Info.PrintfContext(r.Context(), "User %s has been issued an MFA challenge", user.ID)
+
+		response.HTTPResponse(w, MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    challengeToken,
+			ExpiresIn:   expiresIn,
+		})
+		return
+	}
+
+	api.respondWithTokens(w, r, user, method)
+}
+
+func (api *API) respondWithTokens(w http.ResponseWriter, r *http.Request, user *models.User, method string) {
+	authTime := time.Now()
+
+	accessToken, expiresIn, expiresAt, err := auth.NewAccessToken(user.ID, user.Name, user.Email, user.Role, user.TokenVersion, authTime)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	refreshToken, err := auth.NewRefreshToken(user.ID, user.TokenVersion, authTime)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	user.Redact()
+
+	authenticateResponse := AuthenticateResponse{
+		User:         *user,
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresIn,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+	}
+
+	if auth.WantsSessionCookies(r) {
+		if err := auth.SetSessionCookies(w, api.cookies, accessToken, refreshToken); err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		authenticateResponse.AccessToken = ""
+		authenticateResponse.RefreshToken = ""
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionLogin, TargetType: audit.TargetUser, TargetID: &user.ID, After: map[string]any{"method": method}})
+
+	metrics.Login(method, metrics.OutcomeSuccess)
+	api.log.Info.PrintfContext(r.Context(), "User %s has been authenticated", user.ID)
+
+	response.HTTPResponse(w, authenticateResponse)
+}
+
+// @Summary		Sign Out
+// @Description	End a session by revoking its refresh token, taken from the cookie of a cookie session or else the body, and clearing its cookies. The access token expires on its own
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		RefreshTokenBodyParams	false	"RefreshTokenBodyParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		500		{object}	response.Error
+// @Router			/auth/logout [post]
+func (api *API) Logout(w http.ResponseWriter, r *http.Request) {
+	refreshToken := auth.GetRefreshTokenCookie(r)
+	if refreshToken == "" && r.Body != nil {
+		// The body is optional, a refresh token which can't be read has nothing to revoke
+		var body RefreshTokenBodyParams
+		if err := json.NewDecoder(r.Body).Decode(&body); err == nil {
+			refreshToken = body.RefreshToken
+		}
+	}
+
+	if err := api.revokeRefreshToken(r.Context(), refreshToken); err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	auth.ClearSessionCookies(w, api.cookies)
+
+	api.log.Info.PrintfContext(r.Context(), "Session cookies have been cleared")
+
+	response.HTTPResponse(w, "Signed out")
+}
+
+// revokeRefreshToken records the refresh token as used, so it can't be exchanged after signing out. Invalid and expired tokens are ignored.
+func (api *API) revokeRefreshToken(ctx context.Context, refreshToken string) error {
+	claims, err := auth.VerifyRefreshToken(refreshToken)
+	if err != nil {
+		return nil
+	}
+
+	id, err := uuid.Parse(claims.StandardClaims.Id)
+	if err != nil {
+		return nil
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil
+	}
+
+	if err := api.store.RefreshTokens.Use(ctx, id, userID, time.Unix(claims.ExpiresAt, 0)); err != nil && !errors.Is(err, store.ErrConflict) {
+		return err
+	}
+
+	return nil
+}
+
+// ActionUnlockLogin is recorded in the audit log like the other admin actions
+const ActionUnlockLogin = "admin.lockout.unlock"
+
+// @Summary		Unlock Login
+// @Description	Clear the failed login attempts and lockout of an account (by email) or an IP. Requires the users:disable permission, accounts of users with a role at or above the caller's can't be unlocked
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			Body	body		UnlockBodyParams	true	"UnlockBodyParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/admin/lockouts/unlock [post]
+func (api *API) Unlock(w http.ResponseWriter, r *http.Request) {
+	actor := auth.MustPrincipalFromContext(r.Context()).User
+
+	var body UnlockBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	// Attempts are counted per email ignoring case, so every account sharing the email has to be below the caller
+	targets := []models.User{}
+	if body.Scope == lockout.ScopeAccount {
+		var err error
+		if targets, err = api.store.Users.ListByEmail(r.Context(), body.Identifier); err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		for _, target := range targets {
+			if !auth.Outranks(actor.Role, target.Role) {
+				response.GenericForbiddenError(w, fmt.Errorf("Login of a user with the %s role can't be unlocked", target.Role))
+				return
+			}
+		}
+	}
+
+	unlocked, err := api.limiter.Unlock(r.Context(), body.Scope, body.Identifier)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if !unlocked {
+		response.GenericBadRequestError(w, fmt.Errorf("No failed login attempts found for %s %s", body.Scope, body.Identifier))
+		return
+	}
+
+	record := audit.Record{ActorID: &actor.ID, Action: ActionUnlockLogin, After: map[string]any{"scope": body.Scope, "identifier": body.Identifier}}
+	if len(targets) == 0 {
+		api.auditUnlock(r, record)
+	}
+	for _, target := range targets {
+		record.UserID, record.TargetType, record.TargetID = &target.ID, audit.TargetUser, &target.ID
+		api.auditUnlock(r, record)
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Login for %s %s has been unlocked by %s", body.Scope, body.Identifier, actor.ID)
+
+	response.HTTPResponse(w, "Login has been unlocked")
+}
+
+// auditUnlock logs failures rather than returning them since the login has already been unlocked
+func (api *API) auditUnlock(r *http.Request, record audit.Record) {
+	if err := api.store.Audit.Append(context.WithoutCancel(r.Context()), audit.FromRequest(r, record)); err != nil {
+		api.log.Error.PrintfContext(r.Context(), "Failed to audit %s by user %s: %v", record.Action, *record.ActorID, err)
+	}
+}
+
+// checkLockout counts the attempt for the account and the IP address of the request up front, so it stays counted as a failure
+// unless the reservation is released or succeeds. It responds with 429 and false while either is locked out.
+func (api *API) checkLockout(w http.ResponseWriter, r *http.Request, email string) (*lockout.Reservation, bool) {
+	reservation, retryAfter, err := api.limiter.Check(r.Context(), email, request.ClientIP(r))
+	if err != nil {
+		response.GenericServerError(w, err)
+		return nil, false
+	}
+
+	if reservation == nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		response.HTTPError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later", response.StatusFail)
+		return nil, false
+	}
+
+	return reservation, true
+}
+
+// releaseLockout takes back a reserved attempt which hasn't failed or succeeded, it is deferred after every checkLockout
+func (api *API) releaseLockout(r *http.Request, reservation *lockout.Reservation) {
+	// Disconnecting must not leave the attempt counted
+	if err := reservation.Release(context.WithoutCancel(r.Context())); err != nil {
+		api.log.Error.PrintfContext(r.Context(), "Failed to release login attempt: %v", err)
+	}
+}
+
+// succeedLockout forgets the failed login attempts of the account once the login has succeeded
+func (api *API) succeedLockout(r *http.Request, reservation *lockout.Reservation, userID uuid.UUID) {
+	if err := reservation.Succeed(context.WithoutCancel(r.Context())); err != nil {
+		api.log.Error.PrintfContext(r.Context(), "Failed to reset failed login attempts for user %s: %v", userID, err)
+	}
+}
+
+// failLogin keeps the reserved attempt as a failure
+func (api *API) failLogin(ctx context.Context, method string, reservation *lockout.Reservation) {
+	metrics.Login(method, metrics.OutcomeFailure)
+	reservation.Fail()
 }
@@ -1,25 +1,37 @@
 package auth_test
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-faker/faker/v4"
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
 	"github.com/ushiradineth/koano-api/api/resource/auth"
 	"github.com/ushiradineth/koano-api/api/resource/event"
 	"github.com/ushiradineth/koano-api/api/resource/user"
+	"github.com/ushiradineth/koano-api/api/router"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
 	authUtil "github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/lockout"
 	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/oidc"
+	"github.com/ushiradineth/koano-api/util/password"
 	"github.com/ushiradineth/koano-api/util/response"
 	"github.com/ushiradineth/koano-api/util/test"
+	userUtil "github.com/ushiradineth/koano-api/util/user"
 	"github.com/ushiradineth/koano-api/util/validator"
+	"github.com/ushiradineth/koano-api/util/webauthn"
 )
 
 var (
@@ -27,13 +39,14 @@ var (
 	refreshToken           string
 	user1ID                string
 	user2ID                string
-	expiredAccessToken     string
 	expiredRefreshToken    string
 	deletedUserAccessToken string
-	db                     *sqlx.DB
+	deletedUserRefresh     string
+	repositories           *store.Store
 	userAPI                *user.API
 	authAPI                *auth.API
 	eventAPI               *event.API
+	mailer                 *mail.MemoryMailer
 )
 
 var user1 user.PostBodyParams = user.PostBodyParams{
@@ -65,13 +78,14 @@ func TestInit(t *testing.T) {
 			log.Println("Failed to load env")
 		}
 
-		db = test.NewDB("../../../database/migration")
+		repositories = test.NewStore()
 		v := validator.New()
 		l := logger.New()
+		mailer = mail.NewMemoryMailer()
 
-		userAPI = user.New(db, v, l)
-		eventAPI = event.New(db, v, l)
-		authAPI = auth.New(db, v, l)
+		userAPI = user.New(repositories, v, l, mailer, test.NewConfig())
+		eventAPI = event.New(repositories, v, l)
+		authAPI = auth.New(repositories, v, l, mailer, test.NewConfig())
 
 		t.Run("Create User 1", func(t *testing.T) {
 			test.CreateUserHelper(userAPI, t, user1, http.StatusOK, response.StatusSuccess)
@@ -85,33 +99,32 @@ func TestInit(t *testing.T) {
 			test.CreateUserHelper(userAPI, t, user2, http.StatusOK, response.StatusSuccess)
 		})
 
-		userIDUUID, _ := uuid.Parse(user1ID)
-		expiredClaim := authUtil.UserClaim{
-			Id:    userIDUUID,
-			Name:  user1.Name,
-			Email: user1.Email,
-			StandardClaims: jwt.StandardClaims{
-				IssuedAt:  time.Now().Unix(),
-				ExpiresAt: time.Now().Add(-1 * time.Hour).Unix(),
-			},
-		}
+		expiredRefreshToken = expiredAccessToken(t)
 
-		expiredAccessToken = func() string {
-			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, expiredClaim).SignedString([]byte(os.Getenv("JWT_SECRET")))
-			return token
-		}()
+		deletedUserID := uuid.New()
+		deletedUserAccessToken = signExpiredAccessToken(authUtil.UserClaim{Id: deletedUserID, Name: user1.Name, Email: faker.Email()})
+		deletedUserRefresh, _ = authUtil.NewRefreshToken(deletedUserID, 0, time.Now())
+	})
+}
 
-		expiredRefreshToken = func() string {
-			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, expiredClaim).SignedString([]byte(os.Getenv("JWT_SECRET")))
-			return token
-		}()
+// expiredAccessToken signs an expired access token of user 1 at their current token version, which changes as their sessions are revoked
+func expiredAccessToken(t *testing.T) string {
+	t.Helper()
 
-		expiredClaim.Email = faker.Email()
-		deletedUserAccessToken = func() string {
-			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, expiredClaim).SignedString([]byte(os.Getenv("JWT_SECRET")))
-			return token
-		}()
-	})
+	user, err := repositories.Users.GetByEmail(context.Background(), user1.Email)
+	assert.NoError(t, err)
+
+	return signExpiredAccessToken(authUtil.UserClaim{Id: user.ID, Name: user.Name, Email: user.Email, TokenVersion: user.TokenVersion})
+}
+
+func signExpiredAccessToken(claim authUtil.UserClaim) string {
+	claim.StandardClaims = jwt.StandardClaims{
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(-1 * time.Hour).Unix(),
+	}
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claim).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return token
 }
 
 func TestAuthenticateUserHandler(t *testing.T) {
@@ -128,7 +141,7 @@ func TestAuthenticateUserHandler(t *testing.T) {
 		Password: user1.Password,
 	}
 	t.Run("Email is not registered", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, body, http.StatusBadRequest, response.StatusFail, &user1ID, &accessToken, &refreshToken)
+		test.AuthenticateUserHelper(authAPI, t, body, http.StatusUnauthorized, response.StatusFail, &user1ID, &accessToken, &refreshToken)
 	})
 
 	body = auth.AuthenticateBodyParams{
@@ -143,8 +156,8 @@ func TestAuthenticateUserHandler(t *testing.T) {
 		Email:    user1.Email,
 		Password: "not_a_password",
 	}
-	t.Run("Password is invalid", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, body, http.StatusBadRequest, response.StatusFail, &user1ID, &accessToken, &refreshToken)
+	t.Run("Password policy is not applied at login", func(t *testing.T) {
+		test.AuthenticateUserHelper(authAPI, t, body, http.StatusUnauthorized, response.StatusFail, &user1ID, &accessToken, &refreshToken)
 	})
 
 	body = auth.AuthenticateBodyParams{
@@ -156,6 +169,45 @@ func TestAuthenticateUserHandler(t *testing.T) {
 	})
 }
 
+func TestCookieSessionHandler(t *testing.T) {
+	var cookies []*http.Cookie
+
+	t.Run("Login sets session cookies", func(t *testing.T) {
+		cookies = test.AuthenticateCookieSessionHelper(authAPI, t, auth.AuthenticateBodyParams{Email: user1.Email, Password: user1.Password}, http.StatusOK, response.StatusSuccess)
+	})
+
+	t.Run("Access token cookie authenticates requests", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/users/{user_id}", nil)
+		req.SetPathValue("user_id", user1ID)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+
+		router.Authenticated(repositories.Users, userAPI.Get)(res, req)
+
+		test.GenericAssert(t, http.StatusOK, response.StatusSuccess, res)
+	})
+
+	t.Run("Session is refreshed from its cookies", func(t *testing.T) {
+		expired := []*http.Cookie{
+			{Name: authUtil.AccessTokenCookie, Value: expiredAccessToken(t)},
+			{Name: authUtil.RefreshTokenCookie, Value: refreshToken},
+		}
+
+		test.RefreshCookieSessionHelper(authAPI, t, expired, http.StatusOK, response.StatusSuccess)
+	})
+
+	t.Run("Expired refresh token cookie is rejected", func(t *testing.T) {
+		expired := []*http.Cookie{
+			{Name: authUtil.AccessTokenCookie, Value: expiredAccessToken(t)},
+			{Name: authUtil.RefreshTokenCookie, Value: expiredRefreshToken},
+		}
+
+		test.RefreshCookieSessionHelper(authAPI, t, expired, http.StatusUnauthorized, response.StatusFail)
+	})
+}
+
 func TestUpdateUserPasswordHandler(t *testing.T) {
 	t.Run("Update User Password", func(t *testing.T) {
 		t.Run("Authenticates user 1", func(t *testing.T) {
@@ -172,8 +224,15 @@ func TestUpdateUserPasswordHandler(t *testing.T) {
 		body = auth.PutPasswordBodyParams{
 			Password: user1.Password,
 		}
+		t.Run("Password change signs out every session", func(t *testing.T) {
+			test.UpdateUserPasswordHelper(authAPI, t, body, http.StatusUnauthorized, response.StatusFail, accessToken)
+			test.RefreshTokenHelper(authAPI, t, auth.RefreshTokenBodyParams{RefreshToken: refreshToken}, expiredAccessToken(t), http.StatusUnauthorized, response.StatusFail)
+		})
+
 		t.Run("Reset user 1", func(t *testing.T) {
+			test.AuthenticateUserHelper(authAPI, t, auth.AuthenticateBodyParams{Email: user1.Email, Password: user2.Password}, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
 			test.UpdateUserPasswordHelper(authAPI, t, body, http.StatusOK, response.StatusSuccess, accessToken)
+			test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
 		})
 
 		t.Run("JWT is invalid", func(t *testing.T) {
@@ -181,7 +240,7 @@ func TestUpdateUserPasswordHandler(t *testing.T) {
 		})
 
 		t.Run("JWT is expired", func(t *testing.T) {
-			test.UpdateUserPasswordHelper(authAPI, t, body, http.StatusUnauthorized, response.StatusFail, expiredAccessToken)
+			test.UpdateUserPasswordHelper(authAPI, t, body, http.StatusUnauthorized, response.StatusFail, expiredAccessToken(t))
 		})
 
 		body = auth.PutPasswordBodyParams{
@@ -190,6 +249,24 @@ func TestUpdateUserPasswordHandler(t *testing.T) {
 		t.Run("Password is invalid", func(t *testing.T) {
 			test.UpdateUserPasswordHelper(authAPI, t, body, http.StatusBadRequest, response.StatusFail, accessToken)
 		})
+
+		t.Run("Password violations are listed", func(t *testing.T) {
+			test.PasswordPolicyViolationHelper(authAPI, t, auth.PutPasswordBodyParams{Password: "Password1!"}, accessToken, []string{password.ViolationTooWeak})
+		})
+
+		passphrase := auth.AuthenticateBodyParams{
+			Email:    user1.Email,
+			Password: "Seven-Purple-Tulips-Dance-Slowly-9",
+		}
+		t.Run("Passphrase longer than 20 characters", func(t *testing.T) {
+			test.UpdateUserPasswordHelper(authAPI, t, auth.PutPasswordBodyParams{Password: passphrase.Password}, http.StatusOK, response.StatusSuccess, accessToken)
+			test.AuthenticateUserHelper(authAPI, t, passphrase, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		})
+
+		t.Run("Reset user 1 after passphrase", func(t *testing.T) {
+			test.UpdateUserPasswordHelper(authAPI, t, auth.PutPasswordBodyParams{Password: user1.Password}, http.StatusOK, response.StatusSuccess, accessToken)
+			test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		})
 	})
 }
 
@@ -202,12 +279,39 @@ func TestRefreshTokenHandler(t *testing.T) {
 			test.RefreshTokenHelper(authAPI, t, body, accessToken, http.StatusBadRequest, response.StatusFail)
 		})
 
+		t.Run("Refresh token of another user", func(t *testing.T) {
+			var id, access, refresh string
+			test.AuthenticateUserHelper(authAPI, t, user2Auth, http.StatusOK, response.StatusSuccess, &id, &access, &refresh)
+
+			test.RefreshTokenHelper(authAPI, t, auth.RefreshTokenBodyParams{RefreshToken: refresh}, expiredAccessToken(t), http.StatusUnauthorized, response.StatusFail)
+		})
+
 		t.Run("Valid refresh token, Expired access token", func(t *testing.T) {
-			test.RefreshTokenHelper(authAPI, t, body, expiredAccessToken, http.StatusOK, response.StatusSuccess)
+			test.RefreshTokenHelper(authAPI, t, body, expiredAccessToken(t), http.StatusOK, response.StatusSuccess)
+		})
+
+		t.Run("Reused refresh token signs out every session", func(t *testing.T) {
+			test.RefreshTokenHelper(authAPI, t, body, expiredAccessToken(t), http.StatusUnauthorized, response.StatusFail)
+
+			req, _ := http.NewRequest(http.MethodGet, "/users/{user_id}", nil)
+			req.SetPathValue("user_id", user1ID)
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+			res := httptest.NewRecorder()
+			router.Authenticated(repositories.Users, userAPI.Get)(res, req)
+			test.GenericAssert(t, http.StatusUnauthorized, response.StatusFail, res)
+
+			test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		})
+
+		t.Run("Refresh token is revoked on sign out", func(t *testing.T) {
+			test.LogoutHelper(authAPI, t, auth.RefreshTokenBodyParams{RefreshToken: refreshToken}, http.StatusOK, response.StatusSuccess)
+			test.RefreshTokenHelper(authAPI, t, auth.RefreshTokenBodyParams{RefreshToken: refreshToken}, expiredAccessToken(t), http.StatusUnauthorized, response.StatusFail)
+
+			test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
 		})
 
 		t.Run("JWT user does not exist", func(t *testing.T) {
-			test.RefreshTokenHelper(authAPI, t, body, deletedUserAccessToken, http.StatusBadRequest, response.StatusFail)
+			test.RefreshTokenHelper(authAPI, t, auth.RefreshTokenBodyParams{RefreshToken: deletedUserRefresh}, deletedUserAccessToken, http.StatusBadRequest, response.StatusFail)
 		})
 
 		body.RefreshToken = "not_a_refresh_token"
@@ -221,7 +325,7 @@ func TestRefreshTokenHandler(t *testing.T) {
 		})
 
 		t.Run("Expired refresh token, Expired access token", func(t *testing.T) {
-			test.RefreshTokenHelper(authAPI, t, body, expiredAccessToken, http.StatusUnauthorized, response.StatusFail)
+			test.RefreshTokenHelper(authAPI, t, body, expiredAccessToken(t), http.StatusUnauthorized, response.StatusFail)
 		})
 
 		t.Run("JWT is invalid", func(t *testing.T) {
@@ -229,11 +333,542 @@ func TestRefreshTokenHandler(t *testing.T) {
 		})
 
 		t.Run("JWT is expired", func(t *testing.T) {
-			test.RefreshTokenHelper(authAPI, t, body, expiredAccessToken, http.StatusUnauthorized, response.StatusFail)
+			test.RefreshTokenHelper(authAPI, t, body, expiredAccessToken(t), http.StatusUnauthorized, response.StatusFail)
 		})
 	})
 }
 
+func TestVerifyEmailHandler(t *testing.T) {
+	t.Run("Verify Email", func(t *testing.T) {
+		userIDUUID, _ := uuid.Parse(user1ID)
+
+		verificationToken, _ := authUtil.NewEmailVerificationToken(userIDUUID, user1.Email)
+		body := auth.VerifyEmailBodyParams{
+			Token: verificationToken,
+		}
+		t.Run("Verify user 1 email", func(t *testing.T) {
+			test.VerifyEmailHelper(authAPI, t, body, http.StatusOK, response.StatusSuccess, user1.Email)
+		})
+
+		verificationToken, _ = authUtil.NewEmailVerificationToken(userIDUUID, faker.Email())
+		body.Token = verificationToken
+		t.Run("Email is not current or pending", func(t *testing.T) {
+			test.VerifyEmailHelper(authAPI, t, body, http.StatusBadRequest, response.StatusFail, user1.Email)
+		})
+
+		body.Token = accessToken
+		t.Run("Access token is not a verification token", func(t *testing.T) {
+			test.VerifyEmailHelper(authAPI, t, body, http.StatusBadRequest, response.StatusFail, user1.Email)
+		})
+
+		body.Token = "not_a_token"
+		t.Run("Token is invalid", func(t *testing.T) {
+			test.VerifyEmailHelper(authAPI, t, body, http.StatusBadRequest, response.StatusFail, user1.Email)
+		})
+	})
+}
+
+func TestMagicLinkHandler(t *testing.T) {
+	newUser := auth.MagicLinkBodyParams{
+		Email: faker.Email(),
+		Name:  faker.Name(),
+	}
+
+	t.Run("Send magic link to new email", func(t *testing.T) {
+		test.SendMagicLinkHelper(authAPI, t, newUser, http.StatusOK, response.StatusSuccess)
+	})
+
+	token := test.MagicLinkToken(t, mailer, newUser.Email)
+
+	t.Run("Links are not resent too soon", func(t *testing.T) {
+		test.SendMagicLinkHelper(authAPI, t, newUser, http.StatusOK, response.StatusSuccess)
+		assert.Equal(t, token, test.MagicLinkToken(t, mailer, newUser.Email))
+	})
+
+	t.Run("Consume magic link creates user without password", func(t *testing.T) {
+		test.ConsumeMagicLinkHelper(authAPI, t, auth.ConsumeMagicLinkBodyParams{Token: token}, http.StatusOK, response.StatusSuccess, newUser.Email, false)
+	})
+
+	t.Run("Magic link is single use", func(t *testing.T) {
+		test.ConsumeMagicLinkHelper(authAPI, t, auth.ConsumeMagicLinkBodyParams{Token: token}, http.StatusBadRequest, response.StatusFail, newUser.Email, false)
+	})
+
+	t.Run("User without password can't sign in with a password", func(t *testing.T) {
+		var id, access, refresh string
+		test.AuthenticateUserHelper(authAPI, t, auth.AuthenticateBodyParams{Email: newUser.Email, Password: "UPlow1234!@#"}, http.StatusUnauthorized, response.StatusFail, &id, &access, &refresh)
+	})
+
+	t.Run("Send magic link to existing user", func(t *testing.T) {
+		test.SendMagicLinkHelper(authAPI, t, auth.MagicLinkBodyParams{Email: user1.Email}, http.StatusOK, response.StatusSuccess)
+	})
+
+	t.Run("Consume magic link of existing user", func(t *testing.T) {
+		body := auth.ConsumeMagicLinkBodyParams{Token: test.MagicLinkToken(t, mailer, user1.Email)}
+		test.ConsumeMagicLinkHelper(authAPI, t, body, http.StatusOK, response.StatusSuccess, user1.Email, true)
+	})
+
+	t.Run("Magic link of unverified account with a password is refused", func(t *testing.T) {
+		test.SendMagicLinkHelper(authAPI, t, auth.MagicLinkBodyParams{Email: user2.Email}, http.StatusOK, response.StatusSuccess)
+
+		body := auth.ConsumeMagicLinkBodyParams{Token: test.MagicLinkToken(t, mailer, user2.Email)}
+		test.ConsumeMagicLinkHelper(authAPI, t, body, http.StatusBadRequest, response.StatusFail, user2.Email, true)
+
+		unverifiedUser, err := repositories.Users.GetByEmail(context.Background(), user2.Email)
+		assert.NoError(t, err)
+		assert.False(t, unverifiedUser.EmailVerified, "Email should stay unverified")
+		assert.NotNil(t, unverifiedUser.Password, "Password should be kept for the owner of the account")
+	})
+
+	t.Run("Token is invalid", func(t *testing.T) {
+		test.ConsumeMagicLinkHelper(authAPI, t, auth.ConsumeMagicLinkBodyParams{Token: "not_a_token"}, http.StatusBadRequest, response.StatusFail, user1.Email, true)
+	})
+
+	t.Run("Email is invalid", func(t *testing.T) {
+		test.SendMagicLinkHelper(authAPI, t, auth.MagicLinkBodyParams{Email: "not_an_email"}, http.StatusBadRequest, response.StatusFail)
+	})
+}
+
+func TestMFAHandler(t *testing.T) {
+	var secret string
+	var mfaToken string
+	var recoveryCodes []string
+
+	t.Run("Authenticate User 2", func(t *testing.T) {
+		test.AuthenticateUserHelper(authAPI, t, user2Auth, http.StatusOK, response.StatusSuccess, &user2ID, &accessToken, &refreshToken)
+	})
+
+	t.Run("Enroll TOTP", func(t *testing.T) {
+		test.EnrollTOTPHelper(authAPI, t, http.StatusOK, response.StatusSuccess, accessToken, &secret)
+	})
+
+	body := auth.TOTPCodeBodyParams{
+		Code: "000000",
+	}
+	t.Run("TOTP code is wrong", func(t *testing.T) {
+		test.ConfirmTOTPHelper(authAPI, t, body, http.StatusUnauthorized, response.StatusFail, accessToken, &recoveryCodes)
+	})
+
+	t.Run("Confirm TOTP", func(t *testing.T) {
+		body.Code, _ = authUtil.TOTPCode(secret, authUtil.TOTPStep(time.Now()))
+		test.ConfirmTOTPHelper(authAPI, t, body, http.StatusOK, response.StatusSuccess, accessToken, &recoveryCodes)
+	})
+
+	t.Run("Login requires MFA", func(t *testing.T) {
+		test.AuthenticateMFAChallengeHelper(authAPI, t, user2Auth, &mfaToken)
+	})
+
+	t.Run("Verify with recovery code", func(t *testing.T) {
+		test.VerifyMFAHelper(authAPI, t, auth.VerifyMFABodyParams{MFAToken: mfaToken, RecoveryCode: recoveryCodes[0]}, http.StatusOK, response.StatusSuccess)
+	})
+
+	t.Run("MFA token can only be used once", func(t *testing.T) {
+		test.VerifyMFAHelper(authAPI, t, auth.VerifyMFABodyParams{MFAToken: mfaToken, RecoveryCode: recoveryCodes[1]}, http.StatusUnauthorized, response.StatusFail)
+	})
+
+	t.Run("Login requires MFA again", func(t *testing.T) {
+		test.AuthenticateMFAChallengeHelper(authAPI, t, user2Auth, &mfaToken)
+	})
+
+	t.Run("Recovery code is already used", func(t *testing.T) {
+		test.VerifyMFAHelper(authAPI, t, auth.VerifyMFABodyParams{MFAToken: mfaToken, RecoveryCode: recoveryCodes[0]}, http.StatusUnauthorized, response.StatusFail)
+	})
+
+	t.Run("TOTP code is already used", func(t *testing.T) {
+		test.VerifyMFAHelper(authAPI, t, auth.VerifyMFABodyParams{MFAToken: mfaToken, Code: body.Code}, http.StatusUnauthorized, response.StatusFail)
+	})
+
+	t.Run("TOTP code is wrong", func(t *testing.T) {
+		test.VerifyMFAHelper(authAPI, t, auth.VerifyMFABodyParams{MFAToken: mfaToken, Code: "000000"}, http.StatusUnauthorized, response.StatusFail)
+	})
+
+	t.Run("Wrong codes count towards the lockout", func(t *testing.T) {
+		test.VerifyMFAHelper(authAPI, t, auth.VerifyMFABodyParams{MFAToken: mfaToken, RecoveryCode: recoveryCodes[1]}, http.StatusTooManyRequests, response.StatusFail)
+	})
+
+	t.Run("Verify after the lockout is cleared", func(t *testing.T) {
+		_, err := lockout.New(repositories.LoginAttempts, lockout.DefaultPolicy).Unlock(context.Background(), lockout.ScopeAccount, user2.Email)
+		assert.NoError(t, err)
+
+		test.VerifyMFAHelper(authAPI, t, auth.VerifyMFABodyParams{MFAToken: mfaToken, RecoveryCode: recoveryCodes[1]}, http.StatusOK, response.StatusSuccess)
+	})
+
+	t.Run("MFA token is invalid", func(t *testing.T) {
+		test.VerifyMFAHelper(authAPI, t, auth.VerifyMFABodyParams{MFAToken: accessToken, RecoveryCode: recoveryCodes[1]}, http.StatusUnauthorized, response.StatusFail)
+	})
+
+	t.Run("TOTP code can't be replayed to disable MFA", func(t *testing.T) {
+		test.DisableTOTPHelper(authAPI, t, body, http.StatusUnauthorized, response.StatusFail, accessToken)
+	})
+
+	t.Run("Wrong codes to disable MFA count towards the lockout", func(t *testing.T) {
+		test.DisableTOTPHelper(authAPI, t, auth.TOTPCodeBodyParams{Code: "000000"}, http.StatusUnauthorized, response.StatusFail, accessToken)
+		test.DisableTOTPHelper(authAPI, t, auth.TOTPCodeBodyParams{Code: "000000"}, http.StatusUnauthorized, response.StatusFail, accessToken)
+
+		body.Code, _ = authUtil.TOTPCode(secret, authUtil.TOTPStep(time.Now())+1)
+		test.DisableTOTPHelper(authAPI, t, body, http.StatusTooManyRequests, response.StatusFail, accessToken)
+	})
+
+	t.Run("Disable TOTP", func(t *testing.T) {
+		_, err := lockout.New(repositories.LoginAttempts, lockout.DefaultPolicy).Unlock(context.Background(), lockout.ScopeAccount, user2.Email)
+		assert.NoError(t, err)
+
+		test.DisableTOTPHelper(authAPI, t, body, http.StatusOK, response.StatusSuccess, accessToken)
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	unlock := router.Permitted(repositories.Users, authUtil.PermissionUsersDisable, authAPI.Unlock)
+
+	admin := user.PostBodyParams{Name: faker.Name(), Email: faker.Email(), Password: user1.Password}
+	var adminID, adminAccessToken, userID, userAccessToken string
+	t.Run("Create admin", func(t *testing.T) {
+		test.CreateUserHelper(userAPI, t, admin, http.StatusOK, response.StatusSuccess)
+
+		created, err := repositories.Users.GetByEmail(context.Background(), admin.Email)
+		assert.NoError(t, err)
+		assert.NoError(t, repositories.Users.SetRole(context.Background(), created.ID, authUtil.RoleAdmin))
+
+		test.AuthenticateMemoryUserHelper(repositories, t, admin.Email, &adminID, &adminAccessToken)
+		test.AuthenticateMemoryUserHelper(repositories, t, user1.Email, &userID, &userAccessToken)
+	})
+
+	body := auth.AuthenticateBodyParams{
+		Email:    user2.Email,
+		Password: user1.Password,
+	}
+	for i := 0; i < 3; i++ {
+		t.Run("Wrong credentials", func(t *testing.T) {
+			test.AuthenticateUserHelper(authAPI, t, body, http.StatusUnauthorized, response.StatusFail, &user2ID, &accessToken, &refreshToken)
+		})
+	}
+
+	t.Run("Attempt is delayed", func(t *testing.T) {
+		test.AuthenticateUserHelper(authAPI, t, user2Auth, http.StatusTooManyRequests, response.StatusFail, &user2ID, &accessToken, &refreshToken)
+	})
+
+	unlockBody := auth.UnlockBodyParams{
+		Scope:      "account",
+		Identifier: user2.Email,
+	}
+	t.Run("Regular user is forbidden", func(t *testing.T) {
+		test.UnlockHelper(unlock, t, unlockBody, http.StatusForbidden, response.StatusFail, userAccessToken)
+	})
+
+	t.Run("Unlock user 2", func(t *testing.T) {
+		test.UnlockHelper(unlock, t, unlockBody, http.StatusOK, response.StatusSuccess, adminAccessToken)
+	})
+
+	t.Run("Nothing to unlock", func(t *testing.T) {
+		test.UnlockHelper(unlock, t, unlockBody, http.StatusBadRequest, response.StatusFail, adminAccessToken)
+	})
+
+	t.Run("Admin can't unlock another admin", func(t *testing.T) {
+		adminBody := auth.AuthenticateBodyParams{Email: admin.Email, Password: user2.Password}
+		var id, access, refresh string
+		test.AuthenticateUserHelper(authAPI, t, adminBody, http.StatusUnauthorized, response.StatusFail, &id, &access, &refresh)
+
+		test.UnlockHelper(unlock, t, auth.UnlockBodyParams{Scope: "account", Identifier: admin.Email}, http.StatusForbidden, response.StatusFail, adminAccessToken)
+		test.UnlockHelper(unlock, t, auth.UnlockBodyParams{Scope: "account", Identifier: strings.ToUpper(admin.Email)}, http.StatusForbidden, response.StatusFail, adminAccessToken)
+	})
+
+	t.Run("Authenticate User 2", func(t *testing.T) {
+		test.AuthenticateUserHelper(authAPI, t, user2Auth, http.StatusOK, response.StatusSuccess, &user2ID, &accessToken, &refreshToken)
+	})
+}
+
+func TestOIDCHandler(t *testing.T) {
+	server := test.NewMockOIDCServer("koano")
+	defer server.Close()
+
+	cfg := test.NewConfig()
+	cfg.OIDC = []oidc.Config{{
+		Name:        "mock",
+		Issuer:      server.URL,
+		ClientID:    server.ClientID,
+		RedirectURL: "http://localhost:3000/auth/callback/mock",
+		Scopes:      []string{"openid", "email", "profile"},
+	}}
+
+	l := logger.New()
+	oidcAuthAPI := auth.New(repositories, validator.New(), l, mail.NewLogMailer(l), cfg)
+
+	authorize := func(t *testing.T, email string, emailVerified bool) (auth.OIDCCallbackBodyParams, string) {
+		server.Claims = jwt.MapClaims{
+			"sub":            faker.UUIDDigit(),
+			"email":          email,
+			"email_verified": emailVerified,
+			"name":           faker.Name(),
+		}
+
+		var authorizationURL, stateCookie string
+		test.OIDCAuthorizeHelper(oidcAuthAPI, t, "mock", http.StatusOK, response.StatusSuccess, &authorizationURL, &stateCookie)
+
+		code, state, err := server.Authorize(authorizationURL)
+		assert.NoError(t, err)
+
+		return auth.OIDCCallbackBodyParams{Code: code, State: state}, stateCookie
+	}
+
+	login := func(t *testing.T, email string, emailVerified bool, want_code int, want_status string) {
+		body, stateCookie := authorize(t, email, emailVerified)
+		test.OIDCCallbackHelper(oidcAuthAPI, t, "mock", body, stateCookie, want_code, want_status, email)
+
+		t.Run("State is single use", func(t *testing.T) {
+			test.OIDCCallbackHelper(oidcAuthAPI, t, "mock", body, stateCookie, http.StatusBadRequest, response.StatusFail, email)
+		})
+	}
+
+	t.Run("Link existing user by verified email", func(t *testing.T) {
+		login(t, user1.Email, true, http.StatusOK, response.StatusSuccess)
+	})
+
+	t.Run("Email unverified by the provider is not linked", func(t *testing.T) {
+		login(t, user1.Email, false, http.StatusBadRequest, response.StatusFail)
+	})
+
+	t.Run("Email unverified by the account is not linked", func(t *testing.T) {
+		login(t, user2.Email, true, http.StatusBadRequest, response.StatusFail)
+	})
+
+	t.Run("Create new user", func(t *testing.T) {
+		login(t, faker.Email(), true, http.StatusOK, response.StatusSuccess)
+	})
+
+	t.Run("State cookie is missing", func(t *testing.T) {
+		email := faker.Email()
+		body, stateCookie := authorize(t, email, true)
+		test.OIDCCallbackHelper(oidcAuthAPI, t, "mock", body, "", http.StatusBadRequest, response.StatusFail, email)
+
+		t.Run("State is kept for the browser which started the login", func(t *testing.T) {
+			test.OIDCCallbackHelper(oidcAuthAPI, t, "mock", body, stateCookie, http.StatusOK, response.StatusSuccess, email)
+		})
+	})
+
+	t.Run("State cookie is of another login", func(t *testing.T) {
+		email := faker.Email()
+		body, _ := authorize(t, email, true)
+		_, otherStateCookie := authorize(t, email, true)
+		test.OIDCCallbackHelper(oidcAuthAPI, t, "mock", body, otherStateCookie, http.StatusBadRequest, response.StatusFail, email)
+	})
+
+	t.Run("Provider is not configured", func(t *testing.T) {
+		var authorizationURL, stateCookie string
+		test.OIDCAuthorizeHelper(oidcAuthAPI, t, "unknown", http.StatusBadRequest, response.StatusFail, &authorizationURL, &stateCookie)
+	})
+}
+
+func TestPasskeyHandler(t *testing.T) {
+	l := logger.New()
+	passkeyAuthAPI := auth.New(repositories, validator.New(), l, mail.NewLogMailer(l), test.NewConfig())
+
+	authenticator := test.NewSoftwareAuthenticator("http://localhost:3000")
+
+	var userID, userAccessToken, userRefreshToken, passkeyID string
+	t.Run("Authenticate User 1", func(t *testing.T) {
+		test.AuthenticateUserHelper(passkeyAuthAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &userID, &userAccessToken, &userRefreshToken)
+	})
+
+	var creationOptions webauthn.CreationOptions
+	t.Run("Registration takes a recent sign in", func(t *testing.T) {
+		user, err := repositories.Users.GetByID(context.Background(), uuid.MustParse(userID))
+		assert.NoError(t, err)
+
+		staleAccessToken, _, _, err := authUtil.NewAccessToken(user.ID, user.Name, user.Email, user.Role, user.TokenVersion, time.Now().Add(-time.Hour))
+		assert.NoError(t, err)
+
+		test.PasskeyRegistrationOptionsHelper(passkeyAuthAPI, t, auth.PasskeyRegistrationOptionsBodyParams{}, http.StatusForbidden, response.StatusFail, staleAccessToken, &creationOptions)
+
+		t.Run("TOTP code doesn't stand in without MFA", func(t *testing.T) {
+			test.PasskeyRegistrationOptionsHelper(passkeyAuthAPI, t, auth.PasskeyRegistrationOptionsBodyParams{Code: "123456"}, http.StatusForbidden, response.StatusFail, staleAccessToken, &creationOptions)
+		})
+	})
+
+	t.Run("Get registration options", func(t *testing.T) {
+		test.PasskeyRegistrationOptionsHelper(passkeyAuthAPI, t, auth.PasskeyRegistrationOptionsBodyParams{}, http.StatusOK, response.StatusSuccess, userAccessToken, &creationOptions)
+	})
+
+	registerBody := auth.RegisterPasskeyBodyParams{
+		Name:       "Laptop",
+		Credential: authenticator.Create(creationOptions),
+	}
+	t.Run("Register passkey", func(t *testing.T) {
+		test.RegisterPasskeyHelper(passkeyAuthAPI, t, registerBody, http.StatusOK, response.StatusSuccess, userAccessToken, &passkeyID)
+	})
+
+	t.Run("Registration challenge is single use", func(t *testing.T) {
+		test.RegisterPasskeyHelper(passkeyAuthAPI, t, registerBody, http.StatusBadRequest, response.StatusFail, userAccessToken, &passkeyID)
+	})
+
+	t.Run("Get passkeys", func(t *testing.T) {
+		test.GetPasskeysHelper(passkeyAuthAPI, t, http.StatusOK, response.StatusSuccess, 1, userAccessToken)
+	})
+
+	login := func(t *testing.T, authenticator *test.SoftwareAuthenticator) auth.PasskeyLoginBodyParams {
+		var requestOptions webauthn.RequestOptions
+		test.PasskeyLoginOptionsHelper(passkeyAuthAPI, t, &requestOptions)
+
+		return auth.PasskeyLoginBodyParams{Credential: authenticator.Get(requestOptions)}
+	}
+
+	t.Run("Login with passkey", func(t *testing.T) {
+		body := login(t, authenticator)
+		test.PasskeyLoginHelper(passkeyAuthAPI, t, body, http.StatusOK, response.StatusSuccess, user1.Email)
+
+		t.Run("Login challenge is single use", func(t *testing.T) {
+			test.PasskeyLoginHelper(passkeyAuthAPI, t, body, http.StatusBadRequest, response.StatusFail, user1.Email)
+		})
+	})
+
+	t.Run("Sign count did not increase", func(t *testing.T) {
+		authenticator.SignCount = 0
+		test.PasskeyLoginHelper(passkeyAuthAPI, t, login(t, authenticator), http.StatusUnauthorized, response.StatusFail, user1.Email)
+	})
+
+	t.Run("Passkey is not registered", func(t *testing.T) {
+		test.PasskeyLoginHelper(passkeyAuthAPI, t, login(t, test.NewSoftwareAuthenticator("http://localhost:3000")), http.StatusUnauthorized, response.StatusFail, user1.Email)
+	})
+
+	t.Run("Origin is not allowed", func(t *testing.T) {
+		authenticator.Origin = "http://evil.example.com"
+		defer func() { authenticator.Origin = "http://localhost:3000" }()
+
+		test.PasskeyLoginHelper(passkeyAuthAPI, t, login(t, authenticator), http.StatusUnauthorized, response.StatusFail, user1.Email)
+	})
+
+	t.Run("Delete passkey", func(t *testing.T) {
+		test.DeletePasskeyHelper(passkeyAuthAPI, t, http.StatusOK, response.StatusSuccess, passkeyID, userAccessToken)
+	})
+
+	t.Run("Passkey does not exist", func(t *testing.T) {
+		test.DeletePasskeyHelper(passkeyAuthAPI, t, http.StatusBadRequest, response.StatusFail, passkeyID, userAccessToken)
+	})
+
+	t.Run("Deleted passkey can't login", func(t *testing.T) {
+		test.PasskeyLoginHelper(passkeyAuthAPI, t, login(t, authenticator), http.StatusUnauthorized, response.StatusFail, user1.Email)
+	})
+}
+
+func TestRestoreHandler(t *testing.T) {
+	user3 := user.PostBodyParams{
+		Name:     faker.Name(),
+		Email:    faker.Email(),
+		Password: "UPlow1234!@#",
+	}
+	user3Auth := auth.AuthenticateBodyParams{Email: user3.Email, Password: user3.Password}
+
+	var user3ID, user3AccessToken, user3RefreshToken, restoreToken string
+
+	t.Run("Create and delete user", func(t *testing.T) {
+		test.CreateUserHelper(userAPI, t, user3, http.StatusOK, response.StatusSuccess)
+		test.AuthenticateUserHelper(authAPI, t, user3Auth, http.StatusOK, response.StatusSuccess, &user3ID, &user3AccessToken, &user3RefreshToken)
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user3ID, user3AccessToken)
+	})
+
+	t.Run("Deleted user is not offered a restore with a wrong password", func(t *testing.T) {
+		var id, access, refresh string
+		test.AuthenticateUserHelper(authAPI, t, auth.AuthenticateBodyParams{Email: user3.Email, Password: "lowUP1234!@#"}, http.StatusUnauthorized, response.StatusFail, &id, &access, &refresh)
+	})
+
+	t.Run("Login offers a restore", func(t *testing.T) {
+		test.AuthenticateRestoreChallengeHelper(authAPI, t, user3Auth, &restoreToken)
+	})
+
+	t.Run("Restore account", func(t *testing.T) {
+		test.RestoreAccountHelper(authAPI, t, auth.RestoreAccountBodyParams{Token: restoreToken}, http.StatusOK, response.StatusSuccess, user3.Email)
+	})
+
+	t.Run("Restored user can authenticate", func(t *testing.T) {
+		test.AuthenticateUserHelper(authAPI, t, user3Auth, http.StatusOK, response.StatusSuccess, &user3ID, &user3AccessToken, &user3RefreshToken)
+	})
+
+	t.Run("Restore token is single use", func(t *testing.T) {
+		test.RestoreAccountHelper(authAPI, t, auth.RestoreAccountBodyParams{Token: restoreToken}, http.StatusBadRequest, response.StatusFail, user3.Email)
+	})
+
+	t.Run("Restore token of an earlier deletion is rejected", func(t *testing.T) {
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user3ID, user3AccessToken)
+		test.RestoreAccountHelper(authAPI, t, auth.RestoreAccountBodyParams{Token: restoreToken}, http.StatusBadRequest, response.StatusFail, user3.Email)
+	})
+
+	t.Run("Restore account with an emailed link", func(t *testing.T) {
+		test.SendRestoreLinkHelper(authAPI, t, auth.RestoreLinkBodyParams{Email: user3.Email}, http.StatusOK, response.StatusSuccess)
+
+		body := auth.RestoreAccountBodyParams{Token: test.RestoreLinkToken(t, mailer, user3.Email)}
+		test.RestoreAccountHelper(authAPI, t, body, http.StatusOK, response.StatusSuccess, user3.Email)
+	})
+
+	t.Run("Restore link is not sent for an active account", func(t *testing.T) {
+		email := faker.Email()
+		test.SendRestoreLinkHelper(authAPI, t, auth.RestoreLinkBodyParams{Email: email}, http.StatusOK, response.StatusSuccess)
+
+		_, sent := mailer.Last(email)
+		assert.False(t, sent, "No mail should be sent without a restorable account")
+	})
+
+	t.Run("Account can not be restored after the grace period", func(t *testing.T) {
+		test.AuthenticateUserHelper(authAPI, t, user3Auth, http.StatusOK, response.StatusSuccess, &user3ID, &user3AccessToken, &user3RefreshToken)
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user3ID, user3AccessToken)
+		test.AuthenticateRestoreChallengeHelper(authAPI, t, user3Auth, &restoreToken)
+
+		repositories.Users.(*store.MemoryUserRepository).Edit(uuid.MustParse(user3ID), func(user *models.User) {
+			deletedAt := time.Now().Add(-test.NewConfig().AccountRestorePeriod - time.Hour)
+			user.DeletedAt = &deletedAt
+		})
+
+		var id, access, refresh string
+		test.AuthenticateUserHelper(authAPI, t, user3Auth, http.StatusUnauthorized, response.StatusFail, &id, &access, &refresh)
+		test.RestoreAccountHelper(authAPI, t, auth.RestoreAccountBodyParams{Token: restoreToken}, http.StatusBadRequest, response.StatusFail, user3.Email)
+	})
+
+	t.Run("Purge frees the email", func(t *testing.T) {
+		count, err := userUtil.PurgeDeletedUsers(context.Background(), repositories, test.NewConfig().AccountRestorePeriod)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, count, int64(1))
+
+		test.CreateUserHelper(userAPI, t, user3, http.StatusOK, response.StatusSuccess)
+		test.AuthenticateUserHelper(authAPI, t, user3Auth, http.StatusOK, response.StatusSuccess, &user3ID, &user3AccessToken, &user3RefreshToken)
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user3ID, user3AccessToken)
+	})
+
+	t.Run("Token is invalid", func(t *testing.T) {
+		test.RestoreAccountHelper(authAPI, t, auth.RestoreAccountBodyParams{Token: "not_a_token"}, http.StatusBadRequest, response.StatusFail, user3.Email)
+	})
+
+	user4 := user.PostBodyParams{
+		Name:     faker.Name(),
+		Email:    faker.Email(),
+		Password: "UPlow1234!@#",
+	}
+	user4Auth := auth.AuthenticateBodyParams{Email: user4.Email, Password: user4.Password}
+
+	var user4ID, user4AccessToken, user4RefreshToken, secret string
+	var recoveryCodes []string
+
+	t.Run("Create and delete user with MFA", func(t *testing.T) {
+		test.CreateUserHelper(userAPI, t, user4, http.StatusOK, response.StatusSuccess)
+		test.AuthenticateUserHelper(authAPI, t, user4Auth, http.StatusOK, response.StatusSuccess, &user4ID, &user4AccessToken, &user4RefreshToken)
+		test.EnrollTOTPHelper(authAPI, t, http.StatusOK, response.StatusSuccess, user4AccessToken, &secret)
+
+		code, _ := authUtil.TOTPCode(secret, authUtil.TOTPStep(time.Now()))
+		test.ConfirmTOTPHelper(authAPI, t, auth.TOTPCodeBodyParams{Code: code}, http.StatusOK, response.StatusSuccess, user4AccessToken, &recoveryCodes)
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user4ID, user4AccessToken)
+		test.AuthenticateRestoreChallengeHelper(authAPI, t, user4Auth, &restoreToken)
+	})
+
+	t.Run("Account with MFA is not restored without a code", func(t *testing.T) {
+		test.RestoreAccountHelper(authAPI, t, auth.RestoreAccountBodyParams{Token: restoreToken}, http.StatusUnauthorized, response.StatusFail, user4.Email)
+		test.RestoreAccountHelper(authAPI, t, auth.RestoreAccountBodyParams{Token: restoreToken, RecoveryCode: "aaaaa-aaaaa"}, http.StatusUnauthorized, response.StatusFail, user4.Email)
+
+		// The account is still deleted, so the login offers a restore again
+		test.AuthenticateRestoreChallengeHelper(authAPI, t, user4Auth, &restoreToken)
+	})
+
+	t.Run("Restore account with MFA", func(t *testing.T) {
+		body := auth.RestoreAccountBodyParams{Token: restoreToken, RecoveryCode: recoveryCodes[0]}
+		test.RestoreAccountHelper(authAPI, t, body, http.StatusOK, response.StatusSuccess, user4.Email)
+	})
+}
+
 func TestCleanUp(t *testing.T) {
 	t.Run("Authenticates User 1", func(t *testing.T) {
 		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
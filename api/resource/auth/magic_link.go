@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/user"
+)
+
+// @Summary		Send Magic Link
+// @Description	Email a single use sign in link. An account without a password is created when the link is used for an email which isn't registered. The response is the same whether or not the email is registered
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		MagicLinkBodyParams	true	"MagicLinkBodyParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/auth/magic-link [post]
+func (api *API) SendMagicLink(w http.ResponseWriter, r *http.Request) {
+	var body MagicLinkBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	now := time.Now()
+
+	// Repeated requests are answered the same way without sending more mail, so the endpoint can't be used to flood an inbox
+	recentlySent, err := api.store.MagicLinks.SentSince(r.Context(), body.Email, now.Add(-auth.MagicLinkInterval))
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if recentlySent {
+		api.log.Info.PrintfContext(r.Context(), "Magic link for %s has been requested again too soon", body.Email)
+		response.HTTPResponse(w, "Sign in link has been sent")
+		return
+	}
+
+	token, err := auth.NewMagicLinkToken()
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	var name *string
+	if body.Name != "" {
+		name = &body.Name
+	}
+
+	err = api.store.MagicLinks.Create(r.Context(), models.MagicLink{
+		TokenHash: auth.HashMagicLinkToken(token),
+		Email:     body.Email,
+		Name:      name,
+		ExpiresAt: now.Add(auth.MagicLinkLifetime),
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if err := user.SendMagicLink(api.appURL, body.Email, token, api.mailer); err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Magic link has been sent to %s", body.Email)
+
+	response.HTTPResponse(w, "Sign in link has been sent")
+}
+
+// @Summary		Consume Magic Link
+// @Description	Sign in with the token of a magic link. The link can only be used once. Accounts with a password which have not verified their email are refused. Users with MFA enabled receive an MFAChallengeResponse to complete with /auth/mfa/verify instead of the token pair
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		ConsumeMagicLinkBodyParams	true	"ConsumeMagicLinkBodyParams"
+// @Success		200		{object}	response.Response{data=AuthenticateResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/auth/magic-link/consume [post]
+func (api *API) ConsumeMagicLink(w http.ResponseWriter, r *http.Request) {
+	var body ConsumeMagicLinkBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	link, err := api.store.MagicLinks.Consume(r.Context(), auth.HashMagicLinkToken(body.Token))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Sign in link is invalid or has expired"))
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	user := api.getMagicLinkUser(w, r, link)
+	if user == nil {
+		return
+	}
+
+	api.completeLogin(w, r, user, "magic_link")
+}
+
+// getMagicLinkUser returns the user of the email, creating one without a password if there is none. Opening the link proves the user owns the email so it is marked as verified.
+// Unverified accounts with a password are refused, the password may belong to whoever registered the address before its owner.
+func (api *API) getMagicLinkUser(w http.ResponseWriter, r *http.Request, link *models.MagicLink) *models.User {
+	magicLinkUser, err := api.store.Users.GetByEmail(r.Context(), link.Email)
+	if err == nil {
+		if magicLinkUser.EmailVerified {
+			return magicLinkUser
+		}
+
+		if magicLinkUser.Password != nil {
+			response.GenericBadRequestError(w, fmt.Errorf("Email address %s is registered to an account which has not verified it, verify the email to sign in with a link", link.Email))
+			return nil
+		}
+
+		magicLinkUser, err = api.store.Users.VerifyEmail(r.Context(), magicLinkUser.ID, magicLinkUser.Email)
+		if err != nil {
+			response.GenericServerError(w, err)
+			return nil
+		}
+
+		return magicLinkUser
+	}
+
+	if !errors.Is(err, store.ErrNotFound) {
+		response.GenericServerError(w, err)
+		return nil
+	}
+
+	emailInUse, err := api.store.Users.IsEmailInUse(r.Context(), link.Email, uuid.Nil)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return nil
+	}
+
+	if emailInUse {
+		response.GenericBadRequestError(w, fmt.Errorf("Email already in use"))
+		return nil
+	}
+
+	name := link.Email
+	if link.Name != nil {
+		name = *link.Name
+	}
+
+	magicLinkUser, err = api.store.Users.Create(r.Context(), models.User{ID: uuid.New(), Name: name, Email: link.Email, EmailVerified: true})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return nil
+	}
+
+	created := *magicLinkUser
+	created.Redact()
+
+	store.LogUser(api.store.Audit, api.log, r, magicLinkUser.ID, audit.Record{Action: audit.ActionUserCreate, TargetType: audit.TargetUser, TargetID: &magicLinkUser.ID, After: created})
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has been created through a magic link", magicLinkUser.ID)
+
+	return magicLinkUser
+}
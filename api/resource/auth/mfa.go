@@ -0,0 +1,461 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/lockout"
+	"github.com/ushiradineth/koano-api/util/response"
+)
+
+// Wrong codes an MFA token allows before it stops working
+const maxMFAChallengeFailures = 5
+
+type EnrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// @Summary		Enroll TOTP
+// @Description	Generate a TOTP secret for the authenticated user. MFA is enabled once the secret has been confirmed with a code
+// @Tags			Auth
+// @Produce		json
+// @Success		200	{object}	response.Response{data=EnrollTOTPResponse}
+// @Failure		400	{object}	response.Error
+// @Failure		401	{object}	response.Error
+// @Failure		500	{object}	response.Error
+// @Security		BearerAuth
+// @Router			/auth/mfa/totp [post]
+func (api *API) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	if user.MFAEnabled {
+		response.GenericBadRequestError(w, fmt.Errorf("MFA is already enabled"))
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if err := api.store.Users.SetTOTPSecret(r.Context(), user.ID, secret); err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has started TOTP enrollment", user.ID)
+
+	response.HTTPResponse(w, EnrollTOTPResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(secret, user.Email),
+	})
+}
+
+// @Summary		Confirm TOTP
+// @Description	Confirm the TOTP secret of the authenticated user with a first code, enabling MFA and returning single use recovery codes
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		TOTPCodeBodyParams	true	"TOTPCodeBodyParams"
+// @Success		200		{object}	response.Response{data=RecoveryCodesResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		429		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/auth/mfa/totp/confirm [post]
+func (api *API) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var body TOTPCodeBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	if user.MFAEnabled {
+		response.GenericBadRequestError(w, fmt.Errorf("MFA is already enabled"))
+		return
+	}
+
+	if user.TOTPSecret == nil {
+		response.GenericBadRequestError(w, fmt.Errorf("TOTP enrollment has not been started"))
+		return
+	}
+
+	if !api.useTOTPCode(w, r, user, body.Code) {
+		return
+	}
+
+	recoveryCodes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	err = api.store.Tx(r.Context(), func(tx *store.Store) error {
+		if err := tx.Users.EnableMFA(r.Context(), user.ID); err != nil {
+			return err
+		}
+
+		return tx.RecoveryCodes.Replace(r.Context(), user.ID, hashRecoveryCodes(recoveryCodes))
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionMFAEnable, TargetType: audit.TargetUser, TargetID: &user.ID, After: map[string]any{"mfa_enabled": true}})
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has enabled MFA", user.ID)
+
+	response.HTTPResponse(w, RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+// @Summary		Disable TOTP
+// @Description	Disable MFA for the authenticated user after confirming a current TOTP code. Each code is only accepted once and wrong codes count towards the lockout of the account
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		TOTPCodeBodyParams	true	"TOTPCodeBodyParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		429		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/auth/mfa/totp [delete]
+func (api *API) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var body TOTPCodeBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	if !user.MFAEnabled || user.TOTPSecret == nil {
+		response.GenericBadRequestError(w, fmt.Errorf("MFA is not enabled"))
+		return
+	}
+
+	if !api.useTOTPCode(w, r, user, body.Code) {
+		return
+	}
+
+	err := api.store.Tx(r.Context(), func(tx *store.Store) error {
+		if err := tx.Users.DisableMFA(r.Context(), user.ID); err != nil {
+			return err
+		}
+
+		return tx.RecoveryCodes.Replace(r.Context(), user.ID, nil)
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionMFADisable, TargetType: audit.TargetUser, TargetID: &user.ID, After: map[string]any{"mfa_enabled": false}})
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has disabled MFA", user.ID)
+
+	response.HTTPResponse(w, "MFA has been disabled")
+}
+
+// @Summary		Verify MFA Challenge
+// @Description	Complete a login with the MFA token returned by /auth/login and either a TOTP code or an unused recovery code. Each MFA token can be completed once and stops working after a few wrong codes, which also count towards the lockout of the account
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		VerifyMFABodyParams	true	"VerifyMFABodyParams"
+// @Success		200		{object}	response.Response{data=AuthenticateResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		429		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/auth/mfa/verify [post]
+func (api *API) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var body VerifyMFABodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	challengeClaim := auth.ParseMFAChallengeToken(w, body.MFAToken)
+	if challengeClaim == nil {
+		return
+	}
+
+	challengeID, err := uuid.Parse(challengeClaim.StandardClaims.Id)
+	if err != nil {
+		response.GenericUnauthenticatedError(w)
+		return
+	}
+
+	if _, err := api.store.MFAChallenges.Get(r.Context(), challengeID, challengeClaim.Id, maxMFAChallengeFailures); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.HTTPError(w, http.StatusUnauthorized, "MFA token has expired or has already been used", response.StatusFail)
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	existingUser, err := api.store.Users.GetByID(r.Context(), challengeClaim.Id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericUnauthenticatedError(w)
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if !existingUser.MFAEnabled || existingUser.TOTPSecret == nil {
+		response.GenericBadRequestError(w, fmt.Errorf("MFA is not enabled"))
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords, so the second factor can't be guessed once the password is known
+	reservation, ok := api.checkLockout(w, r, existingUser.Email)
+	if !ok {
+		return
+	}
+	defer api.releaseLockout(r, reservation)
+
+	failure, err := api.checkSecondFactor(r.Context(), existingUser, body)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if failure != "" {
+		api.failMFA(r, challengeID, existingUser, reservation)
+		response.HTTPError(w, http.StatusUnauthorized, failure, response.StatusFail)
+		return
+	}
+
+	// Marking the challenge as used only succeeds once, so two requests racing with valid codes can't both sign in. It comes before the code
+	// is used up so the request losing the race doesn't use up a recovery code.
+	if err := api.store.MFAChallenges.Use(r.Context(), challengeID, existingUser.ID, maxMFAChallengeFailures); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.HTTPError(w, http.StatusUnauthorized, "MFA token has expired or has already been used", response.StatusFail)
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	// Another challenge may have used the same code since it was checked
+	failure, err = api.useSecondFactor(r.Context(), existingUser, body)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if failure != "" {
+		response.HTTPError(w, http.StatusUnauthorized, failure, response.StatusFail)
+		return
+	}
+
+	api.succeedLockout(r, reservation, existingUser.ID)
+
+	api.respondWithTokens(w, r, existingUser, "mfa")
+}
+
+// @Summary		Regenerate Recovery Codes
+// @Description	Replace the recovery codes of the authenticated user after confirming a current TOTP code. Each code is only accepted once and wrong codes count towards the lockout of the account
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		TOTPCodeBodyParams	true	"TOTPCodeBodyParams"
+// @Success		200		{object}	response.Response{data=RecoveryCodesResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		429		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/auth/mfa/recovery-codes [post]
+func (api *API) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var body TOTPCodeBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	if !user.MFAEnabled || user.TOTPSecret == nil {
+		response.GenericBadRequestError(w, fmt.Errorf("MFA is not enabled"))
+		return
+	}
+
+	if !api.useTOTPCode(w, r, user, body.Code) {
+		return
+	}
+
+	recoveryCodes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if err := api.store.RecoveryCodes.Replace(r.Context(), user.ID, hashRecoveryCodes(recoveryCodes)); err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionRecoveryCode, TargetType: audit.TargetUser, TargetID: &user.ID})
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has regenerated their recovery codes", user.ID)
+
+	response.HTTPResponse(w, RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+func hashRecoveryCodes(recoveryCodes []string) []string {
+	hashes := make([]string, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+
+	return hashes
+}
+
+// useTOTPCode checks the TOTP code confirming a change to the account of the authenticated user, using it up if it is valid. Like those of a
+// login, wrong codes count towards the lockout of the account. False is returned once an error response has been written.
+func (api *API) useTOTPCode(w http.ResponseWriter, r *http.Request, user *models.User, code string) bool {
+	reservation, ok := api.checkLockout(w, r, user.Email)
+	if !ok {
+		return false
+	}
+	defer api.releaseLockout(r, reservation)
+
+	failure, err := api.useSecondFactor(r.Context(), user, VerifyMFABodyParams{Code: code})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return false
+	}
+
+	if failure != "" {
+		api.failSecondFactor(r, user, reservation)
+		response.HTTPError(w, http.StatusUnauthorized, failure, response.StatusFail)
+		return false
+	}
+
+	return true
+}
+
+// checkSecondFactor checks the TOTP code or recovery code of the body without using it up. The reason is returned if it isn't valid.
+func (api *API) checkSecondFactor(ctx context.Context, user *models.User, body VerifyMFABodyParams) (string, error) {
+	if body.Code != "" {
+		step, valid := auth.ValidateTOTPCode(*user.TOTPSecret, body.Code, time.Now())
+		if !valid {
+			return "Invalid TOTP code", nil
+		}
+
+		if step <= user.TOTPLastStep {
+			return "TOTP code has already been used", nil
+		}
+
+		return "", nil
+	}
+
+	if err := api.store.RecoveryCodes.Check(ctx, user.ID, auth.HashRecoveryCode(body.RecoveryCode)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return "Invalid recovery code", nil
+		}
+
+		return "", err
+	}
+
+	return "", nil
+}
+
+// useSecondFactor checks the TOTP code or recovery code of the body, using it up if it is valid. The reason is returned if it isn't.
+func (api *API) useSecondFactor(ctx context.Context, user *models.User, body VerifyMFABodyParams) (string, error) {
+	if body.Code != "" {
+		step, valid := auth.ValidateTOTPCode(*user.TOTPSecret, body.Code, time.Now())
+		if !valid {
+			return "Invalid TOTP code", nil
+		}
+
+		// Only codes from a later time step than the last accepted one are allowed, so a code can't be replayed
+		if err := api.store.Users.UseTOTPStep(ctx, user.ID, step); err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				return "TOTP code has already been used", nil
+			}
+
+			return "", err
+		}
+
+		return "", nil
+	}
+
+	if err := api.store.RecoveryCodes.Use(ctx, user.ID, auth.HashRecoveryCode(body.RecoveryCode)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return "Invalid recovery code", nil
+		}
+
+		return "", err
+	}
+
+	api.log.Info.PrintfContext(ctx, "User %s has used a recovery code", user.ID)
+
+	return "", nil
+}
+
+// failMFA counts a wrong code against both the challenge and the lockout of the account
+func (api *API) failMFA(r *http.Request, challengeID uuid.UUID, user *models.User, reservation *lockout.Reservation) {
+	if err := api.store.MFAChallenges.Fail(context.WithoutCancel(r.Context()), challengeID); err != nil {
+		api.log.Error.PrintfContext(r.Context(), "Failed to record failed MFA attempt for challenge %s: %v", challengeID, err)
+	}
+
+	api.failSecondFactor(r, user, reservation)
+}
+
+// failSecondFactor counts a wrong code against the lockout of the account
+func (api *API) failSecondFactor(r *http.Request, user *models.User, reservation *lockout.Reservation) {
+	api.failLogin(r.Context(), "mfa", reservation)
+
+	if err := api.store.Audit.Append(context.WithoutCancel(r.Context()), audit.FromRequest(r, audit.Record{UserID: &user.ID, Action: audit.ActionLoginFailed, TargetType: audit.TargetUser, TargetID: &user.ID, After: map[string]any{"method": "mfa"}})); err != nil {
+		api.log.Error.PrintfContext(r.Context(), "Failed to audit failed login of user %s: %v", user.ID, err)
+	}
+}
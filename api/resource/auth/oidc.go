@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/oidc"
+	"github.com/ushiradineth/koano-api/util/response"
+)
+
+// How long a login has to be completed once it has been started
+const oidcStateLifetime = 10 * time.Minute
+
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+// @Summary		Start OIDC Login
+// @Description	Start a login with an OpenID Connect provider. The client redirects the user to the returned authorization URL. The state is also set in the koano_oidc_state cookie, which the browser has to send back with the callback
+// @Tags			Auth
+// @Produce		json
+// @Param			Path	path		OIDCPathParams	true	"OIDCPathParams"
+// @Success		200		{object}	response.Response{data=OIDCAuthorizeResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/auth/oidc/{provider}/authorize [get]
+func (api *API) OIDCAuthorize(w http.ResponseWriter, r *http.Request) {
+	path := OIDCPathParams{
+		Provider: r.PathValue("provider"),
+	}
+
+	if err := api.validator.Struct(path); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	provider, ok := api.providers[path.Provider]
+	if !ok {
+		response.GenericBadRequestError(w, fmt.Errorf("Provider %s is not configured", path.Provider))
+		return
+	}
+
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	codeVerifier, codeChallenge, err := oidc.NewPKCE()
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	authorizationURL, err := provider.AuthorizationURL(r.Context(), state, nonce, codeChallenge)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	err = api.store.Identities.CreateState(r.Context(), models.OIDCState{
+		State:        state,
+		Provider:     provider.Name(),
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcStateLifetime),
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	auth.SetOIDCStateCookie(w, api.cookies, state, oidcStateLifetime)
+
+	response.HTTPResponse(w, OIDCAuthorizeResponse{
+		AuthorizationURL: authorizationURL,
+		State:            state,
+	})
+}
+
+// @Summary		Complete OIDC Login
+// @Description	Complete a login with an OpenID Connect provider using the code and state it redirected back with, from the browser which started it. Existing users are linked when both the provider and the account have verified the email
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Path	path		OIDCPathParams			true	"OIDCPathParams"
+// @Param			Body	body		OIDCCallbackBodyParams	true	"OIDCCallbackBodyParams"
+// @Success		200		{object}	response.Response{data=AuthenticateResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/auth/oidc/{provider}/callback [post]
+func (api *API) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	path := OIDCPathParams{
+		Provider: r.PathValue("provider"),
+	}
+
+	if err := api.validator.Struct(path); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	var body OIDCCallbackBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	provider, ok := api.providers[path.Provider]
+	if !ok {
+		response.GenericBadRequestError(w, fmt.Errorf("Provider %s is not configured", path.Provider))
+		return
+	}
+
+	if !auth.ValidOIDCStateCookie(r, body.State) {
+		response.GenericBadRequestError(w, fmt.Errorf("Login was not started by this browser"))
+		return
+	}
+
+	auth.ClearOIDCStateCookie(w, api.cookies)
+
+	// States are single use, deleting it up front stops the code from being replayed
+	state, err := api.store.Identities.ConsumeState(r.Context(), body.State, provider.Name())
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Login state is invalid or has expired"))
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	tokenResponse, err := provider.Exchange(r.Context(), body.Code, state.CodeVerifier)
+	if err != nil {
+		api.log.Warn.PrintfContext(r.Context(), "OIDC code exchange with %s failed: %v", provider.Name(), err)
+		response.HTTPError(w, http.StatusUnauthorized, "Login with provider failed", response.StatusFail)
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(r.Context(), tokenResponse.IDToken, state.Nonce)
+	if err != nil {
+		api.log.Warn.PrintfContext(r.Context(), "OIDC ID token from %s is invalid: %v", provider.Name(), err)
+		response.HTTPError(w, http.StatusUnauthorized, "Login with provider failed", response.StatusFail)
+		return
+	}
+
+	user := api.getOIDCUser(w, r, provider.Name(), claims)
+	if user == nil {
+		return
+	}
+
+	api.completeLogin(w, r, user, provider.Name())
+}
+
+// getOIDCUser returns the user linked to the identity, linking an existing user by verified email or creating a new user on first login.
+// Accounts whose email hasn't been verified aren't linked, the password may belong to whoever registered the address before its owner.
+func (api *API) getOIDCUser(w http.ResponseWriter, r *http.Request, provider string, claims *oidc.IDTokenClaims) *models.User {
+	linkedUser, err := api.getLinkedUser(r.Context(), provider, claims.Subject)
+	if err == nil {
+		if err := api.store.Identities.Touch(r.Context(), provider, claims.Subject, claims.Email); err != nil {
+			api.log.Error.PrintfContext(r.Context(), "Failed to update identity of user %s: %v", linkedUser.ID, err)
+		}
+
+		return linkedUser
+	}
+
+	if !errors.Is(err, store.ErrNotFound) {
+		response.GenericServerError(w, err)
+		return nil
+	}
+
+	if claims.Email == "" {
+		response.GenericBadRequestError(w, fmt.Errorf("Provider did not share an email address"))
+		return nil
+	}
+
+	// Linking by an unverified email would let anyone with an account at the provider take over the matching user
+	if !bool(claims.EmailVerified) {
+		response.GenericBadRequestError(w, fmt.Errorf("Email address %s has not been verified by the provider", claims.Email))
+		return nil
+	}
+
+	emailInUse, emailUnverified := false, false
+	var oidcUser *models.User
+	err = api.store.Tx(r.Context(), func(tx *store.Store) error {
+		var err error
+		oidcUser, err = tx.Users.GetByEmail(r.Context(), claims.Email)
+		if err == nil && !oidcUser.EmailVerified {
+			emailUnverified = true
+			return nil
+		}
+
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+
+			if emailInUse, err = tx.Users.IsEmailInUse(r.Context(), claims.Email, uuid.Nil); err != nil || emailInUse {
+				return err
+			}
+
+			name := claims.Name
+			if name == "" {
+				name = claims.Email
+			}
+
+			// Users created through a provider have no password until they set one
+			if oidcUser, err = tx.Users.Create(r.Context(), models.User{ID: uuid.New(), Name: name, Email: claims.Email, EmailVerified: true}); err != nil {
+				return err
+			}
+
+			created := *oidcUser
+			created.Redact()
+
+			if err := tx.Audit.Append(r.Context(), audit.FromRequest(r, audit.Record{ActorID: &oidcUser.ID, UserID: &oidcUser.ID, Action: audit.ActionUserCreate, TargetType: audit.TargetUser, TargetID: &oidcUser.ID, After: created})); err != nil {
+				return err
+			}
+
+			api.log.Info.PrintfContext(r.Context(), "User %s has been created through %s", oidcUser.ID, provider)
+		}
+
+		if err := tx.Identities.Create(r.Context(), models.UserIdentity{ID: uuid.New(), UserID: oidcUser.ID, Provider: provider, Subject: claims.Subject, Email: claims.Email}); err != nil {
+			return err
+		}
+
+		return tx.Audit.Append(r.Context(), audit.FromRequest(r, audit.Record{ActorID: &oidcUser.ID, UserID: &oidcUser.ID, Action: audit.ActionIdentityLink, TargetType: audit.TargetUser, TargetID: &oidcUser.ID, After: map[string]any{"provider": provider, "email": claims.Email}}))
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return nil
+	}
+
+	if emailInUse {
+		response.GenericBadRequestError(w, fmt.Errorf("Email already in use"))
+		return nil
+	}
+
+	if emailUnverified {
+		response.GenericBadRequestError(w, fmt.Errorf("Email address %s is registered to an account which has not verified it, verify the email to link %s", claims.Email, provider))
+		return nil
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has been linked to %s", oidcUser.ID, provider)
+
+	return oidcUser
+}
+
+// getLinkedUser returns the active user the identity belongs to
+func (api *API) getLinkedUser(ctx context.Context, provider string, subject string) (*models.User, error) {
+	identity, err := api.store.Identities.Get(ctx, provider, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.store.Users.GetByID(ctx, identity.UserID)
+}
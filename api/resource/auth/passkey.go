@@ -0,0 +1,397 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/webauthn"
+)
+
+// Registering a passkey takes a sign in within this window, or a TOTP code for users with MFA
+const passkeyReauthenticationWindow = 10 * time.Minute
+
+// @Summary		Passkey Registration Options
+// @Description	Start registering a passkey for the authenticated user. The options are in the WebAuthn JSON format and can be passed to navigator.credentials.create as is. The user has to have signed in within the last 10 minutes, users with MFA can confirm with a TOTP code instead. Otherwise 403 is returned and the user has to sign in again
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		PasskeyRegistrationOptionsBodyParams	false	"PasskeyRegistrationOptionsBodyParams"
+// @Success		200		{object}	response.Response{data=webauthn.CreationOptions}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		429		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/auth/passkeys/register/options [post]
+func (api *API) PasskeyRegistrationOptions(w http.ResponseWriter, r *http.Request) {
+	// The body is optional, it is only needed to confirm with a TOTP code
+	var body PasskeyRegistrationOptionsBodyParams
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			response.GenericValidationError(w, err)
+			return
+		}
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	principal := auth.MustPrincipalFromContext(r.Context())
+	user := principal.User
+
+	// A passkey outlives the session it is added from, so a stolen session must not be enough to add one
+	if !principal.SignedInSince(time.Now().Add(-passkeyReauthenticationWindow)) {
+		if !user.MFAEnabled || body.Code == "" {
+			response.HTTPError(w, http.StatusForbidden, "Sign in again to register a passkey", response.StatusFail)
+			return
+		}
+
+		if !api.useTOTPCode(w, r, user, body.Code) {
+			return
+		}
+	}
+
+	credentials, err := api.store.Passkeys.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	// Stops the authenticator from creating a second passkey for an account it already holds one for
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		exclude = append(exclude, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         credential.CredentialID,
+			Transports: credential.Transports,
+		})
+	}
+
+	challenge, err := api.newPasskeyChallenge(r.Context(), webauthn.CeremonyRegistration, &user.ID)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has started passkey registration", user.ID)
+
+	response.HTTPResponse(w, api.webauthn.NewCreationOptions(challenge, user.ID[:], user.Email, user.Name, exclude))
+}
+
+// @Summary		Register Passkey
+// @Description	Finish registering a passkey with the credential returned by navigator.credentials.create
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		RegisterPasskeyBodyParams	true	"RegisterPasskeyBodyParams"
+// @Success		200		{object}	response.Response{data=models.WebAuthnCredential}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/auth/passkeys/register [post]
+func (api *API) RegisterPasskey(w http.ResponseWriter, r *http.Request) {
+	var body RegisterPasskeyBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	challenge, err := webauthn.Challenge(body.Credential.Response.ClientDataJSON)
+	if err != nil {
+		response.GenericBadRequestError(w, err)
+		return
+	}
+
+	if !api.consumePasskeyChallenge(w, r, challenge, webauthn.CeremonyRegistration, &user.ID) {
+		return
+	}
+
+	credential, err := api.webauthn.VerifyRegistration(body.Credential, challenge)
+	if err != nil {
+		response.GenericBadRequestError(w, fmt.Errorf("Passkey could not be verified: %v", err))
+		return
+	}
+
+	if _, err := api.store.Passkeys.GetByCredentialID(r.Context(), credential.ID); err == nil {
+		response.GenericBadRequestError(w, fmt.Errorf("Passkey is already registered"))
+		return
+	} else if !errors.Is(err, store.ErrNotFound) {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	// Authenticators which don't disclose their model report an all zero AAGUID
+	aaguid, err := uuid.FromBytes(credential.AAGUID)
+	if err != nil {
+		aaguid = uuid.Nil
+	}
+
+	passkey, err := api.store.Passkeys.Create(r.Context(), models.WebAuthnCredential{
+		ID:           uuid.New(),
+		UserID:       user.ID,
+		Name:         body.Name,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+		Transports:   pq.StringArray(credential.Transports),
+		AAGUID:       aaguid,
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionPasskeyAdd, TargetType: audit.TargetPasskey, TargetID: &passkey.ID, After: map[string]any{"name": passkey.Name}})
+
+	api.log.Info.PrintfContext(r.Context(), "Passkey %s has been registered for user %s", passkey.ID, user.ID)
+
+	response.HTTPResponse(w, passkey)
+}
+
+// @Summary		Get Passkeys
+// @Description	Get the passkeys registered by the authenticated user
+// @Tags			Auth
+// @Produce		json
+// @Success		200	{object}	response.Response{data=[]models.WebAuthnCredential}
+// @Failure		400	{object}	response.Error
+// @Failure		401	{object}	response.Error
+// @Failure		500	{object}	response.Error
+// @Security		BearerAuth
+// @Router			/auth/passkeys [get]
+func (api *API) GetPasskeys(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	passkeys, err := api.store.Passkeys.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Passkeys for user %s have been retrieved", user.ID)
+
+	response.HTTPResponse(w, passkeys)
+}
+
+// @Summary		Delete Passkey
+// @Description	Delete a passkey registered by the authenticated user
+// @Tags			Auth
+// @Produce		json
+// @Param			Path	path		PasskeyPathParams	true	"PasskeyPathParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/auth/passkeys/{passkey_id} [delete]
+func (api *API) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	path := PasskeyPathParams{
+		PasskeyID: r.PathValue("passkey_id"),
+	}
+
+	if err := api.validator.Struct(path); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	passkeyID, err := uuid.Parse(path.PasskeyID)
+	if err != nil {
+		response.GenericBadRequestError(w, fmt.Errorf("Passkey does not exist"))
+		return
+	}
+
+	if err := api.store.Passkeys.Delete(r.Context(), passkeyID, user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Passkey does not exist"))
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionPasskeyDel, TargetType: audit.TargetPasskey, TargetID: &passkeyID})
+
+	api.log.Info.PrintfContext(r.Context(), "Passkey %s has been deleted by user %s", path.PasskeyID, user.ID)
+
+	response.HTTPResponse(w, "Passkey has been successfully deleted")
+}
+
+// @Summary		Passkey Login Options
+// @Description	Start signing in with a passkey. The options are in the WebAuthn JSON format and can be passed to navigator.credentials.get as is. No credentials are listed so the authenticator offers the discoverable passkeys it holds
+// @Tags			Auth
+// @Produce		json
+// @Success		200	{object}	response.Response{data=webauthn.RequestOptions}
+// @Failure		500	{object}	response.Error
+// @Router			/auth/passkeys/login/options [post]
+func (api *API) PasskeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	challenge, err := api.newPasskeyChallenge(r.Context(), webauthn.CeremonyLogin, nil)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	response.HTTPResponse(w, api.webauthn.NewRequestOptions(challenge))
+}
+
+// @Summary		Passkey Login
+// @Description	Sign in with the credential returned by navigator.credentials.get. A passkey which verified the user counts as a second factor, otherwise users with MFA enabled receive an MFAChallengeResponse to complete with /auth/mfa/verify
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		PasskeyLoginBodyParams	true	"PasskeyLoginBodyParams"
+// @Success		200		{object}	response.Response{data=AuthenticateResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		403		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/auth/passkeys/login [post]
+func (api *API) PasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var body PasskeyLoginBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	challenge, err := webauthn.Challenge(body.Credential.Response.ClientDataJSON)
+	if err != nil {
+		response.GenericBadRequestError(w, err)
+		return
+	}
+
+	if !api.consumePasskeyChallenge(w, r, challenge, webauthn.CeremonyLogin, nil) {
+		return
+	}
+
+	passkey, err := api.store.Passkeys.GetByCredentialID(r.Context(), body.Credential.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.HTTPError(w, http.StatusUnauthorized, "Invalid Credentials", response.StatusFail)
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if body.Credential.Response.UserHandle != "" {
+		userHandle, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(body.Credential.Response.UserHandle, "="))
+		if err != nil || !bytes.Equal(userHandle, passkey.UserID[:]) {
+			response.HTTPError(w, http.StatusUnauthorized, "Invalid Credentials", response.StatusFail)
+			return
+		}
+	}
+
+	signCount, userVerified, err := api.webauthn.VerifyAssertion(body.Credential, challenge, passkey.PublicKey, uint32(passkey.SignCount))
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCount) {
+			api.log.Warn.PrintfContext(r.Context(), "Passkey %s of user %s has been rejected: %v", passkey.ID, passkey.UserID, err)
+		}
+
+		response.HTTPError(w, http.StatusUnauthorized, "Invalid Credentials", response.StatusFail)
+		return
+	}
+
+	// Matching on the previous sign count stops two concurrent assertions with the same counter from both succeeding
+	if err := api.store.Passkeys.UpdateSignCount(r.Context(), passkey.ID, passkey.SignCount, int64(signCount)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.HTTPError(w, http.StatusUnauthorized, "Invalid Credentials", response.StatusFail)
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	passkeyUser, err := api.store.Users.GetByID(r.Context(), passkey.UserID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.HTTPError(w, http.StatusUnauthorized, "Invalid Credentials", response.StatusFail)
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if api.requireEmailVerification && !passkeyUser.EmailVerified {
+		response.HTTPError(w, http.StatusForbidden, "Email address has not been verified", response.StatusFail)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has signed in with passkey %s", passkeyUser.ID, passkey.ID)
+
+	// The passkey proves possession and the verification proves the user, so TOTP would not add a factor
+	if userVerified {
+		api.respondWithTokens(w, r, passkeyUser, "passkey")
+		return
+	}
+
+	api.completeLogin(w, r, passkeyUser, "passkey")
+}
+
+func (api *API) newPasskeyChallenge(ctx context.Context, ceremony string, userID *uuid.UUID) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	err = api.store.Passkeys.CreateChallenge(ctx, models.WebAuthnChallenge{
+		Challenge: challenge,
+		UserID:    userID,
+		Ceremony:  ceremony,
+		ExpiresAt: time.Now().Add(webauthn.ChallengeLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// consumePasskeyChallenge deletes the challenge so it can only be answered once, writing an error response if it doesn't exist
+func (api *API) consumePasskeyChallenge(w http.ResponseWriter, r *http.Request, challenge string, ceremony string, userID *uuid.UUID) bool {
+	if err := api.store.Passkeys.ConsumeChallenge(r.Context(), challenge, ceremony, userID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Passkey challenge is invalid or has expired"))
+			return false
+		}
+
+		response.GenericServerError(w, err)
+		return false
+	}
+
+	return true
+}
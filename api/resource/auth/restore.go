@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/lockout"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/user"
+)
+
+type RestoreChallengeResponse struct {
+	RestoreRequired bool      `json:"restore_required"`
+	RestoreToken    string    `json:"restore_token"`
+	ExpiresIn       int64     `json:"expires_in"`
+	PurgeAt         time.Time `json:"purge_at"`
+}
+
+// @Summary		Restore Account
+// @Description	Restore a deleted account within its grace period with the restore token returned by /auth/login or emailed by /auth/restore/email. Accounts with MFA also need a TOTP code or recovery code, which is checked before the account is restored and counts towards its lockout. The account is signed in once restored
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		RestoreAccountBodyParams	true	"RestoreAccountBodyParams"
+// @Success		200		{object}	response.Response{data=AuthenticateResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		429		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/auth/restore [post]
+func (api *API) RestoreAccount(w http.ResponseWriter, r *http.Request) {
+	var body RestoreAccountBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	claim := auth.ParseAccountRestoreToken(w, body.Token)
+	if claim == nil {
+		return
+	}
+
+	restorableUser, err := api.store.Users.GetRestorableByID(r.Context(), claim.Id, time.Now().Add(-api.restorePeriod))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Account can not be restored"))
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	// A token from an earlier deletion doesn't restore the account after it has been restored and deleted again
+	if restorableUser.DeletedAt.UnixMicro() != claim.DeletedAt {
+		response.GenericBadRequestError(w, fmt.Errorf("Account can not be restored"))
+		return
+	}
+
+	// The second factor is taken before the account is brought back, otherwise the password alone would undo the deletion
+	if restorableUser.MFAEnabled {
+		if body.Code == "" && body.RecoveryCode == "" {
+			response.HTTPError(w, http.StatusUnauthorized, "MFA code is required to restore the account", response.StatusFail)
+			return
+		}
+
+		reservation, ok := api.checkLockout(w, r, restorableUser.Email)
+		if !ok {
+			return
+		}
+		defer api.releaseLockout(r, reservation)
+
+		failure, err := api.useSecondFactor(r.Context(), restorableUser, VerifyMFABodyParams{Code: body.Code, RecoveryCode: body.RecoveryCode})
+		if err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		if failure != "" {
+			api.failSecondFactor(r, restorableUser, reservation)
+			response.HTTPError(w, http.StatusUnauthorized, failure, response.StatusFail)
+			return
+		}
+
+		api.succeedLockout(r, reservation, restorableUser.ID)
+	}
+
+	if err := api.store.Users.Restore(r.Context(), restorableUser.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Account can not be restored"))
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	restorableUser.Active = true
+	restorableUser.DeletedAt = nil
+
+	store.LogUser(api.store.Audit, api.log, r, restorableUser.ID, audit.Record{Action: audit.ActionUserRestore, TargetType: audit.TargetUser, TargetID: &restorableUser.ID})
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has restored their account", restorableUser.ID)
+
+	api.respondWithTokens(w, r, restorableUser, "restore")
+}
+
+// @Summary		Send Restore Link
+// @Description	Email a link to restore a deleted account within its grace period. The response is the same whether or not the account can be restored
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		RestoreLinkBodyParams	true	"RestoreLinkBodyParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/auth/restore/email [post]
+func (api *API) SendRestoreLink(w http.ResponseWriter, r *http.Request) {
+	var body RestoreLinkBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	restorableUser, err := api.store.Users.GetRestorableByEmail(r.Context(), body.Email, time.Now().Add(-api.restorePeriod))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			api.log.Info.PrintfContext(r.Context(), "Restore link for %s has been requested without a restorable account", body.Email)
+			response.HTTPResponse(w, "Restore link has been sent")
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if err := user.SendAccountRestore(api.appURL, restorableUser, api.restorePeriod, api.mailer); err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Restore link has been sent to user %s", restorableUser.ID)
+
+	response.HTTPResponse(w, "Restore link has been sent")
+}
+
+// offerRestore answers a login to an account deleted within its grace period with a restore token instead of the token pair.
+// It reports false when there is no such account or the password doesn't match, leaving the caller to fail the login as usual.
+// Without an account the password is still hashed, so the failure takes as long as a wrong password.
+func (api *API) offerRestore(w http.ResponseWriter, r *http.Request, body AuthenticateBodyParams, reservation *lockout.Reservation) bool {
+	restorableUser, err := api.store.Users.GetRestorableByEmail(r.Context(), body.Email, time.Now().Add(-api.restorePeriod))
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			api.log.Error.PrintfContext(r.Context(), "Failed to look up a restorable account for %s: %v", body.Email, err)
+		}
+
+		auth.VerifyWithoutHash(body.Password)
+		return false
+	}
+
+	if restorableUser.Password == nil {
+		auth.VerifyWithoutHash(body.Password)
+		return false
+	}
+
+	if valid, _ := auth.CheckPasswordHash(body.Password, *restorableUser.Password); !valid {
+		return false
+	}
+
+	restoreToken, expiresIn, err := auth.NewAccountRestoreToken(restorableUser.ID, *restorableUser.DeletedAt)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return true
+	}
+
+	if !restorableUser.MFAEnabled {
+		api.succeedLockout(r, reservation, restorableUser.ID)
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has been offered to restore their account", restorableUser.ID)
+
+	response.HTTPResponse(w, RestoreChallengeResponse{
+		RestoreRequired: true,
+		RestoreToken:    restoreToken,
+		ExpiresIn:       expiresIn,
+		PurgeAt:         restorableUser.DeletedAt.Add(api.restorePeriod),
+	})
+	return true
+}
@@ -1,8 +1,10 @@
 package auth
 
+import "github.com/ushiradineth/koano-api/util/webauthn"
+
 type AuthenticateBodyParams struct {
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8,max=20,hasLowercase,hasUppercase,hasDigit,hasSpecialCharacter"`
+	Password string `json:"password" validate:"required"`
 }
 
 type RefreshTokenBodyParams struct {
@@ -10,5 +12,69 @@ type RefreshTokenBodyParams struct {
 }
 
 type PutPasswordBodyParams struct {
-	Password string `json:"password" validate:"required,min=8,max=20,hasLowercase,hasUppercase,hasDigit,hasSpecialCharacter"`
+	Password string `json:"password" validate:"required"`
+}
+
+type VerifyEmailBodyParams struct {
+	Token string `json:"token" validate:"required,jwt"`
+}
+
+type TOTPCodeBodyParams struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type VerifyMFABodyParams struct {
+	MFAToken     string `json:"mfa_token" validate:"required,jwt"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,min=10,max=11"`
+}
+
+type UnlockBodyParams struct {
+	Scope      string `json:"scope" validate:"required,oneof=account ip"`
+	Identifier string `json:"identifier" validate:"required"`
+}
+
+type OIDCPathParams struct {
+	Provider string `json:"provider" validate:"required,alphanum"`
+}
+
+type OIDCCallbackBodyParams struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+type MagicLinkBodyParams struct {
+	Email string `json:"email" validate:"required,email"`
+	Name  string `json:"name" validate:"omitempty,max=100"`
+}
+
+type ConsumeMagicLinkBodyParams struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type RestoreAccountBodyParams struct {
+	Token        string `json:"token" validate:"required,jwt"`
+	Code         string `json:"code" validate:"omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code" validate:"omitempty,min=10,max=11"`
+}
+
+type RestoreLinkBodyParams struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasskeyRegistrationOptionsBodyParams struct {
+	Code string `json:"code" validate:"omitempty,numeric,len=6"`
+}
+
+type RegisterPasskeyBodyParams struct {
+	Name       string                      `json:"name" validate:"required,max=100"`
+	Credential webauthn.CredentialCreation `json:"credential" validate:"required"`
+}
+
+type PasskeyLoginBodyParams struct {
+	Credential webauthn.CredentialAssertion `json:"credential" validate:"required"`
+}
+
+type PasskeyPathParams struct {
+	PasskeyID string `json:"passkey_id" validate:"required,uuid"`
 }
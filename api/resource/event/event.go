@@ -2,29 +2,31 @@ package event
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 	"github.com/ushiradineth/koano-api/models"
-	"github.com/ushiradineth/koano-api/util/event"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
 	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/metrics"
 	"github.com/ushiradineth/koano-api/util/response"
-	"github.com/ushiradineth/koano-api/util/user"
 )
 
 type API struct {
-	db        *sqlx.DB
+	store     *store.Store
 	validator *validator.Validate
 	log       *logger.Logger
 }
 
-func New(db *sqlx.DB, validator *validator.Validate, log *logger.Logger) *API {
+func New(store *store.Store, validator *validator.Validate, log *logger.Logger) *API {
 	return &API{
-		db:        db,
+		store:     store,
 		validator: validator,
 		log:       log,
 	}
@@ -51,17 +53,14 @@ func (api *API) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := user.GetUserFromJWT(r, w, api.db)
-	if user == nil {
-		return
-	}
+	user := auth.MustPrincipalFromContext(r.Context()).User
 
-	event := event.GetEvent(w, path.EventID, user.ID.String(), api.db)
+	event := api.getEvent(w, r, path.EventID, user.ID)
 	if event == nil {
 		return
 	}
 
-	api.log.Info.Printf("Event %s has been retrieved by user %s", path.EventID, user.ID)
+	api.log.Info.PrintfContext(r.Context(), "Event %s has been retrieved by user %s", path.EventID, user.ID)
 
 	response.HTTPResponse(w, event)
 }
@@ -90,12 +89,7 @@ func (api *API) Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := user.GetUserFromJWT(r, w, api.db)
-	if user == nil {
-		return
-	}
-
-	eventExists := event.DoesEventExist("", body.StartTime, body.EndTime, user.ID.String(), api.db)
+	user := auth.MustPrincipalFromContext(r.Context()).User
 
 	parsedStart, err := time.Parse(time.RFC3339, body.StartTime)
 	if err != nil {
@@ -109,6 +103,12 @@ func (api *API) Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	eventExists, err := api.store.Events.Exists(r.Context(), user.ID, parsedStart, parsedEnd)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
 	if eventExists {
 		response.HTTPError(w, http.StatusBadRequest, "Event already exists", response.StatusFail)
 		return
@@ -129,14 +129,16 @@ func (api *API) Post(w http.ResponseWriter, r *http.Request) {
 		Repeated: body.Repeated,
 	}
 
-	var event models.Event
-	err = api.db.Get(&event, "INSERT INTO events (id, title, start_time, end_time, user_id, timezone, repeated) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *", eventData.ID, eventData.Title, eventData.Start, eventData.End, eventData.UserID, eventData.Timezone, eventData.Repeated)
+	event, err := api.store.Events.Create(r.Context(), eventData)
 	if err != nil {
 		response.GenericServerError(w, err)
 		return
 	}
 
-	api.log.Info.Printf("Event %s has been created by user %s", event.ID, event.UserID)
+	metrics.EventsCreated.Inc()
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionEventCreate, TargetType: audit.TargetEvent, TargetID: &event.ID, After: event})
+
+	api.log.Info.PrintfContext(r.Context(), "Event %s has been created by user %s", event.ID, event.UserID)
 
 	response.HTTPResponse(w, event)
 }
@@ -175,14 +177,10 @@ func (api *API) Put(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := user.GetUserFromJWT(r, w, api.db)
-	if user == nil {
-		return
-	}
+	user := auth.MustPrincipalFromContext(r.Context()).User
 
-	existingEvent := event.GetEvent(w, path.EventID, user.ID.String(), api.db)
+	existingEvent := api.getEvent(w, r, path.EventID, user.ID)
 	if existingEvent == nil {
-		response.HTTPError(w, http.StatusBadRequest, "Event does not exists", response.StatusFail)
 		return
 	}
 
@@ -203,14 +201,8 @@ func (api *API) Put(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	parsedUUID, err := uuid.Parse(path.EventID)
-	if err != nil {
-		response.GenericServerError(w, err)
-		return
-	}
-
 	eventData := models.Event{
-		ID:       parsedUUID,
+		ID:       existingEvent.ID,
 		Title:    body.Title,
 		Start:    parsedStart,
 		End:      parsedEnd,
@@ -219,14 +211,20 @@ func (api *API) Put(w http.ResponseWriter, r *http.Request) {
 		Repeated: body.Repeated,
 	}
 
-	var event models.Event
-	err = api.db.Get(&event, "UPDATE events SET title=$1, start_time=$2, end_time=$3, timezone=$4, repeated=$5 WHERE id=$6 AND user_id=$7 RETURNING *", eventData.Title, eventData.Start, eventData.End, eventData.Timezone, eventData.Repeated, eventData.ID, eventData.UserID.String())
+	event, err := api.store.Events.Update(r.Context(), eventData)
 	if err != nil {
 		response.GenericServerError(w, err)
 		return
 	}
 
-	api.log.Info.Printf("Event %s has been updated by user %s", event.ID, event.UserID)
+	before, after, err := audit.Diff(existingEvent, event)
+	if err != nil {
+		api.log.Error.PrintfContext(r.Context(), "Failed to diff event %s: %v", event.ID, err)
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionEventUpdate, TargetType: audit.TargetEvent, TargetID: &event.ID, Before: before, After: after})
+
+	api.log.Info.PrintfContext(r.Context(), "Event %s has been updated by user %s", event.ID, event.UserID)
 
 	response.HTTPResponse(w, event)
 }
@@ -252,29 +250,27 @@ func (api *API) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := user.GetUserFromJWT(r, w, api.db)
-	if user == nil {
-		return
-	}
+	user := auth.MustPrincipalFromContext(r.Context()).User
 
-	res, err := api.db.Exec("UPDATE events SET active=false, deleted_at=$1 WHERE id=$2 AND user_id=$3", time.Now(), path.EventID, user.ID.String())
+	eventID, err := uuid.Parse(path.EventID)
 	if err != nil {
-		response.GenericServerError(w, err)
+		response.GenericBadRequestError(w, fmt.Errorf("Event does not exist"))
 		return
 	}
 
-	count, err := res.RowsAffected()
-	if err != nil {
+	if err := api.store.Events.Delete(r.Context(), eventID, user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Event does not exist"))
+			return
+		}
+
 		response.GenericServerError(w, err)
 		return
 	}
 
-	if count == 0 {
-		response.GenericBadRequestError(w, fmt.Errorf("Event does not exist"))
-		return
-	}
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionEventDelete, TargetType: audit.TargetEvent, TargetID: &eventID})
 
-	api.log.Info.Printf("Event %s has been deleted by user %s", path.EventID, user.ID)
+	api.log.Info.PrintfContext(r.Context(), "Event %s has been deleted by user %s", path.EventID, user.ID)
 
 	response.HTTPResponse(w, "Event has been successfully deleted")
 }
@@ -302,10 +298,7 @@ func (api *API) GetUserEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := user.GetUserFromJWT(r, w, api.db)
-	if user == nil {
-		return
-	}
+	user := auth.MustPrincipalFromContext(r.Context()).User
 
 	parsedStart, err := time.Parse("2006-01-02", query.StartDay)
 	if err != nil {
@@ -319,15 +312,35 @@ func (api *API) GetUserEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	events := []models.Event{}
-
-	err = api.db.Select(&events, "SELECT * FROM events WHERE user_id=$1 AND start_time >= $2 AND start_time <= $3 AND active=true", user.ID, parsedStart, parsedEnd)
+	events, err := api.store.Events.ListByUser(r.Context(), user.ID, parsedStart, parsedEnd)
 	if err != nil {
 		response.GenericServerError(w, err)
 		return
 	}
 
-	api.log.Info.Printf("Events for user %s have been retrieved", user.ID)
+	api.log.Info.PrintfContext(r.Context(), "Events for user %s have been retrieved", user.ID)
 
 	response.HTTPResponse(w, events)
 }
+
+// getEvent writes the response when the event can't be read, the ID has already been validated as a UUID
+func (api *API) getEvent(w http.ResponseWriter, r *http.Request, id string, userID uuid.UUID) *models.Event {
+	eventID, err := uuid.Parse(id)
+	if err != nil {
+		response.GenericBadRequestError(w, fmt.Errorf("Event not found"))
+		return nil
+	}
+
+	event, err := api.store.Events.Get(r.Context(), eventID, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Event not found"))
+			return nil
+		}
+
+		response.GenericServerError(w, err)
+		return nil
+	}
+
+	return event
+}
@@ -10,29 +10,28 @@ import (
 	"github.com/go-faker/faker/v4"
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
-	"github.com/ushiradineth/koano-api/api/resource/auth"
+	"github.com/stretchr/testify/assert"
 	"github.com/ushiradineth/koano-api/api/resource/event"
 	"github.com/ushiradineth/koano-api/api/resource/user"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
 	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
 	"github.com/ushiradineth/koano-api/util/response"
 	"github.com/ushiradineth/koano-api/util/test"
 	"github.com/ushiradineth/koano-api/util/validator"
 )
 
 var (
-	accessToken         string
-	refreshToken        string
-	user1ID             string
-	user2ID             string
-	eventId             string
-	expiredAccessToken  string
-	expiredRefreshToken string
-	db                  *sqlx.DB
-	userAPI             *user.API
-	authAPI             *auth.API
-	eventAPI            *event.API
+	accessToken        string
+	user1ID            string
+	user2ID            string
+	eventId            string
+	expiredAccessToken string
+	repositories       *store.Store
+	userAPI            *user.API
+	eventAPI           *event.API
 )
 
 var user1 user.PostBodyParams = user.PostBodyParams{
@@ -47,16 +46,6 @@ var user2 user.PostBodyParams = user.PostBodyParams{
 	Password: "lowUP1234!@#",
 }
 
-var user1Auth auth.AuthenticateBodyParams = auth.AuthenticateBodyParams{
-	Email:    user1.Email,
-	Password: user1.Password,
-}
-
-var user2Auth auth.AuthenticateBodyParams = auth.AuthenticateBodyParams{
-	Email:    user2.Email,
-	Password: user2.Password,
-}
-
 var event1 event.EventBodyParams = event.EventBodyParams{
 	Title:     "Test",
 	StartTime: "2020-01-02T15:04:05Z",
@@ -72,23 +61,19 @@ func TestInit(t *testing.T) {
 			log.Println("Failed to load env")
 		}
 
-		db = test.NewDB("../../../database/migration")
+		// The handlers only depend on the store, so they are tested against the in-memory one
+		repositories = test.NewStore()
 		v := validator.New()
 		l := logger.New()
+		m := mail.NewLogMailer(l)
 
-		userAPI = user.New(db, v, l)
-		eventAPI = event.New(db, v, l)
-		authAPI = auth.New(db, v, l)
+		userAPI = user.New(repositories, v, l, m, test.NewConfig())
+		eventAPI = event.New(repositories, v, l)
 
 		expiredAccessToken = func() string {
 			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1234567890", "iat": time.Now().Unix(), "exp": time.Now().Add(-1 * time.Hour).Unix()}).SignedString([]byte(os.Getenv("JWT_SECRET")))
 			return token
 		}()
-
-		expiredRefreshToken = func() string {
-			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1234567890", "iat": time.Now().Unix(), "exp": time.Now().Add(-1 * time.Hour).Unix()}).SignedString([]byte(os.Getenv("JWT_SECRET")))
-			return token
-		}()
 	})
 
 	t.Run("Create User 1", func(t *testing.T) {
@@ -96,7 +81,7 @@ func TestInit(t *testing.T) {
 	})
 
 	t.Run("Authenticates User 1", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		test.AuthenticateMemoryUserHelper(repositories, t, user1.Email, &user1ID, &accessToken)
 	})
 
 	t.Run("Create User 2", func(t *testing.T) {
@@ -168,7 +153,7 @@ func TestGetEventHandler(t *testing.T) {
 	})
 
 	t.Run("Authenticates User 2", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user2Auth, http.StatusOK, response.StatusSuccess, &user2ID, &accessToken, &refreshToken)
+		test.AuthenticateMemoryUserHelper(repositories, t, user2.Email, &user2ID, &accessToken)
 	})
 
 	t.Run("JWT does not match user ID", func(t *testing.T) {
@@ -178,7 +163,7 @@ func TestGetEventHandler(t *testing.T) {
 
 func TestUpdateEventHandler(t *testing.T) {
 	t.Run("Authenticates User 1", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		test.AuthenticateMemoryUserHelper(repositories, t, user1.Email, &user1ID, &accessToken)
 	})
 
 	t.Run("Success", func(t *testing.T) {
@@ -194,7 +179,7 @@ func TestUpdateEventHandler(t *testing.T) {
 	})
 
 	t.Run("Authenticates User 2", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user2Auth, http.StatusOK, response.StatusSuccess, &user2ID, &accessToken, &refreshToken)
+		test.AuthenticateMemoryUserHelper(repositories, t, user2.Email, &user2ID, &accessToken)
 	})
 
 	t.Run("JWT does not match user ID", func(t *testing.T) {
@@ -202,7 +187,7 @@ func TestUpdateEventHandler(t *testing.T) {
 	})
 
 	t.Run("Authenticates User 1", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		test.AuthenticateMemoryUserHelper(repositories, t, user1.Email, &user1ID, &accessToken)
 	})
 
 	body := event.EventBodyParams{
@@ -244,7 +229,7 @@ func TestUpdateEventHandler(t *testing.T) {
 
 func TestGetUserEventsHandler(t *testing.T) {
 	t.Run("Authenticates User 1", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		test.AuthenticateMemoryUserHelper(repositories, t, user1.Email, &user1ID, &accessToken)
 	})
 
 	body := event.GetUserEventsQueryParams{
@@ -268,7 +253,7 @@ func TestGetUserEventsHandler(t *testing.T) {
 	})
 
 	t.Run("Authenticates User 2", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user2Auth, http.StatusOK, response.StatusSuccess, &user2ID, &accessToken, &refreshToken)
+		test.AuthenticateMemoryUserHelper(repositories, t, user2.Email, &user2ID, &accessToken)
 	})
 
 	t.Run("JWT is Invalid", func(t *testing.T) {
@@ -278,7 +263,7 @@ func TestGetUserEventsHandler(t *testing.T) {
 
 func TestDeleteEventHandler(t *testing.T) {
 	t.Run("Authenticate User 1", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		test.AuthenticateMemoryUserHelper(repositories, t, user1.Email, &user1ID, &accessToken)
 	})
 
 	t.Run("Success", func(t *testing.T) {
@@ -298,20 +283,16 @@ func TestDeleteEventHandler(t *testing.T) {
 	})
 }
 
-func TestCleanUp(t *testing.T) {
-	t.Run("Authenticates User 1", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
-	})
-
-	t.Run("Delete User 1", func(t *testing.T) {
-		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user1ID, accessToken)
-	})
-
-	t.Run("Authenticate User 2", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user2Auth, http.StatusOK, response.StatusSuccess, &user2ID, &accessToken, &refreshToken)
-	})
+func TestAuditHandler(t *testing.T) {
+	t.Run("Changes are audited", func(t *testing.T) {
+		actions := []string{}
+		for _, record := range repositories.Audit.(*store.MemoryAuditRepository).Entries() {
+			if record.TargetType == audit.TargetEvent {
+				actions = append(actions, record.Action)
+				assert.Equal(t, user1ID, record.ActorID.String())
+			}
+		}
 
-	t.Run("Delete User 2", func(t *testing.T) {
-		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user2ID, accessToken)
+		assert.Equal(t, []string{audit.ActionEventCreate, audit.ActionEventUpdate, audit.ActionEventDelete}, actions)
 	})
 }
@@ -0,0 +1,226 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/blob"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/response"
+)
+
+type API struct {
+	store     *store.Store
+	validator *validator.Validate
+	log       *logger.Logger
+	blobs     blob.Store
+}
+
+func New(store *store.Store, validator *validator.Validate, log *logger.Logger, blobs blob.Store) *API {
+	return &API{
+		store:     store,
+		validator: validator,
+		log:       log,
+		blobs:     blobs,
+	}
+}
+
+type ExportResponse struct {
+	models.DataExport
+	DownloadURL       *string `json:"download_url"`
+	DownloadExpiresAt *int64  `json:"download_expires_at"`
+}
+
+// @Summary		Request Data Export
+// @Description	Start an export of all data held about the authenticated user. The export is built in the background within a few minutes, poll /exports/{export_id} until it is completed to get the download link
+// @Tags			Export
+// @Produce		json
+// @Success		200	{object}	response.Response{data=ExportResponse}
+// @Failure		400	{object}	response.Error
+// @Failure		401	{object}	response.Error
+// @Failure		500	{object}	response.Error
+// @Security		BearerAuth
+// @Router			/exports [post]
+func (api *API) Post(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	// A partial unique index allows a single pending or running export per user, so concurrent requests can't both start one
+	export, err := api.store.Exports.Create(r.Context(), models.DataExport{ID: uuid.New(), UserID: user.ID})
+	if err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			response.GenericBadRequestError(w, fmt.Errorf("An export is already in progress"))
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Export %s has been requested by user %s", export.ID, user.ID)
+
+	response.HTTPResponse(w, ExportResponse{DataExport: *export})
+}
+
+// @Summary		Get User Exports
+// @Description	Get the data exports of the authenticated user
+// @Tags			Export
+// @Produce		json
+// @Success		200	{object}	response.Response{data=[]models.DataExport}
+// @Failure		400	{object}	response.Error
+// @Failure		401	{object}	response.Error
+// @Failure		500	{object}	response.Error
+// @Security		BearerAuth
+// @Router			/exports [get]
+func (api *API) GetUserExports(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	exports, err := api.store.Exports.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Exports for user %s have been retrieved", user.ID)
+
+	response.HTTPResponse(w, exports)
+}
+
+// @Summary		Get Data Export
+// @Description	Get the status of a data export. Completed exports include a download link which expires after 15 minutes, get the export again for a new one
+// @Tags			Export
+// @Produce		json
+// @Param			Path	path		ExportPathParams	true	"ExportPathParams"
+// @Success		200		{object}	response.Response{data=ExportResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/exports/{export_id} [get]
+func (api *API) Get(w http.ResponseWriter, r *http.Request) {
+	path := ExportPathParams{
+		ExportID: r.PathValue("export_id"),
+	}
+
+	if err := api.validator.Struct(path); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	exportID, err := uuid.Parse(path.ExportID)
+	if err != nil {
+		response.GenericBadRequestError(w, fmt.Errorf("Export does not exist"))
+		return
+	}
+
+	export, err := api.store.Exports.Get(r.Context(), exportID, user.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Export does not exist"))
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	res := ExportResponse{DataExport: *export}
+
+	if export.Status == models.ExportCompleted && export.ExpiresAt != nil && export.ExpiresAt.After(time.Now()) {
+		downloadToken, expiresAt, err := auth.NewExportDownloadToken(export.ID, *export.ExpiresAt)
+		if err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		downloadURL := fmt.Sprintf("/api/v1/exports/%s/download?token=%s", export.ID, downloadToken)
+		res.DownloadURL = &downloadURL
+		res.DownloadExpiresAt = &expiresAt
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Export %s has been retrieved by user %s", export.ID, user.ID)
+
+	response.HTTPResponse(w, res)
+}
+
+// @Summary		Download Data Export
+// @Description	Download the zip archive of a completed export with the token of its download link. The link works without a bearer token so it can be opened in a browser
+// @Tags			Export
+// @Produce		application/zip
+// @Param			Path	path		ExportPathParams	true	"ExportPathParams"
+// @Param			Query	query		DownloadQueryParams	true	"DownloadQueryParams"
+// @Success		200		{file}		file
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Router			/exports/{export_id}/download [get]
+func (api *API) Download(w http.ResponseWriter, r *http.Request) {
+	path := ExportPathParams{
+		ExportID: r.PathValue("export_id"),
+	}
+
+	if err := api.validator.Struct(path); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	query := DownloadQueryParams{
+		Token: r.FormValue("token"),
+	}
+
+	if err := api.validator.Struct(query); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	claim := auth.ParseExportDownloadToken(w, query.Token)
+	if claim == nil {
+		return
+	}
+
+	if claim.ExportID.String() != path.ExportID {
+		response.GenericUnauthenticatedError(w)
+		return
+	}
+
+	export, err := api.store.Exports.GetDownloadable(r.Context(), claim.ExportID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Export is not available"))
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	archive, err := api.blobs.Get(r.Context(), *export.BlobKey)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+	defer archive.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="koano-export-%s.zip"`, export.CreatedAt.Format("2006-01-02")))
+	if export.Size != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*export.Size, 10))
+	}
+
+	if _, err := io.Copy(w, archive); err != nil {
+		api.log.Error.PrintfContext(r.Context(), "Failed to send export %s: %v", export.ID, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Export %s has been downloaded", export.ID)
+}
@@ -0,0 +1,201 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-faker/faker/v4"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/api/resource/auth"
+	"github.com/ushiradineth/koano-api/api/resource/event"
+	"github.com/ushiradineth/koano-api/api/resource/export"
+	"github.com/ushiradineth/koano-api/api/resource/user"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	authUtil "github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/blob"
+	exportUtil "github.com/ushiradineth/koano-api/util/export"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/test"
+	"github.com/ushiradineth/koano-api/util/validator"
+)
+
+var (
+	accessToken  string
+	refreshToken string
+	user1ID      string
+	user2ID      string
+	user2Token   string
+	exportID     string
+	downloadURL  string
+	repositories *store.Store
+	blobs        *blob.MemoryStore
+	userAPI      *user.API
+	authAPI      *auth.API
+	eventAPI     *event.API
+	exportAPI    *export.API
+)
+
+var user1 user.PostBodyParams = user.PostBodyParams{
+	Name:     faker.Name(),
+	Email:    faker.Email(),
+	Password: "UPlow1234!@#",
+}
+
+var user2 user.PostBodyParams = user.PostBodyParams{
+	Name:     faker.Name(),
+	Email:    faker.Email(),
+	Password: "lowUP1234!@#",
+}
+
+var event1 event.EventBodyParams = event.EventBodyParams{
+	Title:     "Exported event",
+	StartTime: "2024-01-02T15:04:05Z",
+	EndTime:   "2024-01-02T16:04:05Z",
+	Timezone:  "Asia/Colombo",
+	Repeated:  "weekly",
+}
+
+func TestInit(t *testing.T) {
+	t.Run("Initiate Dependencies", func(t *testing.T) {
+		err := godotenv.Load("../../../.env")
+		if err != nil {
+			log.Println("Failed to load env")
+		}
+
+		repositories = test.NewStore()
+		v := validator.New()
+		l := logger.New()
+		m := mail.NewLogMailer(l)
+		blobs = blob.NewMemoryStore()
+
+		userAPI = user.New(repositories, v, l, m, test.NewConfig())
+		authAPI = auth.New(repositories, v, l, m, test.NewConfig())
+		eventAPI = event.New(repositories, v, l)
+		exportAPI = export.New(repositories, v, l, blobs)
+
+		test.CreateUserHelper(userAPI, t, user1, http.StatusOK, response.StatusSuccess)
+		test.AuthenticateUserHelper(authAPI, t, auth.AuthenticateBodyParams{Email: user1.Email, Password: user1.Password}, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+
+		test.CreateUserHelper(userAPI, t, user2, http.StatusOK, response.StatusSuccess)
+		test.AuthenticateUserHelper(authAPI, t, auth.AuthenticateBodyParams{Email: user2.Email, Password: user2.Password}, http.StatusOK, response.StatusSuccess, &user2ID, &user2Token, &refreshToken)
+
+		var eventID string
+		test.CreateEventHelper(eventAPI, t, event1, http.StatusOK, response.StatusSuccess, &eventID, accessToken)
+	})
+}
+
+func TestRequestExportHandler(t *testing.T) {
+	t.Run("Request export", func(t *testing.T) {
+		test.RequestExportHelper(exportAPI, t, http.StatusOK, response.StatusSuccess, accessToken, &exportID)
+	})
+
+	t.Run("Second request while the export is pending", func(t *testing.T) {
+		var id string
+		test.RequestExportHelper(exportAPI, t, http.StatusBadRequest, response.StatusFail, accessToken, &id)
+	})
+
+	t.Run("Export is built by the worker", func(t *testing.T) {
+		data := test.GetExportHelper(exportAPI, t, http.StatusOK, response.StatusSuccess, exportID, accessToken)
+		assert.Equal(t, models.ExportPending, data.Status, "Exports should wait for the worker")
+
+		assert.NoError(t, exportUtil.Process(context.Background(), repositories, blobs, 72*time.Hour))
+
+		data = test.GetExportHelper(exportAPI, t, http.StatusOK, response.StatusSuccess, exportID, accessToken)
+		assert.Equal(t, models.ExportCompleted, data.Status)
+		assert.NotNil(t, data.DownloadURL, "Download link is missing")
+		assert.NotNil(t, data.Size)
+		assert.NotNil(t, data.ExpiresAt)
+
+		if data.DownloadURL != nil {
+			downloadURL = *data.DownloadURL
+		}
+	})
+
+	t.Run("Only one export can be in progress", func(t *testing.T) {
+		pending, err := repositories.Exports.Create(context.Background(), models.DataExport{UserID: uuid.MustParse(user1ID)})
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer repositories.Exports.Fail(context.Background(), pending.ID, "Cancelled by the test")
+
+		var id string
+		test.RequestExportHelper(exportAPI, t, http.StatusBadRequest, response.StatusFail, accessToken, &id)
+	})
+
+	t.Run("Export of another user does not exist", func(t *testing.T) {
+		test.GetExportHelper(exportAPI, t, http.StatusBadRequest, response.StatusFail, exportID, user2Token)
+	})
+
+	t.Run("UUID is invalid", func(t *testing.T) {
+		test.GetExportHelper(exportAPI, t, http.StatusBadRequest, response.StatusFail, "not_an_uuid", accessToken)
+	})
+}
+
+func TestDownloadExportHandler(t *testing.T) {
+	t.Run("Download export", func(t *testing.T) {
+		archive := test.DownloadExportHelper(exportAPI, t, http.StatusOK, exportID, downloadURL)
+
+		reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		files := map[string]string{}
+		for _, file := range reader.File {
+			contents, _ := file.Open()
+			data, _ := io.ReadAll(contents)
+			contents.Close()
+			files[file.Name] = string(data)
+		}
+
+		assert.Contains(t, files["profile.json"], user1.Email)
+		assert.NotContains(t, files["profile.json"], "$argon2id", "Password hash should not be exported")
+		assert.Contains(t, files["events.json"], event1.Title)
+		assert.Contains(t, files["events.ics"], "SUMMARY:"+event1.Title)
+		assert.Contains(t, files["events.ics"], "RRULE:FREQ=WEEKLY")
+		assert.Contains(t, files, "sessions.json")
+		assert.Contains(t, files["audit.json"], "event.create")
+	})
+
+	t.Run("Token of another export is rejected", func(t *testing.T) {
+		token, _, _ := authUtil.NewExportDownloadToken(uuid.New(), time.Now().Add(time.Hour))
+		test.DownloadExportHelper(exportAPI, t, http.StatusUnauthorized, exportID, "/exports/"+exportID+"/download?token="+token)
+	})
+
+	t.Run("Token is invalid", func(t *testing.T) {
+		test.DownloadExportHelper(exportAPI, t, http.StatusBadRequest, exportID, "/exports/"+exportID+"/download?token=not_a_token")
+	})
+
+	t.Run("Expired export is removed", func(t *testing.T) {
+		completed, err := repositories.Exports.Get(context.Background(), uuid.MustParse(exportID), uuid.MustParse(user1ID))
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, repositories.Exports.Complete(context.Background(), completed.ID, *completed.BlobKey, *completed.Size, time.Now().Add(-time.Minute)))
+		assert.NoError(t, exportUtil.Process(context.Background(), repositories, blobs, 72*time.Hour))
+
+		data := test.GetExportHelper(exportAPI, t, http.StatusOK, response.StatusSuccess, exportID, accessToken)
+		assert.Equal(t, models.ExportExpired, data.Status)
+		assert.Nil(t, data.DownloadURL)
+
+		test.DownloadExportHelper(exportAPI, t, http.StatusBadRequest, exportID, downloadURL)
+	})
+}
+
+func TestCleanUp(t *testing.T) {
+	t.Run("Delete users", func(t *testing.T) {
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user1ID, accessToken)
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user2ID, user2Token)
+	})
+}
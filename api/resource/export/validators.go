@@ -0,0 +1,9 @@
+package export
+
+type ExportPathParams struct {
+	ExportID string `json:"export_id" validate:"required,uuid"`
+}
+
+type DownloadQueryParams struct {
+	Token string `json:"token" validate:"required,jwt"`
+}
@@ -1,15 +1,155 @@
 package health
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/jmoiron/sqlx"
+	"github.com/ushiradineth/koano-api/database"
+	logger "github.com/ushiradineth/koano-api/util/log"
 	"github.com/ushiradineth/koano-api/util/response"
 )
 
-func Health(w http.ResponseWriter, _ *http.Request) {
-	_, err := w.Write([]byte("healthy"))
-	if err != nil {
-		response.GenericServerError(w, err)
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+	StatusDraining = "draining"
+)
+
+// Check returns an error when the component it checks can't serve requests
+type Check func(ctx context.Context) error
+
+type component struct {
+	name  string
+	check Check
+}
+
+// Report has whether each component is ok or failing. Why a component fails is only logged, the probe is public and errors can reveal the infrastructure.
+type Report struct {
+	Status     string            `json:"status"`
+	Components map[string]string `json:"components"`
+}
+
+type API struct {
+	log        *logger.Logger
+	timeout    time.Duration
+	components []component
+	draining   atomic.Bool
+}
+
+// New checks each component with the timeout, so a hanging dependency fails the probe rather than timing it out
+func New(timeout time.Duration, log *logger.Logger) *API {
+	return &API{
+		log:     log,
+		timeout: timeout,
+	}
+}
+
+// Add checks the component on every readiness probe
+func (api *API) Add(name string, check Check) {
+	api.components = append(api.components, component{name: name, check: check})
+}
+
+// Drain fails readiness from now on, so the load balancer stops sending requests while those in flight finish
+func (api *API) Drain() {
+	api.draining.Store(true)
+}
+
+// @Summary		Liveness
+// @Description	Reports that the process is running. It doesn't check dependencies, so an outage of the database doesn't get the instance restarted
+// @Tags			Health
+// @Produce		json
+// @Success		200	{object}	response.Response{data=string}
+// @Router			/health/live [get]
+func (api *API) Live(w http.ResponseWriter, _ *http.Request) {
+	response.HTTPResponse(w, "alive")
+}
+
+// @Summary		Readiness
+// @Description	Reports whether the instance can serve requests, with whether each component it depends on is ok or failing. The worker fails once one of its jobs has stalled. Fails while the instance is shutting down
+// @Tags			Health
+// @Produce		json
+// @Success		200	{object}	response.Response{data=Report}
+// @Failure		503	{object}	response.Error{error=Report}
+// @Router			/health/ready [get]
+func (api *API) Ready(w http.ResponseWriter, r *http.Request) {
+	if api.draining.Load() {
+		response.HTTPError(w, http.StatusServiceUnavailable, Report{Status: StatusDraining, Components: map[string]string{}}, response.StatusError)
 		return
 	}
+
+	report := api.check(r.Context())
+	if report.Status != StatusReady {
+		response.HTTPError(w, http.StatusServiceUnavailable, report, response.StatusError)
+		return
+	}
+
+	response.HTTPResponse(w, report)
+}
+
+// check runs the checks at once, so the probe takes as long as the slowest of them
+func (api *API) check(ctx context.Context) Report {
+	report := Report{Status: StatusReady, Components: map[string]string{}}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range api.components {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, api.timeout)
+			defer cancel()
+
+			start := time.Now()
+			status := StatusOK
+			if err := c.check(checkCtx); err != nil {
+				status = StatusFailing
+				api.log.Warn.PrintfContext(ctx, "Readiness check %s failed after %s: %v", c.name, time.Since(start).Round(time.Millisecond), err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Components[c.name] = status
+			if status != StatusOK {
+				report.Status = StatusNotReady
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Database checks that a connection can be made and used
+func Database(db *sqlx.DB) Check {
+	return db.PingContext
+}
+
+// Migrations checks that the schema has every migration the code expects. A schema which is ahead is compatible, as while
+// a new version is rolled out it migrates the database before the previous version stops serving.
+func Migrations(migrator *database.Migrator) Check {
+	return func(ctx context.Context) error {
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		if status.Dirty {
+			return fmt.Errorf("Migration %d failed and left the database dirty", status.Version)
+		}
+
+		if len(status.Pending) > 0 {
+			return fmt.Errorf("Database is at version %d, %d migrations are pending", status.Version, len(status.Pending))
+		}
+
+		return nil
+	}
 }
@@ -1,22 +1,94 @@
 package health_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ushiradineth/koano-api/api/resource/health"
+	logger "github.com/ushiradineth/koano-api/util/log"
 )
 
-func TestHealth(t *testing.T) {
-	req, err := http.NewRequest("GET", "/health", nil)
-	assert.NoError(t, err)
+type readyResponse struct {
+	Code  int            `json:"code"`
+	Data  *health.Report `json:"data"`
+	Error *health.Report `json:"error"`
+}
+
+func ready(t *testing.T, api *health.API) (int, health.Report) {
+	res := httptest.NewRecorder()
+	api.Ready(res, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+
+	var body readyResponse
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+
+	if body.Data != nil {
+		return res.Code, *body.Data
+	}
+
+	return res.Code, *body.Error
+}
+
+func TestLive(t *testing.T) {
+	api := health.New(time.Second, logger.New())
+	api.Add("database", func(ctx context.Context) error { return errors.New("connection refused") })
 
 	res := httptest.NewRecorder()
+	api.Live(res, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	assert.Equal(t, http.StatusOK, res.Code, "Liveness should not depend on the database")
+}
+
+func TestReady(t *testing.T) {
+	t.Run("Every component is ok", func(t *testing.T) {
+		api := health.New(time.Second, logger.New())
+		api.Add("database", func(ctx context.Context) error { return nil })
+		api.Add("migrations", func(ctx context.Context) error { return nil })
+
+		code, report := ready(t, api)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, health.StatusReady, report.Status)
+		assert.Equal(t, health.StatusOK, report.Components["database"])
+		assert.Equal(t, health.StatusOK, report.Components["migrations"])
+	})
+
+	t.Run("Failing component", func(t *testing.T) {
+		api := health.New(time.Second, logger.New())
+		api.Add("database", func(ctx context.Context) error { return errors.New("connection refused") })
+		api.Add("migrations", func(ctx context.Context) error { return nil })
+
+		code, report := ready(t, api)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, health.StatusNotReady, report.Status)
+		assert.Equal(t, health.StatusFailing, report.Components["database"])
+		assert.Equal(t, health.StatusOK, report.Components["migrations"])
+	})
+
+	t.Run("Hanging component times out", func(t *testing.T) {
+		api := health.New(20*time.Millisecond, logger.New())
+		api.Add("database", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		start := time.Now()
+		code, report := ready(t, api)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, health.StatusFailing, report.Components["database"])
+	})
 
-	health.Health(res, req)
+	t.Run("Draining", func(t *testing.T) {
+		api := health.New(time.Second, logger.New())
+		api.Add("database", func(ctx context.Context) error { return nil })
+		api.Drain()
 
-	assert.Equal(t, http.StatusOK, res.Code)
-	assert.Equal(t, "healthy", res.Body.String())
+		code, report := ready(t, api)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, health.StatusDraining, report.Status)
+	})
 }
@@ -0,0 +1,215 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/response"
+)
+
+type ConsentClient struct {
+	ClientID string `json:"client_id"`
+	Name     string `json:"name"`
+}
+
+type ConsentScope struct {
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+type ConsentResponse struct {
+	Client      ConsentClient  `json:"client"`
+	Scopes      []ConsentScope `json:"scopes"`
+	RedirectURI string         `json:"redirect_uri"`
+	State       string         `json:"state"`
+}
+
+type AuthorizeResponse struct {
+	RedirectURI string `json:"redirect_uri"`
+}
+
+// @Summary		Get OAuth Consent
+// @Description	Validate an authorization request and return what the consent screen shows the authenticated user: the client and the scopes it asks for
+// @Tags			OAuth
+// @Produce		json
+// @Param			Query	query		AuthorizeQueryParams	true	"AuthorizeQueryParams"
+// @Success		200		{object}	response.Response{data=ConsentResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/oauth/authorize [get]
+func (api *API) GetConsent(w http.ResponseWriter, r *http.Request) {
+	query := AuthorizeQueryParams{
+		ResponseType:        r.FormValue("response_type"),
+		ClientID:            r.FormValue("client_id"),
+		RedirectURI:         r.FormValue("redirect_uri"),
+		Scope:               r.FormValue("scope"),
+		State:               r.FormValue("state"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+	}
+
+	if err := api.validator.Struct(query); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	client, scopes := api.getAuthorizationRequest(w, r, query)
+	if client == nil {
+		return
+	}
+
+	consentScopes := make([]ConsentScope, len(scopes))
+	for i, scope := range scopes {
+		consentScopes[i] = ConsentScope{
+			Scope:       scope,
+			Description: auth.Scopes[scope],
+		}
+	}
+
+	response.HTTPResponse(w, ConsentResponse{
+		Client: ConsentClient{
+			ClientID: client.ID.String(),
+			Name:     client.Name,
+		},
+		Scopes:      consentScopes,
+		RedirectURI: query.RedirectURI,
+		State:       query.State,
+	})
+}
+
+// @Summary		Authorize OAuth Client
+// @Description	Record the authenticated user's decision on an authorization request. Returns the redirect URI carrying the authorization code, or an access_denied error if the user declined
+// @Tags			OAuth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		AuthorizeBodyParams	true	"AuthorizeBodyParams"
+// @Success		200		{object}	response.Response{data=AuthorizeResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/oauth/authorize [post]
+func (api *API) Authorize(w http.ResponseWriter, r *http.Request) {
+	var body AuthorizeBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	client, scopes := api.getAuthorizationRequest(w, r, body.AuthorizeQueryParams)
+	if client == nil {
+		return
+	}
+
+	redirectQuery := url.Values{}
+	if body.State != "" {
+		redirectQuery.Set("state", body.State)
+	}
+
+	if !body.Approve {
+		redirectQuery.Set("error", "access_denied")
+		redirectQuery.Set("error_description", "The user denied the request")
+
+		api.log.Info.PrintfContext(r.Context(), "User %s has denied OAuth client %s", user.ID, client.ID)
+
+		response.HTTPResponse(w, AuthorizeResponse{RedirectURI: withQuery(body.RedirectURI, redirectQuery)})
+		return
+	}
+
+	code, err := auth.NewOAuthAuthorizationCode()
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	err = api.store.OAuth.CreateCode(r.Context(), models.OAuthAuthorizationCode{
+		CodeHash:      auth.HashOAuthToken(code),
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectURI:   body.RedirectURI,
+		Scopes:        pq.StringArray(scopes),
+		CodeChallenge: body.CodeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationCodeLifetime),
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	redirectQuery.Set("code", code)
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionClientAuth, TargetType: audit.TargetOAuthClient, TargetID: &client.ID, After: map[string]any{"scopes": scopes}})
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has authorized OAuth client %s", user.ID, client.ID)
+
+	response.HTTPResponse(w, AuthorizeResponse{RedirectURI: withQuery(body.RedirectURI, redirectQuery)})
+}
+
+// getAuthorizationRequest checks the client, redirect URI and scopes of an authorization request. Errors are not redirected since the redirect URI can't be trusted until it has been checked.
+func (api *API) getAuthorizationRequest(w http.ResponseWriter, r *http.Request, query AuthorizeQueryParams) (*models.OAuthClient, []string) {
+	clientID, err := uuid.Parse(query.ClientID)
+	if err != nil {
+		response.GenericBadRequestError(w, fmt.Errorf("OAuth client %s does not exist", query.ClientID))
+		return nil, nil
+	}
+
+	client, err := api.store.OAuth.GetActiveClient(r.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("OAuth client %s does not exist", query.ClientID))
+			return nil, nil
+		}
+
+		response.GenericServerError(w, err)
+		return nil, nil
+	}
+
+	if !client.HasRedirectURI(query.RedirectURI) {
+		response.GenericBadRequestError(w, fmt.Errorf("Redirect URI %s is not registered for the client", query.RedirectURI))
+		return nil, nil
+	}
+
+	scopes := auth.ParseScope(query.Scope)
+	if len(scopes) == 0 {
+		response.GenericBadRequestError(w, fmt.Errorf("At least one scope is required"))
+		return nil, nil
+	}
+
+	for _, scope := range scopes {
+		if !auth.IsValidScope(scope) || !client.HasScope(scope) {
+			response.GenericBadRequestError(w, fmt.Errorf("Scope `%s` is not allowed for the client", scope))
+			return nil, nil
+		}
+	}
+
+	return client, scopes
+}
+
+func withQuery(redirectURI string, query url.Values) string {
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+
+	return redirectURI + separator + query.Encode()
+}
@@ -0,0 +1,176 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/response"
+)
+
+const (
+	authorizationCodeLifetime = 10 * time.Minute
+	grantLifetime             = 30 * 24 * time.Hour
+)
+
+type API struct {
+	store     *store.Store
+	validator *validator.Validate
+	log       *logger.Logger
+}
+
+func New(store *store.Store, validator *validator.Validate, log *logger.Logger) *API {
+	return &API{
+		store:     store,
+		validator: validator,
+		log:       log,
+	}
+}
+
+type PostClientResponse struct {
+	models.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// @Summary		Register OAuth Client
+// @Description	Register an application which can ask users for access to their account. Confidential clients receive a client secret which is only returned once, public clients authenticate with PKCE alone
+// @Tags			OAuth
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		PostClientBodyParams	true	"PostClientBodyParams"
+// @Success		200		{object}	response.Response{data=PostClientResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/oauth/clients [post]
+func (api *API) PostClient(w http.ResponseWriter, r *http.Request) {
+	var body PostClientBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	var clientSecret string
+	var secretHash *string
+	if body.Confidential {
+		var err error
+		clientSecret, err = auth.NewOAuthClientSecret()
+		if err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		hash := auth.HashOAuthToken(clientSecret)
+		secretHash = &hash
+	}
+
+	client, err := api.store.OAuth.CreateClient(r.Context(), models.OAuthClient{
+		ID:           uuid.New(),
+		UserID:       user.ID,
+		Name:         body.Name,
+		SecretHash:   secretHash,
+		RedirectURIs: pq.StringArray(body.RedirectURIs),
+		Scopes:       pq.StringArray(auth.ParseScope(auth.FormatScope(body.Scopes))),
+	})
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionClientCreate, TargetType: audit.TargetOAuthClient, TargetID: &client.ID, After: client})
+
+	api.log.Info.PrintfContext(r.Context(), "OAuth client %s has been registered by user %s", client.ID, user.ID)
+
+	response.HTTPResponse(w, PostClientResponse{
+		OAuthClient:  *client,
+		ClientSecret: clientSecret,
+	})
+}
+
+// @Summary		Get User OAuth Clients
+// @Description	Get the OAuth clients registered by the authenticated user, including revoked clients
+// @Tags			OAuth
+// @Produce		json
+// @Success		200	{object}	response.Response{data=[]models.OAuthClient}
+// @Failure		400	{object}	response.Error
+// @Failure		401	{object}	response.Error
+// @Failure		500	{object}	response.Error
+// @Security		BearerAuth
+// @Router			/oauth/clients [get]
+func (api *API) GetUserClients(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	clients, err := api.store.OAuth.ListClientsByUser(r.Context(), user.ID)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "OAuth clients for user %s have been retrieved", user.ID)
+
+	response.HTTPResponse(w, clients)
+}
+
+// @Summary		Revoke OAuth Client
+// @Description	Revoke an OAuth client registered by the authenticated user. Every grant given to the client is revoked along with it
+// @Tags			OAuth
+// @Produce		json
+// @Param			Path	path		ClientPathParams	true	"ClientPathParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/oauth/clients/{client_id} [delete]
+func (api *API) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	path := ClientPathParams{
+		ClientID: r.PathValue("client_id"),
+	}
+
+	if err := api.validator.Struct(path); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	clientID, err := uuid.Parse(path.ClientID)
+	if err != nil {
+		response.GenericBadRequestError(w, fmt.Errorf("OAuth client does not exist"))
+		return
+	}
+
+	if err := api.store.OAuth.RevokeClient(r.Context(), clientID, user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("OAuth client does not exist"))
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionClientDelete, TargetType: audit.TargetOAuthClient, TargetID: &clientID})
+
+	api.log.Info.PrintfContext(r.Context(), "OAuth client %s has been revoked by user %s", path.ClientID, user.ID)
+
+	response.HTTPResponse(w, "OAuth client has been successfully revoked")
+}
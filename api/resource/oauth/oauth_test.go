@@ -0,0 +1,346 @@
+package oauth_test
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-faker/faker/v4"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/api/resource/auth"
+	"github.com/ushiradineth/koano-api/api/resource/event"
+	"github.com/ushiradineth/koano-api/api/resource/oauth"
+	"github.com/ushiradineth/koano-api/api/resource/user"
+	"github.com/ushiradineth/koano-api/api/router"
+	"github.com/ushiradineth/koano-api/store"
+	authUtil "github.com/ushiradineth/koano-api/util/auth"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/oidc"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/test"
+	"github.com/ushiradineth/koano-api/util/validator"
+)
+
+var (
+	accessToken       string
+	refreshToken      string
+	user1ID           string
+	clientID          string
+	clientSecret      string
+	publicClientID    string
+	oauthAccessToken  string
+	oauthRefreshToken string
+	repositories      *store.Store
+	l                 *logger.Logger
+	userAPI           *user.API
+	authAPI           *auth.API
+	eventAPI          *event.API
+	oauthAPI          *oauth.API
+)
+
+const redirectURI = "https://partner.example.com/callback"
+
+var user1 user.PostBodyParams = user.PostBodyParams{
+	Name:     faker.Name(),
+	Email:    faker.Email(),
+	Password: "UPlow1234!@#",
+}
+
+var user1Auth auth.AuthenticateBodyParams = auth.AuthenticateBodyParams{
+	Email:    user1.Email,
+	Password: user1.Password,
+}
+
+func TestInit(t *testing.T) {
+	t.Run("Initiate Dependencies", func(t *testing.T) {
+		err := godotenv.Load("../../../.env")
+		if err != nil {
+			log.Println("Failed to load env")
+		}
+
+		repositories = test.NewStore()
+		v := validator.New()
+		l = logger.New()
+		m := mail.NewLogMailer(l)
+
+		userAPI = user.New(repositories, v, l, m, test.NewConfig())
+		authAPI = auth.New(repositories, v, l, m, test.NewConfig())
+		eventAPI = event.New(repositories, v, l)
+		oauthAPI = oauth.New(repositories, v, l)
+
+		t.Run("Create User 1", func(t *testing.T) {
+			test.CreateUserHelper(userAPI, t, user1, http.StatusOK, response.StatusSuccess)
+		})
+
+		t.Run("Authenticates User 1", func(t *testing.T) {
+			test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		})
+	})
+}
+
+func TestCreateClientHandler(t *testing.T) {
+	body := oauth.PostClientBodyParams{
+		Name:         "Partner Calendar",
+		RedirectURIs: []string{redirectURI},
+		Scopes:       []string{authUtil.ScopeEventsRead, authUtil.ScopeUserRead},
+		Confidential: true,
+	}
+
+	t.Run("Create confidential client", func(t *testing.T) {
+		test.CreateOAuthClientHelper(oauthAPI, t, body, http.StatusOK, response.StatusSuccess, accessToken, &clientID, &clientSecret)
+	})
+
+	body.Confidential = false
+	t.Run("Create public client", func(t *testing.T) {
+		var secret string
+		test.CreateOAuthClientHelper(oauthAPI, t, body, http.StatusOK, response.StatusSuccess, accessToken, &publicClientID, &secret)
+	})
+
+	body.RedirectURIs = []string{"not_an_url"}
+	t.Run("Redirect URI is invalid", func(t *testing.T) {
+		var id, secret string
+		test.CreateOAuthClientHelper(oauthAPI, t, body, http.StatusBadRequest, response.StatusFail, accessToken, &id, &secret)
+	})
+
+	for _, uri := range []string{"http://partner.example.com/callback", "https://partner.example.com/callback#fragment", "javascript://partner.example.com/%0Aalert(document.cookie)", "data:text/html,<script>alert(1)</script>"} {
+		body.RedirectURIs = []string{uri}
+		t.Run("Redirect URI is not allowed "+uri, func(t *testing.T) {
+			var id, secret string
+			test.CreateOAuthClientHelper(oauthAPI, t, body, http.StatusBadRequest, response.StatusFail, accessToken, &id, &secret)
+		})
+	}
+
+	body.RedirectURIs = []string{"http://127.0.0.1:8080/callback"}
+	t.Run("Redirect URI on loopback", func(t *testing.T) {
+		var id, secret string
+		test.CreateOAuthClientHelper(oauthAPI, t, body, http.StatusOK, response.StatusSuccess, accessToken, &id, &secret)
+	})
+
+	body.RedirectURIs = []string{redirectURI}
+	body.Scopes = []string{"events:delete"}
+	t.Run("Scope is invalid", func(t *testing.T) {
+		var id, secret string
+		test.CreateOAuthClientHelper(oauthAPI, t, body, http.StatusBadRequest, response.StatusFail, accessToken, &id, &secret)
+	})
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	codeVerifier, codeChallenge, err := oidc.NewPKCE()
+	assert.NoError(t, err)
+
+	query := oauth.AuthorizeQueryParams{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         redirectURI,
+		Scope:               authUtil.ScopeEventsRead,
+		State:               "xyz",
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: "S256",
+	}
+
+	t.Run("Get consent", func(t *testing.T) {
+		test.GetOAuthConsentHelper(oauthAPI, t, query, http.StatusOK, response.StatusSuccess, accessToken)
+	})
+
+	t.Run("Redirect URI is not registered", func(t *testing.T) {
+		unregistered := query
+		unregistered.RedirectURI = "https://attacker.example.com/callback"
+		test.GetOAuthConsentHelper(oauthAPI, t, unregistered, http.StatusBadRequest, response.StatusFail, accessToken)
+	})
+
+	t.Run("Scope is not allowed for the client", func(t *testing.T) {
+		disallowed := query
+		disallowed.Scope = authUtil.ScopeEventsWrite
+		test.GetOAuthConsentHelper(oauthAPI, t, disallowed, http.StatusBadRequest, response.StatusFail, accessToken)
+	})
+
+	t.Run("User denies", func(t *testing.T) {
+		var redirect string
+		test.AuthorizeOAuthClientHelper(oauthAPI, t, oauth.AuthorizeBodyParams{AuthorizeQueryParams: query, Approve: false}, http.StatusOK, response.StatusSuccess, accessToken, &redirect)
+
+		parsed, _ := url.Parse(redirect)
+		assert.Equal(t, "access_denied", parsed.Query().Get("error"))
+		assert.Equal(t, "xyz", parsed.Query().Get("state"))
+	})
+
+	var code string
+	t.Run("User approves", func(t *testing.T) {
+		var redirect string
+		test.AuthorizeOAuthClientHelper(oauthAPI, t, oauth.AuthorizeBodyParams{AuthorizeQueryParams: query, Approve: true}, http.StatusOK, response.StatusSuccess, accessToken, &redirect)
+
+		parsed, _ := url.Parse(redirect)
+		code = parsed.Query().Get("code")
+		assert.NotEmpty(t, code, "Code is missing")
+		assert.Equal(t, "xyz", parsed.Query().Get("state"))
+	})
+
+	form := url.Values{
+		"grant_type":    []string{"authorization_code"},
+		"code":          []string{code},
+		"redirect_uri":  []string{redirectURI},
+		"code_verifier": []string{codeVerifier},
+		"client_id":     []string{clientID},
+		"client_secret": []string{clientSecret},
+	}
+
+	t.Run("Client secret is wrong", func(t *testing.T) {
+		wrongSecret := url.Values{}
+		for key, value := range form {
+			wrongSecret[key] = value
+		}
+		wrongSecret.Set("client_secret", "wrong")
+
+		body := test.OAuthFormHelper(oauthAPI.Token, t, wrongSecret, http.StatusUnauthorized)
+		assert.Equal(t, "invalid_client", body["error"])
+	})
+
+	t.Run("Exchange code", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Token, t, form, http.StatusOK)
+		assert.Equal(t, "Bearer", body["token_type"])
+		assert.Equal(t, authUtil.ScopeEventsRead, body["scope"])
+
+		oauthAccessToken, _ = body["access_token"].(string)
+		oauthRefreshToken, _ = body["refresh_token"].(string)
+		assert.NotEmpty(t, oauthAccessToken, "Access Token is missing")
+		assert.NotEmpty(t, oauthRefreshToken, "Refresh Token is missing")
+	})
+
+	t.Run("Code is single use", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Token, t, form, http.StatusBadRequest)
+		assert.Equal(t, "invalid_grant", body["error"])
+	})
+
+	t.Run("Access token has scope", func(t *testing.T) {
+		getUserEvents := router.Scoped(repositories, l, authUtil.ScopeEventsRead, router.Authenticated(repositories.Users, eventAPI.GetUserEvents))
+		test.ScopedRequestHelper(getUserEvents, t, http.MethodGet, "/events?start_day=2024-01-01&end_day=2024-12-31", http.StatusOK, response.StatusSuccess, oauthAccessToken)
+	})
+
+	t.Run("Access token is missing scope", func(t *testing.T) {
+		getUser := router.Scoped(repositories, l, authUtil.ScopeUserRead, router.Authenticated(repositories.Users, userAPI.Get))
+		test.ScopedRequestHelper(getUser, t, http.MethodGet, "/users/"+user1ID, http.StatusForbidden, response.StatusFail, oauthAccessToken)
+	})
+
+	t.Run("Access token is not allowed on unscoped routes", func(t *testing.T) {
+		test.ScopedRequestHelper(router.Authenticated(repositories.Users, oauthAPI.GetUserClients), t, http.MethodGet, "/oauth/clients", http.StatusForbidden, response.StatusFail, oauthAccessToken)
+	})
+}
+
+func TestPublicClient(t *testing.T) {
+	codeVerifier, codeChallenge, err := oidc.NewPKCE()
+	assert.NoError(t, err)
+
+	query := oauth.AuthorizeQueryParams{
+		ResponseType:        "code",
+		ClientID:            publicClientID,
+		RedirectURI:         redirectURI,
+		Scope:               authUtil.ScopeUserRead,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: "S256",
+	}
+
+	var redirect string
+	test.AuthorizeOAuthClientHelper(oauthAPI, t, oauth.AuthorizeBodyParams{AuthorizeQueryParams: query, Approve: true}, http.StatusOK, response.StatusSuccess, accessToken, &redirect)
+
+	parsed, _ := url.Parse(redirect)
+	form := url.Values{
+		"grant_type":    []string{"authorization_code"},
+		"code":          []string{parsed.Query().Get("code")},
+		"redirect_uri":  []string{redirectURI},
+		"code_verifier": []string{"wrong-verifier-wrong-verifier-wrong-verifier"},
+		"client_id":     []string{publicClientID},
+	}
+
+	t.Run("Code verifier is wrong", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Token, t, form, http.StatusBadRequest)
+		assert.Equal(t, "invalid_grant", body["error"])
+	})
+
+	t.Run("Code can't be retried after a failed exchange", func(t *testing.T) {
+		form.Set("code_verifier", codeVerifier)
+		body := test.OAuthFormHelper(oauthAPI.Token, t, form, http.StatusBadRequest)
+		assert.Equal(t, "invalid_grant", body["error"])
+	})
+}
+
+func TestRefreshIntrospectRevoke(t *testing.T) {
+	credentials := url.Values{
+		"client_id":     []string{clientID},
+		"client_secret": []string{clientSecret},
+	}
+
+	withCredentials := func(values url.Values) url.Values {
+		for key, value := range credentials {
+			values[key] = value
+		}
+		return values
+	}
+
+	t.Run("Introspect access token", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Introspect, t, withCredentials(url.Values{"token": []string{oauthAccessToken}}), http.StatusOK)
+		assert.Equal(t, true, body["active"])
+		assert.Equal(t, user1ID, body["sub"])
+		assert.Equal(t, authUtil.ScopeEventsRead, body["scope"])
+		assert.Equal(t, "access_token", body["token_type"])
+	})
+
+	t.Run("Introspect unknown token", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Introspect, t, withCredentials(url.Values{"token": []string{"not_a_token"}}), http.StatusOK)
+		assert.Equal(t, false, body["active"])
+	})
+
+	t.Run("Introspect requires client authentication", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Introspect, t, url.Values{"token": []string{oauthAccessToken}, "client_id": []string{clientID}}, http.StatusUnauthorized)
+		assert.Equal(t, "invalid_client", body["error"])
+	})
+
+	previousRefreshToken := oauthRefreshToken
+	t.Run("Refresh token", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Token, t, withCredentials(url.Values{"grant_type": []string{"refresh_token"}, "refresh_token": []string{oauthRefreshToken}}), http.StatusOK)
+
+		oauthAccessToken, _ = body["access_token"].(string)
+		oauthRefreshToken, _ = body["refresh_token"].(string)
+		assert.NotEqual(t, previousRefreshToken, oauthRefreshToken, "Refresh token should be rotated")
+	})
+
+	t.Run("Rotated refresh token is rejected", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Token, t, withCredentials(url.Values{"grant_type": []string{"refresh_token"}, "refresh_token": []string{previousRefreshToken}}), http.StatusBadRequest)
+		assert.Equal(t, "invalid_grant", body["error"])
+	})
+
+	t.Run("Refresh can't widen scope", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Token, t, withCredentials(url.Values{"grant_type": []string{"refresh_token"}, "refresh_token": []string{oauthRefreshToken}, "scope": []string{authUtil.ScopeUserRead}}), http.StatusBadRequest)
+		assert.Equal(t, "invalid_scope", body["error"])
+	})
+
+	t.Run("Revoke refresh token", func(t *testing.T) {
+		test.OAuthFormHelper(oauthAPI.Revoke, t, withCredentials(url.Values{"token": []string{oauthRefreshToken}, "token_type_hint": []string{"refresh_token"}}), http.StatusOK)
+	})
+
+	t.Run("Revoking an unknown token succeeds", func(t *testing.T) {
+		test.OAuthFormHelper(oauthAPI.Revoke, t, withCredentials(url.Values{"token": []string{"not_a_token"}}), http.StatusOK)
+	})
+
+	t.Run("Access token of revoked grant is inactive", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Introspect, t, withCredentials(url.Values{"token": []string{oauthAccessToken}}), http.StatusOK)
+		assert.Equal(t, false, body["active"])
+	})
+
+	t.Run("Access token of revoked grant is rejected", func(t *testing.T) {
+		getUserEvents := router.Scoped(repositories, l, authUtil.ScopeEventsRead, router.Authenticated(repositories.Users, eventAPI.GetUserEvents))
+		test.ScopedRequestHelper(getUserEvents, t, http.MethodGet, "/events?start_day=2024-01-01&end_day=2024-12-31", http.StatusUnauthorized, response.StatusFail, oauthAccessToken)
+	})
+
+	t.Run("Grant type is unsupported", func(t *testing.T) {
+		body := test.OAuthFormHelper(oauthAPI.Token, t, withCredentials(url.Values{"grant_type": []string{"password"}}), http.StatusBadRequest)
+		assert.Equal(t, "unsupported_grant_type", body["error"])
+	})
+}
+
+func TestCleanUp(t *testing.T) {
+	t.Run("Delete user", func(t *testing.T) {
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user1ID, accessToken)
+	})
+}
@@ -0,0 +1,429 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/auth"
+)
+
+// Token, revocation and introspection responses follow RFC 6749, RFC 7009 and RFC 7662 rather than the response envelope so off the shelf OAuth client libraries work against them
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+type IntrospectResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// @Summary		OAuth Token
+// @Description	Exchange an authorization code and its PKCE code verifier, or a refresh token, for an access token. Refresh tokens are rotated on every use. Clients authenticate with HTTP Basic or client_id and client_secret form fields
+// @Tags			OAuth
+// @Accept			x-www-form-urlencoded
+// @Produce		json
+// @Param			grant_type		formData	string	true	"authorization_code or refresh_token"
+// @Param			code			formData	string	false	"Authorization code"
+// @Param			redirect_uri	formData	string	false	"Redirect URI of the authorization request"
+// @Param			code_verifier	formData	string	false	"PKCE code verifier"
+// @Param			refresh_token	formData	string	false	"Refresh token"
+// @Param			scope			formData	string	false	"Narrower scope for a refreshed access token"
+// @Param			client_id		formData	string	false	"Client ID"
+// @Param			client_secret	formData	string	false	"Client secret"
+// @Success		200				{object}	TokenResponse
+// @Failure		400				{object}	ErrorResponse
+// @Failure		401				{object}	ErrorResponse
+// @Failure		500				{object}	ErrorResponse
+// @Router			/oauth/token [post]
+func (api *API) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "Request body must be form encoded")
+		return
+	}
+
+	client := api.authenticateClient(w, r)
+	if client == nil {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		api.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		api.exchangeRefreshToken(w, r, client)
+	case "":
+		oauthError(w, http.StatusBadRequest, "invalid_request", "grant_type is required")
+	default:
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type", "Only authorization_code and refresh_token grants are supported")
+	}
+}
+
+// @Summary		Revoke OAuth Token
+// @Description	Revoke a refresh token or access token issued to the client (RFC 7009). Either token revokes the whole grant. Unknown tokens are not an error
+// @Tags			OAuth
+// @Accept			x-www-form-urlencoded
+// @Produce		json
+// @Param			token			formData	string	true	"Token to revoke"
+// @Param			token_type_hint	formData	string	false	"access_token or refresh_token"
+// @Param			client_id		formData	string	false	"Client ID"
+// @Param			client_secret	formData	string	false	"Client secret"
+// @Success		200
+// @Failure		400	{object}	ErrorResponse
+// @Failure		401	{object}	ErrorResponse
+// @Failure		500	{object}	ErrorResponse
+// @Router			/oauth/revoke [post]
+func (api *API) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "Request body must be form encoded")
+		return
+	}
+
+	client := api.authenticateClient(w, r)
+	if client == nil {
+		return
+	}
+
+	tokenValue := r.PostForm.Get("token")
+	if tokenValue == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	grant, err := api.getGrantByToken(r.Context(), tokenValue, client)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	if grant != nil {
+		if err := api.store.OAuth.RevokeGrant(r.Context(), grant.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+
+		api.log.Info.PrintfContext(r.Context(), "OAuth grant %s has been revoked by client %s", grant.ID, client.ID)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// @Summary		Introspect OAuth Token
+// @Description	Report whether a refresh token or access token issued to the client is active, along with its scope and subject (RFC 7662). Tokens issued to other clients are reported as inactive
+// @Tags			OAuth
+// @Accept			x-www-form-urlencoded
+// @Produce		json
+// @Param			token			formData	string	true	"Token to introspect"
+// @Param			token_type_hint	formData	string	false	"access_token or refresh_token"
+// @Param			client_id		formData	string	false	"Client ID"
+// @Param			client_secret	formData	string	false	"Client secret"
+// @Success		200				{object}	IntrospectResponse
+// @Failure		400				{object}	ErrorResponse
+// @Failure		401				{object}	ErrorResponse
+// @Failure		500				{object}	ErrorResponse
+// @Router			/oauth/introspect [post]
+func (api *API) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "Request body must be form encoded")
+		return
+	}
+
+	client := api.authenticateClient(w, r)
+	if client == nil {
+		return
+	}
+
+	tokenValue := r.PostForm.Get("token")
+	if tokenValue == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	grant, err := api.getGrantByToken(r.Context(), tokenValue, client)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	if grant == nil || grant.RevokedAt != nil || !grant.ExpiresAt.After(time.Now()) {
+		oauthResponse(w, IntrospectResponse{Active: false})
+		return
+	}
+
+	if claim, err := auth.ParseOAuthAccessToken(tokenValue); err == nil {
+		oauthResponse(w, IntrospectResponse{
+			Active:    true,
+			Scope:     claim.Scope,
+			ClientID:  claim.ClientID.String(),
+			Subject:   claim.Subject,
+			TokenType: "access_token",
+			ExpiresAt: claim.ExpiresAt,
+			IssuedAt:  claim.IssuedAt,
+		})
+		return
+	}
+
+	issuedAt := grant.CreatedAt
+	if grant.LastUsedAt != nil {
+		issuedAt = *grant.LastUsedAt
+	}
+
+	oauthResponse(w, IntrospectResponse{
+		Active:    true,
+		Scope:     auth.FormatScope(grant.Scopes),
+		ClientID:  grant.ClientID.String(),
+		Subject:   grant.UserID.String(),
+		TokenType: "refresh_token",
+		ExpiresAt: grant.ExpiresAt.Unix(),
+		IssuedAt:  issuedAt.Unix(),
+	})
+}
+
+func (api *API) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	code := r.PostForm.Get("code")
+	codeVerifier := r.PostForm.Get("code_verifier")
+	if code == "" || codeVerifier == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "code and code_verifier are required")
+		return
+	}
+
+	// Codes are single use, deleting it up front stops it from being replayed
+	authorizationCode, err := api.store.OAuth.ConsumeCode(r.Context(), auth.HashOAuthToken(code))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid")
+			return
+		}
+
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	if authorizationCode.ClientID != client.ID || !authorizationCode.ExpiresAt.After(time.Now()) {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid or has expired")
+		return
+	}
+
+	if authorizationCode.RedirectURI != r.PostForm.Get("redirect_uri") {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+		return
+	}
+
+	if !auth.VerifyPKCE(codeVerifier, authorizationCode.CodeChallenge) {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code challenge")
+		return
+	}
+
+	if _, err := api.store.Users.GetByID(r.Context(), authorizationCode.UserID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "User no longer exists")
+			return
+		}
+
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	refreshToken, err := auth.NewOAuthRefreshToken()
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	grant, err := api.store.OAuth.CreateGrant(r.Context(), models.OAuthGrant{
+		ID:               uuid.New(),
+		ClientID:         client.ID,
+		UserID:           authorizationCode.UserID,
+		RefreshTokenHash: auth.HashOAuthToken(refreshToken),
+		Scopes:           authorizationCode.Scopes,
+		ExpiresAt:        time.Now().Add(grantLifetime),
+	})
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "OAuth grant %s has been created for client %s by user %s", grant.ID, client.ID, grant.UserID)
+
+	api.respondWithTokens(w, grant, grant.Scopes, refreshToken)
+}
+
+func (api *API) exchangeRefreshToken(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	refreshToken := r.PostForm.Get("refresh_token")
+	if refreshToken == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+		return
+	}
+
+	if !auth.IsOAuthRefreshToken(refreshToken) {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is invalid or has expired")
+		return
+	}
+
+	grant, err := api.getGrantByToken(r.Context(), refreshToken, client)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	if grant == nil || grant.RevokedAt != nil || !grant.ExpiresAt.After(time.Now()) {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is invalid or has expired")
+		return
+	}
+
+	scopes := []string(grant.Scopes)
+	if scope := r.PostForm.Get("scope"); scope != "" {
+		scopes = auth.ParseScope(scope)
+		for _, s := range scopes {
+			if !grant.HasScope(s) {
+				oauthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the scope of the grant")
+				return
+			}
+		}
+	}
+
+	newRefreshToken, err := auth.NewOAuthRefreshToken()
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	// Matching on the old hash makes concurrent refreshes with the same token fail instead of forking the grant
+	grant, err = api.store.OAuth.RotateGrant(r.Context(), grant.ID, auth.HashOAuthToken(refreshToken), auth.HashOAuthToken(newRefreshToken), time.Now().Add(grantLifetime))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is invalid or has expired")
+			return
+		}
+
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "OAuth grant %s has been refreshed by client %s", grant.ID, client.ID)
+
+	api.respondWithTokens(w, grant, scopes, newRefreshToken)
+}
+
+func (api *API) respondWithTokens(w http.ResponseWriter, grant *models.OAuthGrant, scopes []string, refreshToken string) {
+	accessToken, expiresIn, err := auth.NewOAuthAccessToken(grant.UserID, grant.ClientID, grant.ID, scopes)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	oauthResponse(w, TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresIn,
+		RefreshToken: refreshToken,
+		Scope:        auth.FormatScope(scopes),
+	})
+}
+
+// authenticateClient identifies the client by HTTP Basic or form credentials. Confidential clients must present their secret, public clients only their ID.
+func (api *API) authenticateClient(w http.ResponseWriter, r *http.Request) *models.OAuthClient {
+	clientID, clientSecret, basic := r.BasicAuth()
+	if !basic {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		invalidClient(w, basic)
+		return nil
+	}
+
+	client, err := api.store.OAuth.GetActiveClient(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			invalidClient(w, basic)
+			return nil
+		}
+
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return nil
+	}
+
+	if client.IsConfidential() && !auth.CheckOAuthClientSecret(clientSecret, *client.SecretHash) {
+		invalidClient(w, basic)
+		return nil
+	}
+
+	return client
+}
+
+// getGrantByToken returns the grant of a refresh token or access token issued to the client, or nil if there is none. Revoked and expired grants are returned so callers can tell them apart.
+func (api *API) getGrantByToken(ctx context.Context, tokenValue string, client *models.OAuthClient) (*models.OAuthGrant, error) {
+	var grant *models.OAuthGrant
+	var err error
+	if claim, parseErr := auth.ParseOAuthAccessToken(tokenValue); parseErr == nil {
+		grantID, parseErr := uuid.Parse(claim.Id)
+		if parseErr != nil {
+			return nil, nil
+		}
+
+		grant, err = api.store.OAuth.GetClientGrant(ctx, grantID, client.ID)
+	} else {
+		grant, err = api.store.OAuth.GetClientGrantByRefreshToken(ctx, auth.HashOAuthToken(tokenValue), client.ID)
+	}
+
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+func invalidClient(w http.ResponseWriter, basic bool) {
+	if basic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+
+	oauthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+}
+
+func oauthResponse(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, "Failed to generate the response", http.StatusInternalServerError)
+	}
+}
+
+func oauthError(w http.ResponseWriter, code int, errorCode string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: errorCode, ErrorDescription: description}); err != nil {
+		http.Error(w, "Failed to generate the error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,27 @@
+package oauth
+
+type ClientPathParams struct {
+	ClientID string `json:"client_id" validate:"required,uuid"`
+}
+
+type PostClientBodyParams struct {
+	Name         string   `json:"name" validate:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,min=1,max=10,dive,redirectURI"`
+	Scopes       []string `json:"scopes" validate:"required,min=1,dive,oneof=events:read events:write user:read user:write"`
+	Confidential bool     `json:"confidential"`
+}
+
+type AuthorizeQueryParams struct {
+	ResponseType        string `json:"response_type" validate:"required,oneof=code"`
+	ClientID            string `json:"client_id" validate:"required,uuid"`
+	RedirectURI         string `json:"redirect_uri" validate:"required,url"`
+	Scope               string `json:"scope" validate:"required"`
+	State               string `json:"state" validate:"max=500"`
+	CodeChallenge       string `json:"code_challenge" validate:"required,min=43,max=128"`
+	CodeChallengeMethod string `json:"code_challenge_method" validate:"required,oneof=S256"`
+}
+
+type AuthorizeBodyParams struct {
+	AuthorizeQueryParams
+	Approve bool `json:"approve"`
+}
@@ -0,0 +1,170 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
+	"github.com/ushiradineth/koano-api/util/auth"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/response"
+)
+
+type API struct {
+	store     *store.Store
+	validator *validator.Validate
+	log       *logger.Logger
+}
+
+func New(store *store.Store, validator *validator.Validate, log *logger.Logger) *API {
+	return &API{
+		store:     store,
+		validator: validator,
+		log:       log,
+	}
+}
+
+type PostResponse struct {
+	models.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// @Summary		Create Personal Access Token
+// @Description	Create a personal access token for the authenticated user. The token is only returned once and is used as a Bearer token on routes allowed by its scopes
+// @Tags			Token
+// @Accept			json
+// @Produce		json
+// @Param			Body	body		PostBodyParams	true	"PostBodyParams"
+// @Success		200		{object}	response.Response{data=PostResponse}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/tokens [post]
+func (api *API) Post(w http.ResponseWriter, r *http.Request) {
+	var body PostBodyParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	if err := api.validator.Struct(body); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	plainToken, err := auth.NewPersonalAccessToken()
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	tokenData := models.PersonalAccessToken{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		Name:        body.Name,
+		TokenHash:   auth.HashPersonalAccessToken(plainToken),
+		TokenPrefix: auth.PersonalAccessTokenDisplayPrefix(plainToken),
+		Scopes:      pq.StringArray(body.Scopes),
+	}
+
+	if body.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, body.ExpiresInDays)
+		tokenData.ExpiresAt = &expiresAt
+	}
+
+	token, err := api.store.Tokens.Create(r.Context(), tokenData)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionTokenCreate, TargetType: audit.TargetToken, TargetID: &token.ID, After: token})
+
+	api.log.Info.PrintfContext(r.Context(), "Token %s has been created by user %s", token.ID, user.ID)
+
+	response.HTTPResponse(w, PostResponse{
+		PersonalAccessToken: *token,
+		Token:               plainToken,
+	})
+}
+
+// @Summary		Get User Tokens
+// @Description	Get the personal access tokens of the authenticated user, including revoked and expired tokens
+// @Tags			Token
+// @Produce		json
+// @Success		200	{object}	response.Response{data=[]models.PersonalAccessToken}
+// @Failure		400	{object}	response.Error
+// @Failure		401	{object}	response.Error
+// @Failure		500	{object}	response.Error
+// @Security		BearerAuth
+// @Router			/tokens [get]
+func (api *API) GetUserTokens(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	tokens, err := api.store.Tokens.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		response.GenericServerError(w, err)
+		return
+	}
+
+	api.log.Info.PrintfContext(r.Context(), "Tokens for user %s have been retrieved", user.ID)
+
+	response.HTTPResponse(w, tokens)
+}
+
+// @Summary		Revoke Token
+// @Description	Revoke a personal access token of the authenticated user
+// @Tags			Token
+// @Produce		json
+// @Param			Path	path		TokenPathParams	true	"TokenPathParams"
+// @Success		200		{object}	response.Response{data=string}
+// @Failure		400		{object}	response.Error
+// @Failure		401		{object}	response.Error
+// @Failure		500		{object}	response.Error
+// @Security		BearerAuth
+// @Router			/tokens/{token_id} [delete]
+func (api *API) Delete(w http.ResponseWriter, r *http.Request) {
+	path := TokenPathParams{
+		TokenID: r.PathValue("token_id"),
+	}
+
+	if err := api.validator.Struct(path); err != nil {
+		response.GenericValidationError(w, err)
+		return
+	}
+
+	user := auth.MustPrincipalFromContext(r.Context()).User
+
+	tokenID, err := uuid.Parse(path.TokenID)
+	if err != nil {
+		response.GenericBadRequestError(w, fmt.Errorf("Token does not exist"))
+		return
+	}
+
+	if err := api.store.Tokens.Revoke(r.Context(), tokenID, user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericBadRequestError(w, fmt.Errorf("Token does not exist"))
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionTokenRevoke, TargetType: audit.TargetToken, TargetID: &tokenID})
+
+	api.log.Info.PrintfContext(r.Context(), "Token %s has been revoked by user %s", path.TokenID, user.ID)
+
+	response.HTTPResponse(w, "Token has been successfully revoked")
+}
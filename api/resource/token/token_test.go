@@ -0,0 +1,155 @@
+package token_test
+
+import (
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/go-faker/faker/v4"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/ushiradineth/koano-api/api/resource/auth"
+	"github.com/ushiradineth/koano-api/api/resource/event"
+	"github.com/ushiradineth/koano-api/api/resource/token"
+	"github.com/ushiradineth/koano-api/api/resource/user"
+	"github.com/ushiradineth/koano-api/api/router"
+	"github.com/ushiradineth/koano-api/store"
+	authUtil "github.com/ushiradineth/koano-api/util/auth"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/test"
+	"github.com/ushiradineth/koano-api/util/validator"
+)
+
+var (
+	accessToken  string
+	refreshToken string
+	user1ID      string
+	tokenID      string
+	plainToken   string
+	repositories *store.Store
+	l            *logger.Logger
+	userAPI      *user.API
+	authAPI      *auth.API
+	eventAPI     *event.API
+	tokenAPI     *token.API
+)
+
+var user1 user.PostBodyParams = user.PostBodyParams{
+	Name:     faker.Name(),
+	Email:    faker.Email(),
+	Password: "UPlow1234!@#",
+}
+
+var user1Auth auth.AuthenticateBodyParams = auth.AuthenticateBodyParams{
+	Email:    user1.Email,
+	Password: user1.Password,
+}
+
+func TestInit(t *testing.T) {
+	t.Run("Initiate Dependencies", func(t *testing.T) {
+		err := godotenv.Load("../../../.env")
+		if err != nil {
+			log.Println("Failed to load env")
+		}
+
+		repositories = test.NewStore()
+		v := validator.New()
+		l = logger.New()
+		m := mail.NewLogMailer(l)
+
+		userAPI = user.New(repositories, v, l, m, test.NewConfig())
+		authAPI = auth.New(repositories, v, l, m, test.NewConfig())
+		eventAPI = event.New(repositories, v, l)
+		tokenAPI = token.New(repositories, v, l)
+
+		t.Run("Create User 1", func(t *testing.T) {
+			test.CreateUserHelper(userAPI, t, user1, http.StatusOK, response.StatusSuccess)
+		})
+
+		t.Run("Authenticates User 1", func(t *testing.T) {
+			test.AuthenticateUserHelper(authAPI, t, user1Auth, http.StatusOK, response.StatusSuccess, &user1ID, &accessToken, &refreshToken)
+		})
+	})
+}
+
+func TestCreateTokenHandler(t *testing.T) {
+	body := token.PostBodyParams{
+		Name:          "Calendar sync",
+		Scopes:        []string{authUtil.ScopeEventsRead},
+		ExpiresInDays: 30,
+	}
+
+	t.Run("Create token", func(t *testing.T) {
+		test.CreateTokenHelper(tokenAPI, t, body, http.StatusOK, response.StatusSuccess, accessToken, &tokenID, &plainToken)
+	})
+
+	t.Run("Tokens can't create tokens", func(t *testing.T) {
+		var id, plain string
+		test.CreateTokenHelper(tokenAPI, t, body, http.StatusForbidden, response.StatusFail, plainToken, &id, &plain)
+	})
+
+	body.Scopes = []string{"events:delete"}
+	t.Run("Scope is invalid", func(t *testing.T) {
+		var id, plain string
+		test.CreateTokenHelper(tokenAPI, t, body, http.StatusBadRequest, response.StatusFail, accessToken, &id, &plain)
+	})
+
+	body.Scopes = []string{authUtil.ScopeEventsRead}
+	body.Name = ""
+	t.Run("Name is required", func(t *testing.T) {
+		var id, plain string
+		test.CreateTokenHelper(tokenAPI, t, body, http.StatusBadRequest, response.StatusFail, accessToken, &id, &plain)
+	})
+}
+
+func TestScopedRoutes(t *testing.T) {
+	getUserEvents := router.Scoped(repositories, l, authUtil.ScopeEventsRead, router.Authenticated(repositories.Users, eventAPI.GetUserEvents))
+	getUser := router.Scoped(repositories, l, authUtil.ScopeUserRead, router.Authenticated(repositories.Users, userAPI.Get))
+
+	t.Run("Token has scope", func(t *testing.T) {
+		test.ScopedRequestHelper(getUserEvents, t, http.MethodGet, "/events?start_day=2024-01-01&end_day=2024-12-31", http.StatusOK, response.StatusSuccess, plainToken)
+	})
+
+	t.Run("Token is missing scope", func(t *testing.T) {
+		test.ScopedRequestHelper(getUser, t, http.MethodGet, "/users/"+user1ID, http.StatusForbidden, response.StatusFail, plainToken)
+	})
+
+	t.Run("Token does not exist", func(t *testing.T) {
+		test.ScopedRequestHelper(getUserEvents, t, http.MethodGet, "/events?start_day=2024-01-01&end_day=2024-12-31", http.StatusUnauthorized, response.StatusFail, authUtil.PersonalAccessTokenPrefix+"not_a_token")
+	})
+}
+
+func TestRevokeTokenHandler(t *testing.T) {
+	t.Run("Get user tokens", func(t *testing.T) {
+		test.GetUserTokensHelper(tokenAPI, t, http.StatusOK, response.StatusSuccess, 1, accessToken)
+	})
+
+	t.Run("Revoke token", func(t *testing.T) {
+		test.RevokeTokenHelper(tokenAPI, t, http.StatusOK, response.StatusSuccess, tokenID, accessToken)
+	})
+
+	t.Run("Token is already revoked", func(t *testing.T) {
+		test.RevokeTokenHelper(tokenAPI, t, http.StatusBadRequest, response.StatusFail, tokenID, accessToken)
+	})
+
+	t.Run("Token does not exist", func(t *testing.T) {
+		test.RevokeTokenHelper(tokenAPI, t, http.StatusBadRequest, response.StatusFail, uuid.NewString(), accessToken)
+	})
+
+	t.Run("Revoked token is rejected", func(t *testing.T) {
+		getUserEvents := router.Scoped(repositories, l, authUtil.ScopeEventsRead, router.Authenticated(repositories.Users, eventAPI.GetUserEvents))
+		test.ScopedRequestHelper(getUserEvents, t, http.MethodGet, "/events?start_day=2024-01-01&end_day=2024-12-31", http.StatusUnauthorized, response.StatusFail, plainToken)
+	})
+
+	t.Run("UUID is invalid", func(t *testing.T) {
+		test.RevokeTokenHelper(tokenAPI, t, http.StatusBadRequest, response.StatusFail, "not_an_uuid", accessToken)
+	})
+}
+
+func TestCleanUp(t *testing.T) {
+	t.Run("Delete User 1", func(t *testing.T) {
+		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user1ID, accessToken)
+	})
+}
@@ -0,0 +1,11 @@
+package token
+
+type TokenPathParams struct {
+	TokenID string `json:"token_id" validate:"required,uuid"`
+}
+
+type PostBodyParams struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=events:read events:write user:read user:write"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
@@ -1,34 +1,43 @@
 package user
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
+	"github.com/ushiradineth/koano-api/config"
 	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
 	"github.com/ushiradineth/koano-api/util/auth"
 	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/password"
 	"github.com/ushiradineth/koano-api/util/response"
 	"github.com/ushiradineth/koano-api/util/user"
 )
 
 type API struct {
-	db        *sqlx.DB
+	store     *store.Store
 	validator *validator.Validate
 	log       *logger.Logger
+	mailer    mail.Mailer
+	policy    password.Policy
+	appURL    string
 }
 
-func New(db *sqlx.DB, validator *validator.Validate, log *logger.Logger) *API {
+func New(store *store.Store, validator *validator.Validate, log *logger.Logger, mailer mail.Mailer, cfg *config.Config) *API {
 	return &API{
-		db:        db,
+		store:     store,
 		validator: validator,
 		log:       log,
+		mailer:    mailer,
+		policy:    cfg.Password.Policy,
+		appURL:    cfg.AppURL,
 	}
 }
 
@@ -53,25 +62,22 @@ func (api *API) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := user.GetUserFromJWT(r, w, api.db)
-	if user == nil {
-		return
-	}
+	user := auth.MustPrincipalFromContext(r.Context()).User
 
 	if user.ID.String() != path.UserID {
 		response.GenericUnauthenticatedError(w)
 		return
 	}
 
-	user.Password = "redacted"
+	user.Redact()
 
-	api.log.Info.Printf("User %s has been retrieved", user.ID)
+	api.log.Info.PrintfContext(r.Context(), "User %s has been retrieved", user.ID)
 
 	response.HTTPResponse(w, user)
 }
 
 // @Summary		Create User
-// @Description	Create User with the parameters sent with the request
+// @Description	Create User with the parameters sent with the request and send a verification link to the email address. The password is optional, users without one sign in with a magic link
 // @Tags			User
 // @Accept	  json
 // @Produce		json
@@ -93,9 +99,9 @@ func (api *API) Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	existingUser, err := user.GetUserByEmail(body.Email, api.db)
+	existingUser, err := api.store.Users.GetByEmail(r.Context(), body.Email)
 	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
+		if !errors.Is(err, store.ErrNotFound) {
 			response.GenericServerError(w, err)
 			return
 		}
@@ -106,35 +112,59 @@ func (api *API) Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(body.Password)
-	if err != nil {
-		response.GenericServerError(w, err)
-		return
+	userData := models.User{
+		ID:    uuid.New(),
+		Name:  body.Name,
+		Email: body.Email,
 	}
 
-	userData := models.User{
-		ID:       uuid.New(),
-		Name:     body.Name,
-		Email:    body.Email,
-		Password: hashedPassword,
+	// Users created without a password sign in with a magic link until they set one
+	if body.Password != "" {
+		violations, err := api.policy.Check(body.Password, body.Name, body.Email)
+		if err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		if len(violations) > 0 {
+			response.GenericPasswordPolicyError(w, violations)
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(body.Password)
+		if err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		userData.Password = &hashedPassword
 	}
 
-	var user models.User
-	err = api.db.Get(&user, "INSERT INTO users (id, name, email, password) VALUES ($1, $2, $3, $4) RETURNING *", userData.ID, userData.Name, userData.Email, userData.Password)
+	user, err := api.store.Users.Create(r.Context(), userData)
 	if err != nil {
+		// Deleted users keep their email until they are purged
+		if errors.Is(err, store.ErrConflict) {
+			response.GenericBadRequestError(w, fmt.Errorf("Email already in use"))
+			return
+		}
+
 		response.GenericServerError(w, err)
 		return
 	}
 
-	user.Password = "redacted"
+	api.sendEmailVerification(r.Context(), user.ID, user.Email)
+
+	user.Redact()
 
-	api.log.Info.Printf("User %s has been created", user.ID)
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionUserCreate, TargetType: audit.TargetUser, TargetID: &user.ID, After: user})
+
+	api.log.Info.PrintfContext(r.Context(), "User %s has been created", user.ID)
 
 	response.HTTPResponse(w, user)
 }
 
 // @Summary		Update User
-// @Description	Update authenticated User with the parameters sent with the request based on the JWT
+// @Description	Update authenticated User with the parameters sent with the request based on the JWT. A changed email is kept as pending until it has been verified
 // @Tags			User
 // @Accept	  json
 // @Produce		json
@@ -167,10 +197,7 @@ func (api *API) Put(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	existingUser := user.GetUserFromJWT(r, w, api.db)
-	if existingUser == nil {
-		return
-	}
+	existingUser := auth.MustPrincipalFromContext(r.Context()).User
 
 	if existingUser.ID.String() != path.UserID {
 		response.GenericUnauthenticatedError(w)
@@ -178,38 +205,60 @@ func (api *API) Put(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userData := models.User{
-		ID:    existingUser.ID,
-		Name:  body.Name,
-		Email: body.Email,
+		ID:           existingUser.ID,
+		Name:         body.Name,
+		Email:        existingUser.Email,
+		PendingEmail: existingUser.PendingEmail,
 	}
 
-	emailInUse, err := user.IsEmailInUse(userData.Email, userData.ID.String(), api.db)
+	// The current email stays active until the new address has been verified
+	emailChanged := body.Email != existingUser.Email && (existingUser.PendingEmail == nil || body.Email != *existingUser.PendingEmail)
+	if body.Email == existingUser.Email {
+		userData.PendingEmail = nil
+	}
+
+	if emailChanged {
+		emailInUse, err := api.store.Users.IsEmailInUse(r.Context(), body.Email, userData.ID)
+		if err != nil {
+			response.GenericServerError(w, err)
+			return
+		}
+
+		if emailInUse {
+			response.GenericBadRequestError(w, fmt.Errorf("Email already in use"))
+			return
+		}
+
+		userData.PendingEmail = &body.Email
+	}
+
+	user, err := api.store.Users.Update(r.Context(), userData)
 	if err != nil {
 		response.GenericServerError(w, err)
 		return
 	}
 
-	if emailInUse {
-		response.GenericBadRequestError(w, fmt.Errorf("Email already in use"))
-		return
+	if emailChanged {
+		api.sendEmailVerification(r.Context(), user.ID, *user.PendingEmail)
 	}
 
-	var user models.User
-	err = api.db.Get(&user, "UPDATE users SET name=$1, email=$2, updated_at=$3 WHERE id=$4 AND active=true RETURNING *", userData.Name, userData.Email, time.Now(), userData.ID.String())
+	user.Redact()
+	existingUser.Redact()
+
+	before, after, err := audit.Diff(existingUser, user)
 	if err != nil {
-		response.GenericServerError(w, err)
-		return
+		api.log.Error.PrintfContext(r.Context(), "Failed to diff user %s: %v", user.ID, err)
 	}
 
-	user.Password = "redacted"
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionUserUpdate, TargetType: audit.TargetUser, TargetID: &user.ID, Before: before, After: after})
 
-	api.log.Info.Printf("User %s has been updated", user.ID)
+	api.log.Info.PrintfContext(r.Context(), "User %s has been updated", user.ID)
 
 	response.HTTPResponse(w, user)
 }
 
 // @Summary		Delete User
-// @Description	Delete authenticated User based on the JWT
+// @Description	Delete authenticated User based on the JWT. The account can be restored through /auth/restore until it is permanently deleted after the grace period
 // @Tags			User
 // @Produce		json
 // @Param			Path	path		UserPathParams	true	"UserPathParams"
@@ -229,34 +278,33 @@ func (api *API) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := user.GetUserFromJWT(r, w, api.db)
-	if user == nil {
-		return
-	}
+	user := auth.MustPrincipalFromContext(r.Context()).User
 
 	if user.ID.String() != path.UserID {
 		response.GenericUnauthenticatedError(w)
 		return
 	}
 
-	res, err := api.db.Exec("UPDATE users SET active=false, deleted_at=$1 WHERE id=$2", time.Now(), user.ID)
-	if err != nil {
-		response.GenericServerError(w, err)
-		return
-	}
+	if err := api.store.Users.Delete(r.Context(), user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.HTTPError(w, http.StatusBadRequest, "User does not exist", response.StatusFail)
+			return
+		}
 
-	count, err := res.RowsAffected()
-	if err != nil {
 		response.GenericServerError(w, err)
 		return
 	}
 
-	if count == 0 {
-		response.HTTPError(w, http.StatusBadRequest, "User does not exist", response.StatusFail)
-		return
-	}
+	store.LogUser(api.store.Audit, api.log, r, user.ID, audit.Record{Action: audit.ActionUserDelete, TargetType: audit.TargetUser, TargetID: &user.ID})
 
-	api.log.Info.Printf("User %s has been deleted", user.ID)
+	api.log.Info.PrintfContext(r.Context(), "User %s has been deleted", user.ID)
 
 	response.HTTPResponse(w, "User has been successfully deleted")
 }
+
+func (api *API) sendEmailVerification(ctx context.Context, id uuid.UUID, email string) {
+	// The account stays usable without a delivered email, the link can be resent later
+	if err := user.SendEmailVerification(api.appURL, id, email, api.mailer); err != nil {
+		api.log.Error.PrintfContext(ctx, "Failed to send verification email to user %s: %v", id, err)
+	}
+}
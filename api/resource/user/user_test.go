@@ -10,11 +10,12 @@ import (
 	"github.com/go-faker/faker/v4"
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	"github.com/ushiradineth/koano-api/api/resource/auth"
 	"github.com/ushiradineth/koano-api/api/resource/user"
+	"github.com/ushiradineth/koano-api/store"
 	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
 	"github.com/ushiradineth/koano-api/util/response"
 	"github.com/ushiradineth/koano-api/util/test"
 	"github.com/ushiradineth/koano-api/util/validator"
@@ -27,7 +28,7 @@ var (
 	user2ID             string
 	expiredAccessToken  string
 	expiredRefreshToken string
-	db                  *sqlx.DB
+	repositories        *store.Store
 	userAPI             *user.API
 	authAPI             *auth.API
 )
@@ -61,12 +62,13 @@ func TestInit(t *testing.T) {
 			log.Println("Failed to load env")
 		}
 
-		db = test.NewDB("../../../database/migration")
+		repositories = test.NewStore()
 		v := validator.New()
 		l := logger.New()
+		m := mail.NewLogMailer(l)
 
-		userAPI = user.New(db, v, l)
-		authAPI = auth.New(db, v, l)
+		userAPI = user.New(repositories, v, l, m, test.NewConfig())
+		authAPI = auth.New(repositories, v, l, m, test.NewConfig())
 
 		expiredAccessToken = func() string {
 			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1234567890", "iat": time.Now().Unix(), "exp": time.Now().Add(-1 * time.Hour).Unix()}).SignedString([]byte(os.Getenv("JWT_SECRET")))
@@ -114,6 +116,14 @@ func TestCreateUserHandler(t *testing.T) {
 	t.Run("Password is invalid", func(t *testing.T) {
 		test.CreateUserHelper(userAPI, t, body, http.StatusBadRequest, response.StatusFail)
 	})
+
+	body = user.PostBodyParams{
+		Name:  faker.Name(),
+		Email: faker.Email(),
+	}
+	t.Run("Create user without password", func(t *testing.T) {
+		test.CreateUserHelper(userAPI, t, body, http.StatusOK, response.StatusSuccess)
+	})
 }
 
 func TestGetUserHandler(t *testing.T) {
@@ -198,8 +208,8 @@ func TestDeleteUserHandler(t *testing.T) {
 		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user1ID, accessToken)
 	})
 
-	t.Run("User does not exist", func(t *testing.T) {
-		test.DeleteUserHelper(userAPI, t, http.StatusBadRequest, response.StatusFail, uuid.NewString(), accessToken)
+	t.Run("Deleted user is unauthenticated", func(t *testing.T) {
+		test.DeleteUserHelper(userAPI, t, http.StatusUnauthorized, response.StatusFail, uuid.NewString(), accessToken)
 	})
 
 	t.Run("Authenticate User 2", func(t *testing.T) {
@@ -210,6 +220,10 @@ func TestDeleteUserHandler(t *testing.T) {
 		test.DeleteUserHelper(userAPI, t, http.StatusUnauthorized, response.StatusFail, user1ID, accessToken)
 	})
 
+	t.Run("UUID is invalid", func(t *testing.T) {
+		test.DeleteUserHelper(userAPI, t, http.StatusBadRequest, response.StatusFail, "not_an_uuid", accessToken)
+	})
+
 	t.Run("Delete User 2", func(t *testing.T) {
 		test.DeleteUserHelper(userAPI, t, http.StatusOK, response.StatusSuccess, user2ID, accessToken)
 	})
@@ -217,8 +231,4 @@ func TestDeleteUserHandler(t *testing.T) {
 	t.Run("JWT is invalid", func(t *testing.T) {
 		test.DeleteUserHelper(userAPI, t, http.StatusUnauthorized, response.StatusFail, user1ID, expiredAccessToken)
 	})
-
-	t.Run("UUID is invalid", func(t *testing.T) {
-		test.DeleteUserHelper(userAPI, t, http.StatusBadRequest, response.StatusFail, "not_an_uuid", accessToken)
-	})
 }
@@ -7,7 +7,7 @@ type UserPathParams struct {
 type PostBodyParams struct {
 	Name     string `json:"name" validate:"required"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8,max=20,hasLowercase,hasUppercase,hasDigit,hasSpecialCharacter"`
+	Password string `json:"password"`
 }
 
 type PutBodyParams struct {
@@ -0,0 +1,359 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/auth"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/metrics"
+	"github.com/ushiradineth/koano-api/util/request"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/tracing"
+	"github.com/ushiradineth/koano-api/util/user"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Request IDs from callers are kept when they can't break the log, such as a UUID or the ID of a load balancer
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// Scoped allows personal access tokens and OAuth access tokens with the scope on the route. Other bearer tokens are passed through untouched.
+func Scoped(repositories *store.Store, log *logger.Logger, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bearerToken, err := auth.GetJWT(r)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		if auth.IsPersonalAccessToken(bearerToken) {
+			scopedPersonalAccessToken(w, r, repositories.Tokens, log, scope, bearerToken, next)
+			return
+		}
+
+		if claim, err := auth.ParseOAuthAccessToken(bearerToken); err == nil {
+			scopedOAuthAccessToken(w, r, repositories.OAuth, scope, claim, next)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func scopedPersonalAccessToken(w http.ResponseWriter, r *http.Request, tokens store.TokenRepository, log *logger.Logger, scope string, bearerToken string, next http.HandlerFunc) {
+	personalAccessToken, err := tokens.GetActive(r.Context(), auth.HashPersonalAccessToken(bearerToken))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericUnauthenticatedError(w)
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	if !personalAccessToken.HasScope(scope) {
+		response.HTTPError(w, http.StatusForbidden, fmt.Sprintf("Token is missing the `%s` scope", scope), response.StatusFail)
+		return
+	}
+
+	if err := tokens.Touch(r.Context(), personalAccessToken.ID); err != nil {
+		log.Error.PrintfContext(r.Context(), "Failed to update last used time of token %s: %v", personalAccessToken.ID, err)
+	}
+
+	next(w, r.WithContext(auth.WithPersonalAccessToken(r.Context(), personalAccessToken)))
+}
+
+// The grant is looked up on every request so revoking it cuts off access tokens which haven't expired yet
+func scopedOAuthAccessToken(w http.ResponseWriter, r *http.Request, oauth store.OAuthRepository, scope string, claim *auth.OAuthAccessClaim, next http.HandlerFunc) {
+	grantID, err := uuid.Parse(claim.Id)
+	if err != nil {
+		response.GenericUnauthenticatedError(w)
+		return
+	}
+
+	grant, err := oauth.GetActiveGrant(r.Context(), grantID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			response.GenericUnauthenticatedError(w)
+			return
+		}
+
+		response.GenericServerError(w, err)
+		return
+	}
+
+	// A refresh may narrow the scopes of the access token below those of the grant
+	if !slices.Contains(auth.ParseScope(claim.Scope), scope) || !grant.HasScope(scope) {
+		response.HTTPError(w, http.StatusForbidden, fmt.Sprintf("Token is missing the `%s` scope", scope), response.StatusFail)
+		return
+	}
+
+	next(w, r.WithContext(auth.WithOAuthGrant(r.Context(), grant)))
+}
+
+// Permitted allows users whose role grants the permission. The role is checked against the token first and then the stored user,
+// so a demoted user loses access straight away. Tokens issued to third parties are never accepted.
+func Permitted(users store.UserRepository, permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bearerToken, err := auth.GetJWT(r)
+		if err != nil {
+			response.GenericUnauthenticatedError(w)
+			return
+		}
+
+		if auth.IsPersonalAccessToken(bearerToken) || auth.IsOAuthAccessToken(bearerToken) {
+			response.HTTPError(w, http.StatusForbidden, "Access tokens issued to third parties are not allowed on this route", response.StatusFail)
+			return
+		}
+
+		claim := auth.ParseAccessToken(w, bearerToken)
+		if claim == nil {
+			return
+		}
+
+		if !auth.HasPermission(claim.Role, permission) {
+			response.HTTPError(w, http.StatusForbidden, fmt.Sprintf("Role is missing the `%s` permission", permission), response.StatusFail)
+			return
+		}
+
+		user, err := users.GetByID(r.Context(), claim.Id)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				response.GenericUnauthenticatedError(w)
+				return
+			}
+
+			response.GenericServerError(w, err)
+			return
+		}
+
+		if user.TokenVersion != claim.TokenVersion {
+			response.GenericUnauthenticatedError(w)
+			return
+		}
+
+		if !auth.HasPermission(user.Role, permission) {
+			response.HTTPError(w, http.StatusForbidden, fmt.Sprintf("Role is missing the `%s` permission", permission), response.StatusFail)
+			return
+		}
+
+		next(w, r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{User: user, Method: auth.MethodAccessToken, AuthTime: time.Unix(claim.AuthTime, 0)})))
+	}
+}
+
+// Authenticated rejects requests without a valid bearer token or session cookie before the handler runs, so invalid input from
+// an unauthenticated caller is a 401 rather than a 400. The principal is stored in the context for the handler to read.
+func Authenticated(users store.UserRepository, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Permitted has already authenticated the request
+		if auth.PrincipalFromContext(r.Context()) != nil {
+			next(w, r)
+			return
+		}
+
+		principal, err := user.Authenticate(r, users)
+		if err != nil {
+			user.AuthenticationError(w, err)
+			return
+		}
+
+		next(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	}
+}
+
+// CSRF rejects state changing requests authenticated by session cookies unless they carry the matching CSRF token.
+// Requests with an Authorization header are passed through since browsers don't attach it on their own.
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Authorization") == "" && auth.HasSessionCookie(r) && !auth.ValidCSRFToken(r) {
+			response.HTTPError(w, http.StatusForbidden, "Invalid CSRF token", response.StatusFail)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Fields gives the request the fields its log entries carry, which are its trace and the request itself.
+// The request ID, route and user are filled in by the middleware and handlers which know them.
+func Fields(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, fields := logger.WithFields(r.Context())
+		fields.SetTrace(logger.TraceFromHeader(r.Header))
+		fields.SetHTTPRequest(logger.HTTPRequest{
+			RequestMethod: r.Method,
+			RequestURL:    logger.RedactURL(r.URL),
+			UserAgent:     r.UserAgent(),
+			RemoteIP:      request.ClientIP(r),
+			Referer:       r.Referer(),
+			Protocol:      r.Proto,
+		})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestID keeps the X-Request-ID of the caller, such as a load balancer, or assigns one. It is sent back on the response,
+// which is also where error bodies read it from.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(response.RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(response.RequestIDHeader, id)
+		logger.FieldsFromContext(r.Context()).SetRequestID(id)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AccessLog logs every request once it has been answered, with its route, status, size and latency
+func AccessLog(log *logger.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := record(w)
+
+		next.ServeHTTP(recorder, r)
+
+		// Probes and scrapes would drown out the requests of users
+		if recorder.status < http.StatusBadRequest && (strings.HasPrefix(r.URL.Path, "/health") || r.URL.Path == "/metrics") {
+			return
+		}
+
+		fields := logger.FieldsFromContext(r.Context())
+		fields.SetResponse(recorder.status, recorder.size, time.Since(start))
+
+		route := fields.Route()
+		if route == "" {
+			route = fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+		}
+
+		printer := log.Info
+		if recorder.status >= http.StatusInternalServerError {
+			printer = log.Error
+		}
+
+		printer.Log(r.Context(), fmt.Sprintf("%s %d", route, recorder.status))
+	})
+}
+
+// Metrics counts requests and their latency by route pattern and status class
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := record(w)
+
+		metrics.HTTPRequestsInFlight.Inc()
+		defer metrics.HTTPRequestsInFlight.Dec()
+
+		next.ServeHTTP(recorder, r)
+
+		route := logger.FieldsFromContext(r.Context()).Route()
+		if route == "" {
+			route = metrics.RouteUnmatched
+		}
+
+		metrics.ObserveRequest(r.Method, route, recorder.status, time.Since(start))
+	})
+}
+
+// Recover answers a panicking handler with a 500 in the usual error body instead of dropping the connection
+func Recover(log *logger.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := record(w)
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+
+			// Handlers panic with ErrAbortHandler to abort the response on purpose
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			log.Error.Log(r.Context(), fmt.Sprintf("Handler panicked: %v", err), "stack", string(debug.Stack()))
+
+			// Once the status has been sent the response can't be turned into an error
+			if !recorder.wroteHeader {
+				response.HTTPError(recorder, http.StatusInternalServerError, "Internal server error", response.StatusError)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// statusRecorder keeps the status and size of the response for the access log and panic recovery
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+// record reuses the recorder of an outer middleware so they all see the same response
+func record(w http.ResponseWriter) *statusRecorder {
+	if recorder, ok := w.(*statusRecorder); ok {
+		return recorder
+	}
+
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status = status
+		recorder.wroteHeader = true
+	}
+
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(b []byte) (int, error) {
+	recorder.wroteHeader = true
+
+	n, err := recorder.ResponseWriter.Write(b)
+	recorder.size += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the underlying writer
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// Trace starts the server span of the request, continuing the trace in its traceparent header. The span is named after
+// the route once the mux has matched it.
+func Trace(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, tracing.ServiceName)
+}
+
+// Timeout gives the request a deadline, which the database calls of the handler inherit through the request context
+func Timeout(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
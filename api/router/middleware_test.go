@@ -0,0 +1,374 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/api/resource/health"
+	"github.com/ushiradineth/koano-api/api/router"
+	"github.com/ushiradineth/koano-api/config"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/auth"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/metrics"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/tracing"
+)
+
+func TestCSRF(t *testing.T) {
+	handler := router.CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(method string, authorization string, cookies []*http.Cookie, csrfToken string) int {
+		req := httptest.NewRequest(method, "/events", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		if csrfToken != "" {
+			req.Header.Set(auth.CSRFHeader, csrfToken)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	session := []*http.Cookie{
+		{Name: auth.AccessTokenCookie, Value: "access"},
+		{Name: auth.CSRFCookie, Value: "csrf"},
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "", nil, ""), "Requests without a session cookie should pass")
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "Bearer token", session, ""), "Requests with a bearer token should pass")
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "", session, ""), "Safe requests should pass")
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "", session, "csrf"))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "", session, ""))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodDelete, "", session, "other"))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "", session[:1], "csrf"), "CSRF token without its cookie should be rejected")
+}
+
+func TestAuthenticated(t *testing.T) {
+	handler := router.Authenticated(nil, func(w http.ResponseWriter, r *http.Request) {
+		assert.NotNil(t, auth.PrincipalFromContext(r.Context()))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(authorization string) int {
+		req := httptest.NewRequest(http.MethodPost, "/events", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		res := httptest.NewRecorder()
+		handler(res, req)
+		return res.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(""), "Missing token should be rejected before the handler")
+	assert.Equal(t, http.StatusUnauthorized, serve("Bearer invalid_token"))
+	assert.Equal(t, http.StatusUnauthorized, serve("Basic credentials"))
+	assert.Equal(t, http.StatusForbidden, serve("Bearer "+auth.PersonalAccessTokenPrefix+"token"), "Personal access tokens need a scope check on the route")
+
+	t.Run("Principal set earlier is kept", func(t *testing.T) {
+		principal := &auth.Principal{User: &models.User{Name: "Admin"}, Method: auth.MethodAccessToken}
+		req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+		res := httptest.NewRecorder()
+
+		router.Authenticated(nil, func(w http.ResponseWriter, r *http.Request) {
+			assert.Same(t, principal, auth.PrincipalFromContext(r.Context()))
+		})(res, req.WithContext(auth.WithPrincipal(req.Context(), principal)))
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+}
+
+func TestRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	routes := router.NewRoutes(mux, store.NewMemory())
+
+	order := []string{}
+	trace := func(name string) router.Middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next(w, r)
+			}
+		}
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+		w.WriteHeader(http.StatusOK)
+	}
+
+	routes.Public("POST /auth/login", ok, trace("first"), trace("second"))
+	routes.Private("GET /events", ok, trace("scope"))
+
+	serve := func(method string, target string) int {
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, httptest.NewRequest(method, target, nil))
+		return res.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/auth/login"), "Public routes should not need a token")
+	assert.Equal(t, []string{"first", "second", "handler"}, order)
+
+	order = []string{}
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/events"), "Private routes should need a token")
+	assert.Equal(t, []string{"scope"}, order, "Middleware should run before authentication")
+}
+
+func TestFields(t *testing.T) {
+	var output bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Level: slog.LevelInfo, Writer: &output})
+
+	mux := http.NewServeMux()
+	router.NewRoutes(mux, nil).Public("GET /auth/magic-link/consume", func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(t, logger.FieldsFromContext(r.Context()).RequestID())
+		log.Info.PrintfContext(r.Context(), "Magic link has been consumed")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/magic-link/consume?token=secret", nil)
+	req.Header.Set("User-Agent", "koano-test")
+	router.Fields(router.RequestID(mux)).ServeHTTP(httptest.NewRecorder(), req)
+
+	entry := map[string]any{}
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &entry))
+	assert.NotEmpty(t, entry["request_id"])
+	assert.Equal(t, "GET /auth/magic-link/consume", entry["route"])
+
+	httpRequest, _ := entry["httpRequest"].(map[string]any)
+	assert.Equal(t, "GET", httpRequest["requestMethod"])
+	assert.Equal(t, "/auth/magic-link/consume?token=REDACTED", httpRequest["requestUrl"], "Tokens in the URL should not be logged")
+	assert.Equal(t, "koano-test", httpRequest["userAgent"])
+}
+
+func TestRequestID(t *testing.T) {
+	handler := router.Fields(router.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response.HTTPError(w, http.StatusNotFound, "User not found", response.StatusFail)
+	})))
+
+	t.Run("Request ID is assigned", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+		id := res.Header().Get(response.RequestIDHeader)
+		assert.NotEmpty(t, id)
+
+		var body response.Error
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		assert.Equal(t, id, body.RequestID, "Error bodies should carry the request ID")
+	})
+
+	t.Run("Request ID of the caller is kept", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set(response.RequestIDHeader, "lb-1234.abc_def")
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		assert.Equal(t, "lb-1234.abc_def", res.Header().Get(response.RequestIDHeader))
+	})
+
+	t.Run("Invalid request ID is replaced", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set(response.RequestIDHeader, "id with spaces")
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		assert.NotEqual(t, "id with spaces", res.Header().Get(response.RequestIDHeader))
+		assert.NotEmpty(t, res.Header().Get(response.RequestIDHeader))
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	var output bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Level: slog.LevelInfo, Writer: &output})
+
+	mux := http.NewServeMux()
+	router.NewRoutes(mux, nil).Public("POST /events", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	})
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := router.Fields(router.RequestID(router.AccessLog(log, mux)))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/events", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	entry := map[string]any{}
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &entry), "Only the request to /events should be logged")
+	assert.Equal(t, "INFO", entry["severity"])
+	assert.Equal(t, "POST /events 201", entry["message"])
+	assert.NotEmpty(t, entry["request_id"])
+
+	httpRequest, _ := entry["httpRequest"].(map[string]any)
+	assert.Equal(t, float64(http.StatusCreated), httpRequest["status"])
+	assert.NotEqual(t, "0", httpRequest["responseSize"])
+	assert.Regexp(t, `^[0-9.e-]+s$`, httpRequest["latency"])
+}
+
+func TestMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	router.NewRoutes(mux, nil).Public("GET /metrics-test/{id}", func(w http.ResponseWriter, r *http.Request) {
+		response.HTTPError(w, http.StatusNotFound, "Not found", response.StatusFail)
+	})
+	handler := router.Fields(router.Metrics(mux))
+
+	requests := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "GET /metrics-test/{id}", "4xx")
+	unmatched := metrics.HTTPRequests.WithLabelValues(http.MethodGet, metrics.RouteUnmatched, "4xx")
+	before, beforeUnmatched := testutil.ToFloat64(requests), testutil.ToFloat64(unmatched)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics-test/1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics-test/2", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/wp-admin.php", nil))
+
+	assert.Equal(t, before+2, testutil.ToFloat64(requests), "Requests should be counted by route pattern rather than path")
+	assert.Equal(t, beforeUnmatched+1, testutil.ToFloat64(unmatched))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.HTTPRequestsInFlight))
+}
+
+func TestBase(t *testing.T) {
+	res := httptest.NewRecorder()
+	router.Base(&config.Config{}, health.New(time.Second, logger.New())).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(), "koano_http_requests_total")
+
+	res = httptest.NewRecorder()
+	router.Base(&config.Config{Metrics: config.Metrics{Port: 9090}}, health.New(time.Second, logger.New())).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, res.Code, "Metrics on their own port should not be served with the API")
+}
+
+func TestDrain(t *testing.T) {
+	healthAPI := health.New(time.Second, logger.New())
+	healthAPI.Add("database", func(ctx context.Context) error { return nil })
+	handler := router.Base(&config.Config{}, healthAPI)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	healthAPI.Drain()
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code, "Readiness should fail once the instance is draining")
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	assert.Equal(t, http.StatusOK, res.Code, "Liveness should pass while draining, so the instance isn't restarted")
+}
+
+func TestRecover(t *testing.T) {
+	var output bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Level: slog.LevelInfo, Writer: &output})
+
+	t.Run("Panic is answered with an error", func(t *testing.T) {
+		output.Reset()
+		handler := router.Fields(router.RequestID(router.AccessLog(log, router.Recover(log, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("nil map")
+		})))))
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/events", nil))
+		assert.Equal(t, http.StatusInternalServerError, res.Code)
+
+		var body response.Error
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		assert.Equal(t, response.StatusError, body.Status)
+		assert.Equal(t, res.Header().Get(response.RequestIDHeader), body.RequestID)
+
+		assert.Contains(t, output.String(), "Handler panicked: nil map")
+		assert.Contains(t, output.String(), `"message":"GET /events 500"`, "The panic should show in the access log as a 500")
+	})
+
+	t.Run("Aborted handler is not recovered", func(t *testing.T) {
+		handler := router.Recover(log, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+		})
+	})
+}
+
+func TestTrace(t *testing.T) {
+	spans := tracing.Memory()
+
+	var output bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Level: slog.LevelInfo, Writer: &output})
+
+	mux := http.NewServeMux()
+	router.NewRoutes(mux, nil).Public("GET /events/{event_id}", func(w http.ResponseWriter, r *http.Request) {
+		log.Info.PrintfContext(r.Context(), "Event has been retrieved")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/events/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.Fields(router.RequestID(router.Trace(mux))).ServeHTTP(httptest.NewRecorder(), req)
+
+	recorded := spans.GetSpans()
+	assert.Len(t, recorded, 1)
+	span := recorded[0]
+	assert.Equal(t, "GET /events/{event_id}", span.Name, "The span should be named after the route")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String(), "The span should continue the trace of the caller")
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+
+	entry := map[string]any{}
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &entry))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry["trace_id"])
+	assert.Equal(t, span.SpanContext.SpanID().String(), entry["logging.googleapis.com/spanId"], "Logs should be linked to the span of the request")
+}
+
+func TestTimeout(t *testing.T) {
+	handler := router.Timeout(10*time.Millisecond, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Deadline()
+		assert.True(t, ok, "Request should have a deadline")
+
+		<-r.Context().Done()
+		response.GenericServerError(w, r.Context().Err())
+	}))
+
+	t.Run("Deadline is exceeded", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/events", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	})
+
+	t.Run("Client cancels the request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(ctx))
+		assert.Equal(t, response.StatusClientClosedRequest, res.Code)
+	})
+
+	t.Run("Statement is cancelled by Postgres", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		response.GenericServerError(res, &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"})
+		assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+
+		res = httptest.NewRecorder()
+		response.GenericServerError(res, errors.New("connection refused"))
+		assert.Equal(t, http.StatusInternalServerError, res.Code)
+	})
+}
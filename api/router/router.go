@@ -3,56 +3,71 @@ package router
 import (
 	"fmt"
 	"net/http"
-	"os"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/jmoiron/sqlx"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
+	"github.com/ushiradineth/koano-api/api/resource/admin"
+	"github.com/ushiradineth/koano-api/api/resource/audit"
 	"github.com/ushiradineth/koano-api/api/resource/auth"
 	"github.com/ushiradineth/koano-api/api/resource/event"
+	"github.com/ushiradineth/koano-api/api/resource/export"
 	"github.com/ushiradineth/koano-api/api/resource/health"
+	"github.com/ushiradineth/koano-api/api/resource/oauth"
+	"github.com/ushiradineth/koano-api/api/resource/token"
 	"github.com/ushiradineth/koano-api/api/resource/user"
+	"github.com/ushiradineth/koano-api/config"
+	"github.com/ushiradineth/koano-api/store"
+	authUtil "github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/blob"
 	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/metrics"
+	"github.com/ushiradineth/koano-api/util/response"
 )
 
-func New(db *sqlx.DB, validator *validator.Validate, logger *logger.Logger) http.Handler {
+func New(cfg *config.Config, repositories *store.Store, validator *validator.Validate, logger *logger.Logger, mailer mail.Mailer, blobs blob.Store, healthAPI *health.API) http.Handler {
 	router := http.NewServeMux()
-	router.Handle("/", Base())
+	router.Handle("/", Base(cfg, healthAPI))
 
 	group := "/api/v1"
-	router.Handle(fmt.Sprintf("%s/", group), V1(group, db, validator, logger))
+	router.Handle(fmt.Sprintf("%s/", group), Timeout(cfg.RequestTimeout, CSRF(V1(cfg, group, repositories, validator, logger, mailer, blobs))))
 
-	if os.Getenv("CORS_ENABLED") == "true" {
-		allowedOrigin := os.Getenv("CORS_ALLOWED_ORIGIN")
+	var handler http.Handler = router
+	if cfg.CORS.Enabled {
 		logger.Info.Println("CORS Enabled")
-		if allowedOrigin == "" {
-			logger.Warn.Println("CORS_ALLOWED_ORIGIN is not set or empty. Defaulting to no CORS.")
-		} else {
-			logger.Info.Printf("CORS Allowed Origin: %s", allowedOrigin)
-		}
+		logger.Info.Printf("CORS Allowed Origins: %s", strings.Join(cfg.CORS.AllowedOrigins, ", "))
 
+		// Credentials are allowed for cookie sessions, which is why the origins have to be listed
 		c := cors.New(cors.Options{
-			AllowedOrigins: []string{allowedOrigin},
-			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders: []string{"Authorization", "Content-Type"},
+			AllowedOrigins:   cfg.CORS.AllowedOrigins,
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Authorization", "Content-Type", authUtil.CSRFHeader, authUtil.SessionModeHeader},
+			AllowCredentials: true,
+			ExposedHeaders:   []string{response.RequestIDHeader},
 		})
 
-		return c.Handler(router)
+		handler = c.Handler(router)
+	} else {
+		logger.Info.Println("CORS Disabled")
 	}
 
-	logger.Info.Println("CORS Disabled")
-	return router
+	return Fields(RequestID(AccessLog(logger, Metrics(Recover(logger, handler)))))
 }
 
-func Base() http.Handler {
+func Base(cfg *config.Config, healthAPI *health.API) http.Handler {
 	router := http.NewServeMux()
 
-	router.HandleFunc("GET /health", health.Health)
-	router.Handle("GET /metrics", promhttp.Handler())
+	router.HandleFunc("GET /health/live", route("GET /health/live", healthAPI.Live))
+	router.HandleFunc("GET /health/ready", route("GET /health/ready", healthAPI.Ready))
+
+	// Metrics served on their own port aren't exposed with the API
+	if cfg.Metrics.Port == 0 {
+		router.Handle("GET /metrics", route("GET /metrics", metrics.Handler().ServeHTTP))
+	}
 
-	if os.Getenv("ENV") == "DEVELOPMENT" {
+	if cfg.Development() {
 		router.HandleFunc("/swagger/", httpSwagger.Handler(
 			httpSwagger.URL("/swagger/doc.json"),
 		))
@@ -61,26 +76,83 @@ func Base() http.Handler {
 	return router
 }
 
-func V1(group string, db *sqlx.DB, validator *validator.Validate, logger *logger.Logger) http.Handler {
+func V1(cfg *config.Config, group string, repositories *store.Store, validator *validator.Validate, logger *logger.Logger, mailer mail.Mailer, blobs blob.Store) http.Handler {
 	router := http.NewServeMux()
-
-	userAPI := user.New(db, validator, logger)
-	router.HandleFunc("GET /users/{user_id}", userAPI.Get)
-	router.HandleFunc("POST /users", userAPI.Post)
-	router.HandleFunc("PUT /users/{user_id}", userAPI.Put)
-	router.HandleFunc("DELETE /users/{user_id}", userAPI.Delete)
-
-	authAPI := auth.New(db, validator, logger)
-	router.HandleFunc("POST /auth/login", authAPI.Authenticate)
-	router.HandleFunc("POST /auth/refresh", authAPI.RefreshToken)
-	router.HandleFunc("PUT /auth/reset-password", authAPI.PutPassword)
-
-	eventAPI := event.New(db, validator, logger)
-	router.HandleFunc("GET /events/{event_id}", eventAPI.Get)
-	router.HandleFunc("POST /events", eventAPI.Post)
-	router.HandleFunc("PUT /events/{event_id}", eventAPI.Put)
-	router.HandleFunc("DELETE /events/{event_id}", eventAPI.Delete)
-	router.HandleFunc("GET /events", eventAPI.GetUserEvents)
-
-	return http.StripPrefix(group, router)
+	routes := NewRoutes(router, repositories)
+
+	userAPI := user.New(repositories, validator, logger, mailer, cfg)
+	routes.Private("GET /users/{user_id}", userAPI.Get, Scope(repositories, logger, authUtil.ScopeUserRead))
+	routes.Public("POST /users", userAPI.Post)
+	routes.Private("PUT /users/{user_id}", userAPI.Put, Scope(repositories, logger, authUtil.ScopeUserWrite))
+	routes.Private("DELETE /users/{user_id}", userAPI.Delete)
+
+	authAPI := auth.New(repositories, validator, logger, mailer, cfg)
+	routes.Public("POST /auth/login", authAPI.Authenticate)
+	routes.Public("POST /auth/refresh", authAPI.RefreshToken)
+	routes.Public("POST /auth/logout", authAPI.Logout)
+	routes.Private("PUT /auth/reset-password", authAPI.PutPassword)
+	routes.Public("POST /auth/magic-link", authAPI.SendMagicLink)
+	routes.Public("POST /auth/magic-link/consume", authAPI.ConsumeMagicLink)
+	routes.Public("POST /auth/restore", authAPI.RestoreAccount)
+	routes.Public("POST /auth/restore/email", authAPI.SendRestoreLink)
+	routes.Public("POST /auth/verify-email", authAPI.VerifyEmail)
+	routes.Private("POST /auth/verify-email/resend", authAPI.ResendEmailVerification)
+	routes.Private("POST /auth/mfa/totp", authAPI.EnrollTOTP)
+	routes.Private("POST /auth/mfa/totp/confirm", authAPI.ConfirmTOTP)
+	routes.Private("DELETE /auth/mfa/totp", authAPI.DisableTOTP)
+	routes.Public("POST /auth/mfa/verify", authAPI.VerifyMFA)
+	routes.Private("POST /auth/mfa/recovery-codes", authAPI.RegenerateRecoveryCodes)
+	routes.Public("GET /auth/oidc/{provider}/authorize", authAPI.OIDCAuthorize)
+	routes.Public("POST /auth/oidc/{provider}/callback", authAPI.OIDCCallback)
+	routes.Private("POST /auth/passkeys/register/options", authAPI.PasskeyRegistrationOptions)
+	routes.Private("POST /auth/passkeys/register", authAPI.RegisterPasskey)
+	routes.Private("GET /auth/passkeys", authAPI.GetPasskeys)
+	routes.Private("DELETE /auth/passkeys/{passkey_id}", authAPI.DeletePasskey)
+	routes.Public("POST /auth/passkeys/login/options", authAPI.PasskeyLoginOptions)
+	routes.Public("POST /auth/passkeys/login", authAPI.PasskeyLogin)
+	routes.Private("POST /admin/lockouts/unlock", authAPI.Unlock, Permission(repositories, authUtil.PermissionUsersDisable))
+
+	eventAPI := event.New(repositories, validator, logger)
+	routes.Private("GET /events/{event_id}", eventAPI.Get, Scope(repositories, logger, authUtil.ScopeEventsRead))
+	routes.Private("POST /events", eventAPI.Post, Scope(repositories, logger, authUtil.ScopeEventsWrite))
+	routes.Private("PUT /events/{event_id}", eventAPI.Put, Scope(repositories, logger, authUtil.ScopeEventsWrite))
+	routes.Private("DELETE /events/{event_id}", eventAPI.Delete, Scope(repositories, logger, authUtil.ScopeEventsWrite))
+	routes.Private("GET /events", eventAPI.GetUserEvents, Scope(repositories, logger, authUtil.ScopeEventsRead))
+
+	tokenAPI := token.New(repositories, validator, logger)
+	routes.Private("POST /tokens", tokenAPI.Post)
+	routes.Private("GET /tokens", tokenAPI.GetUserTokens)
+	routes.Private("DELETE /tokens/{token_id}", tokenAPI.Delete)
+
+	exportAPI := export.New(repositories, validator, logger, blobs)
+	routes.Private("POST /exports", exportAPI.Post)
+	routes.Private("GET /exports", exportAPI.GetUserExports)
+	routes.Private("GET /exports/{export_id}", exportAPI.Get)
+	routes.Public("GET /exports/{export_id}/download", exportAPI.Download)
+
+	auditAPI := audit.New(repositories, validator, logger)
+	routes.Private("GET /audit", auditAPI.GetUserAudit)
+	routes.Private("GET /admin/audit", auditAPI.Search, Permission(repositories, authUtil.PermissionAuditRead))
+	routes.Private("GET /admin/audit/verify", auditAPI.Verify, Permission(repositories, authUtil.PermissionAuditRead))
+
+	oauthAPI := oauth.New(repositories, validator, logger)
+	routes.Private("POST /oauth/clients", oauthAPI.PostClient)
+	routes.Private("GET /oauth/clients", oauthAPI.GetUserClients)
+	routes.Private("DELETE /oauth/clients/{client_id}", oauthAPI.DeleteClient)
+	routes.Private("GET /oauth/authorize", oauthAPI.GetConsent)
+	routes.Private("POST /oauth/authorize", oauthAPI.Authorize)
+	routes.Public("POST /oauth/token", oauthAPI.Token)
+	routes.Public("POST /oauth/revoke", oauthAPI.Revoke)
+	routes.Public("POST /oauth/introspect", oauthAPI.Introspect)
+
+	adminAPI := admin.New(repositories, validator, logger)
+	routes.Private("GET /admin/users", adminAPI.Search, Permission(repositories, authUtil.PermissionUsersRead))
+	routes.Private("GET /admin/users/{user_id}", adminAPI.Get, Permission(repositories, authUtil.PermissionUsersRead))
+	routes.Private("POST /admin/users/{user_id}/disable", adminAPI.Disable, Permission(repositories, authUtil.PermissionUsersDisable))
+	routes.Private("POST /admin/users/{user_id}/restore", adminAPI.Restore, Permission(repositories, authUtil.PermissionUsersDisable))
+	routes.Private("POST /admin/users/{user_id}/logout", adminAPI.Logout, Permission(repositories, authUtil.PermissionSessionsRevoke))
+	routes.Private("POST /admin/users/{user_id}/mfa/reset", adminAPI.ResetMFA, Permission(repositories, authUtil.PermissionMFAReset))
+	routes.Private("PUT /admin/users/{user_id}/role", adminAPI.PutRole, Permission(repositories, authUtil.PermissionUsersRole))
+
+	return Trace(http.StripPrefix(group, router))
 }
@@ -0,0 +1,80 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/ushiradineth/koano-api/store"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware wraps a handler with a check which runs before it
+type Middleware func(next http.HandlerFunc) http.HandlerFunc
+
+// Routes registers handlers on a mux, where every route has to be declared either public or private
+type Routes struct {
+	mux          *http.ServeMux
+	repositories *store.Store
+}
+
+func NewRoutes(mux *http.ServeMux, repositories *store.Store) *Routes {
+	return &Routes{
+		mux:          mux,
+		repositories: repositories,
+	}
+}
+
+// Public registers a route which doesn't need authentication, such as signing in or one authenticating its callers some other way
+func (routes *Routes) Public(pattern string, handler http.HandlerFunc, middleware ...Middleware) {
+	routes.mux.HandleFunc(pattern, route(pattern, Chain(handler, middleware...)))
+}
+
+// Private registers a route which needs an authenticated user. The middleware runs first, in order, so a scope check can
+// resolve the token before the user is authenticated.
+func (routes *Routes) Private(pattern string, handler http.HandlerFunc, middleware ...Middleware) {
+	routes.mux.HandleFunc(pattern, route(pattern, Chain(Authenticated(routes.repositories.Users, handler), middleware...)))
+}
+
+// route names the route in the log fields and the span of the request, which is only known once the mux has matched it
+func route(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fields := logger.FieldsFromContext(r.Context())
+		fields.SetRoute(pattern)
+
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(pattern)
+		span.SetAttributes(semconv.HTTPRoute(pattern), attribute.String("request_id", fields.RequestID()))
+
+		// The span continues the trace of the caller, if there is one, so logs of the request are linked to it
+		if spanContext := span.SpanContext(); spanContext.IsValid() {
+			fields.SetTrace(spanContext.TraceID().String(), spanContext.SpanID().String())
+		}
+
+		next(w, r)
+	}
+}
+
+// Chain wraps the handler with the middleware, the first of which runs first
+func Chain(handler http.HandlerFunc, middleware ...Middleware) http.HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	return handler
+}
+
+// Scope is Scoped as a middleware
+func Scope(repositories *store.Store, log *logger.Logger, scope string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return Scoped(repositories, log, scope, next)
+	}
+}
+
+// Permission is Permitted as a middleware
+func Permission(repositories *store.Store, permission string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return Permitted(repositories.Users, permission, next)
+	}
+}
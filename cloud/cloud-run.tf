@@ -1,14 +1,19 @@
 locals {
   API_VARIABLES = {
-    ENV                 = var.API_ENV
-    PG_USER             = var.API_PG_USER
-    PG_PASSWORD         = var.API_PG_PASSWORD
-    PG_URL              = var.API_PG_URL
-    PG_DATABASE         = var.API_PG_DATABASE
-    PG_SSLMODE          = var.API_PG_SSLMODE
-    JWT_SECRET          = var.API_JWT_SECRET
-    CORS_ENABLED        = var.API_CORS_ENABLED
-    CORS_ALLOWED_ORIGIN = var.API_CORS_ALLOWED_ORIGIN
+    ENV                  = var.API_ENV
+    PG_USER              = var.API_PG_USER
+    PG_PASSWORD          = var.API_PG_PASSWORD
+    PG_URL               = var.API_PG_URL
+    PG_DATABASE          = var.API_PG_DATABASE
+    PG_SSLMODE           = var.API_PG_SSLMODE
+    JWT_SECRET           = var.API_JWT_SECRET
+    CORS_ENABLED         = var.API_CORS_ENABLED
+    CORS_ALLOWED_ORIGIN  = var.API_CORS_ALLOWED_ORIGIN
+    APP_URL              = var.API_APP_URL
+    BLOB_BACKEND         = "gcs"
+    BLOB_BUCKET          = google_storage_bucket.exports.name
+    TRUST_PROXY          = "true"
+    GOOGLE_CLOUD_PROJECT = local.gcp_context.project_id
   }
 }
 
@@ -28,18 +33,21 @@ resource "google_cloud_run_service" "api" {
             value = env.value
           }
         }
+        # Instances only get traffic once the database is reachable and migrated
         startup_probe {
           initial_delay_seconds = 0
-          timeout_seconds       = 1
+          timeout_seconds       = 3
           period_seconds        = 3
-          failure_threshold     = 1
-          tcp_socket {
-            port = 8080
+          failure_threshold     = 10
+          http_get {
+            path = "/health/ready"
           }
         }
+        # Liveness doesn't check dependencies, so a database outage doesn't restart every instance
         liveness_probe {
+          timeout_seconds = 1
           http_get {
-            path = "/health"
+            path = "/health/live"
           }
         }
       }
@@ -58,7 +66,7 @@ resource "google_cloud_run_service" "api" {
     ]
   }
 
-  depends_on = [google_service_account.github_action]
+  depends_on = [google_service_account.github_action, google_storage_bucket_iam_member.api_exports]
 }
 
 # To allow Cloud Run to invoke the service without authentication, AKA, Public Access
@@ -4,3 +4,10 @@ resource "google_project_service" "compute" {
   disable_on_destroy         = true
   disable_dependent_services = true
 }
+
+resource "google_project_service" "storage" {
+  project                    = local.gcp_context.project_id
+  service                    = "storage.googleapis.com"
+  disable_on_destroy         = true
+  disable_dependent_services = true
+}
@@ -0,0 +1,29 @@
+# Holds the data exports, which the worker builds and every API instance serves, so they have to be shared rather than kept on disk
+resource "google_storage_bucket" "exports" {
+  name     = "${local.project}-exports-${local.gcp_context.environment}"
+  project  = local.gcp_context.project_id
+  location = local.gcp_context.location
+
+  uniform_bucket_level_access = true
+  public_access_prevention    = "enforced"
+
+  # The worker removes exports once they expire, this only catches those it missed. Keep it above EXPORT_RETENTION_HOURS
+  lifecycle_rule {
+    condition {
+      age = 7
+    }
+    action {
+      type = "Delete"
+    }
+  }
+
+  depends_on = [google_project_service.storage]
+}
+
+resource "google_storage_bucket_iam_member" "api_exports" {
+  bucket = google_storage_bucket.exports.name
+  role   = "roles/storage.objectAdmin"
+  member = "serviceAccount:${google_service_account.github_action.email}"
+
+  depends_on = [google_service_account.github_action, google_storage_bucket.exports]
+}
@@ -35,19 +35,34 @@ variable "API_PG_SSLMODE" {
 }
 
 variable "API_JWT_SECRET" {
-  description = "JWT Secret"
+  description = "JWT Secret, at least 32 characters. Generate one with openssl rand -base64 32"
   type        = string
   sensitive   = true
+
+  validation {
+    condition     = length(var.API_JWT_SECRET) >= 32
+    error_message = "API_JWT_SECRET has to be at least 32 characters, the API refuses to start with a shorter one."
+  }
 }
 
 variable "API_CORS_ENABLED" {
-  description = "CORS Enabled"
+  description = "CORS Enabled. The API refuses to start if this is true while API_CORS_ALLOWED_ORIGIN is empty"
   type        = string
   sensitive   = true
 }
 
 variable "API_CORS_ALLOWED_ORIGIN" {
-  description = "CORS Allowed Origin"
+  description = "CORS Allowed Origin, a comma separated list of origins without wildcards. Required when API_CORS_ENABLED is true"
   type        = string
   sensitive   = true
 }
+
+variable "API_APP_URL" {
+  description = "URL of the web app, used for links in emails and as the passkey origin. Required by the API"
+  type        = string
+
+  validation {
+    condition     = can(regex("^https?://", var.API_APP_URL))
+    error_message = "API_APP_URL has to be an absolute http or https URL."
+  }
+}
@@ -3,18 +3,33 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/ushiradineth/koano-api/api/resource/health"
 	"github.com/ushiradineth/koano-api/api/router"
+	"github.com/ushiradineth/koano-api/config"
 	"github.com/ushiradineth/koano-api/database"
+	"github.com/ushiradineth/koano-api/database/migration"
 	_ "github.com/ushiradineth/koano-api/docs"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/blob"
+	"github.com/ushiradineth/koano-api/util/export"
+	"github.com/ushiradineth/koano-api/util/lockout"
 	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/metrics"
+	"github.com/ushiradineth/koano-api/util/request"
+	"github.com/ushiradineth/koano-api/util/tracing"
+	"github.com/ushiradineth/koano-api/util/user"
 	validator "github.com/ushiradineth/koano-api/util/validator"
+	"github.com/ushiradineth/koano-api/util/worker"
 )
 
 //	@title						Koano
@@ -36,22 +51,127 @@ func main() {
 }
 
 func run(ctx context.Context) error {
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	// Cloud Run sends SIGTERM before stopping an instance
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer cancel()
-	log := logger.New()
 
-	err := godotenv.Load(".env")
+	// Invalid settings are all reported before anything starts
+	cfg, err := config.Load()
 	if err != nil {
-		log.Error.Println("Failed to load env")
+		return err
+	}
+
+	log := logger.NewWithOptions(logger.Options{
+		Level:     cfg.Log.Level,
+		Format:    cfg.Log.Format,
+		ProjectID: cfg.Log.ProjectID,
+	})
+
+	// Tracing is set up before the database, so its queries are traced
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+
+	auth.SetSecret(cfg.JWTSecret)
+	auth.SetPasswordHasher(cfg.Password.Hasher)
+	request.SetTrustProxy(cfg.TrustProxy)
+	db := database.New(cfg.Database, log)
+	if err := metrics.RegisterDB(db, cfg.Database.Name); err != nil {
+		return err
+	}
+
+	migrator, err := database.NewMigrator(db, migration.FS)
+	if err != nil {
+		return err
+	}
+
+	// Instances starting together wait on the migration lock, so only one of them applies each migration
+	if cfg.AutoMigrate {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("Error migrating database: %w", err)
+		}
+
+		log.Info.Printf("Applied %d migrations", applied)
 	}
 
-	db := database.New(log)
 	validator := validator.New()
-	router := router.New(db, validator, log)
+	mailer := mail.New(mail.Options{
+		Host:     cfg.SMTP.Host,
+		Port:     cfg.SMTP.Port,
+		Username: cfg.SMTP.Username,
+		Password: cfg.SMTP.Password,
+		From:     cfg.SMTP.From,
+	}, log)
+	healthAPI := health.New(2*time.Second, log)
+	repositories := store.NewPostgres(db)
+	blobs := blob.New(blob.Options{
+		Backend: cfg.Blob.Backend,
+		Dir:     cfg.Blob.Dir,
+		Bucket:  cfg.Blob.Bucket,
+	}, log)
+	router := router.New(cfg, repositories, validator, log, mailer, blobs, healthAPI)
+
+	// Each job takes an advisory lock, so it runs on one instance at a time
+	worker := worker.New(log, database.NewJobLocker(db))
+	worker.Every("purge deleted users", time.Hour, func(ctx context.Context) error {
+		count, err := user.PurgeDeletedUsers(ctx, repositories, cfg.AccountRestorePeriod)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			log.Info.Printf("Purged %d users deleted more than %s ago", count, cfg.AccountRestorePeriod)
+		}
+
+		return nil
+	})
+	worker.Every("update user metrics", time.Minute, func(ctx context.Context) error {
+		count, err := repositories.Users.CountActive(ctx)
+		if err != nil {
+			return err
+		}
+
+		metrics.ActiveUsers.Set(float64(count))
+		return nil
+	})
+	limiter := lockout.New(repositories.LoginAttempts, lockout.DefaultPolicy)
+	worker.Every("prune login attempts", time.Hour, func(ctx context.Context) error {
+		count, err := limiter.Prune(ctx)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			log.Info.Printf("Pruned %d login attempts", count)
+		}
+
+		return nil
+	})
+	// Exports are only built here, so one still gets built when the instance which took its request stops
+	worker.Every("process data exports", time.Minute, func(ctx context.Context) error {
+		return export.Process(ctx, repositories, blobs, cfg.ExportRetention)
+	})
+	worker.Start(ctx)
+
+	healthAPI.Add("database", health.Database(db))
+	healthAPI.Add("migrations", health.Migrations(migrator))
+	healthAPI.Add("worker", worker.Check)
+
+	// Requests still running once the shutdown grace period is over are cancelled along with their queries
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
 	httpServer := &http.Server{
-		Addr:    fmt.Sprintf(":%s", os.Getenv("PORT")),
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
 		Handler: router,
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
 	}
 
 	go func() {
@@ -63,20 +183,56 @@ func run(ctx context.Context) error {
 		}
 	}()
 
+	// Metrics on their own port stay internal, such as on Cloud Run where only PORT is public
+	var metricsServer *http.Server
+	if cfg.Metrics.Port != 0 {
+		metricsServer = &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.Metrics.Port),
+			Handler: metrics.Handler(),
+		}
+
+		go func() {
+			log.Info.Printf("Serving metrics on %s", metricsServer.Addr)
+			err := metricsServer.ListenAndServe()
+
+			if err != nil && err != http.ErrServerClosed {
+				log.Error.Printf("Error serving metrics: %s", err)
+			}
+		}()
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 
 	go func() {
 		defer wg.Done()
 		<-ctx.Done()
-		shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		// Probes fail from here on, the server keeps taking requests until the load balancer has noticed and stopped sending them
+		healthAPI.Drain()
+		time.Sleep(cfg.ShutdownDrainDelay)
+		// ctx is already done, so the grace period starts from a fresh context
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		if err := httpServer.Shutdown(shutdownCtx); err != nil {
 			log.Error.Printf("error shutting down http server: %s\n", err)
+			cancelRequests()
+		}
+
+		if metricsServer != nil {
+			if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+				log.Error.Printf("Error shutting down metrics server: %s", err)
+			}
 		}
 	}()
 
 	wg.Wait()
 
+	// Spans of the last requests are still waiting in the batch
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		log.Error.Printf("Error exporting the remaining spans: %s", err)
+	}
+
 	return nil
 }
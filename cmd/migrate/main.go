@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/ushiradineth/koano-api/config"
+	"github.com/ushiradineth/koano-api/database"
+	"github.com/ushiradineth/koano-api/database/migration"
+	logger "github.com/ushiradineth/koano-api/util/log"
+)
+
+const usage = `Usage: migrate [-dir database/migration] <command>
+
+Commands:
+  up            Apply all pending migrations
+  down [N|all]  Revert the last N applied migrations, 1 unless set
+  status        Show the current version and the pending migrations
+  force V       Set the version to V without running migrations, clearing the dirty flag
+  create NAME   Add empty up and down migrations for the next version to -dir
+`
+
+func main() {
+	if err := run(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	defer cancel()
+
+	dir := flag.String("dir", "database/migration", "Directory new migrations are created in")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		return errors.New("Missing command")
+	}
+
+	// Creating a migration only touches the files, so it works without a database
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New("Usage: migrate create NAME")
+		}
+
+		paths, err := database.CreateMigration(*dir, args[1])
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		return err
+	}
+
+	log := logger.New()
+	cfg, err := config.LoadDatabase()
+	if err != nil {
+		return err
+	}
+
+	// The SQL is embedded, so the binary migrates the schema it was built with
+	migrator, err := database.NewMigrator(database.New(*cfg, log), migration.FS)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		log.Info.Printf("Applied %d migrations", applied)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if args[1] == "all" {
+				steps = 0
+			} else if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return errors.New("Usage: migrate down [N|all]")
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		log.Info.Printf("Reverted %d migrations", reverted)
+		return err
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Version: %d\n", status.Version)
+		fmt.Printf("Dirty: %t\n", status.Dirty)
+		fmt.Printf("Pending: %d\n", len(status.Pending))
+		for _, pending := range status.Pending {
+			fmt.Printf("  %06d_%s\n", pending.Version, pending.Name)
+		}
+		return nil
+	case "force":
+		if len(args) != 2 {
+			return errors.New("Usage: migrate force V")
+		}
+
+		version, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return errors.New("Usage: migrate force V")
+		}
+
+		if err := migrator.Force(ctx, uint(version)); err != nil {
+			return err
+		}
+
+		log.Info.Printf("Forced version %d", version)
+		return nil
+	default:
+		flag.Usage()
+		return fmt.Errorf("Unknown command %s", args[0])
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/joho/godotenv"
+	"github.com/ushiradineth/koano-api/config"
 	"github.com/ushiradineth/koano-api/database"
 	"github.com/ushiradineth/koano-api/database/seeder"
 	logger "github.com/ushiradineth/koano-api/util/log"
@@ -19,12 +19,12 @@ func main() {
 
 func run() error {
 	log := logger.New()
-	err := godotenv.Load(".env")
+	cfg, err := config.LoadDatabase()
 	if err != nil {
-		log.Error.Println("Failed to load env")
+		return err
 	}
 
-	db := database.New(log)
+	db := database.New(*cfg, log)
 
 	for i := 0; i < 100; i++ {
 		userId := seeder.CreateUser(db)
@@ -0,0 +1,708 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/blob"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/oidc"
+	"github.com/ushiradineth/koano-api/util/password"
+	"github.com/ushiradineth/koano-api/util/tracing"
+	"github.com/ushiradineth/koano-api/util/webauthn"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are read from, highest precedence first, the environment, .env and the YAML file named by CONFIG_FILE.
+// Secrets can instead be read from the file named by <NAME>_FILE, such as a mounted secret.
+
+const (
+	EnvDevelopment = "DEVELOPMENT"
+	EnvProduction  = "PRODUCTION"
+
+	// HMAC keys shorter than the SHA-256 output weaken the token signatures
+	minJWTSecretLength = 32
+)
+
+var (
+	sslModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+	// Only these are read from files, other variables ending in _FILE such as SSL_CERT_FILE belong to other programs
+	secrets           = []string{"JWT_SECRET", "PG_PASSWORD", "SMTP_PASSWORD"}
+	oidcClientSecrets = regexp.MustCompile(`^OIDC_[A-Z0-9_]+_CLIENT_SECRET$`)
+	providerName      = regexp.MustCompile(`^[a-z0-9]+$`)
+)
+
+type Config struct {
+	// Env is DEVELOPMENT or PRODUCTION, PRODUCTION unless set
+	Env            string
+	Port           int
+	RequestTimeout time.Duration
+	AutoMigrate    bool
+	JWTSecret      string
+	Database       Database
+	CORS           CORS
+	Log            Log
+	Tracing        Tracing
+	Metrics        Metrics
+	Blob           Blob
+	// AppURL is the frontend, which the links in emails point to
+	AppURL string
+	// TrustProxy takes the client IP from X-Forwarded-For, which is only safe behind a proxy such as the one of Cloud Run
+	TrustProxy               bool
+	RequireEmailVerification bool
+	// ShutdownDrainDelay is how long readiness fails before the server stops taking requests, so the load balancer notices first
+	ShutdownDrainDelay time.Duration
+	// AccountRestorePeriod is how long a deleted account can be restored before it is purged
+	AccountRestorePeriod time.Duration
+	// ExportRetention is how long a completed export can be downloaded
+	ExportRetention time.Duration
+	SMTP            SMTP
+	Cookies         auth.CookieConfig
+	Password        Password
+	WebAuthn        webauthn.Config
+	// OIDC has a provider for each name in OIDC_PROVIDERS, configured with its OIDC_<NAME>_* variables
+	OIDC []oidc.Config
+}
+
+type Database struct {
+	User     string
+	Password string
+	// URL is the host and port
+	URL              string
+	Name             string
+	SSLMode          string
+	StatementTimeout time.Duration
+}
+
+type CORS struct {
+	Enabled bool
+	// AllowedOrigins can't have a wildcard since credentials are allowed
+	AllowedOrigins []string
+}
+
+type Log struct {
+	Level slog.Level
+	// Format is json, which Cloud Logging parses, or text
+	Format string
+	// ProjectID links entries to their trace in Cloud Logging
+	ProjectID string
+}
+
+type Tracing struct {
+	// Exporter is none, otlp or stdout. OTLP is configured with the standard OTEL_EXPORTER_OTLP_* variables.
+	Exporter string
+	// SampleRatio is the share of new traces which are recorded, between 0 and 1
+	SampleRatio float64
+}
+
+type Metrics struct {
+	// Port serves the metrics on their own port, such as one which isn't public on Cloud Run. When 0 they are served on /metrics of the API.
+	Port int
+}
+
+type Blob struct {
+	// Backend is file, which only suits a single instance, or gcs, which every instance shares
+	Backend string
+	// Dir is where the file backend keeps blobs, a directory in the temp directory when empty
+	Dir string
+	// Bucket is the Cloud Storage bucket of the gcs backend
+	Bucket string
+}
+
+type SMTP struct {
+	// Host is empty when emails are written to the log instead
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+type Password struct {
+	// Hasher hashes new passwords, existing hashes are upgraded to it on login
+	Hasher auth.PasswordHasher
+	// Policy is applied when a password is set or changed
+	Policy password.Policy
+}
+
+// Error lists every invalid setting so they can all be fixed at once
+type Error struct {
+	Problems []string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("Invalid configuration:\n  - %s", strings.Join(err.Problems, "\n  - "))
+}
+
+func (config *Config) Development() bool {
+	return config.Env == EnvDevelopment
+}
+
+// ConnectionString is the Postgres URL, Postgres cancels any statement running longer than the statement timeout
+func (database Database) ConnectionString() string {
+	connectionURL := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(database.User, database.Password),
+		Host:   database.URL,
+		Path:   "/" + database.Name,
+		RawQuery: url.Values{
+			"sslmode":           {database.SSLMode},
+			"statement_timeout": {strconv.FormatInt(database.StatementTimeout.Milliseconds(), 10)},
+		}.Encode(),
+	}
+
+	return connectionURL.String()
+}
+
+// Load reads the sources and returns the config of the API, or an *Error listing every invalid setting
+func Load() (*Config, error) {
+	if err := loadSources(".env"); err != nil {
+		return nil, err
+	}
+
+	return FromEnv()
+}
+
+// LoadDatabase is Load for tools which only connect to the database, such as the migrate command
+func LoadDatabase() (*Database, error) {
+	if err := loadSources(".env"); err != nil {
+		return nil, err
+	}
+
+	env := &reader{}
+	database := env.database()
+	if err := env.err(); err != nil {
+		return nil, err
+	}
+
+	return &database, nil
+}
+
+// FromEnv builds the config from the environment alone
+func FromEnv() (*Config, error) {
+	env := &reader{}
+
+	config := Config{
+		Env:            env.oneOf("ENV", EnvProduction, []string{EnvDevelopment, EnvProduction}),
+		Port:           env.port("PORT", 8080),
+		RequestTimeout: env.duration("REQUEST_TIMEOUT", 30*time.Second),
+		AutoMigrate:    env.bool("AUTO_MIGRATE", false),
+		JWTSecret:      env.required("JWT_SECRET"),
+		Database:       env.database(),
+		CORS: CORS{
+			Enabled:        env.bool("CORS_ENABLED", false),
+			AllowedOrigins: env.origins("CORS_ALLOWED_ORIGINS", "CORS_ALLOWED_ORIGIN"),
+		},
+		Log: Log{
+			Level:     env.level("LOG_LEVEL", slog.LevelInfo),
+			Format:    env.oneOf("LOG_FORMAT", logger.FormatJSON, []string{logger.FormatJSON, logger.FormatText}),
+			ProjectID: os.Getenv("GOOGLE_CLOUD_PROJECT"),
+		},
+		Tracing: Tracing{
+			Exporter:    env.oneOf("TRACING_EXPORTER", tracing.ExporterNone, []string{tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout}),
+			SampleRatio: env.ratio("TRACING_SAMPLE_RATIO", 1),
+		},
+		Metrics: Metrics{
+			Port: env.port("METRICS_PORT", 0),
+		},
+		Blob: Blob{
+			Backend: env.oneOf("BLOB_BACKEND", blob.BackendFile, []string{blob.BackendFile, blob.BackendGCS}),
+			Dir:     strings.TrimSpace(os.Getenv("BLOB_DIR")),
+			Bucket:  strings.TrimSpace(os.Getenv("BLOB_BUCKET")),
+		},
+		AppURL:                   env.url("APP_URL"),
+		TrustProxy:               env.bool("TRUST_PROXY", false),
+		RequireEmailVerification: env.bool("REQUIRE_EMAIL_VERIFICATION", false),
+		AccountRestorePeriod:     time.Duration(env.integer("ACCOUNT_RESTORE_DAYS", 30, 0, math.MaxInt32)) * 24 * time.Hour,
+		ExportRetention:          time.Duration(env.integer("EXPORT_RETENTION_HOURS", 72, 1, math.MaxInt32)) * time.Hour,
+		ShutdownDrainDelay:       env.duration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+		SMTP:                     env.smtp(),
+		Cookies:                  env.cookies(),
+		Password:                 env.password(),
+		OIDC:                     env.oidc(),
+	}
+	config.WebAuthn = env.webAuthn(config.AppURL)
+
+	if config.Metrics.Port == config.Port {
+		env.problem("METRICS_PORT has to differ from PORT, leave it unset to serve metrics on the API port")
+	}
+
+	if config.JWTSecret != "" && len(config.JWTSecret) < minJWTSecretLength {
+		env.problem("JWT_SECRET has to be at least %d characters, generate one with openssl rand -base64 32", minJWTSecretLength)
+	}
+
+	if config.CORS.Enabled && len(config.CORS.AllowedOrigins) == 0 {
+		env.problem("CORS_ALLOWED_ORIGINS is required when CORS_ENABLED is true")
+	}
+
+	if config.Blob.Backend == blob.BackendGCS && config.Blob.Bucket == "" {
+		env.problem("BLOB_BUCKET is required when BLOB_BACKEND is gcs")
+	}
+
+	if err := env.err(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func loadSources(envFile string) error {
+	// Deployments set the environment directly, so .env is optional
+	if err := godotenv.Load(envFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Error loading %s: %w", envFile, err)
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path); err != nil {
+			return fmt.Errorf("Error loading %s: %w", path, err)
+		}
+	}
+
+	return loadSecretFiles()
+}
+
+// loadFile sets the settings in the YAML file which aren't set yet. Nested keys are joined with underscores and lists with commas,
+// so pg: {user: koano} sets PG_USER and cors: {allowed_origins: [a, b]} sets CORS_ALLOWED_ORIGINS.
+func loadFile(path string) error {
+	if extension := filepath.Ext(path); extension != ".yaml" && extension != ".yml" {
+		return fmt.Errorf("Unsupported config file %s, use YAML", extension)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	document := map[string]any{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return err
+	}
+
+	values := map[string]string{}
+	if err := flatten("", document, values); err != nil {
+		return err
+	}
+
+	for name, value := range values {
+		if _, ok := os.LookupEnv(name); !ok {
+			os.Setenv(name, value)
+		}
+	}
+
+	return nil
+}
+
+func flatten(prefix string, value any, values map[string]string) error {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, nested := range value {
+			name := strings.ToUpper(key)
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+
+			if err := flatten(name, nested, values); err != nil {
+				return err
+			}
+		}
+	case []any:
+		items := []string{}
+		for _, item := range value {
+			switch item.(type) {
+			case map[string]any, []any:
+				return fmt.Errorf("%s can only list values", prefix)
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		values[prefix] = strings.Join(items, ",")
+	case nil:
+		values[prefix] = ""
+	default:
+		values[prefix] = fmt.Sprint(value)
+	}
+
+	return nil
+}
+
+// loadSecretFiles sets a secret to the contents of the file named by <NAME>_FILE, so secrets don't have to be passed in the environment
+func loadSecretFiles() error {
+	problems := []string{}
+
+	for _, entry := range os.Environ() {
+		key, path, _ := strings.Cut(entry, "=")
+		name, ok := strings.CutSuffix(key, "_FILE")
+		if !ok || path == "" || !(slices.Contains(secrets, name) || oidcClientSecrets.MatchString(name)) {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s can not be read: %v", key, err))
+			continue
+		}
+
+		// Files written by editors and secret managers often end with a newline
+		secret := strings.TrimRight(string(content), "\r\n")
+
+		// The value matches when the file has already been loaded
+		if value := os.Getenv(name); value != "" && value != secret {
+			problems = append(problems, fmt.Sprintf("%s and %s are both set, only set one", name, key))
+			continue
+		}
+
+		os.Setenv(name, secret)
+	}
+
+	if len(problems) > 0 {
+		return &Error{Problems: problems}
+	}
+
+	return nil
+}
+
+// reader reads settings from the environment and collects the problems instead of stopping at the first
+type reader struct {
+	problems []string
+}
+
+func (env *reader) problem(format string, args ...any) {
+	env.problems = append(env.problems, fmt.Sprintf(format, args...))
+}
+
+func (env *reader) err() error {
+	if len(env.problems) > 0 {
+		return &Error{Problems: env.problems}
+	}
+
+	return nil
+}
+
+func (env *reader) database() Database {
+	return Database{
+		User:             env.required("PG_USER"),
+		Password:         os.Getenv("PG_PASSWORD"),
+		URL:              env.required("PG_URL"),
+		Name:             env.required("PG_DATABASE"),
+		SSLMode:          env.oneOf("PG_SSLMODE", "require", sslModes),
+		StatementTimeout: env.duration("DB_STATEMENT_TIMEOUT", 15*time.Second),
+	}
+}
+
+func (env *reader) smtp() SMTP {
+	smtp := SMTP{
+		Host:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
+		Port:     env.port("SMTP_PORT", 587),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     strings.TrimSpace(os.Getenv("SMTP_FROM")),
+	}
+
+	if smtp.Host != "" && smtp.From == "" {
+		env.problem("SMTP_FROM is required when SMTP_HOST is set")
+	}
+
+	return smtp
+}
+
+func (env *reader) cookies() auth.CookieConfig {
+	cookies := auth.CookieConfig{
+		Domain: strings.TrimSpace(os.Getenv("COOKIE_DOMAIN")),
+		Secure: env.bool("COOKIE_SECURE", true),
+	}
+
+	switch env.oneOf("COOKIE_SAME_SITE", "lax", []string{"lax", "strict", "none"}) {
+	case "lax":
+		cookies.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookies.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookies.SameSite = http.SameSiteNoneMode
+	}
+
+	if cookies.SameSite == http.SameSiteNoneMode && !cookies.Secure {
+		env.problem("COOKIE_SECURE can't be false when COOKIE_SAME_SITE is none, browsers drop SameSite=None cookies which are not Secure")
+	}
+
+	return cookies
+}
+
+func (env *reader) password() Password {
+	var hasher auth.PasswordHasher
+	policy := password.DefaultPolicy
+	maxLength := math.MaxInt32
+
+	if env.oneOf("PASSWORD_HASHER", auth.PasswordHasherArgon2id, []string{auth.PasswordHasherArgon2id, auth.PasswordHasherBcrypt}) == auth.PasswordHasherBcrypt {
+		bcryptHasher := auth.DefaultBcryptHasher
+		bcryptHasher.Cost = env.integer("BCRYPT_COST", bcryptHasher.Cost, bcrypt.MinCost, bcrypt.MaxCost)
+		hasher = bcryptHasher
+
+		// bcrypt can't hash more than 72 bytes
+		maxLength = 72
+		policy.MaxLength = min(policy.MaxLength, maxLength)
+	} else {
+		argon2idHasher := auth.DefaultArgon2idHasher
+		argon2idHasher.Memory = uint32(env.integer("ARGON2_MEMORY", int(argon2idHasher.Memory), 8, math.MaxInt32))
+		argon2idHasher.Iterations = uint32(env.integer("ARGON2_ITERATIONS", int(argon2idHasher.Iterations), 1, math.MaxInt32))
+		argon2idHasher.Parallelism = uint8(env.integer("ARGON2_PARALLELISM", int(argon2idHasher.Parallelism), 1, math.MaxUint8))
+		hasher = argon2idHasher
+	}
+
+	policy.MaxLength = env.integer("PASSWORD_MAX_LENGTH", policy.MaxLength, 1, maxLength)
+	policy.MinLength = env.integer("PASSWORD_MIN_LENGTH", policy.MinLength, 1, policy.MaxLength)
+	policy.RequireLowercase = env.bool("PASSWORD_REQUIRE_LOWERCASE", policy.RequireLowercase)
+	policy.RequireUppercase = env.bool("PASSWORD_REQUIRE_UPPERCASE", policy.RequireUppercase)
+	policy.RequireDigit = env.bool("PASSWORD_REQUIRE_DIGIT", policy.RequireDigit)
+	policy.RequireSpecial = env.bool("PASSWORD_REQUIRE_SPECIAL", policy.RequireSpecial)
+	policy.MinStrength = env.integer("PASSWORD_MIN_STRENGTH", policy.MinStrength, 0, 4)
+
+	if path := strings.TrimSpace(os.Getenv("PASSWORD_BREACHED_LIST")); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			env.problem("PASSWORD_BREACHED_LIST has to be a readable file or directory, %v", err)
+		} else {
+			policy.Breached = password.NewBreachedList(path)
+		}
+	}
+
+	return Password{Hasher: hasher, Policy: policy}
+}
+
+// webAuthn reads the relying party, passkeys are accepted from the frontend at appURL unless WEBAUTHN_ORIGINS lists others
+func (env *reader) webAuthn(appURL string) webauthn.Config {
+	config := webauthn.Config{
+		RPID:    env.text("WEBAUTHN_RP_ID", "localhost"),
+		RPName:  env.text("WEBAUTHN_RP_NAME", "Koano"),
+		Origins: env.origins("WEBAUTHN_ORIGINS", ""),
+	}
+
+	if len(config.Origins) == 0 && appURL != "" {
+		config.Origins = []string{appURL}
+	}
+
+	return config
+}
+
+func (env *reader) oidc() []oidc.Config {
+	configs := []oidc.Config{}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		// The name is part of the variable names and of the callback path
+		if !providerName.MatchString(name) {
+			env.problem("OIDC_PROVIDERS can only have letters and digits in provider names, got %q", name)
+			continue
+		}
+
+		prefix := fmt.Sprintf("OIDC_%s_", strings.ToUpper(name))
+		scopes := strings.Fields(os.Getenv(prefix + "SCOPES"))
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+
+		configs = append(configs, oidc.Config{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(env.url(prefix+"ISSUER"), "/"),
+			ClientID:     env.required(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  env.url(prefix + "REDIRECT_URL"),
+			Scopes:       scopes,
+		})
+	}
+
+	return configs
+}
+
+func (env *reader) required(name string) string {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		env.problem("%s is required", name)
+	}
+
+	return value
+}
+
+func (env *reader) text(name string, fallback string) string {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+// url reads a required http or https URL without its trailing slash
+func (env *reader) url(name string) string {
+	value := strings.TrimRight(env.required(name), "/")
+	if value == "" {
+		return value
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		env.problem("%s has to be a URL such as https://koano.app, got %q", name, value)
+		return ""
+	}
+
+	return value
+}
+
+func (env *reader) oneOf(name string, fallback string, allowed []string) string {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+
+	for _, option := range allowed {
+		if value == option {
+			return value
+		}
+	}
+
+	env.problem("%s has to be one of %s, got %q", name, strings.Join(allowed, ", "), value)
+	return fallback
+}
+
+func (env *reader) port(name string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		env.problem("%s has to be a port between 1 and 65535, got %q", name, value)
+		return fallback
+	}
+
+	return port
+}
+
+func (env *reader) integer(name string, fallback int, min int, max int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < min || number > max {
+		if max >= math.MaxInt32 {
+			env.problem("%s has to be a whole number of at least %d, got %q", name, min, value)
+		} else {
+			env.problem("%s has to be a whole number between %d and %d, got %q", name, min, max, value)
+		}
+		return fallback
+	}
+
+	return number
+}
+
+func (env *reader) bool(name string, fallback bool) bool {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		env.problem("%s has to be true or false, got %q", name, value)
+		return fallback
+	}
+
+	return parsed
+}
+
+func (env *reader) level(name string, fallback slog.Level) slog.Level {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+
+	level, err := logger.ParseLevel(value)
+	if err != nil {
+		env.problem("%s has to be one of debug, info, warn, error, got %q", name, value)
+		return fallback
+	}
+
+	return level
+}
+
+func (env *reader) ratio(name string, fallback float64) float64 {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		env.problem("%s has to be a number between 0 and 1, got %q", name, value)
+		return fallback
+	}
+
+	return ratio
+}
+
+func (env *reader) duration(name string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		env.problem("%s has to be a positive duration such as %s, got %q", name, fallback, value)
+		return fallback
+	}
+
+	return duration
+}
+
+// origins reads a comma separated list of origins, falling back to the single origin in legacy when it is set.
+// Wildcards aren't allowed, CORS allows credentials and passkeys have to be bound to their origins.
+func (env *reader) origins(name string, legacy string) []string {
+	value := os.Getenv(name)
+	if strings.TrimSpace(value) == "" && legacy != "" {
+		name = legacy
+		value = os.Getenv(legacy)
+	}
+
+	origins := []string{}
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+
+		if origin == "*" {
+			env.problem("%s can't have a wildcard, list the origins instead", name)
+			continue
+		}
+
+		parsed, err := url.Parse(origin)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Path != "" {
+			env.problem("%s has to list origins such as https://koano.app, got %q", name, origin)
+			continue
+		}
+
+		origins = append(origins, origin)
+	}
+
+	return origins
+}
@@ -1,29 +1,27 @@
 package database
 
 import (
-	"fmt"
-	"os"
-
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/uptrace/opentelemetry-go-extra/otelsql"
+	"github.com/ushiradineth/koano-api/config"
 	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func New(log *logger.Logger) *sqlx.DB {
-	connectionString := fmt.Sprintf(
-		"postgres://%s:%s@%s/%s?sslmode=%s",
-		os.Getenv("PG_USER"),
-		os.Getenv("PG_PASSWORD"),
-		os.Getenv("PG_URL"),
-		os.Getenv("PG_DATABASE"),
-		os.Getenv("PG_SSLMODE"),
-	)
-
-	db, err := sqlx.Connect("postgres", connectionString)
+func New(cfg config.Database, log *logger.Logger) *sqlx.DB {
+	connector, err := pq.NewConnector(cfg.ConnectionString())
 	if err != nil {
 		log.Error.Fatalf("Error connecting to database: %v", err)
 	}
 
+	// Every query gets a span under the request running it, with the literals of the query removed
+	db := sqlx.NewDb(otelsql.OpenDB(connector,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBNamespace(cfg.Name)),
+		otelsql.WithQueryFormatter(tracing.SanitizeSQL),
+	), "postgres")
+
 	if err := db.Ping(); err != nil {
 		log.Error.Fatalf("Error pinging database: %v", err)
 	}
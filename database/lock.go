@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Job locks are keyed by this and the hash of the job name. The pair of keys doesn't overlap with the single key of the migration lock.
+const jobLockNamespace int32 = 1000
+
+// JobLocker keeps a scheduled job from running on more than one instance at a time
+type JobLocker struct {
+	db *sqlx.DB
+}
+
+func NewJobLocker(db *sqlx.DB) *JobLocker {
+	return &JobLocker{db: db}
+}
+
+// TryLock takes the lock of the job on a connection of its own, since advisory locks are held by the session.
+// It doesn't wait, locked is false while another instance is running the job.
+func (l *JobLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := l.db.Connx(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var locked bool
+	if err := conn.GetContext(ctx, &locked, "SELECT pg_try_advisory_lock($1, hashtext($2))", jobLockNamespace, name); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+
+	if !locked {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1, hashtext($2))", jobLockNamespace, name)
+		conn.Close()
+	}
+
+	return unlock, true, nil
+}
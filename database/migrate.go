@@ -0,0 +1,386 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Migrations are named like the sequential migrations of golang-migrate, 000001_name.up.sql and 000001_name.down.sql,
+// and the version is kept in its schema_migrations table, so databases migrated with the migrate CLI carry on from where they are.
+
+const (
+	// Held while migrating so instances starting together don't apply the same migration twice
+	migrationLockKey     int64 = 7041329583
+	migrationLockRetry         = time.Second
+	undefinedTable             = "42P01"
+	migrationVersionSize       = 6
+)
+
+var (
+	migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	migrationName = regexp.MustCompile(`^\w+$`)
+)
+
+var (
+	ErrDirty            = errors.New("Database is dirty, fix the failed migration and force its version")
+	ErrUnknownVersion   = errors.New("Unknown migration version")
+	ErrNoDownMigration  = errors.New("Migration has no down migration")
+	ErrInvalidMigration = errors.New("Invalid migration")
+)
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	// Version is the last applied migration, 0 when none have been
+	Version uint
+	Dirty   bool
+	Pending []Migration
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sqlx.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// LoadMigrations reads the migrations at the root of fsys, ordered by version. Files other than SQL files are skipped.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s is not named like 000001_name.up.sql", ErrInvalidMigration, entry.Name())
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("%w: %s has an invalid version", ErrInvalidMigration, entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%w: version %d is used by %s and %s", ErrInvalidMigration, version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("%w: %d_%s has no up migration", ErrInvalidMigration, migration.Version, migration.Name)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// CreateMigration adds empty up and down files for the next version to dir and returns their paths
+func CreateMigration(dir string, name string) ([]string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if !migrationName.MatchString(name) {
+		return nil, fmt.Errorf("%w: name can only have letters, digits and underscores", ErrInvalidMigration)
+	}
+
+	migrations, err := LoadMigrations(os.DirFS(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var version uint = 1
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+
+	paths := []string{}
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%0*d_%s.%s.sql", migrationVersionSize, version, name, direction))
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return paths, err
+		}
+
+		if err := file.Close(); err != nil {
+			return paths, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration{}, m.migrations...)
+}
+
+func (m *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	version, dirty, err := currentVersion(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := MigrationStatus{Version: version, Dirty: dirty, Pending: []Migration{}}
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	return &status, nil
+}
+
+// Up applies the pending migrations and returns how many were applied. Each migration runs in a transaction along with
+// the version update, so a failed migration is rolled back rather than leaving the database dirty.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	version, dirty, err := currentVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, ErrDirty
+	}
+
+	applied := 0
+	for _, migration := range m.migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		if err := apply(ctx, conn, migration.Up, migration.Version); err != nil {
+			return applied, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		applied++
+	}
+
+	return applied, nil
+}
+
+// Down reverts the last steps applied migrations, or all of them when steps is 0, and returns how many were reverted
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	version, dirty, err := currentVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, ErrDirty
+	}
+
+	index := m.index(version)
+	if version != 0 && index == -1 {
+		return 0, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	reverted := 0
+	for ; index >= 0 && (steps <= 0 || reverted < steps); index-- {
+		migration := m.migrations[index]
+		if migration.Down == "" {
+			return reverted, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, ErrNoDownMigration)
+		}
+
+		var previous uint
+		if index > 0 {
+			previous = m.migrations[index-1].Version
+		}
+
+		if err := apply(ctx, conn, migration.Down, previous); err != nil {
+			return reverted, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		reverted++
+	}
+
+	return reverted, nil
+}
+
+// Force sets the version without running any migration and clears the dirty flag, once a failed migration has been fixed by hand.
+// Version 0 marks the database as having no migrations applied.
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	if version != 0 && m.index(version) == -1 {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return apply(ctx, conn, "", version)
+}
+
+func (m *Migrator) index(version uint) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// lock takes the migration lock on a connection of its own, since advisory locks are held by the session.
+// pg_try_advisory_lock is polled so waiting isn't cut short by the statement timeout.
+func (m *Migrator) lock(ctx context.Context) (*sqlx.Conn, func(), error) {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		var locked bool
+		if err := conn.GetContext(ctx, &locked, "SELECT pg_try_advisory_lock($1)", migrationLockKey); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+
+		if locked {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return nil, nil, ctx.Err()
+		case <-time.After(migrationLockRetry):
+		}
+	}
+
+	unlock := func() {
+		conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		conn.Close()
+	}
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)"); err != nil {
+		unlock()
+		return nil, nil, err
+	}
+
+	return conn, unlock, nil
+}
+
+func currentVersion(ctx context.Context, q sqlx.QueryerContext) (uint, bool, error) {
+	row := struct {
+		Version int64 `db:"version"`
+		Dirty   bool  `db:"dirty"`
+	}{}
+
+	err := sqlx.GetContext(ctx, q, &row, "SELECT version, dirty FROM schema_migrations LIMIT 1")
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.Is(err, sql.ErrNoRows) || (errors.As(err, &pqErr) && pqErr.Code == undefinedTable) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	// golang-migrate stores -1 once every migration has been reverted
+	if row.Version < 0 {
+		return 0, row.Dirty, nil
+	}
+
+	return uint(row.Version), row.Dirty, nil
+}
+
+// apply runs the statements and sets the version in a single transaction
+func apply(ctx context.Context, conn *sqlx.Conn, statements string, version uint) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Migrations can take longer than the statement timeout meant for requests
+	if _, err := tx.ExecContext(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(statements) != "" {
+		if _, err := tx.ExecContext(ctx, statements); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+
+	if version != 0 {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)", version); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
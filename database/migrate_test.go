@@ -0,0 +1,85 @@
+package database_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/database"
+	"github.com/ushiradineth/koano-api/database/migration"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("Embedded migrations", func(t *testing.T) {
+		migrations, err := database.LoadMigrations(migration.FS)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, migrations)
+
+		for i, migration := range migrations {
+			assert.Equal(t, uint(i+1), migration.Version, "Versions should be sequential")
+			assert.NotEmpty(t, migration.Up)
+			assert.NotEmpty(t, migration.Down)
+		}
+
+		assert.Equal(t, "init_mg", migrations[0].Name)
+	})
+
+	t.Run("Ordered by version", func(t *testing.T) {
+		migrations, err := database.LoadMigrations(fstest.MapFS{
+			"000010_later.up.sql":   {Data: []byte("SELECT 10;")},
+			"000002_second.up.sql":  {Data: []byte("SELECT 2;")},
+			"000001_first.up.sql":   {Data: []byte("SELECT 1;")},
+			"000001_first.down.sql": {Data: []byte("SELECT -1;")},
+			"README.md":             {Data: []byte("Not a migration")},
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []database.Migration{
+			{Version: 1, Name: "first", Up: "SELECT 1;", Down: "SELECT -1;"},
+			{Version: 2, Name: "second", Up: "SELECT 2;"},
+			{Version: 10, Name: "later", Up: "SELECT 10;"},
+		}, migrations)
+	})
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"Badly named file", fstest.MapFS{"first.up.sql": {Data: []byte("SELECT 1;")}}},
+		{"Version 0", fstest.MapFS{"000000_zero.up.sql": {Data: []byte("SELECT 1;")}}},
+		{"Version used twice", fstest.MapFS{
+			"000001_first.up.sql": {Data: []byte("SELECT 1;")},
+			"000001_other.up.sql": {Data: []byte("SELECT 1;")},
+		}},
+		{"Missing up migration", fstest.MapFS{"000001_first.down.sql": {Data: []byte("SELECT 1;")}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := database.LoadMigrations(test.fsys)
+			assert.ErrorIs(t, err, database.ErrInvalidMigration)
+		})
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+
+	paths, err := database.CreateMigration(dir, "Add Calendars")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "000001_add_calendars.up.sql"),
+		filepath.Join(dir, "000001_add_calendars.down.sql"),
+	}, paths)
+
+	assert.NoError(t, os.WriteFile(paths[0], []byte("CREATE TABLE calendars (id UUID PRIMARY KEY);"), 0o644))
+
+	paths, err = database.CreateMigration(dir, "calendar_events")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "000002_calendar_events.up.sql"), paths[0])
+
+	_, err = database.CreateMigration(dir, "drop-calendars")
+	assert.ErrorIs(t, err, database.ErrInvalidMigration)
+}
@@ -0,0 +1,4 @@
+ALTER TABLE users
+ADD COLUMN email_verified BOOLEAN DEFAULT FALSE,
+ADD COLUMN email_verified_at TIMESTAMP,
+ADD COLUMN pending_email VARCHAR(255);
@@ -0,0 +1,15 @@
+ALTER TABLE users
+ADD COLUMN mfa_enabled BOOLEAN DEFAULT FALSE,
+ADD COLUMN totp_secret VARCHAR(255),
+ADD COLUMN totp_last_step BIGINT DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    used_at TIMESTAMP,
+
+    code_hash VARCHAR(255),
+
+    UNIQUE (user_id, code_hash)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    scope VARCHAR(16),
+    identifier VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    failed_count INT DEFAULT 0,
+    last_failed_at TIMESTAMP,
+    locked_until TIMESTAMP,
+
+    PRIMARY KEY (scope, identifier)
+);
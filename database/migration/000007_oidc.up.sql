@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+
+    provider VARCHAR(64),
+    subject VARCHAR(255),
+    email VARCHAR(255),
+
+    UNIQUE (provider, subject)
+);
+
+CREATE TABLE IF NOT EXISTS oidc_states (
+    state VARCHAR(64) PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+
+    provider VARCHAR(64),
+    code_verifier VARCHAR(128),
+    nonce VARCHAR(64)
+);
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    name TEXT,
+    secret_hash VARCHAR(64),
+    redirect_uris TEXT[] DEFAULT '{}',
+    scopes TEXT[] DEFAULT '{}',
+    revoked_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+
+    redirect_uri TEXT,
+    scopes TEXT[] DEFAULT '{}',
+    code_challenge VARCHAR(128)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_grants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    refresh_token_hash VARCHAR(64),
+    scopes TEXT[] DEFAULT '{}',
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+
+    UNIQUE (refresh_token_hash)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS magic_links;
+
+UPDATE users SET password='' WHERE password IS NULL;
@@ -0,0 +1,14 @@
+-- Users created through a provider used to get an empty password, passwordless users now have none
+UPDATE users SET password=NULL WHERE password='';
+
+CREATE TABLE IF NOT EXISTS magic_links (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    used_at TIMESTAMP,
+
+    email VARCHAR(255),
+    name TEXT
+);
+
+CREATE INDEX IF NOT EXISTS magic_links_email_idx ON magic_links (email);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS admin_actions;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS token_version,
+DROP COLUMN IF EXISTS disabled_at,
+DROP COLUMN IF EXISTS role;
@@ -0,0 +1,17 @@
+ALTER TABLE users
+ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user',
+ADD COLUMN disabled_at TIMESTAMP,
+ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS admin_actions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    target_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(64),
+    details JSONB,
+    ip VARCHAR(64)
+);
+
+CREATE INDEX IF NOT EXISTS admin_actions_target_user_id_idx ON admin_actions (target_user_id);
@@ -0,0 +1,30 @@
+DROP TRIGGER IF EXISTS admin_actions_legacy_no_truncate ON admin_actions_legacy;
+DROP TRIGGER IF EXISTS admin_actions_legacy_closed ON admin_actions_legacy;
+DROP FUNCTION IF EXISTS admin_actions_legacy_closed;
+
+ALTER TABLE admin_actions_legacy RENAME TO admin_actions;
+ALTER INDEX admin_actions_legacy_target_user_id_idx RENAME TO admin_actions_target_user_id_idx;
+
+-- Ids of users purged since are cleared as the foreign keys would have done
+UPDATE admin_actions SET actor_id = NULL WHERE actor_id NOT IN (SELECT id FROM users);
+UPDATE admin_actions SET target_user_id = NULL WHERE target_user_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE admin_actions
+ADD CONSTRAINT admin_actions_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+ADD CONSTRAINT admin_actions_target_user_id_fkey FOREIGN KEY (target_user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- Admin actions recorded in the audit log since are carried back
+INSERT INTO admin_actions (id, created_at, actor_id, target_user_id, action, details, ip)
+SELECT
+    audit_log.id,
+    audit_log.created_at,
+    (SELECT id FROM users WHERE id = audit_log.actor_id),
+    (SELECT id FROM users WHERE id = audit_log.user_id),
+    audit_log.action,
+    COALESCE(audit_log.after, '{}'::jsonb),
+    NULLIF(audit_log.ip, '')
+FROM audit_log
+WHERE audit_log.action LIKE 'admin.%';
+
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only;
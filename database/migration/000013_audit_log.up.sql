@@ -0,0 +1,59 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq BIGSERIAL PRIMARY KEY,
+    id UUID UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+
+    actor_id UUID,
+    user_id UUID,
+    action VARCHAR(64) NOT NULL,
+    target_type VARCHAR(32) NOT NULL DEFAULT '',
+    target_id UUID,
+    before JSONB,
+    after JSONB,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) UNIQUE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id, seq);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id, seq);
+
+-- User ids are kept without foreign keys so purging a user doesn't rewrite, and break, the hash chain
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON audit_log
+FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- The existing admin actions are kept as they were in a closed legacy table rather than replayed into the chain, whose
+-- hashes are only ever computed by the API. Their foreign keys are dropped so purging a user doesn't have to update it.
+ALTER TABLE admin_actions RENAME TO admin_actions_legacy;
+ALTER INDEX admin_actions_target_user_id_idx RENAME TO admin_actions_legacy_target_user_id_idx;
+
+ALTER TABLE admin_actions_legacy
+DROP CONSTRAINT IF EXISTS admin_actions_actor_id_fkey,
+DROP CONSTRAINT IF EXISTS admin_actions_target_user_id_fkey;
+
+CREATE OR REPLACE FUNCTION admin_actions_legacy_closed() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'admin_actions_legacy is closed, admin actions are recorded in audit_log';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER admin_actions_legacy_closed
+BEFORE INSERT OR UPDATE OR DELETE ON admin_actions_legacy
+FOR EACH ROW EXECUTE FUNCTION admin_actions_legacy_closed();
+
+CREATE TRIGGER admin_actions_legacy_no_truncate
+BEFORE TRUNCATE ON admin_actions_legacy
+FOR EACH STATEMENT EXECUTE FUNCTION admin_actions_legacy_closed();
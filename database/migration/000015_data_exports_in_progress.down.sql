@@ -0,0 +1 @@
+DROP INDEX IF EXISTS data_exports_in_progress_idx;
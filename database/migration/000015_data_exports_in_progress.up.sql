@@ -0,0 +1,7 @@
+-- Exports still in progress from before the index are failed, so it can be created
+UPDATE data_exports SET status = 'failed', error = 'Export failed, request a new one', updated_at = CURRENT_TIMESTAMP
+WHERE status IN ('pending', 'running') AND id NOT IN (
+    SELECT DISTINCT ON (user_id) id FROM data_exports WHERE status IN ('pending', 'running') ORDER BY user_id, created_at DESC
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS data_exports_in_progress_idx ON data_exports (user_id) WHERE status IN ('pending', 'running');
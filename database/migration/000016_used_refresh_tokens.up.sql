@@ -0,0 +1,9 @@
+-- Refresh tokens are rotated on every use, the IDs of used ones are kept until they expire so they can't be exchanged again
+CREATE TABLE IF NOT EXISTS used_refresh_tokens (
+    id UUID PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS used_refresh_tokens_expires_at_idx ON used_refresh_tokens (expires_at);
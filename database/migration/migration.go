@@ -0,0 +1,8 @@
+package migration
+
+import "embed"
+
+// FS holds the migrations so the binaries don't need the SQL files next to them
+//
+//go:embed *.sql
+var FS embed.FS
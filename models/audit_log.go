@@ -0,0 +1,36 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditLog is an entry of the append only audit log. Each entry carries the hash of the one before it, so editing or removing an entry breaks the chain.
+type AuditLog struct {
+	Seq       int64     `db:"seq" json:"seq"`
+	ID        uuid.UUID `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+
+	ActorID    *uuid.UUID      `db:"actor_id" json:"actor_id"`
+	UserID     *uuid.UUID      `db:"user_id" json:"user_id"`
+	Action     string          `db:"action" json:"action"`
+	TargetType string          `db:"target_type" json:"target_type"`
+	TargetID   *uuid.UUID      `db:"target_id" json:"target_id"`
+	Before     json.RawMessage `db:"before" json:"before" swaggertype:"object"`
+	After      json.RawMessage `db:"after" json:"after" swaggertype:"object"`
+	IP         string          `db:"ip" json:"ip"`
+	UserAgent  string          `db:"user_agent" json:"user_agent"`
+
+	PrevHash string `db:"prev_hash" json:"prev_hash"`
+	Hash     string `db:"hash" json:"hash"`
+}
+
+// RedactFor hides where a change came from when it was made by someone other than the user, such as an admin, before the entry is shown to the user
+func (a *AuditLog) RedactFor(userID uuid.UUID) {
+	if a.ActorID == nil || *a.ActorID != userID {
+		a.IP = ""
+		a.UserAgent = ""
+	}
+}
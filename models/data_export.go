@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	ExportExpired   = "expired"
+)
+
+type DataExport struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	UserID    uuid.UUID `db:"user_id" json:"user_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+
+	Status      string     `db:"status" json:"status"`
+	BlobKey     *string    `db:"blob_key" json:"-"`
+	Size        *int64     `db:"size" json:"size"`
+	Error       *string    `db:"error" json:"error"`
+	CompletedAt *time.Time `db:"completed_at" json:"completed_at"`
+	ExpiresAt   *time.Time `db:"expires_at" json:"expires_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+type LoginAttempt struct {
+	Scope      string    `db:"scope" json:"scope"`
+	Identifier string    `db:"identifier" json:"identifier"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+
+	FailedCount  int        `db:"failed_count" json:"failed_count"`
+	LastFailedAt *time.Time `db:"last_failed_at" json:"last_failed_at"`
+	LockedUntil  *time.Time `db:"locked_until" json:"locked_until"`
+}
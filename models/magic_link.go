@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+type MagicLink struct {
+	TokenHash string     `db:"token_hash" json:"-"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time `db:"used_at" json:"used_at"`
+
+	Email string  `db:"email" json:"email"`
+	Name  *string `db:"name" json:"name"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type OAuthClient struct {
+	ID        uuid.UUID `db:"id" json:"client_id"`
+	UserID    uuid.UUID `db:"user_id" json:"user_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+
+	Name         string         `db:"name" json:"name"`
+	SecretHash   *string        `db:"secret_hash" json:"-"`
+	RedirectURIs pq.StringArray `db:"redirect_uris" json:"redirect_uris" swaggertype:"array,string"`
+	Scopes       pq.StringArray `db:"scopes" json:"scopes" swaggertype:"array,string"`
+	RevokedAt    *time.Time     `db:"revoked_at" json:"revoked_at"`
+}
+
+// IsConfidential reports whether the client has a secret, public clients such as mobile apps rely on PKCE alone
+func (c *OAuthClient) IsConfidential() bool {
+	return c.SecretHash != nil
+}
+
+func (c *OAuthClient) HasRedirectURI(redirectURI string) bool {
+	return slices.Contains(c.RedirectURIs, redirectURI)
+}
+
+func (c *OAuthClient) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+type OAuthAuthorizationCode struct {
+	CodeHash  string    `db:"code_hash" json:"-"`
+	ClientID  uuid.UUID `db:"client_id" json:"client_id"`
+	UserID    uuid.UUID `db:"user_id" json:"user_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+
+	RedirectURI   string         `db:"redirect_uri" json:"redirect_uri"`
+	Scopes        pq.StringArray `db:"scopes" json:"scopes" swaggertype:"array,string"`
+	CodeChallenge string         `db:"code_challenge" json:"-"`
+}
+
+// OAuthGrant is the access a user has given a client. Its refresh token is rotated on every use and access tokens carry its ID
+type OAuthGrant struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	ClientID  uuid.UUID `db:"client_id" json:"client_id"`
+	UserID    uuid.UUID `db:"user_id" json:"user_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+
+	RefreshTokenHash string         `db:"refresh_token_hash" json:"-"`
+	Scopes           pq.StringArray `db:"scopes" json:"scopes" swaggertype:"array,string"`
+	ExpiresAt        time.Time      `db:"expires_at" json:"expires_at"`
+	LastUsedAt       *time.Time     `db:"last_used_at" json:"last_used_at"`
+	RevokedAt        *time.Time     `db:"revoked_at" json:"revoked_at"`
+}
+
+func (g *OAuthGrant) HasScope(scope string) bool {
+	return slices.Contains(g.Scopes, scope)
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type PersonalAccessToken struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	UserID    uuid.UUID `db:"user_id" json:"user_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+
+	Name        string         `db:"name" json:"name"`
+	TokenHash   string         `db:"token_hash" json:"-"`
+	TokenPrefix string         `db:"token_prefix" json:"token_prefix"`
+	Scopes      pq.StringArray `db:"scopes" json:"scopes" swaggertype:"array,string"`
+	ExpiresAt   *time.Time     `db:"expires_at" json:"expires_at"`
+	LastUsedAt  *time.Time     `db:"last_used_at" json:"last_used_at"`
+	RevokedAt   *time.Time     `db:"revoked_at" json:"revoked_at"`
+}
+
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
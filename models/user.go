@@ -13,7 +13,27 @@ type User struct {
 	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at"`
 	Active    bool       `db:"active" json:"active"`
 
-	Name     string `db:"name" json:"name"`
-	Email    string `db:"email" json:"email"`
-	Password string `db:"password" json:"password"`
+	Name     string  `db:"name" json:"name"`
+	Email    string  `db:"email" json:"email"`
+	Password *string `db:"password" json:"password"`
+
+	EmailVerified   bool       `db:"email_verified" json:"email_verified"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at" json:"email_verified_at"`
+	PendingEmail    *string    `db:"pending_email" json:"pending_email"`
+
+	MFAEnabled   bool    `db:"mfa_enabled" json:"mfa_enabled"`
+	TOTPSecret   *string `db:"totp_secret" json:"-"`
+	TOTPLastStep int64   `db:"totp_last_step" json:"-"`
+
+	Role         string     `db:"role" json:"role"`
+	DisabledAt   *time.Time `db:"disabled_at" json:"disabled_at"`
+	TokenVersion int        `db:"token_version" json:"-"`
+}
+
+// Redact hides the password hash before the user is sent in a response. Users without a password keep a null password so clients can offer to set one.
+func (u *User) Redact() {
+	if u.Password != nil {
+		redacted := "redacted"
+		u.Password = &redacted
+	}
 }
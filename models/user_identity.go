@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserIdentity struct {
+	ID          uuid.UUID  `db:"id" json:"id"`
+	UserID      uuid.UUID  `db:"user_id" json:"user_id"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	LastLoginAt *time.Time `db:"last_login_at" json:"last_login_at"`
+
+	Provider string `db:"provider" json:"provider"`
+	Subject  string `db:"subject" json:"subject"`
+	Email    string `db:"email" json:"email"`
+}
+
+type OIDCState struct {
+	State     string    `db:"state" json:"state"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+
+	Provider     string `db:"provider" json:"provider"`
+	CodeVerifier string `db:"code_verifier" json:"-"`
+	Nonce        string `db:"nonce" json:"-"`
+}
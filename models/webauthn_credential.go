@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type WebAuthnCredential struct {
+	ID         uuid.UUID  `db:"id" json:"id"`
+	UserID     uuid.UUID  `db:"user_id" json:"user_id"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at"`
+
+	Name         string         `db:"name" json:"name"`
+	CredentialID string         `db:"credential_id" json:"credential_id"`
+	PublicKey    []byte         `db:"public_key" json:"-"`
+	SignCount    int64          `db:"sign_count" json:"sign_count"`
+	Transports   pq.StringArray `db:"transports" json:"transports" swaggertype:"array,string"`
+	AAGUID       uuid.UUID      `db:"aaguid" json:"aaguid"`
+}
+
+type WebAuthnChallenge struct {
+	Challenge string     `db:"challenge" json:"challenge"`
+	UserID    *uuid.UUID `db:"user_id" json:"user_id"`
+	Ceremony  string     `db:"ceremony" json:"ceremony"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at" json:"expires_at"`
+}
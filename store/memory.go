@@ -0,0 +1,645 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/util/audit"
+	authUtil "github.com/ushiradineth/koano-api/util/auth"
+)
+
+// The in-memory repositories keep the same rules as the tables and queries behind the Postgres ones, so handler tests don't need a database.
+// They hand out copies, so changing a returned value doesn't change what is stored.
+
+type MemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[uuid.UUID]models.User
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: map[uuid.UUID]models.User{}}
+}
+
+func (repository *MemoryUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	user, ok := repository.users[id]
+	if !ok || !canSignIn(user) {
+		return nil, ErrNotFound
+	}
+
+	return &user, nil
+}
+
+func (repository *MemoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	for _, user := range repository.users {
+		if user.Email == email && canSignIn(user) {
+			return &user, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (repository *MemoryUserRepository) Find(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return repository.find(func(user models.User) bool {
+		return user.ID == id
+	})
+}
+
+func (repository *MemoryUserRepository) GetRestorableByID(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*models.User, error) {
+	return repository.find(func(user models.User) bool {
+		return user.ID == id && isRestorable(user, deletedAfter)
+	})
+}
+
+func (repository *MemoryUserRepository) GetRestorableByEmail(ctx context.Context, email string, deletedAfter time.Time) (*models.User, error) {
+	return repository.find(func(user models.User) bool {
+		return user.Email == email && isRestorable(user, deletedAfter)
+	})
+}
+
+func (repository *MemoryUserRepository) ListByEmail(ctx context.Context, email string) ([]models.User, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range repository.users {
+		if strings.EqualFold(user.Email, email) {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+func (repository *MemoryUserRepository) IsEmailInUse(ctx context.Context, email string, exceptID uuid.UUID) (bool, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	for _, user := range repository.users {
+		if user.Email == email && user.ID != exceptID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (repository *MemoryUserRepository) Search(ctx context.Context, search UserSearch) ([]models.User, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	query := strings.ToLower(search.Query)
+
+	users := []models.User{}
+	for _, user := range repository.users {
+		if !strings.Contains(strings.ToLower(user.Email), query) && !strings.Contains(strings.ToLower(user.Name), query) {
+			continue
+		}
+
+		if search.Role != "" && user.Role != search.Role {
+			continue
+		}
+
+		switch search.Status {
+		case UserStatusActive:
+			if !canSignIn(user) {
+				continue
+			}
+		case UserStatusDisabled:
+			if user.DisabledAt == nil {
+				continue
+			}
+		case UserStatusDeleted:
+			if user.Active {
+				continue
+			}
+		}
+
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.After(users[j].CreatedAt)
+	})
+
+	return page(users, search.Limit, search.Offset), nil
+}
+
+func (repository *MemoryUserRepository) CountActive(ctx context.Context) (int64, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	var count int64
+	for _, user := range repository.users {
+		if canSignIn(user) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (repository *MemoryUserRepository) Create(ctx context.Context, user models.User) (*models.User, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+
+	for _, existing := range repository.users {
+		if existing.ID == user.ID || existing.Email == user.Email {
+			return nil, ErrConflict
+		}
+	}
+
+	now := time.Now().UTC()
+	user = models.User{
+		ID:            user.ID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Active:        true,
+		Name:          user.Name,
+		Email:         user.Email,
+		Password:      user.Password,
+		EmailVerified: user.EmailVerified,
+		Role:          authUtil.RoleUser,
+	}
+
+	if user.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+
+	repository.users[user.ID] = user
+
+	return &user, nil
+}
+
+func (repository *MemoryUserRepository) Update(ctx context.Context, user models.User) (*models.User, error) {
+	return repository.update(user.ID, func(existing *models.User) bool {
+		if !existing.Active {
+			return false
+		}
+
+		existing.Name = user.Name
+		existing.PendingEmail = user.PendingEmail
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return repository.change(id, func(user *models.User) bool {
+		if !user.Active {
+			return false
+		}
+
+		now := time.Now().UTC()
+		user.Active = false
+		user.DeletedAt = &now
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	return repository.change(id, func(user *models.User) bool {
+		if user.Active {
+			return false
+		}
+
+		user.Active = true
+		user.DeletedAt = nil
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	purged := []uuid.UUID{}
+	for id, user := range repository.users {
+		if !user.Active && user.DeletedAt != nil && !user.DeletedAt.After(deletedBefore) {
+			purged = append(purged, id)
+			delete(repository.users, id)
+		}
+	}
+
+	return purged, nil
+}
+
+func (repository *MemoryUserRepository) SetPassword(ctx context.Context, id uuid.UUID, hash string) error {
+	return repository.change(id, func(user *models.User) bool {
+		user.Password = &hash
+		user.TokenVersion++
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) RehashPassword(ctx context.Context, id uuid.UUID, oldHash string, newHash string) error {
+	return repository.change(id, func(user *models.User) bool {
+		if user.Password == nil || *user.Password != oldHash {
+			return false
+		}
+
+		user.Password = &newHash
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) VerifyEmail(ctx context.Context, id uuid.UUID, email string) (*models.User, error) {
+	return repository.update(id, func(user *models.User) bool {
+		if !user.Active {
+			return false
+		}
+
+		now := time.Now().UTC()
+		user.Email = email
+		if user.PendingEmail != nil && *user.PendingEmail == email {
+			user.PendingEmail = nil
+		}
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) SetTOTPSecret(ctx context.Context, id uuid.UUID, secret string) error {
+	return repository.change(id, func(user *models.User) bool {
+		user.TOTPSecret = &secret
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) EnableMFA(ctx context.Context, id uuid.UUID) error {
+	return repository.change(id, func(user *models.User) bool {
+		user.MFAEnabled = true
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) DisableMFA(ctx context.Context, id uuid.UUID) error {
+	return repository.change(id, func(user *models.User) bool {
+		user.MFAEnabled = false
+		user.TOTPSecret = nil
+		user.TOTPLastStep = 0
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) error {
+	err := repository.change(id, func(user *models.User) bool {
+		if user.TOTPLastStep >= step {
+			return false
+		}
+
+		user.TOTPLastStep = step
+		return true
+	})
+	if errors.Is(err, ErrNotFound) {
+		return ErrConflict
+	}
+
+	return err
+}
+
+func (repository *MemoryUserRepository) Disable(ctx context.Context, id uuid.UUID) error {
+	return repository.change(id, func(user *models.User) bool {
+		now := time.Now().UTC()
+		user.DisabledAt = &now
+		user.TokenVersion++
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) Reinstate(ctx context.Context, id uuid.UUID) error {
+	return repository.change(id, func(user *models.User) bool {
+		user.DisabledAt = nil
+		user.Active = true
+		user.DeletedAt = nil
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) RevokeSessions(ctx context.Context, id uuid.UUID) error {
+	return repository.change(id, func(user *models.User) bool {
+		user.TokenVersion++
+		return true
+	})
+}
+
+func (repository *MemoryUserRepository) SetRole(ctx context.Context, id uuid.UUID, role string) error {
+	return repository.change(id, func(user *models.User) bool {
+		user.Role = role
+		return true
+	})
+}
+
+// Edit changes a user in place, standing in for state a test can't reach through the API such as an account deleted a long time ago
+func (repository *MemoryUserRepository) Edit(id uuid.UUID, fn func(user *models.User)) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if user, ok := repository.users[id]; ok {
+		fn(&user)
+		repository.users[id] = user
+	}
+}
+
+func (repository *MemoryUserRepository) find(match func(user models.User) bool) (*models.User, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	for _, user := range repository.users {
+		if match(user) {
+			return &user, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// update applies fn to a copy of the user, storing it only if fn reports that the user matched like the WHERE clause of an UPDATE
+func (repository *MemoryUserRepository) update(id uuid.UUID, fn func(user *models.User) bool) (*models.User, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	user, ok := repository.users[id]
+	if !ok || !fn(&user) {
+		return nil, ErrNotFound
+	}
+
+	user.UpdatedAt = time.Now().UTC()
+	repository.users[id] = user
+
+	return &user, nil
+}
+
+func (repository *MemoryUserRepository) change(id uuid.UUID, fn func(user *models.User) bool) error {
+	_, err := repository.update(id, fn)
+	return err
+}
+
+func isRestorable(user models.User, deletedAfter time.Time) bool {
+	return !user.Active && user.DeletedAt != nil && user.DeletedAt.After(deletedAfter) && user.DisabledAt == nil
+}
+
+// page applies a LIMIT and OFFSET, a limit of zero returns nothing like it does in Postgres
+func page[T any](items []T, limit int, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+
+	items = items[offset:]
+	if limit < len(items) {
+		items = items[:limit]
+	}
+
+	return items
+}
+
+func canSignIn(user models.User) bool {
+	return user.Active && user.DisabledAt == nil
+}
+
+type MemoryEventRepository struct {
+	mu     sync.RWMutex
+	events map[uuid.UUID]models.Event
+}
+
+func NewMemoryEventRepository() *MemoryEventRepository {
+	return &MemoryEventRepository{events: map[uuid.UUID]models.Event{}}
+}
+
+func (repository *MemoryEventRepository) Get(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.Event, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	event, ok := repository.events[id]
+	if !ok || event.UserID != userID || !event.Active {
+		return nil, ErrNotFound
+	}
+
+	return &event, nil
+}
+
+func (repository *MemoryEventRepository) Exists(ctx context.Context, userID uuid.UUID, start time.Time, end time.Time) (bool, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	for _, event := range repository.events {
+		if event.UserID == userID && event.Active && event.Start.Equal(start) && event.End.Equal(end) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (repository *MemoryEventRepository) ListByUser(ctx context.Context, userID uuid.UUID, from time.Time, to time.Time) ([]models.Event, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	events := []models.Event{}
+	for _, event := range repository.events {
+		if event.UserID == userID && event.Active && !event.Start.Before(from) && !event.Start.After(to) {
+			events = append(events, event)
+		}
+	}
+
+	// Map order is random, Postgres returns the rows in the order they were inserted
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+
+	return events, nil
+}
+
+func (repository *MemoryEventRepository) ListAll(ctx context.Context, userID uuid.UUID) ([]models.Event, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	events := []models.Event{}
+	for _, event := range repository.events {
+		if event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+
+	return events, nil
+}
+
+func (repository *MemoryEventRepository) Create(ctx context.Context, event models.Event) (*models.Event, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+
+	if _, ok := repository.events[event.ID]; ok {
+		return nil, ErrConflict
+	}
+
+	now := time.Now().UTC()
+	event.CreatedAt = now
+	event.UpdatedAt = now
+	event.DeletedAt = nil
+	event.Active = true
+	repository.events[event.ID] = event
+
+	return &event, nil
+}
+
+func (repository *MemoryEventRepository) Update(ctx context.Context, event models.Event) (*models.Event, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	existing, ok := repository.events[event.ID]
+	if !ok || existing.UserID != event.UserID || !existing.Active {
+		return nil, ErrNotFound
+	}
+
+	existing.Title = event.Title
+	existing.Start = event.Start
+	existing.End = event.End
+	existing.Timezone = event.Timezone
+	existing.Repeated = event.Repeated
+	existing.UpdatedAt = time.Now().UTC()
+	repository.events[event.ID] = existing
+
+	return &existing, nil
+}
+
+func (repository *MemoryEventRepository) Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	event, ok := repository.events[id]
+	if !ok || event.UserID != userID || !event.Active {
+		return ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	event.Active = false
+	event.DeletedAt = &now
+	repository.events[id] = event
+
+	return nil
+}
+
+// MemoryAuditRepository chains entries like the audit_log table, so verification can be tested without a database
+type MemoryAuditRepository struct {
+	mu      sync.RWMutex
+	entries []models.AuditLog
+}
+
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+func (repository *MemoryAuditRepository) Append(ctx context.Context, record audit.Record) error {
+	entry, err := audit.NewEntry(record)
+	if err != nil {
+		return err
+	}
+
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	entry.Seq = int64(len(repository.entries) + 1)
+	if len(repository.entries) > 0 {
+		entry.PrevHash = repository.entries[len(repository.entries)-1].Hash
+	}
+
+	entry.Hash, err = audit.Hash(entry)
+	if err != nil {
+		return err
+	}
+
+	repository.entries = append(repository.entries, entry)
+
+	return nil
+}
+
+func (repository *MemoryAuditRepository) Search(ctx context.Context, filter audit.Filter) ([]models.AuditLog, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	entries := []models.AuditLog{}
+	for i := len(repository.entries) - 1; i >= 0; i-- {
+		if filter.Matches(repository.entries[i]) {
+			entries = append(entries, repository.entries[i])
+		}
+	}
+
+	return page(entries, filter.Limit, filter.Offset), nil
+}
+
+func (repository *MemoryAuditRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.AuditLog, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	entries := []models.AuditLog{}
+	for _, entry := range repository.entries {
+		if entry.UserID != nil && *entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (repository *MemoryAuditRepository) Verify(ctx context.Context) (*audit.Verification, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	verification := audit.Verification{Valid: true}
+	for _, entry := range repository.entries {
+		valid, err := verification.Check(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if !valid {
+			break
+		}
+	}
+
+	return &verification, nil
+}
+
+// Entries returns the whole log, oldest first
+func (repository *MemoryAuditRepository) Entries() []models.AuditLog {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	return append([]models.AuditLog{}, repository.entries...)
+}
+
+// Edit changes an entry in place, standing in for someone tampering with the table so tests can check the chain catches it
+func (repository *MemoryAuditRepository) Edit(seq int64, fn func(entry *models.AuditLog)) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for i := range repository.entries {
+		if repository.entries[i].Seq == seq {
+			fn(&repository.entries[i])
+		}
+	}
+}
@@ -0,0 +1,578 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+)
+
+type MemoryRecoveryCodeRepository struct {
+	mu    sync.Mutex
+	codes map[uuid.UUID][]models.RecoveryCode
+}
+
+func NewMemoryRecoveryCodeRepository() *MemoryRecoveryCodeRepository {
+	return &MemoryRecoveryCodeRepository{codes: map[uuid.UUID][]models.RecoveryCode{}}
+}
+
+func (repository *MemoryRecoveryCodeRepository) Replace(ctx context.Context, userID uuid.UUID, hashes []string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := time.Now().UTC()
+	codes := []models.RecoveryCode{}
+	for _, hash := range hashes {
+		codes = append(codes, models.RecoveryCode{ID: uuid.New(), UserID: userID, CreatedAt: now, CodeHash: hash})
+	}
+	repository.codes[userID] = codes
+
+	return nil
+}
+
+func (repository *MemoryRecoveryCodeRepository) Check(ctx context.Context, userID uuid.UUID, hash string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for _, code := range repository.codes[userID] {
+		if code.CodeHash == hash && code.UsedAt == nil {
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (repository *MemoryRecoveryCodeRepository) Use(ctx context.Context, userID uuid.UUID, hash string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for i, code := range repository.codes[userID] {
+		if code.CodeHash == hash && code.UsedAt == nil {
+			now := time.Now().UTC()
+			repository.codes[userID][i].UsedAt = &now
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+type MemoryMFAChallengeRepository struct {
+	mu         sync.Mutex
+	challenges map[uuid.UUID]models.MFAChallenge
+}
+
+func NewMemoryMFAChallengeRepository() *MemoryMFAChallengeRepository {
+	return &MemoryMFAChallengeRepository{challenges: map[uuid.UUID]models.MFAChallenge{}}
+}
+
+func (repository *MemoryMFAChallengeRepository) Create(ctx context.Context, challenge models.MFAChallenge) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, stored := range repository.challenges {
+		if stored.ExpiresAt.Before(now) {
+			delete(repository.challenges, id)
+		}
+	}
+
+	if _, ok := repository.challenges[challenge.ID]; ok {
+		return ErrConflict
+	}
+
+	challenge.CreatedAt = now
+	challenge.UsedAt = nil
+	challenge.FailedCount = 0
+	repository.challenges[challenge.ID] = challenge
+
+	return nil
+}
+
+func (repository *MemoryMFAChallengeRepository) Get(ctx context.Context, id uuid.UUID, userID uuid.UUID, maxFailures int) (*models.MFAChallenge, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	challenge, ok := repository.challenges[id]
+	if !ok || !isActiveMFAChallenge(challenge, userID, maxFailures) {
+		return nil, ErrNotFound
+	}
+
+	return &challenge, nil
+}
+
+func (repository *MemoryMFAChallengeRepository) Fail(ctx context.Context, id uuid.UUID) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	challenge, ok := repository.challenges[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	challenge.FailedCount++
+	repository.challenges[id] = challenge
+
+	return nil
+}
+
+func (repository *MemoryMFAChallengeRepository) Use(ctx context.Context, id uuid.UUID, userID uuid.UUID, maxFailures int) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	challenge, ok := repository.challenges[id]
+	if !ok || !isActiveMFAChallenge(challenge, userID, maxFailures) {
+		return ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	challenge.UsedAt = &now
+	repository.challenges[id] = challenge
+
+	return nil
+}
+
+func isActiveMFAChallenge(challenge models.MFAChallenge, userID uuid.UUID, maxFailures int) bool {
+	return challenge.UserID == userID && challenge.UsedAt == nil && challenge.ExpiresAt.After(time.Now()) && challenge.FailedCount < maxFailures
+}
+
+type MemoryRefreshTokenRepository struct {
+	mu   sync.Mutex
+	used map[uuid.UUID]time.Time
+}
+
+func NewMemoryRefreshTokenRepository() *MemoryRefreshTokenRepository {
+	return &MemoryRefreshTokenRepository{used: map[uuid.UUID]time.Time{}}
+}
+
+func (repository *MemoryRefreshTokenRepository) Use(ctx context.Context, id uuid.UUID, userID uuid.UUID, expiresAt time.Time) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := time.Now()
+	for usedID, usedExpiresAt := range repository.used {
+		if usedExpiresAt.Before(now) {
+			delete(repository.used, usedID)
+		}
+	}
+
+	if _, ok := repository.used[id]; ok {
+		return ErrConflict
+	}
+
+	repository.used[id] = expiresAt
+	return nil
+}
+
+type MemoryPasskeyRepository struct {
+	mu          sync.RWMutex
+	credentials map[uuid.UUID]models.WebAuthnCredential
+	challenges  map[string]models.WebAuthnChallenge
+}
+
+func NewMemoryPasskeyRepository() *MemoryPasskeyRepository {
+	return &MemoryPasskeyRepository{
+		credentials: map[uuid.UUID]models.WebAuthnCredential{},
+		challenges:  map[string]models.WebAuthnChallenge{},
+	}
+}
+
+func (repository *MemoryPasskeyRepository) Create(ctx context.Context, credential models.WebAuthnCredential) (*models.WebAuthnCredential, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if credential.ID == uuid.Nil {
+		credential.ID = uuid.New()
+	}
+
+	for _, existing := range repository.credentials {
+		if existing.ID == credential.ID || existing.CredentialID == credential.CredentialID {
+			return nil, ErrConflict
+		}
+	}
+
+	credential.CreatedAt = time.Now().UTC()
+	credential.LastUsedAt = nil
+	repository.credentials[credential.ID] = credential
+
+	return &credential, nil
+}
+
+func (repository *MemoryPasskeyRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	credentials := []models.WebAuthnCredential{}
+	for _, credential := range repository.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.After(credentials[j].CreatedAt)
+	})
+
+	return credentials, nil
+}
+
+func (repository *MemoryPasskeyRepository) GetByCredentialID(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	for _, credential := range repository.credentials {
+		if credential.CredentialID == credentialID {
+			return &credential, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (repository *MemoryPasskeyRepository) UpdateSignCount(ctx context.Context, id uuid.UUID, oldCount int64, newCount int64) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	credential, ok := repository.credentials[id]
+	if !ok || credential.SignCount != oldCount {
+		return ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	credential.SignCount = newCount
+	credential.LastUsedAt = &now
+	repository.credentials[id] = credential
+
+	return nil
+}
+
+func (repository *MemoryPasskeyRepository) Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	credential, ok := repository.credentials[id]
+	if !ok || credential.UserID != userID {
+		return ErrNotFound
+	}
+
+	delete(repository.credentials, id)
+
+	return nil
+}
+
+func (repository *MemoryPasskeyRepository) CreateChallenge(ctx context.Context, challenge models.WebAuthnChallenge) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := time.Now()
+	for key, existing := range repository.challenges {
+		if existing.ExpiresAt.Before(now) {
+			delete(repository.challenges, key)
+		}
+	}
+
+	if _, ok := repository.challenges[challenge.Challenge]; ok {
+		return ErrConflict
+	}
+
+	challenge.CreatedAt = now.UTC()
+	repository.challenges[challenge.Challenge] = challenge
+
+	return nil
+}
+
+func (repository *MemoryPasskeyRepository) ConsumeChallenge(ctx context.Context, challenge string, ceremony string, userID *uuid.UUID) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	stored, ok := repository.challenges[challenge]
+	if !ok || stored.Ceremony != ceremony || !sameUser(stored.UserID, userID) || !stored.ExpiresAt.After(time.Now()) {
+		return ErrNotFound
+	}
+
+	delete(repository.challenges, challenge)
+
+	return nil
+}
+
+// sameUser compares like IS NOT DISTINCT FROM, so two missing users match
+func sameUser(a *uuid.UUID, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return *a == *b
+}
+
+type MemoryIdentityRepository struct {
+	mu         sync.RWMutex
+	identities []models.UserIdentity
+	states     map[string]models.OIDCState
+}
+
+func NewMemoryIdentityRepository() *MemoryIdentityRepository {
+	return &MemoryIdentityRepository{states: map[string]models.OIDCState{}}
+}
+
+func (repository *MemoryIdentityRepository) Get(ctx context.Context, provider string, subject string) (*models.UserIdentity, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	for _, identity := range repository.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (repository *MemoryIdentityRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	identities := []models.UserIdentity{}
+	for _, identity := range repository.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+
+	return identities, nil
+}
+
+func (repository *MemoryIdentityRepository) Create(ctx context.Context, identity models.UserIdentity) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if identity.ID == uuid.Nil {
+		identity.ID = uuid.New()
+	}
+
+	if slices.ContainsFunc(repository.identities, func(existing models.UserIdentity) bool {
+		return existing.ID == identity.ID || (existing.Provider == identity.Provider && existing.Subject == identity.Subject)
+	}) {
+		return ErrConflict
+	}
+
+	now := time.Now().UTC()
+	identity.CreatedAt = now
+	identity.LastLoginAt = &now
+	repository.identities = append(repository.identities, identity)
+
+	return nil
+}
+
+func (repository *MemoryIdentityRepository) Touch(ctx context.Context, provider string, subject string, email string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	for i, identity := range repository.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			now := time.Now().UTC()
+			repository.identities[i].LastLoginAt = &now
+			repository.identities[i].Email = email
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryIdentityRepository) CreateState(ctx context.Context, state models.OIDCState) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if _, ok := repository.states[state.State]; ok {
+		return ErrConflict
+	}
+
+	state.CreatedAt = time.Now().UTC()
+	repository.states[state.State] = state
+
+	return nil
+}
+
+func (repository *MemoryIdentityRepository) ConsumeState(ctx context.Context, state string, provider string) (*models.OIDCState, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	stored, ok := repository.states[state]
+	if !ok || stored.Provider != provider || !stored.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+
+	delete(repository.states, state)
+
+	return &stored, nil
+}
+
+type MemoryMagicLinkRepository struct {
+	mu    sync.RWMutex
+	links map[string]models.MagicLink
+}
+
+func NewMemoryMagicLinkRepository() *MemoryMagicLinkRepository {
+	return &MemoryMagicLinkRepository{links: map[string]models.MagicLink{}}
+}
+
+func (repository *MemoryMagicLinkRepository) Create(ctx context.Context, link models.MagicLink) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if _, ok := repository.links[link.TokenHash]; ok {
+		return ErrConflict
+	}
+
+	link.CreatedAt = time.Now().UTC()
+	link.UsedAt = nil
+	repository.links[link.TokenHash] = link
+
+	return nil
+}
+
+func (repository *MemoryMagicLinkRepository) SentSince(ctx context.Context, email string, since time.Time) (bool, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	for _, link := range repository.links {
+		if link.Email == email && link.CreatedAt.After(since) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (repository *MemoryMagicLinkRepository) Consume(ctx context.Context, hash string) (*models.MagicLink, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	link, ok := repository.links[hash]
+	if !ok || link.UsedAt != nil || !link.ExpiresAt.After(now) {
+		return nil, ErrNotFound
+	}
+
+	link.UsedAt = &now
+	repository.links[hash] = link
+
+	return &link, nil
+}
+
+type loginAttemptKey struct {
+	scope      string
+	identifier string
+}
+
+type MemoryLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[loginAttemptKey]models.LoginAttempt
+}
+
+func NewMemoryLoginAttemptRepository() *MemoryLoginAttemptRepository {
+	return &MemoryLoginAttemptRepository{attempts: map[loginAttemptKey]models.LoginAttempt{}}
+}
+
+func (repository *MemoryLoginAttemptRepository) List(ctx context.Context, scope string, identifiers ...string) ([]models.LoginAttempt, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	attempts := []models.LoginAttempt{}
+	for _, identifier := range identifiers {
+		if attempt, ok := repository.attempts[loginAttemptKey{scope, identifier}]; ok {
+			attempts = append(attempts, attempt)
+		}
+	}
+
+	return attempts, nil
+}
+
+func (repository *MemoryLoginAttemptRepository) Reserve(ctx context.Context, scope string, identifier string, lockout LoginLockout) (*models.LoginAttempt, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := time.Now().UTC()
+	key := loginAttemptKey{scope, identifier}
+
+	attempt, ok := repository.attempts[key]
+	if !ok {
+		attempt = models.LoginAttempt{Scope: scope, Identifier: identifier, CreatedAt: now}
+	}
+
+	if lockout.RetryAfter(attempt, now) > 0 {
+		return nil, ErrConflict
+	}
+
+	if attempt.LastFailedAt != nil && attempt.LastFailedAt.Before(now.Add(-lockout.Window)) {
+		attempt.FailedCount = 1
+	} else {
+		attempt.FailedCount++
+	}
+
+	if lockedUntil := lockout.LockedUntil(attempt.FailedCount, now); lockedUntil != nil {
+		attempt.LockedUntil = lockedUntil
+	}
+
+	attempt.LastFailedAt = &now
+	attempt.UpdatedAt = now
+	repository.attempts[key] = attempt
+
+	return &attempt, nil
+}
+
+func (repository *MemoryLoginAttemptRepository) Release(ctx context.Context, scope string, identifier string, lockout LoginLockout) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	key := loginAttemptKey{scope, identifier}
+	attempt, ok := repository.attempts[key]
+	if !ok || attempt.FailedCount <= 0 {
+		return nil
+	}
+
+	if lockout.LockedUntil(attempt.FailedCount, time.Now()) != nil {
+		attempt.LockedUntil = nil
+	}
+
+	attempt.FailedCount--
+	attempt.UpdatedAt = time.Now().UTC()
+	repository.attempts[key] = attempt
+
+	return nil
+}
+
+func (repository *MemoryLoginAttemptRepository) Delete(ctx context.Context, scope string, identifier string) (bool, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	key := loginAttemptKey{scope, identifier}
+	if _, ok := repository.attempts[key]; !ok {
+		return false, nil
+	}
+
+	delete(repository.attempts, key)
+
+	return true, nil
+}
+
+func (repository *MemoryLoginAttemptRepository) Prune(ctx context.Context, lastFailedBefore time.Time) (int64, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := time.Now()
+	var count int64
+	for key, attempt := range repository.attempts {
+		if attempt.LastFailedAt != nil && attempt.LastFailedAt.Before(lastFailedBefore) && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(now)) {
+			delete(repository.attempts, key)
+			count++
+		}
+	}
+
+	return count, nil
+}
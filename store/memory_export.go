@@ -0,0 +1,215 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+)
+
+type MemoryExportRepository struct {
+	mu      sync.RWMutex
+	exports map[uuid.UUID]models.DataExport
+}
+
+func NewMemoryExportRepository() *MemoryExportRepository {
+	return &MemoryExportRepository{exports: map[uuid.UUID]models.DataExport{}}
+}
+
+func (repository *MemoryExportRepository) Create(ctx context.Context, export models.DataExport) (*models.DataExport, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if export.ID == uuid.Nil {
+		export.ID = uuid.New()
+	}
+
+	if _, ok := repository.exports[export.ID]; ok {
+		return nil, ErrConflict
+	}
+
+	// Matches the partial unique index on the pending and running exports of a user
+	for _, existing := range repository.exports {
+		if existing.UserID == export.UserID && (existing.Status == models.ExportPending || existing.Status == models.ExportRunning) {
+			return nil, ErrConflict
+		}
+	}
+
+	now := time.Now().UTC()
+	export = models.DataExport{
+		ID:        export.ID,
+		UserID:    export.UserID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Status:    models.ExportPending,
+	}
+	repository.exports[export.ID] = export
+
+	return &export, nil
+}
+
+func (repository *MemoryExportRepository) Get(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.DataExport, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	export, ok := repository.exports[id]
+	if !ok || export.UserID != userID {
+		return nil, ErrNotFound
+	}
+
+	return &export, nil
+}
+
+func (repository *MemoryExportRepository) GetDownloadable(ctx context.Context, id uuid.UUID) (*models.DataExport, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	export, ok := repository.exports[id]
+	if !ok || export.Status != models.ExportCompleted || export.ExpiresAt == nil || !export.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+
+	return &export, nil
+}
+
+func (repository *MemoryExportRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.DataExport, error) {
+	exports := repository.list(func(export models.DataExport) bool {
+		return export.UserID == userID
+	})
+
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].CreatedAt.After(exports[j].CreatedAt)
+	})
+
+	return exports, nil
+}
+
+func (repository *MemoryExportRepository) ListPending(ctx context.Context) ([]uuid.UUID, error) {
+	exports := repository.list(func(export models.DataExport) bool {
+		return export.Status == models.ExportPending
+	})
+
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].CreatedAt.Before(exports[j].CreatedAt)
+	})
+
+	pending := []uuid.UUID{}
+	for _, export := range exports {
+		pending = append(pending, export.ID)
+	}
+
+	return pending, nil
+}
+
+func (repository *MemoryExportRepository) ListExpired(ctx context.Context) ([]models.DataExport, error) {
+	now := time.Now()
+
+	return repository.list(func(export models.DataExport) bool {
+		return export.Status == models.ExportCompleted && export.ExpiresAt != nil && !export.ExpiresAt.After(now)
+	}), nil
+}
+
+func (repository *MemoryExportRepository) Start(ctx context.Context, id uuid.UUID) (*models.DataExport, error) {
+	return repository.update(id, func(export *models.DataExport) bool {
+		if export.Status != models.ExportPending {
+			return false
+		}
+
+		export.Status = models.ExportRunning
+		return true
+	})
+}
+
+func (repository *MemoryExportRepository) Complete(ctx context.Context, id uuid.UUID, blobKey string, size int64, expiresAt time.Time) error {
+	_, err := repository.update(id, func(export *models.DataExport) bool {
+		now := time.Now().UTC()
+		export.Status = models.ExportCompleted
+		export.BlobKey = &blobKey
+		export.Size = &size
+		export.CompletedAt = &now
+		export.ExpiresAt = &expiresAt
+		return true
+	})
+
+	return ignoreNotFound(err)
+}
+
+func (repository *MemoryExportRepository) Fail(ctx context.Context, id uuid.UUID, message string) error {
+	_, err := repository.update(id, func(export *models.DataExport) bool {
+		export.Status = models.ExportFailed
+		export.Error = &message
+		return true
+	})
+
+	return ignoreNotFound(err)
+}
+
+func (repository *MemoryExportRepository) FailStale(ctx context.Context, updatedBefore time.Time, message string) (int64, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	var count int64
+	for id, export := range repository.exports {
+		if export.Status == models.ExportRunning && export.UpdatedAt.Before(updatedBefore) {
+			export.Status = models.ExportFailed
+			export.Error = &message
+			export.UpdatedAt = time.Now().UTC()
+			repository.exports[id] = export
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (repository *MemoryExportRepository) Expire(ctx context.Context, id uuid.UUID) error {
+	_, err := repository.update(id, func(export *models.DataExport) bool {
+		export.Status = models.ExportExpired
+		export.BlobKey = nil
+		return true
+	})
+
+	return ignoreNotFound(err)
+}
+
+func (repository *MemoryExportRepository) list(match func(export models.DataExport) bool) []models.DataExport {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	exports := []models.DataExport{}
+	for _, export := range repository.exports {
+		if match(export) {
+			exports = append(exports, export)
+		}
+	}
+
+	return exports
+}
+
+func (repository *MemoryExportRepository) update(id uuid.UUID, fn func(export *models.DataExport) bool) (*models.DataExport, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	export, ok := repository.exports[id]
+	if !ok || !fn(&export) {
+		return nil, ErrNotFound
+	}
+
+	export.UpdatedAt = time.Now().UTC()
+	repository.exports[id] = export
+
+	return &export, nil
+}
+
+// ignoreNotFound matches an UPDATE whose affected rows aren't checked
+func ignoreNotFound(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
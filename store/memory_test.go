@@ -0,0 +1,135 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/auth"
+)
+
+func TestMemoryUserRepository(t *testing.T) {
+	ctx := context.Background()
+	users := store.NewMemoryUserRepository()
+
+	user, err := users.Create(ctx, models.User{ID: uuid.New(), Name: "Jane", Email: "jane@koano.app"})
+	assert.NoError(t, err)
+	assert.True(t, user.Active)
+	assert.Equal(t, auth.RoleUser, user.Role)
+
+	_, err = users.Create(ctx, models.User{ID: uuid.New(), Name: "Jane", Email: "jane@koano.app"})
+	assert.ErrorIs(t, err, store.ErrConflict, "Emails should be unique")
+
+	found, err := users.GetByEmail(ctx, "jane@koano.app")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+
+	found.Name = "Changed"
+	found, _ = users.GetByID(ctx, user.ID)
+	assert.Equal(t, "Jane", found.Name, "Returned users should be copies")
+
+	pending := "jane@example.com"
+	updated, err := users.Update(ctx, models.User{ID: user.ID, Name: "Jane Doe", PendingEmail: &pending})
+	assert.NoError(t, err)
+	assert.Equal(t, "Jane Doe", updated.Name)
+	assert.Equal(t, &pending, updated.PendingEmail)
+	assert.Equal(t, "jane@koano.app", updated.Email, "Update should not change the email")
+
+	inUse, _ := users.IsEmailInUse(ctx, "jane@koano.app", user.ID)
+	assert.False(t, inUse, "Email of the user themselves is not in use")
+
+	assert.NoError(t, users.Delete(ctx, user.ID))
+	assert.ErrorIs(t, users.Delete(ctx, user.ID), store.ErrNotFound)
+
+	_, err = users.GetByID(ctx, user.ID)
+	assert.ErrorIs(t, err, store.ErrNotFound, "Deleted users should not be returned")
+
+	inUse, _ = users.IsEmailInUse(ctx, "jane@koano.app", uuid.New())
+	assert.True(t, inUse, "Email of a deleted user is in use until they are purged")
+}
+
+func TestMemoryEventRepository(t *testing.T) {
+	ctx := context.Background()
+	events := store.NewMemoryEventRepository()
+
+	owner := uuid.New()
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+
+	event, err := events.Create(ctx, models.Event{ID: uuid.New(), UserID: owner, Title: "Standup", Start: start, End: start.Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.True(t, event.Active)
+
+	_, err = events.Get(ctx, event.ID, uuid.New())
+	assert.ErrorIs(t, err, store.ErrNotFound, "Events of other users should not be returned")
+
+	exists, _ := events.Exists(ctx, owner, start.In(time.FixedZone("+0530", 19800)), start.Add(time.Hour))
+	assert.True(t, exists, "Times should be compared as instants")
+
+	list, _ := events.ListByUser(ctx, owner, start, start)
+	assert.Len(t, list, 1, "Range should include its bounds")
+
+	list, _ = events.ListByUser(ctx, owner, start.Add(time.Second), start.Add(time.Hour))
+	assert.Empty(t, list)
+
+	updated, err := events.Update(ctx, models.Event{ID: event.ID, UserID: owner, Title: "Retro", Start: start, End: start.Add(2 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, "Retro", updated.Title)
+	assert.Equal(t, event.CreatedAt, updated.CreatedAt)
+
+	_, err = events.Update(ctx, models.Event{ID: event.ID, UserID: uuid.New(), Title: "Stolen"})
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	assert.ErrorIs(t, events.Delete(ctx, event.ID, uuid.New()), store.ErrNotFound)
+	assert.NoError(t, events.Delete(ctx, event.ID, owner))
+
+	list, _ = events.ListByUser(ctx, owner, start, start)
+	assert.Empty(t, list, "Deleted events should not be listed")
+}
+
+func TestMemoryMFAChallengeRepository(t *testing.T) {
+	ctx := context.Background()
+	challenges := store.NewMemoryMFAChallengeRepository()
+
+	userID := uuid.New()
+	challenge := models.MFAChallenge{ID: uuid.New(), UserID: userID, ExpiresAt: time.Now().Add(time.Minute)}
+	assert.NoError(t, challenges.Create(ctx, challenge))
+
+	_, err := challenges.Get(ctx, challenge.ID, uuid.New(), 2)
+	assert.ErrorIs(t, err, store.ErrNotFound, "Challenges of other users should not be returned")
+
+	assert.NoError(t, challenges.Fail(ctx, challenge.ID))
+	_, err = challenges.Get(ctx, challenge.ID, userID, 2)
+	assert.NoError(t, err)
+
+	assert.NoError(t, challenges.Fail(ctx, challenge.ID))
+	_, err = challenges.Get(ctx, challenge.ID, userID, 2)
+	assert.ErrorIs(t, err, store.ErrNotFound, "Challenges should stop working after too many failures")
+	assert.ErrorIs(t, challenges.Use(ctx, challenge.ID, userID, 2), store.ErrNotFound)
+
+	assert.NoError(t, challenges.Use(ctx, challenge.ID, userID, 3))
+	assert.ErrorIs(t, challenges.Use(ctx, challenge.ID, userID, 3), store.ErrNotFound, "Challenges should only be used once")
+
+	expired := models.MFAChallenge{ID: uuid.New(), UserID: userID, ExpiresAt: time.Now().Add(-time.Minute)}
+	assert.NoError(t, challenges.Create(ctx, expired))
+	_, err = challenges.Get(ctx, expired.ID, userID, 2)
+	assert.ErrorIs(t, err, store.ErrNotFound, "Expired challenges should not be returned")
+}
+
+func TestMemoryRefreshTokenRepository(t *testing.T) {
+	ctx := context.Background()
+	refreshTokens := store.NewMemoryRefreshTokenRepository()
+
+	id := uuid.New()
+	userID := uuid.New()
+	assert.NoError(t, refreshTokens.Use(ctx, id, userID, time.Now().Add(time.Minute)))
+	assert.ErrorIs(t, refreshTokens.Use(ctx, id, userID, time.Now().Add(time.Minute)), store.ErrConflict, "Refresh tokens should only be used once")
+
+	expired := uuid.New()
+	assert.NoError(t, refreshTokens.Use(ctx, expired, userID, time.Now().Add(-time.Minute)))
+	assert.NoError(t, refreshTokens.Use(ctx, uuid.New(), userID, time.Now().Add(time.Minute)))
+	assert.NoError(t, refreshTokens.Use(ctx, expired, userID, time.Now().Add(-time.Minute)), "Expired refresh tokens should be cleared, they are rejected before they get here")
+}
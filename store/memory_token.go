@@ -0,0 +1,328 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+)
+
+type MemoryTokenRepository struct {
+	mu     sync.RWMutex
+	tokens map[uuid.UUID]models.PersonalAccessToken
+}
+
+func NewMemoryTokenRepository() *MemoryTokenRepository {
+	return &MemoryTokenRepository{tokens: map[uuid.UUID]models.PersonalAccessToken{}}
+}
+
+func (repository *MemoryTokenRepository) Create(ctx context.Context, token models.PersonalAccessToken) (*models.PersonalAccessToken, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+
+	for _, existing := range repository.tokens {
+		if existing.ID == token.ID || existing.TokenHash == token.TokenHash {
+			return nil, ErrConflict
+		}
+	}
+
+	token.CreatedAt = time.Now().UTC()
+	token.LastUsedAt = nil
+	token.RevokedAt = nil
+	repository.tokens[token.ID] = token
+
+	return &token, nil
+}
+
+func (repository *MemoryTokenRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.PersonalAccessToken, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	tokens := []models.PersonalAccessToken{}
+	for _, token := range repository.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	return tokens, nil
+}
+
+func (repository *MemoryTokenRepository) GetActive(ctx context.Context, hash string) (*models.PersonalAccessToken, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	now := time.Now()
+	for _, token := range repository.tokens {
+		if token.TokenHash == hash && token.RevokedAt == nil && (token.ExpiresAt == nil || token.ExpiresAt.After(now)) {
+			return &token, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (repository *MemoryTokenRepository) Touch(ctx context.Context, id uuid.UUID) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if token, ok := repository.tokens[id]; ok {
+		now := time.Now().UTC()
+		token.LastUsedAt = &now
+		repository.tokens[id] = token
+	}
+
+	return nil
+}
+
+func (repository *MemoryTokenRepository) Revoke(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	token, ok := repository.tokens[id]
+	if !ok || token.UserID != userID || token.RevokedAt != nil {
+		return ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	token.RevokedAt = &now
+	repository.tokens[id] = token
+
+	return nil
+}
+
+type MemoryOAuthRepository struct {
+	mu      sync.RWMutex
+	clients map[uuid.UUID]models.OAuthClient
+	codes   map[string]models.OAuthAuthorizationCode
+	grants  map[uuid.UUID]models.OAuthGrant
+}
+
+func NewMemoryOAuthRepository() *MemoryOAuthRepository {
+	return &MemoryOAuthRepository{
+		clients: map[uuid.UUID]models.OAuthClient{},
+		codes:   map[string]models.OAuthAuthorizationCode{},
+		grants:  map[uuid.UUID]models.OAuthGrant{},
+	}
+}
+
+func (repository *MemoryOAuthRepository) CreateClient(ctx context.Context, client models.OAuthClient) (*models.OAuthClient, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if client.ID == uuid.Nil {
+		client.ID = uuid.New()
+	}
+
+	if _, ok := repository.clients[client.ID]; ok {
+		return nil, ErrConflict
+	}
+
+	client.CreatedAt = time.Now().UTC()
+	client.RevokedAt = nil
+	repository.clients[client.ID] = client
+
+	return &client, nil
+}
+
+func (repository *MemoryOAuthRepository) ListClientsByUser(ctx context.Context, userID uuid.UUID) ([]models.OAuthClient, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	clients := []models.OAuthClient{}
+	for _, client := range repository.clients {
+		if client.UserID == userID {
+			clients = append(clients, client)
+		}
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.After(clients[j].CreatedAt)
+	})
+
+	return clients, nil
+}
+
+func (repository *MemoryOAuthRepository) GetActiveClient(ctx context.Context, id uuid.UUID) (*models.OAuthClient, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	client, ok := repository.clients[id]
+	if !ok || client.RevokedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	return &client, nil
+}
+
+func (repository *MemoryOAuthRepository) RevokeClient(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	client, ok := repository.clients[id]
+	if !ok || client.UserID != userID || client.RevokedAt != nil {
+		return ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	client.RevokedAt = &now
+	repository.clients[id] = client
+
+	for grantID, grant := range repository.grants {
+		if grant.ClientID == id && grant.RevokedAt == nil {
+			grant.RevokedAt = &now
+			repository.grants[grantID] = grant
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryOAuthRepository) CreateCode(ctx context.Context, code models.OAuthAuthorizationCode) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if _, ok := repository.codes[code.CodeHash]; ok {
+		return ErrConflict
+	}
+
+	code.CreatedAt = time.Now().UTC()
+	repository.codes[code.CodeHash] = code
+
+	return nil
+}
+
+func (repository *MemoryOAuthRepository) ConsumeCode(ctx context.Context, hash string) (*models.OAuthAuthorizationCode, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	code, ok := repository.codes[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	delete(repository.codes, hash)
+
+	return &code, nil
+}
+
+func (repository *MemoryOAuthRepository) CreateGrant(ctx context.Context, grant models.OAuthGrant) (*models.OAuthGrant, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if grant.ID == uuid.Nil {
+		grant.ID = uuid.New()
+	}
+
+	if _, ok := repository.grants[grant.ID]; ok {
+		return nil, ErrConflict
+	}
+
+	grant.CreatedAt = time.Now().UTC()
+	grant.LastUsedAt = nil
+	grant.RevokedAt = nil
+	repository.grants[grant.ID] = grant
+
+	return &grant, nil
+}
+
+func (repository *MemoryOAuthRepository) GetActiveGrant(ctx context.Context, id uuid.UUID) (*models.OAuthGrant, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	grant, ok := repository.grants[id]
+	if !ok || grant.RevokedAt != nil || !grant.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+
+	if client, ok := repository.clients[grant.ClientID]; !ok || client.RevokedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	return &grant, nil
+}
+
+func (repository *MemoryOAuthRepository) GetClientGrant(ctx context.Context, id uuid.UUID, clientID uuid.UUID) (*models.OAuthGrant, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	grant, ok := repository.grants[id]
+	if !ok || grant.ClientID != clientID {
+		return nil, ErrNotFound
+	}
+
+	return &grant, nil
+}
+
+func (repository *MemoryOAuthRepository) GetClientGrantByRefreshToken(ctx context.Context, hash string, clientID uuid.UUID) (*models.OAuthGrant, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	for _, grant := range repository.grants {
+		if grant.RefreshTokenHash == hash && grant.ClientID == clientID {
+			return &grant, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (repository *MemoryOAuthRepository) ListGrantsByUser(ctx context.Context, userID uuid.UUID) ([]models.OAuthGrant, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+
+	grants := []models.OAuthGrant{}
+	for _, grant := range repository.grants {
+		if grant.UserID == userID {
+			grants = append(grants, grant)
+		}
+	}
+
+	sort.Slice(grants, func(i, j int) bool {
+		return grants[i].CreatedAt.Before(grants[j].CreatedAt)
+	})
+
+	return grants, nil
+}
+
+func (repository *MemoryOAuthRepository) RotateGrant(ctx context.Context, id uuid.UUID, oldHash string, newHash string, expiresAt time.Time) (*models.OAuthGrant, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	grant, ok := repository.grants[id]
+	if !ok || grant.RefreshTokenHash != oldHash || grant.RevokedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	grant.RefreshTokenHash = newHash
+	grant.LastUsedAt = &now
+	grant.ExpiresAt = expiresAt
+	repository.grants[id] = grant
+
+	return &grant, nil
+}
+
+func (repository *MemoryOAuthRepository) RevokeGrant(ctx context.Context, id uuid.UUID) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if grant, ok := repository.grants[id]; ok && grant.RevokedAt == nil {
+		now := time.Now().UTC()
+		grant.RevokedAt = &now
+		repository.grants[id] = grant
+	}
+
+	return nil
+}
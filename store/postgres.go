@@ -0,0 +1,366 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/ushiradineth/koano-api/models"
+)
+
+const uniqueViolation = "23505"
+
+// database is what the repositories need from a connection, so the same repository runs on the pool or in a transaction
+type database interface {
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+var (
+	_ database = (*sqlx.DB)(nil)
+	_ database = (*sqlx.Tx)(nil)
+)
+
+type postgresUserRepository struct {
+	db database
+}
+
+func NewPostgresUserRepository(db database) UserRepository {
+	return &postgresUserRepository{db: db}
+}
+
+func (repository *postgresUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user := models.User{}
+
+	err := repository.db.GetContext(ctx, &user, "SELECT * FROM users WHERE id=$1 AND active=true AND disabled_at IS NULL", id)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &user, nil
+}
+
+func (repository *postgresUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	user := models.User{}
+
+	err := repository.db.GetContext(ctx, &user, "SELECT * FROM users WHERE email=$1 AND active=true AND disabled_at IS NULL", email)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &user, nil
+}
+
+func (repository *postgresUserRepository) Find(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user := models.User{}
+
+	err := repository.db.GetContext(ctx, &user, "SELECT * FROM users WHERE id=$1", id)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &user, nil
+}
+
+func (repository *postgresUserRepository) GetRestorableByID(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*models.User, error) {
+	user := models.User{}
+
+	err := repository.db.GetContext(ctx, &user, "SELECT * FROM users WHERE id=$1 AND active=false AND deleted_at > $2 AND disabled_at IS NULL", id, deletedAfter)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &user, nil
+}
+
+func (repository *postgresUserRepository) GetRestorableByEmail(ctx context.Context, email string, deletedAfter time.Time) (*models.User, error) {
+	user := models.User{}
+
+	err := repository.db.GetContext(ctx, &user, "SELECT * FROM users WHERE email=$1 AND active=false AND deleted_at > $2 AND disabled_at IS NULL", email, deletedAfter)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &user, nil
+}
+
+func (repository *postgresUserRepository) ListByEmail(ctx context.Context, email string) ([]models.User, error) {
+	users := []models.User{}
+
+	err := repository.db.SelectContext(ctx, &users, "SELECT * FROM users WHERE lower(email)=lower($1)", email)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (repository *postgresUserRepository) IsEmailInUse(ctx context.Context, email string, exceptID uuid.UUID) (bool, error) {
+	var count int
+
+	err := repository.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM users WHERE email=$1 AND id!=$2", email, exceptID)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (repository *postgresUserRepository) Search(ctx context.Context, search UserSearch) ([]models.User, error) {
+	users := []models.User{}
+
+	// Wildcards in the query are matched literally so a search for "_" doesn't list every user
+	pattern := "%" + likeEscaper.Replace(search.Query) + "%"
+
+	err := repository.db.SelectContext(ctx, &users, `SELECT * FROM users
+		WHERE (email ILIKE $1 OR name ILIKE $1)
+		AND ($2 = '' OR role = $2)
+		AND ($3 = '' OR ($3 = 'active' AND active=true AND disabled_at IS NULL) OR ($3 = 'disabled' AND disabled_at IS NOT NULL) OR ($3 = 'deleted' AND active=false))
+		ORDER BY created_at DESC LIMIT $4 OFFSET $5`, pattern, search.Role, search.Status, search.Limit, search.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (repository *postgresUserRepository) CountActive(ctx context.Context) (int64, error) {
+	var count int64
+	err := repository.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM users WHERE active=true AND disabled_at IS NULL")
+	return count, err
+}
+
+func (repository *postgresUserRepository) Create(ctx context.Context, user models.User) (*models.User, error) {
+	created := models.User{}
+
+	var verifiedAt *time.Time
+	if user.EmailVerified {
+		now := time.Now()
+		verifiedAt = &now
+	}
+
+	err := repository.db.GetContext(ctx, &created, "INSERT INTO users (id, name, email, password, email_verified, email_verified_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *", user.ID, user.Name, user.Email, user.Password, user.EmailVerified, verifiedAt)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &created, nil
+}
+
+func (repository *postgresUserRepository) Update(ctx context.Context, user models.User) (*models.User, error) {
+	updated := models.User{}
+
+	err := repository.db.GetContext(ctx, &updated, "UPDATE users SET name=$1, pending_email=$2, updated_at=$3 WHERE id=$4 AND active=true RETURNING *", user.Name, user.PendingEmail, time.Now(), user.ID)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &updated, nil
+}
+
+func (repository *postgresUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	res, err := repository.db.ExecContext(ctx, "UPDATE users SET active=false, deleted_at=$1 WHERE id=$2 AND active=true", time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return affected(res)
+}
+
+func (repository *postgresUserRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	return repository.exec(ctx, "UPDATE users SET active=true, deleted_at=NULL, updated_at=$1 WHERE id=$2 AND active=false", time.Now(), id)
+}
+
+func (repository *postgresUserRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error) {
+	purged := []uuid.UUID{}
+
+	if err := repository.db.SelectContext(ctx, &purged, "DELETE FROM users WHERE active=false AND deleted_at <= $1 RETURNING id", deletedBefore); err != nil {
+		return nil, err
+	}
+
+	return purged, nil
+}
+
+func (repository *postgresUserRepository) SetPassword(ctx context.Context, id uuid.UUID, hash string) error {
+	return repository.exec(ctx, "UPDATE users SET password=$1, token_version=token_version+1, updated_at=$2 WHERE id=$3", hash, time.Now(), id)
+}
+
+func (repository *postgresUserRepository) RehashPassword(ctx context.Context, id uuid.UUID, oldHash string, newHash string) error {
+	return repository.exec(ctx, "UPDATE users SET password=$1 WHERE id=$2 AND password=$3", newHash, id, oldHash)
+}
+
+func (repository *postgresUserRepository) VerifyEmail(ctx context.Context, id uuid.UUID, email string) (*models.User, error) {
+	verified := models.User{}
+
+	err := repository.db.GetContext(ctx, &verified, "UPDATE users SET email=$1, pending_email=NULLIF(pending_email, $1), email_verified=true, email_verified_at=$2, updated_at=$2 WHERE id=$3 AND active=true RETURNING *", email, time.Now(), id)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &verified, nil
+}
+
+func (repository *postgresUserRepository) SetTOTPSecret(ctx context.Context, id uuid.UUID, secret string) error {
+	return repository.exec(ctx, "UPDATE users SET totp_secret=$1, updated_at=$2 WHERE id=$3", secret, time.Now(), id)
+}
+
+func (repository *postgresUserRepository) EnableMFA(ctx context.Context, id uuid.UUID) error {
+	return repository.exec(ctx, "UPDATE users SET mfa_enabled=true, updated_at=$1 WHERE id=$2", time.Now(), id)
+}
+
+func (repository *postgresUserRepository) DisableMFA(ctx context.Context, id uuid.UUID) error {
+	return repository.exec(ctx, "UPDATE users SET mfa_enabled=false, totp_secret=NULL, totp_last_step=0, updated_at=$1 WHERE id=$2", time.Now(), id)
+}
+
+func (repository *postgresUserRepository) UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) error {
+	err := repository.exec(ctx, "UPDATE users SET totp_last_step=$1 WHERE id=$2 AND totp_last_step < $1", step, id)
+	if errors.Is(err, ErrNotFound) {
+		return ErrConflict
+	}
+
+	return err
+}
+
+func (repository *postgresUserRepository) Disable(ctx context.Context, id uuid.UUID) error {
+	return repository.exec(ctx, "UPDATE users SET disabled_at=$1, token_version=token_version+1, updated_at=$1 WHERE id=$2", time.Now(), id)
+}
+
+func (repository *postgresUserRepository) Reinstate(ctx context.Context, id uuid.UUID) error {
+	return repository.exec(ctx, "UPDATE users SET disabled_at=NULL, active=true, deleted_at=NULL, updated_at=$1 WHERE id=$2", time.Now(), id)
+}
+
+func (repository *postgresUserRepository) RevokeSessions(ctx context.Context, id uuid.UUID) error {
+	return repository.exec(ctx, "UPDATE users SET token_version=token_version+1, updated_at=$1 WHERE id=$2", time.Now(), id)
+}
+
+func (repository *postgresUserRepository) SetRole(ctx context.Context, id uuid.UUID, role string) error {
+	return repository.exec(ctx, "UPDATE users SET role=$1, updated_at=$2 WHERE id=$3", role, time.Now(), id)
+}
+
+func (repository *postgresUserRepository) exec(ctx context.Context, query string, args ...any) error {
+	res, err := repository.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return affected(res)
+}
+
+type postgresEventRepository struct {
+	db database
+}
+
+func NewPostgresEventRepository(db database) EventRepository {
+	return &postgresEventRepository{db: db}
+}
+
+func (repository *postgresEventRepository) Get(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.Event, error) {
+	event := models.Event{}
+
+	err := repository.db.GetContext(ctx, &event, "SELECT * FROM events WHERE id=$1 AND user_id=$2 AND active=true", id, userID)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &event, nil
+}
+
+func (repository *postgresEventRepository) Exists(ctx context.Context, userID uuid.UUID, start time.Time, end time.Time) (bool, error) {
+	var count int
+
+	err := repository.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM events WHERE start_time=$1 AND end_time=$2 AND user_id=$3 AND active=true", start, end, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (repository *postgresEventRepository) ListByUser(ctx context.Context, userID uuid.UUID, from time.Time, to time.Time) ([]models.Event, error) {
+	events := []models.Event{}
+
+	err := repository.db.SelectContext(ctx, &events, "SELECT * FROM events WHERE user_id=$1 AND start_time >= $2 AND start_time <= $3 AND active=true", userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (repository *postgresEventRepository) ListAll(ctx context.Context, userID uuid.UUID) ([]models.Event, error) {
+	events := []models.Event{}
+
+	err := repository.db.SelectContext(ctx, &events, "SELECT * FROM events WHERE user_id=$1 ORDER BY start_time", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (repository *postgresEventRepository) Create(ctx context.Context, event models.Event) (*models.Event, error) {
+	created := models.Event{}
+
+	err := repository.db.GetContext(ctx, &created, "INSERT INTO events (id, title, start_time, end_time, user_id, timezone, repeated) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *", event.ID, event.Title, event.Start, event.End, event.UserID, event.Timezone, event.Repeated)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &created, nil
+}
+
+func (repository *postgresEventRepository) Update(ctx context.Context, event models.Event) (*models.Event, error) {
+	updated := models.Event{}
+
+	err := repository.db.GetContext(ctx, &updated, "UPDATE events SET title=$1, start_time=$2, end_time=$3, timezone=$4, repeated=$5, updated_at=$6 WHERE id=$7 AND user_id=$8 AND active=true RETURNING *", event.Title, event.Start, event.End, event.Timezone, event.Repeated, time.Now(), event.ID, event.UserID)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &updated, nil
+}
+
+func (repository *postgresEventRepository) Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	res, err := repository.db.ExecContext(ctx, "UPDATE events SET active=false, deleted_at=$1 WHERE id=$2 AND user_id=$3 AND active=true", time.Now(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return affected(res)
+}
+
+func affected(res sql.Result) error {
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// postgresError maps the errors callers handle to the ones the in-memory repositories return
+func postgresError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrConflict
+	}
+
+	return err
+}
+
+// likeEscaper escapes the wildcards of LIKE, so user input is matched literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
@@ -0,0 +1,372 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/ushiradineth/koano-api/models"
+)
+
+type postgresRecoveryCodeRepository struct {
+	db database
+}
+
+func NewPostgresRecoveryCodeRepository(db database) RecoveryCodeRepository {
+	return &postgresRecoveryCodeRepository{db: db}
+}
+
+func (repository *postgresRecoveryCodeRepository) Replace(ctx context.Context, userID uuid.UUID, hashes []string) error {
+	// A single statement swaps the codes, so a failure can't leave the user with none
+	_, err := repository.db.ExecContext(ctx, `WITH removed AS (
+			DELETE FROM recovery_codes WHERE user_id=$1
+		)
+		INSERT INTO recovery_codes (id, user_id, code_hash) SELECT uuid_generate_v4(), $1, code_hash FROM unnest($2::text[]) AS code_hash`, userID, pq.StringArray(hashes))
+	return err
+}
+
+func (repository *postgresRecoveryCodeRepository) Check(ctx context.Context, userID uuid.UUID, hash string) error {
+	var exists bool
+	if err := repository.db.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM recovery_codes WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL)", userID, hash); err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (repository *postgresRecoveryCodeRepository) Use(ctx context.Context, userID uuid.UUID, hash string) error {
+	res, err := repository.db.ExecContext(ctx, "UPDATE recovery_codes SET used_at=$1 WHERE user_id=$2 AND code_hash=$3 AND used_at IS NULL", time.Now(), userID, hash)
+	if err != nil {
+		return err
+	}
+
+	return affected(res)
+}
+
+type postgresMFAChallengeRepository struct {
+	db database
+}
+
+func NewPostgresMFAChallengeRepository(db database) MFAChallengeRepository {
+	return &postgresMFAChallengeRepository{db: db}
+}
+
+func (repository *postgresMFAChallengeRepository) Create(ctx context.Context, challenge models.MFAChallenge) error {
+	now := time.Now()
+
+	if _, err := repository.db.ExecContext(ctx, "DELETE FROM mfa_challenges WHERE expires_at < $1", now); err != nil {
+		return err
+	}
+
+	_, err := repository.db.ExecContext(ctx, "INSERT INTO mfa_challenges (id, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4)", challenge.ID, challenge.UserID, now, challenge.ExpiresAt)
+	return postgresError(err)
+}
+
+func (repository *postgresMFAChallengeRepository) Get(ctx context.Context, id uuid.UUID, userID uuid.UUID, maxFailures int) (*models.MFAChallenge, error) {
+	challenge := models.MFAChallenge{}
+
+	err := repository.db.GetContext(ctx, &challenge, "SELECT * FROM mfa_challenges WHERE id=$1 AND user_id=$2 AND used_at IS NULL AND expires_at > $3 AND failed_count < $4", id, userID, time.Now(), maxFailures)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &challenge, nil
+}
+
+func (repository *postgresMFAChallengeRepository) Fail(ctx context.Context, id uuid.UUID) error {
+	res, err := repository.db.ExecContext(ctx, "UPDATE mfa_challenges SET failed_count=failed_count+1 WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+
+	return affected(res)
+}
+
+func (repository *postgresMFAChallengeRepository) Use(ctx context.Context, id uuid.UUID, userID uuid.UUID, maxFailures int) error {
+	res, err := repository.db.ExecContext(ctx, "UPDATE mfa_challenges SET used_at=$1 WHERE id=$2 AND user_id=$3 AND used_at IS NULL AND expires_at > $1 AND failed_count < $4", time.Now(), id, userID, maxFailures)
+	if err != nil {
+		return err
+	}
+
+	return affected(res)
+}
+
+type postgresRefreshTokenRepository struct {
+	db database
+}
+
+func NewPostgresRefreshTokenRepository(db database) RefreshTokenRepository {
+	return &postgresRefreshTokenRepository{db: db}
+}
+
+func (repository *postgresRefreshTokenRepository) Use(ctx context.Context, id uuid.UUID, userID uuid.UUID, expiresAt time.Time) error {
+	now := time.Now()
+
+	if _, err := repository.db.ExecContext(ctx, "DELETE FROM used_refresh_tokens WHERE expires_at < $1", now); err != nil {
+		return err
+	}
+
+	// The primary key makes a second use fail, even when two requests race with the same token
+	_, err := repository.db.ExecContext(ctx, "INSERT INTO used_refresh_tokens (id, user_id, used_at, expires_at) VALUES ($1, $2, $3, $4)", id, userID, now, expiresAt)
+	return postgresError(err)
+}
+
+type postgresPasskeyRepository struct {
+	db database
+}
+
+func NewPostgresPasskeyRepository(db database) PasskeyRepository {
+	return &postgresPasskeyRepository{db: db}
+}
+
+func (repository *postgresPasskeyRepository) Create(ctx context.Context, credential models.WebAuthnCredential) (*models.WebAuthnCredential, error) {
+	created := models.WebAuthnCredential{}
+
+	err := repository.db.GetContext(ctx, &created, "INSERT INTO webauthn_credentials (id, user_id, name, credential_id, public_key, sign_count, transports, aaguid) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *", credential.ID, credential.UserID, credential.Name, credential.CredentialID, credential.PublicKey, credential.SignCount, credential.Transports, credential.AAGUID)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &created, nil
+}
+
+func (repository *postgresPasskeyRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	credentials := []models.WebAuthnCredential{}
+
+	err := repository.db.SelectContext(ctx, &credentials, "SELECT * FROM webauthn_credentials WHERE user_id=$1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+func (repository *postgresPasskeyRepository) GetByCredentialID(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error) {
+	credential := models.WebAuthnCredential{}
+
+	err := repository.db.GetContext(ctx, &credential, "SELECT * FROM webauthn_credentials WHERE credential_id=$1", credentialID)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &credential, nil
+}
+
+func (repository *postgresPasskeyRepository) UpdateSignCount(ctx context.Context, id uuid.UUID, oldCount int64, newCount int64) error {
+	res, err := repository.db.ExecContext(ctx, "UPDATE webauthn_credentials SET sign_count=$1, last_used_at=$2 WHERE id=$3 AND sign_count=$4", newCount, time.Now(), id, oldCount)
+	if err != nil {
+		return err
+	}
+
+	return affected(res)
+}
+
+func (repository *postgresPasskeyRepository) Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	res, err := repository.db.ExecContext(ctx, "DELETE FROM webauthn_credentials WHERE id=$1 AND user_id=$2", id, userID)
+	if err != nil {
+		return err
+	}
+
+	return affected(res)
+}
+
+func (repository *postgresPasskeyRepository) CreateChallenge(ctx context.Context, challenge models.WebAuthnChallenge) error {
+	now := time.Now()
+
+	if _, err := repository.db.ExecContext(ctx, "DELETE FROM webauthn_challenges WHERE expires_at < $1", now); err != nil {
+		return err
+	}
+
+	_, err := repository.db.ExecContext(ctx, "INSERT INTO webauthn_challenges (challenge, user_id, ceremony, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)", challenge.Challenge, challenge.UserID, challenge.Ceremony, now, challenge.ExpiresAt)
+	return postgresError(err)
+}
+
+func (repository *postgresPasskeyRepository) ConsumeChallenge(ctx context.Context, challenge string, ceremony string, userID *uuid.UUID) error {
+	stored := models.WebAuthnChallenge{}
+
+	err := repository.db.GetContext(ctx, &stored, "DELETE FROM webauthn_challenges WHERE challenge=$1 AND ceremony=$2 AND user_id IS NOT DISTINCT FROM $3 AND expires_at > $4 RETURNING *", challenge, ceremony, userID, time.Now())
+	return postgresError(err)
+}
+
+type postgresIdentityRepository struct {
+	db database
+}
+
+func NewPostgresIdentityRepository(db database) IdentityRepository {
+	return &postgresIdentityRepository{db: db}
+}
+
+func (repository *postgresIdentityRepository) Get(ctx context.Context, provider string, subject string) (*models.UserIdentity, error) {
+	identity := models.UserIdentity{}
+
+	err := repository.db.GetContext(ctx, &identity, "SELECT * FROM user_identities WHERE provider=$1 AND subject=$2", provider, subject)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &identity, nil
+}
+
+func (repository *postgresIdentityRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error) {
+	identities := []models.UserIdentity{}
+
+	err := repository.db.SelectContext(ctx, &identities, "SELECT * FROM user_identities WHERE user_id=$1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+func (repository *postgresIdentityRepository) Create(ctx context.Context, identity models.UserIdentity) error {
+	_, err := repository.db.ExecContext(ctx, "INSERT INTO user_identities (id, user_id, provider, subject, email, last_login_at) VALUES ($1, $2, $3, $4, $5, $6)", identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email, time.Now())
+	return postgresError(err)
+}
+
+func (repository *postgresIdentityRepository) Touch(ctx context.Context, provider string, subject string, email string) error {
+	_, err := repository.db.ExecContext(ctx, "UPDATE user_identities SET last_login_at=$1, email=$2 WHERE provider=$3 AND subject=$4", time.Now(), email, provider, subject)
+	return err
+}
+
+func (repository *postgresIdentityRepository) CreateState(ctx context.Context, state models.OIDCState) error {
+	_, err := repository.db.ExecContext(ctx, "INSERT INTO oidc_states (state, provider, code_verifier, nonce, expires_at) VALUES ($1, $2, $3, $4, $5)", state.State, state.Provider, state.CodeVerifier, state.Nonce, state.ExpiresAt)
+	return postgresError(err)
+}
+
+func (repository *postgresIdentityRepository) ConsumeState(ctx context.Context, state string, provider string) (*models.OIDCState, error) {
+	stored := models.OIDCState{}
+
+	err := repository.db.GetContext(ctx, &stored, "DELETE FROM oidc_states WHERE state=$1 AND provider=$2 AND expires_at > $3 RETURNING *", state, provider, time.Now())
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &stored, nil
+}
+
+type postgresMagicLinkRepository struct {
+	db database
+}
+
+func NewPostgresMagicLinkRepository(db database) MagicLinkRepository {
+	return &postgresMagicLinkRepository{db: db}
+}
+
+func (repository *postgresMagicLinkRepository) Create(ctx context.Context, link models.MagicLink) error {
+	_, err := repository.db.ExecContext(ctx, "INSERT INTO magic_links (token_hash, email, name, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)", link.TokenHash, link.Email, link.Name, time.Now(), link.ExpiresAt)
+	return postgresError(err)
+}
+
+func (repository *postgresMagicLinkRepository) SentSince(ctx context.Context, email string, since time.Time) (bool, error) {
+	var count int
+
+	err := repository.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM magic_links WHERE email=$1 AND created_at > $2", email, since)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (repository *postgresMagicLinkRepository) Consume(ctx context.Context, hash string) (*models.MagicLink, error) {
+	link := models.MagicLink{}
+
+	err := repository.db.GetContext(ctx, &link, "UPDATE magic_links SET used_at=$1 WHERE token_hash=$2 AND used_at IS NULL AND expires_at > $1 RETURNING *", time.Now(), hash)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &link, nil
+}
+
+type postgresLoginAttemptRepository struct {
+	db database
+}
+
+func NewPostgresLoginAttemptRepository(db database) LoginAttemptRepository {
+	return &postgresLoginAttemptRepository{db: db}
+}
+
+func (repository *postgresLoginAttemptRepository) List(ctx context.Context, scope string, identifiers ...string) ([]models.LoginAttempt, error) {
+	attempts := []models.LoginAttempt{}
+
+	err := repository.db.SelectContext(ctx, &attempts, "SELECT * FROM login_attempts WHERE scope=$1 AND identifier=ANY($2)", scope, pq.StringArray(identifiers))
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+func (repository *postgresLoginAttemptRepository) Reserve(ctx context.Context, scope string, identifier string, lockout LoginLockout) (*models.LoginAttempt, error) {
+	now := time.Now()
+	attempt := models.LoginAttempt{}
+
+	// The new count is repeated in locked_until since SET can't refer to the value it assigns. The lockout doubles with every
+	// threshold reached, computed in microseconds so it can be capped before it becomes an interval. The WHERE of the conflict
+	// leaves a locked or delayed identifier as it is, returning no row, which is checked under the row lock of the upsert.
+	err := repository.db.GetContext(ctx, &attempt, `INSERT INTO login_attempts (scope, identifier, failed_count, last_failed_at, locked_until, created_at, updated_at)
+		VALUES ($1, $2, 1, $3::timestamptz, CASE WHEN $5::int = 1 THEN $3::timestamptz + LEAST($6::bigint, $7::bigint) * interval '1 microsecond' END, $3::timestamptz, $3::timestamptz)
+		ON CONFLICT (scope, identifier) DO UPDATE SET
+			failed_count = CASE WHEN login_attempts.last_failed_at < $4 THEN 1 ELSE login_attempts.failed_count + 1 END,
+			locked_until = CASE
+				WHEN $5::int > 0 AND (CASE WHEN login_attempts.last_failed_at < $4 THEN 1 ELSE login_attempts.failed_count + 1 END) % $5::int = 0
+				THEN $3::timestamptz + LEAST($6::bigint * power(2, (CASE WHEN login_attempts.last_failed_at < $4 THEN 1 ELSE login_attempts.failed_count + 1 END) / $5::int - 1), $7::bigint) * interval '1 microsecond'
+				ELSE login_attempts.locked_until
+			END,
+			last_failed_at = $3::timestamptz,
+			updated_at = $3::timestamptz
+		WHERE (login_attempts.locked_until IS NULL OR login_attempts.locked_until <= $3::timestamptz)
+			AND ($8::int <= 0 OR login_attempts.last_failed_at IS NULL OR login_attempts.last_failed_at < $4 OR login_attempts.failed_count < $8::int
+				OR login_attempts.last_failed_at + LEAST(1000000 * power(2, login_attempts.failed_count - $8::int), $9::bigint) * interval '1 microsecond' <= $3::timestamptz)
+		RETURNING *`, scope, identifier, now, now.Add(-lockout.Window), lockout.Threshold, lockout.Duration.Microseconds(), lockout.Max.Microseconds(), lockout.DelayAfter, lockout.MaxDelay.Microseconds())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrConflict
+		}
+
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+func (repository *postgresLoginAttemptRepository) Release(ctx context.Context, scope string, identifier string, lockout LoginLockout) error {
+	// SET refers to the count before it is taken back, which is the count that triggered the lockout if there was one
+	_, err := repository.db.ExecContext(ctx, `UPDATE login_attempts SET
+			locked_until = CASE WHEN $3::int > 0 AND failed_count % $3::int = 0 THEN NULL ELSE locked_until END,
+			failed_count = failed_count - 1,
+			updated_at = $4
+		WHERE scope=$1 AND identifier=$2 AND failed_count > 0`, scope, identifier, lockout.Threshold, time.Now())
+	return err
+}
+
+func (repository *postgresLoginAttemptRepository) Delete(ctx context.Context, scope string, identifier string) (bool, error) {
+	res, err := repository.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE scope=$1 AND identifier=$2", scope, identifier)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (repository *postgresLoginAttemptRepository) Prune(ctx context.Context, lastFailedBefore time.Time) (int64, error) {
+	res, err := repository.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE last_failed_at < $1 AND (locked_until IS NULL OR locked_until < $2)", lastFailedBefore, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
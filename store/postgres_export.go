@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+)
+
+type postgresExportRepository struct {
+	db database
+}
+
+func NewPostgresExportRepository(db database) ExportRepository {
+	return &postgresExportRepository{db: db}
+}
+
+func (repository *postgresExportRepository) Create(ctx context.Context, export models.DataExport) (*models.DataExport, error) {
+	created := models.DataExport{}
+
+	err := repository.db.GetContext(ctx, &created, "INSERT INTO data_exports (id, user_id, status) VALUES ($1, $2, $3) RETURNING *", export.ID, export.UserID, models.ExportPending)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &created, nil
+}
+
+func (repository *postgresExportRepository) Get(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.DataExport, error) {
+	export := models.DataExport{}
+
+	err := repository.db.GetContext(ctx, &export, "SELECT * FROM data_exports WHERE id=$1 AND user_id=$2", id, userID)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &export, nil
+}
+
+func (repository *postgresExportRepository) GetDownloadable(ctx context.Context, id uuid.UUID) (*models.DataExport, error) {
+	export := models.DataExport{}
+
+	err := repository.db.GetContext(ctx, &export, "SELECT * FROM data_exports WHERE id=$1 AND status=$2 AND expires_at > $3", id, models.ExportCompleted, time.Now())
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &export, nil
+}
+
+func (repository *postgresExportRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.DataExport, error) {
+	exports := []models.DataExport{}
+
+	err := repository.db.SelectContext(ctx, &exports, "SELECT * FROM data_exports WHERE user_id=$1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+func (repository *postgresExportRepository) ListPending(ctx context.Context) ([]uuid.UUID, error) {
+	pending := []uuid.UUID{}
+
+	err := repository.db.SelectContext(ctx, &pending, "SELECT id FROM data_exports WHERE status=$1 ORDER BY created_at", models.ExportPending)
+	if err != nil {
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+func (repository *postgresExportRepository) ListExpired(ctx context.Context) ([]models.DataExport, error) {
+	expired := []models.DataExport{}
+
+	err := repository.db.SelectContext(ctx, &expired, "SELECT * FROM data_exports WHERE status=$1 AND expires_at <= $2", models.ExportCompleted, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+func (repository *postgresExportRepository) Start(ctx context.Context, id uuid.UUID) (*models.DataExport, error) {
+	export := models.DataExport{}
+
+	err := repository.db.GetContext(ctx, &export, "UPDATE data_exports SET status=$1, updated_at=$2 WHERE id=$3 AND status=$4 RETURNING *", models.ExportRunning, time.Now(), id, models.ExportPending)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &export, nil
+}
+
+func (repository *postgresExportRepository) Complete(ctx context.Context, id uuid.UUID, blobKey string, size int64, expiresAt time.Time) error {
+	_, err := repository.db.ExecContext(ctx, "UPDATE data_exports SET status=$1, blob_key=$2, size=$3, completed_at=$4, expires_at=$5, updated_at=$4 WHERE id=$6", models.ExportCompleted, blobKey, size, time.Now(), expiresAt, id)
+	return err
+}
+
+func (repository *postgresExportRepository) Fail(ctx context.Context, id uuid.UUID, message string) error {
+	_, err := repository.db.ExecContext(ctx, "UPDATE data_exports SET status=$1, error=$2, updated_at=$3 WHERE id=$4", models.ExportFailed, message, time.Now(), id)
+	return err
+}
+
+func (repository *postgresExportRepository) FailStale(ctx context.Context, updatedBefore time.Time, message string) (int64, error) {
+	res, err := repository.db.ExecContext(ctx, "UPDATE data_exports SET status=$1, error=$2, updated_at=$3 WHERE status=$4 AND updated_at < $5", models.ExportFailed, message, time.Now(), models.ExportRunning, updatedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (repository *postgresExportRepository) Expire(ctx context.Context, id uuid.UUID) error {
+	_, err := repository.db.ExecContext(ctx, "UPDATE data_exports SET status=$1, blob_key=NULL, updated_at=$2 WHERE id=$3", models.ExportExpired, time.Now(), id)
+	return err
+}
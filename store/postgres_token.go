@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+)
+
+type postgresTokenRepository struct {
+	db database
+}
+
+func NewPostgresTokenRepository(db database) TokenRepository {
+	return &postgresTokenRepository{db: db}
+}
+
+func (repository *postgresTokenRepository) Create(ctx context.Context, token models.PersonalAccessToken) (*models.PersonalAccessToken, error) {
+	created := models.PersonalAccessToken{}
+
+	err := repository.db.GetContext(ctx, &created, "INSERT INTO personal_access_tokens (id, user_id, name, token_hash, token_prefix, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *", token.ID, token.UserID, token.Name, token.TokenHash, token.TokenPrefix, token.Scopes, token.ExpiresAt)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &created, nil
+}
+
+func (repository *postgresTokenRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.PersonalAccessToken, error) {
+	tokens := []models.PersonalAccessToken{}
+
+	err := repository.db.SelectContext(ctx, &tokens, "SELECT * FROM personal_access_tokens WHERE user_id=$1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (repository *postgresTokenRepository) GetActive(ctx context.Context, hash string) (*models.PersonalAccessToken, error) {
+	token := models.PersonalAccessToken{}
+
+	err := repository.db.GetContext(ctx, &token, "SELECT * FROM personal_access_tokens WHERE token_hash=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $2)", hash, time.Now())
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &token, nil
+}
+
+func (repository *postgresTokenRepository) Touch(ctx context.Context, id uuid.UUID) error {
+	_, err := repository.db.ExecContext(ctx, "UPDATE personal_access_tokens SET last_used_at=$1 WHERE id=$2", time.Now(), id)
+	return err
+}
+
+func (repository *postgresTokenRepository) Revoke(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	res, err := repository.db.ExecContext(ctx, "UPDATE personal_access_tokens SET revoked_at=$1 WHERE id=$2 AND user_id=$3 AND revoked_at IS NULL", time.Now(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return affected(res)
+}
+
+type postgresOAuthRepository struct {
+	db database
+}
+
+func NewPostgresOAuthRepository(db database) OAuthRepository {
+	return &postgresOAuthRepository{db: db}
+}
+
+func (repository *postgresOAuthRepository) CreateClient(ctx context.Context, client models.OAuthClient) (*models.OAuthClient, error) {
+	created := models.OAuthClient{}
+
+	err := repository.db.GetContext(ctx, &created, "INSERT INTO oauth_clients (id, user_id, name, secret_hash, redirect_uris, scopes) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *", client.ID, client.UserID, client.Name, client.SecretHash, client.RedirectURIs, client.Scopes)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &created, nil
+}
+
+func (repository *postgresOAuthRepository) ListClientsByUser(ctx context.Context, userID uuid.UUID) ([]models.OAuthClient, error) {
+	clients := []models.OAuthClient{}
+
+	err := repository.db.SelectContext(ctx, &clients, "SELECT * FROM oauth_clients WHERE user_id=$1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+func (repository *postgresOAuthRepository) GetActiveClient(ctx context.Context, id uuid.UUID) (*models.OAuthClient, error) {
+	client := models.OAuthClient{}
+
+	err := repository.db.GetContext(ctx, &client, "SELECT * FROM oauth_clients WHERE id=$1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &client, nil
+}
+
+func (repository *postgresOAuthRepository) RevokeClient(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	now := time.Now()
+
+	// A single statement revokes the client and its grants together without a transaction
+	var revoked uuid.UUID
+	err := repository.db.GetContext(ctx, &revoked, `WITH client AS (
+			UPDATE oauth_clients SET revoked_at=$1 WHERE id=$2 AND user_id=$3 AND revoked_at IS NULL RETURNING id
+		), grants AS (
+			UPDATE oauth_grants SET revoked_at=$1 WHERE client_id IN (SELECT id FROM client) AND revoked_at IS NULL
+		)
+		SELECT id FROM client`, now, id, userID)
+	return postgresError(err)
+}
+
+func (repository *postgresOAuthRepository) CreateCode(ctx context.Context, code models.OAuthAuthorizationCode) error {
+	_, err := repository.db.ExecContext(ctx, "INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)", code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scopes, code.CodeChallenge, code.ExpiresAt)
+	return postgresError(err)
+}
+
+func (repository *postgresOAuthRepository) ConsumeCode(ctx context.Context, hash string) (*models.OAuthAuthorizationCode, error) {
+	code := models.OAuthAuthorizationCode{}
+
+	err := repository.db.GetContext(ctx, &code, "DELETE FROM oauth_authorization_codes WHERE code_hash=$1 RETURNING *", hash)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &code, nil
+}
+
+func (repository *postgresOAuthRepository) CreateGrant(ctx context.Context, grant models.OAuthGrant) (*models.OAuthGrant, error) {
+	created := models.OAuthGrant{}
+
+	err := repository.db.GetContext(ctx, &created, "INSERT INTO oauth_grants (id, client_id, user_id, refresh_token_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *", grant.ID, grant.ClientID, grant.UserID, grant.RefreshTokenHash, grant.Scopes, grant.ExpiresAt)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &created, nil
+}
+
+func (repository *postgresOAuthRepository) GetActiveGrant(ctx context.Context, id uuid.UUID) (*models.OAuthGrant, error) {
+	grant := models.OAuthGrant{}
+
+	err := repository.db.GetContext(ctx, &grant, "SELECT oauth_grants.* FROM oauth_grants JOIN oauth_clients ON oauth_clients.id=oauth_grants.client_id WHERE oauth_grants.id=$1 AND oauth_grants.revoked_at IS NULL AND oauth_grants.expires_at > $2 AND oauth_clients.revoked_at IS NULL", id, time.Now())
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &grant, nil
+}
+
+func (repository *postgresOAuthRepository) GetClientGrant(ctx context.Context, id uuid.UUID, clientID uuid.UUID) (*models.OAuthGrant, error) {
+	grant := models.OAuthGrant{}
+
+	err := repository.db.GetContext(ctx, &grant, "SELECT * FROM oauth_grants WHERE id=$1 AND client_id=$2", id, clientID)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &grant, nil
+}
+
+func (repository *postgresOAuthRepository) GetClientGrantByRefreshToken(ctx context.Context, hash string, clientID uuid.UUID) (*models.OAuthGrant, error) {
+	grant := models.OAuthGrant{}
+
+	err := repository.db.GetContext(ctx, &grant, "SELECT * FROM oauth_grants WHERE refresh_token_hash=$1 AND client_id=$2", hash, clientID)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &grant, nil
+}
+
+func (repository *postgresOAuthRepository) ListGrantsByUser(ctx context.Context, userID uuid.UUID) ([]models.OAuthGrant, error) {
+	grants := []models.OAuthGrant{}
+
+	err := repository.db.SelectContext(ctx, &grants, "SELECT * FROM oauth_grants WHERE user_id=$1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+func (repository *postgresOAuthRepository) RotateGrant(ctx context.Context, id uuid.UUID, oldHash string, newHash string, expiresAt time.Time) (*models.OAuthGrant, error) {
+	grant := models.OAuthGrant{}
+
+	err := repository.db.GetContext(ctx, &grant, "UPDATE oauth_grants SET refresh_token_hash=$1, last_used_at=$2, expires_at=$3 WHERE id=$4 AND refresh_token_hash=$5 AND revoked_at IS NULL RETURNING *", newHash, time.Now(), expiresAt, id, oldHash)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+
+	return &grant, nil
+}
+
+func (repository *postgresOAuthRepository) RevokeGrant(ctx context.Context, id uuid.UUID) error {
+	_, err := repository.db.ExecContext(ctx, "UPDATE oauth_grants SET revoked_at=$1 WHERE id=$2 AND revoked_at IS NULL", time.Now(), id)
+	return err
+}
@@ -0,0 +1,405 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/util/audit"
+	logger "github.com/ushiradineth/koano-api/util/log"
+)
+
+var (
+	ErrNotFound = errors.New("Not found")
+	ErrConflict = errors.New("Already exists")
+)
+
+// UserRepository reads and writes users. Lookups only return users who can sign in, which are active and not disabled, unless they say otherwise.
+type UserRepository interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// Find returns the user whatever their state, for admins and background jobs
+	Find(ctx context.Context, id uuid.UUID) (*models.User, error)
+	// GetRestorableByID and GetRestorableByEmail return a user deleted after the time, disabled users are left to admins
+	GetRestorableByID(ctx context.Context, id uuid.UUID, deletedAfter time.Time) (*models.User, error)
+	GetRestorableByEmail(ctx context.Context, email string, deletedAfter time.Time) (*models.User, error)
+	// ListByEmail returns the users whose email matches ignoring case whatever their state, the way failed logins are counted
+	ListByEmail(ctx context.Context, email string) ([]models.User, error)
+	// IsEmailInUse includes deleted users since they can be restored until they are purged
+	IsEmailInUse(ctx context.Context, email string, exceptID uuid.UUID) (bool, error)
+	// Search matches the query against names and emails, newest users first
+	Search(ctx context.Context, search UserSearch) ([]models.User, error)
+	CountActive(ctx context.Context) (int64, error)
+	// Create adds an active user with the default role. Users created by signing in elsewhere are created with their email verified.
+	Create(ctx context.Context, user models.User) (*models.User, error)
+	// Update writes the profile fields of an active user, which are the name and pending email
+	Update(ctx context.Context, user models.User) (*models.User, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	// Restore reactivates a user who deleted their account
+	Restore(ctx context.Context, id uuid.UUID) error
+	// PurgeDeleted hard deletes the users deleted before the time, returning their IDs
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error)
+
+	// SetPassword also bumps the token version, so every session from before the change is signed out
+	SetPassword(ctx context.Context, id uuid.UUID, hash string) error
+	// RehashPassword only replaces the hash if it is still the old one, so a concurrent password change isn't overwritten
+	RehashPassword(ctx context.Context, id uuid.UUID, oldHash string, newHash string) error
+	// VerifyEmail marks the email as verified, promoting it to the email of the user if it was pending
+	VerifyEmail(ctx context.Context, id uuid.UUID, email string) (*models.User, error)
+
+	SetTOTPSecret(ctx context.Context, id uuid.UUID, secret string) error
+	// EnableMFA turns on MFA once the TOTP secret has been confirmed with a code, whose step has already been recorded by UseTOTPStep
+	EnableMFA(ctx context.Context, id uuid.UUID) error
+	DisableMFA(ctx context.Context, id uuid.UUID) error
+	// UseTOTPStep records the time step of an accepted code, failing with ErrConflict unless it is later than the last one
+	UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) error
+
+	// Disable blocks the user from signing in and signs them out everywhere
+	Disable(ctx context.Context, id uuid.UUID) error
+	// Reinstate clears both a disable and a deletion
+	Reinstate(ctx context.Context, id uuid.UUID) error
+	// RevokeSessions invalidates every access token issued to the user so far
+	RevokeSessions(ctx context.Context, id uuid.UUID) error
+	SetRole(ctx context.Context, id uuid.UUID, role string) error
+}
+
+type UserSearch struct {
+	Query string
+	// Role and Status are ignored when empty
+	Role   string
+	Status string
+	Limit  int
+	Offset int
+}
+
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusDeleted  = "deleted"
+)
+
+// EventRepository reads and writes events, every method is scoped to the user who owns the event
+type EventRepository interface {
+	Get(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.Event, error)
+	// Exists reports whether the user already has an event with the same start and end time
+	Exists(ctx context.Context, userID uuid.UUID, start time.Time, end time.Time) (bool, error)
+	// ListByUser returns the events of the user starting within the range, inclusive
+	ListByUser(ctx context.Context, userID uuid.UUID, from time.Time, to time.Time) ([]models.Event, error)
+	// ListAll returns every event of the user by start time, including deleted ones which are held until the user is purged
+	ListAll(ctx context.Context, userID uuid.UUID) ([]models.Event, error)
+	Create(ctx context.Context, event models.Event) (*models.Event, error)
+	Update(ctx context.Context, event models.Event) (*models.Event, error)
+	Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+}
+
+// AuditRepository appends to the hash chained audit log and reads it back
+type AuditRepository interface {
+	Append(ctx context.Context, record audit.Record) error
+	// Search returns the matching entries, newest first
+	Search(ctx context.Context, filter audit.Filter) ([]models.AuditLog, error)
+	// ListByUser returns the whole history of the user, oldest first
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.AuditLog, error)
+	Verify(ctx context.Context) (*audit.Verification, error)
+}
+
+// TokenRepository reads and writes personal access tokens
+type TokenRepository interface {
+	Create(ctx context.Context, token models.PersonalAccessToken) (*models.PersonalAccessToken, error)
+	// ListByUser returns the tokens of the user, newest first, including revoked and expired ones
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.PersonalAccessToken, error)
+	// GetActive returns the token with the hash unless it has been revoked or has expired
+	GetActive(ctx context.Context, hash string) (*models.PersonalAccessToken, error)
+	Touch(ctx context.Context, id uuid.UUID) error
+	Revoke(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+}
+
+// OAuthRepository reads and writes the clients of the authorization server and the codes and grants issued to them
+type OAuthRepository interface {
+	CreateClient(ctx context.Context, client models.OAuthClient) (*models.OAuthClient, error)
+	ListClientsByUser(ctx context.Context, userID uuid.UUID) ([]models.OAuthClient, error)
+	GetActiveClient(ctx context.Context, id uuid.UUID) (*models.OAuthClient, error)
+	// RevokeClient revokes the client of the user along with the grants issued to it
+	RevokeClient(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+
+	CreateCode(ctx context.Context, code models.OAuthAuthorizationCode) error
+	// ConsumeCode deletes the code as it is read, so it can only be exchanged once
+	ConsumeCode(ctx context.Context, hash string) (*models.OAuthAuthorizationCode, error)
+
+	CreateGrant(ctx context.Context, grant models.OAuthGrant) (*models.OAuthGrant, error)
+	// GetActiveGrant returns the grant unless it or its client have been revoked or it has expired
+	GetActiveGrant(ctx context.Context, id uuid.UUID) (*models.OAuthGrant, error)
+	// GetClientGrant and GetClientGrantByRefreshToken return grants of the client even if they are revoked or expired, so callers can tell them apart
+	GetClientGrant(ctx context.Context, id uuid.UUID, clientID uuid.UUID) (*models.OAuthGrant, error)
+	GetClientGrantByRefreshToken(ctx context.Context, hash string, clientID uuid.UUID) (*models.OAuthGrant, error)
+	ListGrantsByUser(ctx context.Context, userID uuid.UUID) ([]models.OAuthGrant, error)
+	// RotateGrant replaces the refresh token of an active grant, only if it is still the old one so concurrent refreshes can't fork the grant
+	RotateGrant(ctx context.Context, id uuid.UUID, oldHash string, newHash string, expiresAt time.Time) (*models.OAuthGrant, error)
+	RevokeGrant(ctx context.Context, id uuid.UUID) error
+}
+
+// ExportRepository tracks account data exports as they move from pending to running to completed, failed or expired
+type ExportRepository interface {
+	// Create returns ErrConflict when the user already has a pending or running export
+	Create(ctx context.Context, export models.DataExport) (*models.DataExport, error)
+	Get(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.DataExport, error)
+	// GetDownloadable returns the export if it has completed and not yet expired
+	GetDownloadable(ctx context.Context, id uuid.UUID) (*models.DataExport, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.DataExport, error)
+	// ListPending returns the IDs of the pending exports, oldest first
+	ListPending(ctx context.Context) ([]uuid.UUID, error)
+	// ListExpired returns the completed exports which have expired
+	ListExpired(ctx context.Context) ([]models.DataExport, error)
+	// Start moves a pending export to running, failing with ErrNotFound if it has already been picked up
+	Start(ctx context.Context, id uuid.UUID) (*models.DataExport, error)
+	Complete(ctx context.Context, id uuid.UUID, blobKey string, size int64, expiresAt time.Time) error
+	Fail(ctx context.Context, id uuid.UUID, message string) error
+	// FailStale fails the exports which have been running since before the time, returning how many there were
+	FailStale(ctx context.Context, updatedBefore time.Time, message string) (int64, error)
+	// Expire forgets the archive of an export once it has been removed
+	Expire(ctx context.Context, id uuid.UUID) error
+}
+
+// RecoveryCodeRepository keeps the hashes of the MFA recovery codes of each user
+type RecoveryCodeRepository interface {
+	// Replace swaps every code of the user for the new ones, no hashes removes them all
+	Replace(ctx context.Context, userID uuid.UUID, hashes []string) error
+	// Check fails with ErrNotFound unless the user has the unused code, without using it up
+	Check(ctx context.Context, userID uuid.UUID, hash string) error
+	// Use marks an unused code as used, failing with ErrNotFound if there is none
+	Use(ctx context.Context, userID uuid.UUID, hash string) error
+}
+
+// RefreshTokenRepository remembers the refresh tokens which have been exchanged or signed out, so each can only be used once
+type RefreshTokenRepository interface {
+	// Use records the token as used until it expires, failing with ErrConflict if it already has been. It also clears expired tokens.
+	Use(ctx context.Context, id uuid.UUID, userID uuid.UUID, expiresAt time.Time) error
+}
+
+// MFAChallengeRepository tracks the challenges issued once the first factor has passed, so each can be completed once and only answered wrongly a few times
+type MFAChallengeRepository interface {
+	// Create also clears expired challenges
+	Create(ctx context.Context, challenge models.MFAChallenge) error
+	// Get returns the challenge of the user unless it has been used, has expired or has failed maxFailures times
+	Get(ctx context.Context, id uuid.UUID, userID uuid.UUID, maxFailures int) (*models.MFAChallenge, error)
+	// Fail counts a wrong answer in a single step
+	Fail(ctx context.Context, id uuid.UUID) error
+	// Use marks the challenge as used as long as Get would still return it, failing with ErrNotFound otherwise
+	Use(ctx context.Context, id uuid.UUID, userID uuid.UUID, maxFailures int) error
+}
+
+// PasskeyRepository reads and writes WebAuthn credentials and the challenges of their ceremonies
+type PasskeyRepository interface {
+	Create(ctx context.Context, credential models.WebAuthnCredential) (*models.WebAuthnCredential, error)
+	// ListByUser returns the passkeys of the user, newest first
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.WebAuthnCredential, error)
+	GetByCredentialID(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error)
+	// UpdateSignCount only applies if the count is still the old one, so two assertions with the same counter can't both succeed
+	UpdateSignCount(ctx context.Context, id uuid.UUID, oldCount int64, newCount int64) error
+	Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+
+	// CreateChallenge also clears expired challenges, since login options can be requested without an account
+	CreateChallenge(ctx context.Context, challenge models.WebAuthnChallenge) error
+	// ConsumeChallenge deletes an unexpired challenge of the ceremony and user as it is read, so it can only be answered once
+	ConsumeChallenge(ctx context.Context, challenge string, ceremony string, userID *uuid.UUID) error
+}
+
+// IdentityRepository links users to the accounts they sign in with at OIDC providers, and keeps the state of logins in progress
+type IdentityRepository interface {
+	Get(ctx context.Context, provider string, subject string) (*models.UserIdentity, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error)
+	Create(ctx context.Context, identity models.UserIdentity) error
+	// Touch records a login through the identity along with the email the provider has for it now
+	Touch(ctx context.Context, provider string, subject string, email string) error
+
+	CreateState(ctx context.Context, state models.OIDCState) error
+	// ConsumeState deletes an unexpired state of the provider as it is read, so the login can't be replayed
+	ConsumeState(ctx context.Context, state string, provider string) (*models.OIDCState, error)
+}
+
+// MagicLinkRepository keeps the hashes of sign in links sent by email
+type MagicLinkRepository interface {
+	Create(ctx context.Context, link models.MagicLink) error
+	// SentSince reports whether a link has been sent to the email after the time
+	SentSince(ctx context.Context, email string, since time.Time) (bool, error)
+	// Consume marks an unused and unexpired link as used as it is read, so it can only be used once
+	Consume(ctx context.Context, hash string) (*models.MagicLink, error)
+}
+
+// LoginAttemptRepository counts failed logins per account and IP for the lockout
+type LoginAttemptRepository interface {
+	// List returns the attempts of the identifiers in the scope, identifiers without failures are left out
+	List(ctx context.Context, scope string, identifiers ...string) ([]models.LoginAttempt, error)
+	// Reserve counts an attempt as failed before it is made and locks the identifier if the count calls for it. It checks and
+	// counts in a single step, so concurrent attempts can't all pass the check before any of them is counted. ErrConflict is
+	// returned without counting while the identifier is locked or has to wait out its delay. The count starts over if the last
+	// failure is older than the window.
+	Reserve(ctx context.Context, scope string, identifier string, lockout LoginLockout) (*models.LoginAttempt, error)
+	// Release takes back an attempt counted by Reserve which didn't fail, along with the lockout it triggered
+	Release(ctx context.Context, scope string, identifier string, lockout LoginLockout) error
+	// Delete forgets the attempts of the identifier, reporting whether there were any
+	Delete(ctx context.Context, scope string, identifier string) (bool, error)
+	// Prune forgets the attempts whose last failure is before the time and which aren't locked, returning how many there were
+	Prune(ctx context.Context, lastFailedBefore time.Time) (int64, error)
+}
+
+// LoginLockout is when Reserve locks or delays an identifier. Every Threshold failures within the window lock it for Duration,
+// which doubles with each repeated lockout up to Max. From DelayAfter failures on, each attempt has to wait a delay which
+// doubles from a second with every failure up to MaxDelay. A threshold or DelayAfter of zero never locks or delays.
+type LoginLockout struct {
+	Window    time.Duration
+	Threshold int
+	Duration  time.Duration
+	Max       time.Duration
+
+	DelayAfter int
+	MaxDelay   time.Duration
+}
+
+// RetryAfter returns how long after now the next attempt is allowed, or zero if it is allowed right away
+func (lockout LoginLockout) RetryAfter(attempt models.LoginAttempt, now time.Time) time.Duration {
+	if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+		return attempt.LockedUntil.Sub(now)
+	}
+
+	if lockout.DelayAfter <= 0 || attempt.LastFailedAt == nil || attempt.LastFailedAt.Before(now.Add(-lockout.Window)) {
+		return 0
+	}
+
+	if attempt.FailedCount < lockout.DelayAfter {
+		return 0
+	}
+
+	delay := time.Duration(math.Pow(2, float64(attempt.FailedCount-lockout.DelayAfter))) * time.Second
+	if delay > lockout.MaxDelay || delay <= 0 {
+		delay = lockout.MaxDelay
+	}
+
+	next := attempt.LastFailedAt.Add(delay)
+	if next.After(now) {
+		return next.Sub(now)
+	}
+
+	return 0
+}
+
+// LockedUntil returns the end of the lockout triggered by the failed count, or nil if it doesn't trigger one
+func (lockout LoginLockout) LockedUntil(failedCount int, now time.Time) *time.Time {
+	if lockout.Threshold <= 0 || failedCount < lockout.Threshold || failedCount%lockout.Threshold != 0 {
+		return nil
+	}
+
+	duration := lockout.Duration * time.Duration(math.Pow(2, float64(failedCount/lockout.Threshold-1)))
+	if duration > lockout.Max || duration <= 0 {
+		duration = lockout.Max
+	}
+
+	lockedUntil := now.Add(duration)
+	return &lockedUntil
+}
+
+// Store groups the repositories the handlers depend on
+type Store struct {
+	Users         UserRepository
+	Events        EventRepository
+	Audit         AuditRepository
+	Tokens        TokenRepository
+	OAuth         OAuthRepository
+	Exports       ExportRepository
+	RecoveryCodes RecoveryCodeRepository
+	MFAChallenges MFAChallengeRepository
+	RefreshTokens RefreshTokenRepository
+	Passkeys      PasskeyRepository
+	Identities    IdentityRepository
+	MagicLinks    MagicLinkRepository
+	LoginAttempts LoginAttemptRepository
+
+	transact func(ctx context.Context, fn func(tx *Store) error) error
+}
+
+func NewPostgres(db *sqlx.DB) *Store {
+	store := newPostgres(db)
+	store.transact = func(ctx context.Context, fn func(tx *Store) error) error {
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(newPostgres(tx)); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+
+	return store
+}
+
+func newPostgres(db database) *Store {
+	return &Store{
+		Users:         NewPostgresUserRepository(db),
+		Events:        NewPostgresEventRepository(db),
+		Audit:         NewPostgresAuditRepository(db),
+		Tokens:        NewPostgresTokenRepository(db),
+		OAuth:         NewPostgresOAuthRepository(db),
+		Exports:       NewPostgresExportRepository(db),
+		RecoveryCodes: NewPostgresRecoveryCodeRepository(db),
+		MFAChallenges: NewPostgresMFAChallengeRepository(db),
+		RefreshTokens: NewPostgresRefreshTokenRepository(db),
+		Passkeys:      NewPostgresPasskeyRepository(db),
+		Identities:    NewPostgresIdentityRepository(db),
+		MagicLinks:    NewPostgresMagicLinkRepository(db),
+		LoginAttempts: NewPostgresLoginAttemptRepository(db),
+	}
+}
+
+func NewMemory() *Store {
+	store := &Store{
+		Users:         NewMemoryUserRepository(),
+		Events:        NewMemoryEventRepository(),
+		Audit:         NewMemoryAuditRepository(),
+		Tokens:        NewMemoryTokenRepository(),
+		OAuth:         NewMemoryOAuthRepository(),
+		Exports:       NewMemoryExportRepository(),
+		RecoveryCodes: NewMemoryRecoveryCodeRepository(),
+		MFAChallenges: NewMemoryMFAChallengeRepository(),
+		RefreshTokens: NewMemoryRefreshTokenRepository(),
+		Passkeys:      NewMemoryPasskeyRepository(),
+		Identities:    NewMemoryIdentityRepository(),
+		MagicLinks:    NewMemoryMagicLinkRepository(),
+		LoginAttempts: NewMemoryLoginAttemptRepository(),
+	}
+
+	// Transactions run one at a time, but changes made before an error are kept since nothing is rolled back
+	var mu sync.Mutex
+	store.transact = func(ctx context.Context, fn func(tx *Store) error) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return fn(store)
+	}
+
+	return store
+}
+
+// Tx runs fn in a transaction, with repositories which are committed together once fn returns without an error
+func (store *Store) Tx(ctx context.Context, fn func(tx *Store) error) error {
+	return store.transact(ctx, fn)
+}
+
+// LogUser records a change the user made to their own account. Failures are logged rather than returned since the change has already been made.
+func LogUser(repository AuditRepository, log *logger.Logger, r *http.Request, userID uuid.UUID, record audit.Record) {
+	record.ActorID = &userID
+	record.UserID = &userID
+
+	// The entry is written even if the client goes away once the change is made
+	if err := repository.Append(context.WithoutCancel(r.Context()), audit.FromRequest(r, record)); err != nil {
+		log.Error.PrintfContext(r.Context(), "Failed to audit %s by user %s: %v", record.Action, userID, err)
+	}
+}
@@ -0,0 +1,257 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/util/request"
+)
+
+const (
+	TargetUser        = "user"
+	TargetEvent       = "event"
+	TargetToken       = "token"
+	TargetOAuthClient = "oauth_client"
+	TargetPasskey     = "passkey"
+)
+
+const (
+	ActionUserCreate   = "user.create"
+	ActionUserUpdate   = "user.update"
+	ActionUserDelete   = "user.delete"
+	ActionUserRestore  = "user.restore"
+	ActionUserPurge    = "user.purge"
+	ActionPasswordSet  = "user.password"
+	ActionEmailVerify  = "user.email_verify"
+	ActionLogin        = "auth.login"
+	ActionLoginFailed  = "auth.login_failed"
+	ActionMFAEnable    = "auth.mfa_enable"
+	ActionMFADisable   = "auth.mfa_disable"
+	ActionRecoveryCode = "auth.recovery_codes"
+	ActionPasskeyAdd   = "auth.passkey_add"
+	ActionPasskeyDel   = "auth.passkey_delete"
+	ActionIdentityLink = "auth.identity_link"
+	ActionEventCreate  = "event.create"
+	ActionEventUpdate  = "event.update"
+	ActionEventDelete  = "event.delete"
+	ActionTokenCreate  = "token.create"
+	ActionTokenRevoke  = "token.revoke"
+	ActionClientCreate = "oauth_client.create"
+	ActionClientDelete = "oauth_client.delete"
+	ActionClientAuth   = "oauth_client.authorize"
+)
+
+// Record is an entry to append. UserID is whose history the entry belongs to, ActorID is who made the change, which differs for admin actions.
+// Before and After are marshalled to JSON, use Diff to keep only the fields which changed. IP and UserAgent are empty for changes made by background jobs.
+type Record struct {
+	ActorID    *uuid.UUID
+	UserID     *uuid.UUID
+	Action     string
+	TargetType string
+	TargetID   *uuid.UUID
+	Before     any
+	After      any
+	IP         string
+	UserAgent  string
+}
+
+// Filter narrows a search of the log, empty fields match every entry
+type Filter struct {
+	UserID  *uuid.UUID
+	ActorID *uuid.UUID
+	// Action matches the action itself or a group of actions, such as event for event.create
+	Action     string
+	TargetType string
+	Limit      int
+	Offset     int
+}
+
+type Verification struct {
+	Entries  int64  `json:"entries"`
+	Valid    bool   `json:"valid"`
+	BrokenAt *int64 `json:"broken_at"`
+	Head     string `json:"head"`
+}
+
+// FromRequest fills in the IP and user agent of the request the change was made in
+func FromRequest(r *http.Request, record Record) Record {
+	record.IP = request.ClientIP(r)
+	record.UserAgent = r.UserAgent()
+
+	return record
+}
+
+// NewEntry builds the entry for a record. Linking it to the chain, with PrevHash and Hash, is left to the store which knows the last entry.
+func NewEntry(record Record) (models.AuditLog, error) {
+	entry := models.AuditLog{
+		ID: uuid.New(),
+		// Postgres keeps microseconds, so the hash is taken over the time as it will be read back
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+		ActorID:    record.ActorID,
+		UserID:     record.UserID,
+		Action:     record.Action,
+		TargetType: record.TargetType,
+		TargetID:   record.TargetID,
+		IP:         record.IP,
+		UserAgent:  record.UserAgent,
+	}
+
+	var err error
+	if entry.Before, err = marshal(record.Before); err != nil {
+		return entry, err
+	}
+	if entry.After, err = marshal(record.After); err != nil {
+		return entry, err
+	}
+
+	return entry, nil
+}
+
+// Matches reports whether the entry passes the filter, ignoring the page
+func (filter Filter) Matches(entry models.AuditLog) bool {
+	if filter.UserID != nil && (entry.UserID == nil || *entry.UserID != *filter.UserID) {
+		return false
+	}
+
+	if filter.ActorID != nil && (entry.ActorID == nil || *entry.ActorID != *filter.ActorID) {
+		return false
+	}
+
+	if filter.Action != "" && entry.Action != filter.Action && !strings.HasPrefix(entry.Action, filter.Action+".") {
+		return false
+	}
+
+	return filter.TargetType == "" || entry.TargetType == filter.TargetType
+}
+
+// Hash is the hash of an entry chained to the one before it
+func Hash(entry models.AuditLog) (string, error) {
+	before, err := canonical(entry.Before)
+	if err != nil {
+		return "", err
+	}
+
+	after, err := canonical(entry.After)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := json.Marshal(struct {
+		ID         uuid.UUID       `json:"id"`
+		CreatedAt  string          `json:"created_at"`
+		ActorID    *uuid.UUID      `json:"actor_id"`
+		UserID     *uuid.UUID      `json:"user_id"`
+		Action     string          `json:"action"`
+		TargetType string          `json:"target_type"`
+		TargetID   *uuid.UUID      `json:"target_id"`
+		Before     json.RawMessage `json:"before"`
+		After      json.RawMessage `json:"after"`
+		IP         string          `json:"ip"`
+		UserAgent  string          `json:"user_agent"`
+	}{entry.ID, entry.CreatedAt.UTC().Format(time.RFC3339Nano), entry.ActorID, entry.UserID, entry.Action, entry.TargetType, entry.TargetID, before, after, entry.IP, entry.UserAgent})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(append([]byte(entry.PrevHash), content...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Check adds the next entry of the chain to the verification, reporting false from the first entry which was changed or follows a removed entry.
+// Head is the hash of the last entry, keeping a copy of it elsewhere also catches entries removed from the end.
+func (verification *Verification) Check(entry models.AuditLog) (bool, error) {
+	hash, err := Hash(entry)
+	if err != nil {
+		return false, err
+	}
+
+	if entry.PrevHash != verification.Head || hash != entry.Hash {
+		seq := entry.Seq
+		verification.Valid = false
+		verification.BrokenAt = &seq
+		return false, nil
+	}
+
+	verification.Entries++
+	verification.Head = entry.Hash
+	return true, nil
+}
+
+// Diff returns the fields of before and after, marshalled as JSON objects, which differ between the two. Unchanged fields are left out of both,
+// as is updated_at since every change bumps it and the entry already records when the change was made.
+func Diff(before any, after any) (map[string]any, map[string]any, error) {
+	beforeFields, err := fields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	afterFields, err := fields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	delete(beforeFields, "updated_at")
+	delete(afterFields, "updated_at")
+
+	for key, value := range beforeFields {
+		if other, ok := afterFields[key]; ok && reflect.DeepEqual(value, other) {
+			delete(beforeFields, key)
+			delete(afterFields, key)
+		}
+	}
+
+	return beforeFields, afterFields, nil
+}
+
+func fields(value any) (map[string]any, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]any{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func marshal(value any) (json.RawMessage, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nil maps and pointers are stored as NULL like a missing value
+	if string(raw) == "null" {
+		return nil, nil
+	}
+
+	return raw, nil
+}
+
+// canonical rewrites JSON with sorted keys and no whitespace, since JSONB doesn't keep the layout it was written with
+func canonical(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return json.RawMessage("null"), nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(value)
+}
@@ -0,0 +1,81 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/util/audit"
+)
+
+func TestHash(t *testing.T) {
+	actorID := uuid.New()
+	entry := models.AuditLog{
+		ID:         uuid.New(),
+		CreatedAt:  time.Date(2024, 1, 2, 15, 4, 5, 123456000, time.UTC),
+		ActorID:    &actorID,
+		UserID:     &actorID,
+		Action:     audit.ActionEventUpdate,
+		TargetType: audit.TargetEvent,
+		After:      json.RawMessage(`{"title":"Renamed","repeated":"none"}`),
+		IP:         "127.0.0.1",
+	}
+
+	hash, err := audit.Hash(entry)
+	assert.NoError(t, err)
+	assert.Len(t, hash, 64)
+
+	t.Run("Layout of the JSON does not change the hash", func(t *testing.T) {
+		stored := entry
+		stored.After = json.RawMessage(`{"repeated": "none", "title": "Renamed"}`)
+		stored.CreatedAt = entry.CreatedAt.In(time.FixedZone("", 5*60*60))
+
+		storedHash, err := audit.Hash(stored)
+		assert.NoError(t, err)
+		assert.Equal(t, hash, storedHash)
+	})
+
+	t.Run("Changed entry changes the hash", func(t *testing.T) {
+		changed := entry
+		changed.IP = "127.0.0.2"
+
+		changedHash, err := audit.Hash(changed)
+		assert.NoError(t, err)
+		assert.NotEqual(t, hash, changedHash)
+	})
+
+	t.Run("Hash is chained to the previous entry", func(t *testing.T) {
+		chained := entry
+		chained.PrevHash = hash
+
+		chainedHash, err := audit.Hash(chained)
+		assert.NoError(t, err)
+		assert.NotEqual(t, hash, chainedHash)
+	})
+}
+
+func TestDiff(t *testing.T) {
+	before := models.Event{Title: "Standup", Timezone: "Asia/Colombo", Repeated: "daily"}
+	after := models.Event{Title: "Standup", Timezone: "Asia/Colombo", Repeated: "weekly"}
+
+	beforeFields, afterFields, err := audit.Diff(before, after)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"repeated": "daily"}, beforeFields)
+	assert.Equal(t, map[string]any{"repeated": "weekly"}, afterFields)
+}
+
+func TestRedactFor(t *testing.T) {
+	userID, adminID := uuid.New(), uuid.New()
+
+	own := models.AuditLog{ActorID: &userID, IP: "127.0.0.1", UserAgent: "browser"}
+	own.RedactFor(userID)
+	assert.Equal(t, "127.0.0.1", own.IP)
+
+	byAdmin := models.AuditLog{ActorID: &adminID, IP: "127.0.0.2", UserAgent: "browser"}
+	byAdmin.RedactFor(userID)
+	assert.Empty(t, byAdmin.IP, "Origin of changes made by others should be hidden")
+	assert.Empty(t, byAdmin.UserAgent)
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -22,9 +23,7 @@ func TestHashPasswordAndCheckPasswordHash(t *testing.T) {
 		assert.NoError(t, err, "HashPassword should not return an error")
 		assert.NotEmpty(t, hashedPassword, "Hashed password should not be empty")
 		assert.NotEqual(t, password, hashedPassword, "Hashed password should not match the original password")
-
-		err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-		assert.NoError(t, err, "The bcrypt hash comparison should not return an error for the correct password")
+		assert.True(t, strings.HasPrefix(hashedPassword, "$argon2id$v=19$m=19456,t=2,p=1$"), "Passwords should be hashed with Argon2id by default")
 	})
 
 	t.Run("Wrong Password", func(t *testing.T) {
@@ -32,19 +31,111 @@ func TestHashPasswordAndCheckPasswordHash(t *testing.T) {
 
 		hashedPassword, err := auth.HashPassword(password)
 		assert.NoError(t, err, "HashPassword should not return an error")
-		assert.True(t, auth.CheckPasswordHash(password, hashedPassword), "CheckPasswordHash should return true for a correct password")
+
+		valid, rehashed := auth.CheckPasswordHash(password, hashedPassword)
+		assert.True(t, valid, "CheckPasswordHash should return true for a correct password")
+		assert.Empty(t, rehashed, "A hash made with the current policy should not be rehashed")
 
 		incorrectPassword := "wrongpassword"
-		assert.False(t, auth.CheckPasswordHash(incorrectPassword, hashedPassword), "CheckPasswordHash should return false for an incorrect password")
+		valid, _ = auth.CheckPasswordHash(incorrectPassword, hashedPassword)
+		assert.False(t, valid, "CheckPasswordHash should return false for an incorrect password")
 	})
 
 	t.Run("Empty Password", func(t *testing.T) {
 		password := ""
 		hashedPassword, err := auth.HashPassword(password)
-
 		assert.NoError(t, err, "HashPassword should not return an error for an empty password")
-		assert.True(t, auth.CheckPasswordHash(password, hashedPassword), "CheckPasswordHash should return true for an empty password")
-		assert.False(t, auth.CheckPasswordHash("nonemptypassword", hashedPassword), "CheckPasswordHash should return false for a non-empty password")
+
+		valid, _ := auth.CheckPasswordHash(password, hashedPassword)
+		assert.True(t, valid, "CheckPasswordHash should return true for an empty password")
+
+		valid, _ = auth.CheckPasswordHash("nonemptypassword", hashedPassword)
+		assert.False(t, valid, "CheckPasswordHash should return false for a non-empty password")
+	})
+
+	t.Run("Long Password", func(t *testing.T) {
+		password := strings.Repeat("a", 100)
+		hashedPassword, err := auth.HashPassword(password)
+		assert.NoError(t, err, "HashPassword should not return an error")
+
+		valid, _ := auth.CheckPasswordHash(strings.Repeat("a", 72), hashedPassword)
+		assert.False(t, valid, "Argon2id should not truncate passwords at 72 bytes like bcrypt")
+	})
+
+	t.Run("Malformed Hash", func(t *testing.T) {
+		for _, hash := range []string{"", "password", "$argon2id$v=19$m=8,t=0,p=1$c2FsdA$a2V5", "$argon2id$v=16$m=8,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=8,t=1,p=1$c2FsdA$"} {
+			valid, _ := auth.CheckPasswordHash("password", hash)
+			assert.False(t, valid, "CheckPasswordHash should return false for the malformed hash %q", hash)
+		}
+	})
+}
+
+func TestPasswordHasher(t *testing.T) {
+	defer auth.SetPasswordHasher(auth.DefaultArgon2idHasher)
+
+	password := "password"
+	argon2idHasher := func(memory uint32) auth.Argon2idHasher {
+		hasher := auth.DefaultArgon2idHasher
+		hasher.Memory = memory
+		return hasher
+	}
+
+	t.Run("Bcrypt with configured cost", func(t *testing.T) {
+		auth.SetPasswordHasher(auth.BcryptHasher{Cost: 5})
+
+		hashedPassword, err := auth.HashPassword(password)
+		assert.NoError(t, err, "HashPassword should not return an error")
+
+		cost, err := bcrypt.Cost([]byte(hashedPassword))
+		assert.NoError(t, err, "Hash should be a bcrypt hash")
+		assert.Equal(t, 5, cost, "Hash should use the configured cost")
+
+		t.Run("Bcrypt rejects passwords it would truncate", func(t *testing.T) {
+			_, err := auth.HashPassword(strings.Repeat("a", 73))
+			assert.Error(t, err, "HashPassword should return an error for passwords over 72 bytes")
+		})
+
+		t.Run("Bcrypt cost is upgraded", func(t *testing.T) {
+			auth.SetPasswordHasher(auth.BcryptHasher{Cost: 6})
+
+			valid, rehashed := auth.CheckPasswordHash(password, hashedPassword)
+			assert.True(t, valid, "CheckPasswordHash should return true for a correct password")
+
+			cost, err := bcrypt.Cost([]byte(rehashed))
+			assert.NoError(t, err, "Rehashed password should be a bcrypt hash")
+			assert.Equal(t, 6, cost, "Rehashed password should use the new cost")
+		})
+
+		t.Run("Bcrypt is upgraded to Argon2id", func(t *testing.T) {
+			auth.SetPasswordHasher(argon2idHasher(1024))
+
+			valid, rehashed := auth.CheckPasswordHash(password, hashedPassword)
+			assert.True(t, valid, "CheckPasswordHash should return true for a correct password")
+			assert.True(t, strings.HasPrefix(rehashed, "$argon2id$v=19$m=1024,t=2,p=1$"), "Rehashed password should use Argon2id")
+
+			valid, rehashed = auth.CheckPasswordHash(password, rehashed)
+			assert.True(t, valid, "CheckPasswordHash should return true for the rehashed password")
+			assert.Empty(t, rehashed, "A hash made with the current policy should not be rehashed")
+		})
+
+		t.Run("Wrong password is not upgraded", func(t *testing.T) {
+			valid, rehashed := auth.CheckPasswordHash("wrongpassword", hashedPassword)
+			assert.False(t, valid, "CheckPasswordHash should return false for an incorrect password")
+			assert.Empty(t, rehashed, "An incorrect password should not be rehashed")
+		})
+	})
+
+	t.Run("Argon2id parameters are upgraded", func(t *testing.T) {
+		auth.SetPasswordHasher(argon2idHasher(1024))
+
+		hashedPassword, err := auth.HashPassword(password)
+		assert.NoError(t, err, "HashPassword should not return an error")
+
+		auth.SetPasswordHasher(argon2idHasher(2048))
+
+		valid, rehashed := auth.CheckPasswordHash(password, hashedPassword)
+		assert.True(t, valid, "CheckPasswordHash should return true for a correct password")
+		assert.True(t, strings.HasPrefix(rehashed, "$argon2id$v=19$m=2048,t=2,p=1$"), "Rehashed password should use the new memory cost")
 	})
 }
 
@@ -55,7 +146,7 @@ func TestNewAccessToken(t *testing.T) {
 	name := "Test User"
 	email := "test@example.com"
 
-	token, expiresIn, expiresAt, err := auth.NewAccessToken(id, name, email)
+	token, expiresIn, expiresAt, err := auth.NewAccessToken(id, name, email, auth.RoleUser, 0, time.Now())
 	assert.NoError(t, err, "NewAccessToken should not return an error")
 	assert.NotEmpty(t, token, "NewAccessToken should return a non-empty token")
 	assert.NotEmpty(t, expiresIn, "NewAccessToken should return a non-empty expiresIn")
@@ -65,7 +156,7 @@ func TestNewAccessToken(t *testing.T) {
 func TestNewRefreshToken(t *testing.T) {
 	os.Setenv("JWT_SECRET", "testsecret")
 
-	token, err := auth.NewRefreshToken()
+	token, err := auth.NewRefreshToken(uuid.New(), 0, time.Now())
 	assert.NoError(t, err, "NewRefreshToken should not return an error")
 	assert.NotEmpty(t, token, "NewRefreshToken should return a non-empty token")
 }
@@ -76,7 +167,7 @@ func TestParseAccessToken(t *testing.T) {
 	id := uuid.New()
 	name := "Test User"
 	email := "test@example.com"
-	token, expiresIn, expiresAt, err := auth.NewAccessToken(id, name, email)
+	token, expiresIn, expiresAt, err := auth.NewAccessToken(id, name, email, auth.RoleUser, 0, time.Now())
 
 	w := httptest.NewRecorder()
 	claims := auth.ParseAccessToken(w, token)
@@ -96,15 +187,33 @@ func TestParseAccessToken(t *testing.T) {
 func TestParseRefreshToken(t *testing.T) {
 	os.Setenv("JWT_SECRET", "testsecret")
 
+	id := uuid.New()
 	w := httptest.NewRecorder()
-	token, _ := auth.NewRefreshToken()
+	token, _ := auth.NewRefreshToken(id, 3, time.Now())
 
 	parsedClaims := auth.ParseRefreshToken(w, token)
-	assert.NotNil(t, parsedClaims, "Parsed token claims should not be nil")
+	if assert.NotNil(t, parsedClaims, "Parsed token claims should not be nil") {
+		assert.Equal(t, id.String(), parsedClaims.Subject, "Parsed token subject should be the user")
+		assert.Equal(t, 3, parsedClaims.TokenVersion, "Parsed token version should match")
+		assert.NotEmpty(t, parsedClaims.StandardClaims.Id, "Each refresh token should have its own ID")
+	}
 
 	w = httptest.NewRecorder()
 	parsedClaims = auth.ParseRefreshToken(w, "invalidtoken")
 	assert.Nil(t, parsedClaims, "Parsed claims should be nil for an invalid token")
+
+	// Tokens for other purposes are signed with the same secret
+	accessToken, _, _, _ := auth.NewAccessToken(uuid.New(), "name", "user@koano.app", auth.RoleUser, 0, time.Now())
+	challengeToken, _, _ := auth.NewMFAChallengeToken(uuid.New(), uuid.New())
+	verificationToken, _ := auth.NewEmailVerificationToken(uuid.New(), "user@koano.app")
+	for _, other := range []string{accessToken, challengeToken, verificationToken} {
+		w = httptest.NewRecorder()
+		assert.Nil(t, auth.ParseRefreshToken(w, other), "Only refresh tokens should be accepted")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	_, err := auth.VerifyAccessToken(token)
+	assert.Error(t, err, "A refresh token should not be accepted as an access token")
 }
 
 func TestGetJWT(t *testing.T) {
@@ -146,7 +255,254 @@ func TestParseExpiredAccessToken(t *testing.T) {
 	assert.Equal(t, claims.Email, parsedClaims.Email, "Parsed token email should match")
 
 	w = httptest.NewRecorder()
-	validToken, _, _, _ := auth.NewAccessToken(claims.Id, claims.Name, claims.Email)
+	validToken, _, _, _ := auth.NewAccessToken(claims.Id, claims.Name, claims.Email, claims.Role, claims.TokenVersion, time.Now())
 	parsedClaims = auth.ParseExpiredAccessToken(w, validToken)
 	assert.Nil(t, parsedClaims, "Parsed claims should be nil for a valid token")
 }
+
+func TestEmailVerificationToken(t *testing.T) {
+	os.Setenv("JWT_SECRET", "testsecret")
+
+	id := uuid.New()
+	email := "test@example.com"
+
+	token, err := auth.NewEmailVerificationToken(id, email)
+	assert.NoError(t, err, "NewEmailVerificationToken should not return an error")
+
+	w := httptest.NewRecorder()
+	claims := auth.ParseEmailVerificationToken(w, token)
+	assert.NotNil(t, claims, "Parsed verification token claims should not be nil")
+	assert.Equal(t, id, claims.Id, "Parsed token ID should match")
+	assert.Equal(t, email, claims.Email, "Parsed token email should match")
+
+	w = httptest.NewRecorder()
+	claims = auth.ParseEmailVerificationToken(w, "invalidtoken")
+	assert.Nil(t, claims, "Parsed claims should be nil for an invalid token")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	accessToken, _, _, _ := auth.NewAccessToken(id, "Test User", email, auth.RoleUser, 0, time.Now())
+	w = httptest.NewRecorder()
+	claims = auth.ParseEmailVerificationToken(w, accessToken)
+	assert.Nil(t, claims, "Access tokens should not be accepted as verification tokens")
+
+	w = httptest.NewRecorder()
+	userClaims := auth.ParseAccessToken(w, token)
+	assert.Nil(t, userClaims, "Verification tokens should not be accepted as access tokens")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 SHA1 test vectors, truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	t.Run("Code", func(t *testing.T) {
+		code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Unix(59, 0)))
+		assert.NoError(t, err, "TOTPCode should not return an error")
+		assert.Equal(t, "287082", code)
+
+		code, err = auth.TOTPCode(secret, auth.TOTPStep(time.Unix(1111111109, 0)))
+		assert.NoError(t, err, "TOTPCode should not return an error")
+		assert.Equal(t, "081804", code)
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		now := time.Unix(1111111109, 0)
+
+		step, valid := auth.ValidateTOTPCode(secret, "081804", now)
+		assert.True(t, valid, "Code for the current step should be valid")
+		assert.Equal(t, auth.TOTPStep(now), step)
+
+		_, valid = auth.ValidateTOTPCode(secret, "081804", now.Add(30*time.Second))
+		assert.True(t, valid, "Code from the previous step should be valid")
+
+		_, valid = auth.ValidateTOTPCode(secret, "081804", now.Add(90*time.Second))
+		assert.False(t, valid, "Code from older steps should not be valid")
+
+		_, valid = auth.ValidateTOTPCode(secret, "000000", now)
+		assert.False(t, valid, "Wrong code should not be valid")
+	})
+
+	t.Run("Secret and URI", func(t *testing.T) {
+		secret, err := auth.NewTOTPSecret()
+		assert.NoError(t, err, "NewTOTPSecret should not return an error")
+		assert.Len(t, secret, 32)
+
+		uri := auth.TOTPURI(secret, "test@example.com")
+		assert.Contains(t, uri, "otpauth://totp/Koano:test@example.com?")
+		assert.Contains(t, uri, "secret="+secret)
+		assert.Contains(t, uri, "issuer=Koano")
+	})
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := auth.NewRecoveryCodes()
+	assert.NoError(t, err, "NewRecoveryCodes should not return an error")
+	assert.Len(t, codes, auth.RecoveryCodeCount)
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Len(t, code, 11)
+		assert.False(t, seen[code], "Recovery codes should be unique")
+		seen[code] = true
+	}
+
+	assert.Equal(t, auth.HashRecoveryCode(codes[0]), auth.HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))), "Hashing should ignore case and separators")
+	assert.NotEqual(t, auth.HashRecoveryCode(codes[0]), auth.HashRecoveryCode(codes[1]))
+}
+
+func TestMFAChallengeToken(t *testing.T) {
+	os.Setenv("JWT_SECRET", "testsecret")
+
+	id, challengeID := uuid.New(), uuid.New()
+	token, expiresIn, err := auth.NewMFAChallengeToken(id, challengeID)
+	assert.NoError(t, err, "NewMFAChallengeToken should not return an error")
+	assert.NotEmpty(t, expiresIn)
+
+	w := httptest.NewRecorder()
+	claims := auth.ParseMFAChallengeToken(w, token)
+	assert.NotNil(t, claims, "Parsed challenge token claims should not be nil")
+	assert.Equal(t, id, claims.Id)
+	assert.Equal(t, challengeID.String(), claims.StandardClaims.Id)
+
+	w = httptest.NewRecorder()
+	assert.Nil(t, auth.ParseAccessToken(w, token), "Challenge tokens should not be accepted as access tokens")
+
+	accessToken, _, _, _ := auth.NewAccessToken(id, "Test User", "test@example.com", auth.RoleUser, 0, time.Now())
+	w = httptest.NewRecorder()
+	assert.Nil(t, auth.ParseMFAChallengeToken(w, accessToken), "Access tokens should not be accepted as challenge tokens")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestOutranks(t *testing.T) {
+	assert.True(t, auth.Outranks(auth.RoleAdmin, auth.RoleSupport))
+	assert.True(t, auth.Outranks(auth.RoleSupport, ""), "Empty role should rank as a regular user")
+	assert.False(t, auth.Outranks(auth.RoleAdmin, auth.RoleAdmin), "Equal roles should not outrank each other")
+	assert.False(t, auth.Outranks(auth.RoleUser, auth.RoleSupport))
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	token, err := auth.NewPersonalAccessToken()
+	assert.NoError(t, err, "NewPersonalAccessToken should not return an error")
+	assert.True(t, auth.IsPersonalAccessToken(token))
+	assert.False(t, auth.IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.signature"), "JWTs should not be treated as personal access tokens")
+
+	other, _ := auth.NewPersonalAccessToken()
+	assert.NotEqual(t, token, other)
+	assert.Equal(t, auth.HashPersonalAccessToken(token), auth.HashPersonalAccessToken(token))
+	assert.NotEqual(t, auth.HashPersonalAccessToken(token), auth.HashPersonalAccessToken(other))
+	assert.True(t, strings.HasPrefix(token, auth.PersonalAccessTokenDisplayPrefix(token)))
+}
+
+func TestOAuthAccessToken(t *testing.T) {
+	os.Setenv("JWT_SECRET", "testsecret")
+
+	userID, clientID, grantID := uuid.New(), uuid.New(), uuid.New()
+
+	token, expiresIn, err := auth.NewOAuthAccessToken(userID, clientID, grantID, []string{auth.ScopeEventsRead, auth.ScopeUserRead})
+	assert.NoError(t, err, "NewOAuthAccessToken should not return an error")
+	assert.NotEmpty(t, expiresIn)
+	assert.True(t, auth.IsOAuthAccessToken(token))
+
+	claims, err := auth.ParseOAuthAccessToken(token)
+	assert.NoError(t, err, "ParseOAuthAccessToken should not return an error")
+	assert.Equal(t, userID.String(), claims.Subject)
+	assert.Equal(t, clientID, claims.ClientID)
+	assert.Equal(t, grantID.String(), claims.Id)
+	assert.Equal(t, []string{auth.ScopeEventsRead, auth.ScopeUserRead}, auth.ParseScope(claims.Scope))
+
+	w := httptest.NewRecorder()
+	assert.Nil(t, auth.ParseAccessToken(w, token), "OAuth access tokens should not be accepted as user access tokens")
+
+	accessToken, _, _, _ := auth.NewAccessToken(userID, "Test User", "test@example.com", auth.RoleUser, 0, time.Now())
+	assert.False(t, auth.IsOAuthAccessToken(accessToken), "User access tokens should not be accepted as OAuth access tokens")
+}
+
+func TestOAuthHelpers(t *testing.T) {
+	t.Run("PKCE", func(t *testing.T) {
+		// RFC 7636 Appendix B
+		verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+		assert.True(t, auth.VerifyPKCE(verifier, challenge))
+		assert.False(t, auth.VerifyPKCE("wrong-verifier", challenge))
+	})
+
+	t.Run("Scope", func(t *testing.T) {
+		assert.Equal(t, []string{"events:read", "user:read"}, auth.ParseScope(" events:read  user:read events:read "))
+		assert.Empty(t, auth.ParseScope(""))
+		assert.Equal(t, "events:read user:read", auth.FormatScope([]string{"events:read", "user:read"}))
+		assert.True(t, auth.IsValidScope(auth.ScopeEventsWrite))
+		assert.False(t, auth.IsValidScope("events:delete"))
+	})
+
+	t.Run("Client secret", func(t *testing.T) {
+		secret, err := auth.NewOAuthClientSecret()
+		assert.NoError(t, err)
+		assert.True(t, auth.CheckOAuthClientSecret(secret, auth.HashOAuthToken(secret)))
+		assert.False(t, auth.CheckOAuthClientSecret("wrong-secret", auth.HashOAuthToken(secret)))
+	})
+
+	t.Run("Refresh token", func(t *testing.T) {
+		refreshToken, err := auth.NewOAuthRefreshToken()
+		assert.NoError(t, err)
+		assert.True(t, auth.IsOAuthRefreshToken(refreshToken))
+		assert.False(t, auth.IsPersonalAccessToken(refreshToken))
+	})
+}
+
+func TestRoles(t *testing.T) {
+	assert.True(t, auth.IsValidRole(auth.RoleSupport))
+	assert.False(t, auth.IsValidRole("superuser"))
+
+	assert.True(t, auth.HasPermission(auth.RoleAdmin, auth.PermissionUsersRole))
+	assert.True(t, auth.HasPermission(auth.RoleSupport, auth.PermissionMFAReset))
+	assert.False(t, auth.HasPermission(auth.RoleSupport, auth.PermissionUsersDisable), "Support should not be able to disable users")
+	assert.False(t, auth.HasPermission(auth.RoleUser, auth.PermissionUsersRead))
+	assert.False(t, auth.HasPermission(auth.RoleSupport, auth.PermissionAuditRead), "Only admins should be able to read the whole audit log")
+	assert.False(t, auth.HasPermission("", auth.PermissionUsersRead), "Tokens without a role should be treated as regular users")
+
+	accessToken, _, _, _ := auth.NewAccessToken(uuid.New(), "Test User", "test@example.com", auth.RoleSupport, 3, time.Now())
+	claim := auth.ParseAccessToken(httptest.NewRecorder(), accessToken)
+	assert.NotNil(t, claim)
+	assert.Equal(t, auth.RoleSupport, claim.Role)
+	assert.Equal(t, 3, claim.TokenVersion)
+}
+
+func TestSessionCookies(t *testing.T) {
+	config := auth.CookieConfig{Secure: true, SameSite: http.SameSiteLaxMode}
+
+	res := httptest.NewRecorder()
+	assert.NoError(t, auth.SetSessionCookies(res, config, "access", "refresh"))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/events", nil)
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range res.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+		req.AddCookie(cookie)
+	}
+
+	assert.True(t, cookies[auth.AccessTokenCookie].HttpOnly)
+	assert.True(t, cookies[auth.AccessTokenCookie].Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[auth.AccessTokenCookie].SameSite)
+	assert.Equal(t, "/api/v1/auth", cookies[auth.RefreshTokenCookie].Path, "Refresh token should only be sent to the auth endpoints")
+	assert.False(t, cookies[auth.CSRFCookie].HttpOnly)
+
+	token, err := auth.GetJWT(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "access", token, "Access token cookie should be used without an Authorization header")
+	assert.True(t, auth.HasSessionCookie(req))
+
+	assert.False(t, auth.ValidCSRFToken(req), "Missing CSRF header should be rejected")
+	req.Header.Set(auth.CSRFHeader, cookies[auth.CSRFCookie].Value)
+	assert.True(t, auth.ValidCSRFToken(req))
+
+	req.Header.Set("Authorization", "Bearer header")
+	token, _ = auth.GetJWT(req)
+	assert.Equal(t, "header", token, "Authorization header should take precedence over the cookie")
+
+	cleared := httptest.NewRecorder()
+	auth.ClearSessionCookies(cleared, config)
+	for _, cookie := range cleared.Result().Cookies() {
+		assert.Equal(t, -1, cookie.MaxAge)
+	}
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Browser clients opt in to cookie sessions per request with the session mode header, the tokens are then set as cookies instead of being returned in the body
+const (
+	SessionModeHeader = "X-Session-Mode"
+	SessionModeCookie = "cookie"
+
+	AccessTokenCookie  = "koano_access_token"
+	RefreshTokenCookie = "koano_refresh_token"
+	CSRFCookie         = "koano_csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+
+	// OIDCStateCookie binds an OIDC login to the browser which started it
+	OIDCStateCookie = "koano_oidc_state"
+)
+
+// The refresh token is only sent to the endpoints which use it
+const (
+	refreshTokenCookiePath = "/api/v1/auth"
+	oidcStateCookiePath    = "/api/v1/auth/oidc"
+)
+
+type CookieConfig struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+func WantsSessionCookies(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(SessionModeHeader), SessionModeCookie)
+}
+
+// HasSessionCookie reports whether the request is authenticated by the browser rather than the client, which is when it needs a CSRF token
+func HasSessionCookie(r *http.Request) bool {
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie} {
+		if cookie, err := r.Cookie(name); err == nil && cookie.Value != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetSessionCookies sets the token pair as HttpOnly cookies along with a new CSRF token readable by the client.
+// The cookies last as long as the refresh token so an expired access token can still be refreshed.
+func SetSessionCookies(w http.ResponseWriter, config CookieConfig, accessToken string, refreshToken string) error {
+	csrfToken, err := NewCSRFToken()
+	if err != nil {
+		return err
+	}
+
+	maxAge := int(RefreshTokenLifetime.Seconds())
+
+	http.SetCookie(w, config.cookie(AccessTokenCookie, accessToken, "/", maxAge, true))
+	http.SetCookie(w, config.cookie(RefreshTokenCookie, refreshToken, refreshTokenCookiePath, maxAge, true))
+	http.SetCookie(w, config.cookie(CSRFCookie, csrfToken, "/", maxAge, false))
+
+	return nil
+}
+
+func ClearSessionCookies(w http.ResponseWriter, config CookieConfig) {
+	http.SetCookie(w, config.cookie(AccessTokenCookie, "", "/", -1, true))
+	http.SetCookie(w, config.cookie(RefreshTokenCookie, "", refreshTokenCookiePath, -1, true))
+	http.SetCookie(w, config.cookie(CSRFCookie, "", "/", -1, false))
+}
+
+// SetOIDCStateCookie remembers the state of an OIDC login in the browser which started it for as long as the state is valid
+func SetOIDCStateCookie(w http.ResponseWriter, config CookieConfig, state string, lifetime time.Duration) {
+	http.SetCookie(w, config.cookie(OIDCStateCookie, state, oidcStateCookiePath, int(lifetime.Seconds()), true))
+}
+
+func ClearOIDCStateCookie(w http.ResponseWriter, config CookieConfig) {
+	http.SetCookie(w, config.cookie(OIDCStateCookie, "", oidcStateCookiePath, -1, true))
+}
+
+// ValidOIDCStateCookie checks the state of an OIDC callback came back to the browser which started the login. Without it an
+// attacker could have the victim complete a login with the code of the attacker's own account.
+func ValidOIDCStateCookie(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(OIDCStateCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(state), []byte(cookie.Value)) == 1
+}
+
+func (c CookieConfig) cookie(name string, value string, path string, maxAge int, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.Domain,
+		MaxAge:   maxAge,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	}
+
+	if maxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(maxAge) * time.Second)
+	}
+
+	return cookie
+}
+
+func NewCSRFToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// ValidCSRFToken checks the double submitted CSRF token, another site can make the browser send the cookie but can't read it to set the header
+func ValidCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRFCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	header := r.Header.Get(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1
+}
+
+// GetRefreshTokenCookie returns the refresh token of a cookie session, or an empty string outside of one
+func GetRefreshTokenCookie(r *http.Request) string {
+	cookie, err := r.Cookie(RefreshTokenCookie)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
@@ -12,16 +12,93 @@ import (
 	"github.com/ushiradineth/koano-api/util/response"
 )
 
+// UserClaim carries the token version of the user, tokens from before the version was last bumped are rejected
 type UserClaim struct {
+	Id           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	TokenVersion int       `json:"ver"`
+	// AuthTime is when the user signed in, kept as the session is refreshed so sensitive changes can require a recent sign in
+	AuthTime int64 `json:"auth_time"`
+	jwt.StandardClaims
+}
+
+// signingSecret is set from the validated config on startup. Tests which don't load the config set JWT_SECRET instead.
+var signingSecret []byte
+
+// SetSecret sets the key tokens are signed and verified with
+func SetSecret(secret string) {
+	signingSecret = []byte(secret)
+}
+
+func secret() []byte {
+	if signingSecret != nil {
+		return signingSecret
+	}
+
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+const RefreshTokenAudience = "refresh"
+
+// RefreshTokenClaim names the user as its subject and carries their token version, so it stops working once the sessions of the user
+// are revoked. Its ID is recorded once it has been used, since each refresh token is exchanged for a new one.
+type RefreshTokenClaim struct {
+	TokenVersion int   `json:"ver"`
+	AuthTime     int64 `json:"auth_time"`
+	jwt.StandardClaims
+}
+
+const EmailVerificationAudience = "email_verification"
+
+type EmailVerificationClaim struct {
 	Id    uuid.UUID `json:"id"`
-	Name  string    `json:"name"`
 	Email string    `json:"email"`
 	jwt.StandardClaims
 }
 
+const MFAChallengeAudience = "mfa_challenge"
+
+// MFAChallengeClaim carries the ID of the stored challenge as its jti, which is what makes the token single use
+type MFAChallengeClaim struct {
+	Id uuid.UUID `json:"id"`
+	jwt.StandardClaims
+}
+
+const AccountRestoreAudience = "account_restore"
+
+// AccountRestoreClaim is bound to the deletion it undoes, so it stops working once the account is restored
+type AccountRestoreClaim struct {
+	Id        uuid.UUID `json:"id"`
+	DeletedAt int64     `json:"deleted_at"`
+	jwt.StandardClaims
+}
+
+const ExportDownloadAudience = "export_download"
+
+type ExportDownloadClaim struct {
+	ExportID uuid.UUID `json:"export_id"`
+	jwt.StandardClaims
+}
+
+const OAuthAccessAudience = "oauth_access"
+
+// OAuthAccessClaim identifies the grant by the token ID and the user by the subject
+type OAuthAccessClaim struct {
+	ClientID uuid.UUID `json:"client_id"`
+	Scope    string    `json:"scope"`
+	jwt.StandardClaims
+}
+
+// GetJWT returns the bearer token of the request, falling back to the access token cookie of a cookie session
 func GetJWT(r *http.Request) (string, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
+		if cookie, err := r.Cookie(AccessTokenCookie); err == nil && cookie.Value != "" {
+			return cookie.Value, nil
+		}
+
 		return "", errors.New("Authorization header is missing")
 	}
 
@@ -33,20 +110,23 @@ func GetJWT(r *http.Request) (string, error) {
 	return parts[1], nil
 }
 
-func NewAccessToken(id uuid.UUID, name string, email string) (string, int64, int64, error) {
+func NewAccessToken(id uuid.UUID, name string, email string, role string, tokenVersion int, authTime time.Time) (string, int64, int64, error) {
 	expiresIn := int64(15 * 60)
 	expiresAt := time.Now().Add(time.Duration(expiresIn) * time.Second).Unix()
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, UserClaim{
-		Id:    id,
-		Name:  name,
-		Email: email,
+		Id:           id,
+		Name:         name,
+		Email:        email,
+		Role:         role,
+		TokenVersion: tokenVersion,
+		AuthTime:     authTime.Unix(),
 		StandardClaims: jwt.StandardClaims{
 			IssuedAt:  time.Now().Unix(),
 			ExpiresAt: expiresAt,
 		},
 	})
 
-	signedToken, err := accessToken.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	signedToken, err := accessToken.SignedString(secret())
 	if err != nil {
 		return "", 0, 0, err
 	}
@@ -54,52 +134,83 @@ func NewAccessToken(id uuid.UUID, name string, email string) (string, int64, int
 	return signedToken, expiresIn, expiresAt, nil
 }
 
-func NewRefreshToken() (string, error) {
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		IssuedAt:  time.Now().Unix(),
-		ExpiresAt: time.Now().Add(time.Hour * 48).Unix(),
+const RefreshTokenLifetime = 48 * time.Hour
+
+func NewRefreshToken(id uuid.UUID, tokenVersion int, authTime time.Time) (string, error) {
+	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, RefreshTokenClaim{
+		TokenVersion: tokenVersion,
+		AuthTime:     authTime.Unix(),
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.NewString(),
+			Subject:   id.String(),
+			Audience:  RefreshTokenAudience,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(RefreshTokenLifetime).Unix(),
+		},
 	})
 
-	return refreshToken.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return refreshToken.SignedString(secret())
 }
 
 func ParseAccessToken(w http.ResponseWriter, accessToken string) *UserClaim {
-	parsedAccessToken, err := jwt.ParseWithClaims(accessToken, &UserClaim{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	claims, err := VerifyAccessToken(accessToken)
 	if err != nil {
 		response.GenericUnauthenticatedError(w)
 		return nil
 	}
 
+	return claims
+}
+
+// VerifyAccessToken is ParseAccessToken for callers which write their own error response
+func VerifyAccessToken(accessToken string) (*UserClaim, error) {
+	parsedAccessToken, err := jwt.ParseWithClaims(accessToken, &UserClaim{}, func(token *jwt.Token) (interface{}, error) {
+		return secret(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	claims, ok := parsedAccessToken.Claims.(*UserClaim)
-	if ok && parsedAccessToken.Valid {
-		return claims
+	// Tokens minted for other purposes carry an audience and must not be accepted as access tokens
+	if ok && parsedAccessToken.Valid && claims.Audience == "" {
+		return claims, nil
 	}
 
-	return nil
+	return nil, errors.New("Invalid access token")
 }
 
-func ParseRefreshToken(w http.ResponseWriter, refreshToken string) *jwt.StandardClaims {
-	parsedRefreshToken, err := jwt.ParseWithClaims(refreshToken, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+// ParseRefreshToken only accepts tokens with the refresh audience, since the tokens for other purposes are signed with the same secret
+func ParseRefreshToken(w http.ResponseWriter, refreshToken string) *RefreshTokenClaim {
+	claims, err := VerifyRefreshToken(refreshToken)
 	if err != nil {
 		response.GenericUnauthenticatedError(w)
 		return nil
 	}
 
-	claims, ok := parsedRefreshToken.Claims.(*jwt.StandardClaims)
-	if ok && parsedRefreshToken.Valid {
-		return claims
+	return claims
+}
+
+// VerifyRefreshToken is ParseRefreshToken for callers which write their own error response
+func VerifyRefreshToken(refreshToken string) (*RefreshTokenClaim, error) {
+	parsedRefreshToken, err := jwt.ParseWithClaims(refreshToken, &RefreshTokenClaim{}, func(token *jwt.Token) (interface{}, error) {
+		return secret(), nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	claims, ok := parsedRefreshToken.Claims.(*RefreshTokenClaim)
+	if ok && parsedRefreshToken.Valid && claims.VerifyAudience(RefreshTokenAudience, true) {
+		return claims, nil
+	}
+
+	return nil, errors.New("Invalid refresh token")
 }
 
 func ParseExpiredAccessToken(w http.ResponseWriter, accessToken string) *UserClaim {
 	parsedAccessToken, err := jwt.ParseWithClaims(accessToken, &UserClaim{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
+		return secret(), nil
 	})
 	if err == nil || !strings.Contains(err.Error(), "token is expired by") {
 		response.GenericBadRequestError(w, errors.New("Token is valid"))
@@ -114,3 +225,202 @@ func ParseExpiredAccessToken(w http.ResponseWriter, accessToken string) *UserCla
 
 	return claims
 }
+
+func NewEmailVerificationToken(id uuid.UUID, email string) (string, error) {
+	verificationToken := jwt.NewWithClaims(jwt.SigningMethodHS256, EmailVerificationClaim{
+		Id:    id,
+		Email: email,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  EmailVerificationAudience,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
+		},
+	})
+
+	return verificationToken.SignedString(secret())
+}
+
+func ParseEmailVerificationToken(w http.ResponseWriter, verificationToken string) *EmailVerificationClaim {
+	parsedVerificationToken, err := jwt.ParseWithClaims(verificationToken, &EmailVerificationClaim{}, func(token *jwt.Token) (interface{}, error) {
+		return secret(), nil
+	})
+	if err != nil {
+		response.GenericBadRequestError(w, errors.New("Invalid verification token"))
+		return nil
+	}
+
+	claims, ok := parsedVerificationToken.Claims.(*EmailVerificationClaim)
+	if ok && parsedVerificationToken.Valid && claims.VerifyAudience(EmailVerificationAudience, true) {
+		return claims
+	}
+
+	response.GenericBadRequestError(w, errors.New("Invalid verification token"))
+	return nil
+}
+
+func NewMFAChallengeToken(id uuid.UUID, challengeID uuid.UUID) (string, int64, error) {
+	expiresIn := int64(5 * 60)
+	challengeToken := jwt.NewWithClaims(jwt.SigningMethodHS256, MFAChallengeClaim{
+		Id: id,
+		StandardClaims: jwt.StandardClaims{
+			Id:        challengeID.String(),
+			Audience:  MFAChallengeAudience,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(time.Duration(expiresIn) * time.Second).Unix(),
+		},
+	})
+
+	signedToken, err := challengeToken.SignedString(secret())
+	if err != nil {
+		return "", 0, err
+	}
+
+	return signedToken, expiresIn, nil
+}
+
+func ParseMFAChallengeToken(w http.ResponseWriter, challengeToken string) *MFAChallengeClaim {
+	parsedChallengeToken, err := jwt.ParseWithClaims(challengeToken, &MFAChallengeClaim{}, func(token *jwt.Token) (interface{}, error) {
+		return secret(), nil
+	})
+	if err != nil {
+		response.GenericUnauthenticatedError(w)
+		return nil
+	}
+
+	claims, ok := parsedChallengeToken.Claims.(*MFAChallengeClaim)
+	if ok && parsedChallengeToken.Valid && claims.VerifyAudience(MFAChallengeAudience, true) {
+		return claims
+	}
+
+	response.GenericUnauthenticatedError(w)
+	return nil
+}
+
+func NewAccountRestoreToken(id uuid.UUID, deletedAt time.Time) (string, int64, error) {
+	expiresIn := int64(60 * 60)
+	restoreToken := jwt.NewWithClaims(jwt.SigningMethodHS256, AccountRestoreClaim{
+		Id:        id,
+		DeletedAt: deletedAt.UnixMicro(),
+		StandardClaims: jwt.StandardClaims{
+			Audience:  AccountRestoreAudience,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(time.Duration(expiresIn) * time.Second).Unix(),
+		},
+	})
+
+	signedToken, err := restoreToken.SignedString(secret())
+	if err != nil {
+		return "", 0, err
+	}
+
+	return signedToken, expiresIn, nil
+}
+
+func ParseAccountRestoreToken(w http.ResponseWriter, restoreToken string) *AccountRestoreClaim {
+	parsedRestoreToken, err := jwt.ParseWithClaims(restoreToken, &AccountRestoreClaim{}, func(token *jwt.Token) (interface{}, error) {
+		return secret(), nil
+	})
+	if err != nil {
+		response.GenericBadRequestError(w, errors.New("Invalid restore token"))
+		return nil
+	}
+
+	claims, ok := parsedRestoreToken.Claims.(*AccountRestoreClaim)
+	if ok && parsedRestoreToken.Valid && claims.VerifyAudience(AccountRestoreAudience, true) {
+		return claims
+	}
+
+	response.GenericBadRequestError(w, errors.New("Invalid restore token"))
+	return nil
+}
+
+// NewExportDownloadToken signs a short lived download link, which never outlives the export itself
+func NewExportDownloadToken(exportID uuid.UUID, exportExpiresAt time.Time) (string, int64, error) {
+	expiresAt := time.Now().Add(15 * time.Minute)
+	if exportExpiresAt.Before(expiresAt) {
+		expiresAt = exportExpiresAt
+	}
+
+	downloadToken := jwt.NewWithClaims(jwt.SigningMethodHS256, ExportDownloadClaim{
+		ExportID: exportID,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  ExportDownloadAudience,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	})
+
+	signedToken, err := downloadToken.SignedString(secret())
+	if err != nil {
+		return "", 0, err
+	}
+
+	return signedToken, expiresAt.Unix(), nil
+}
+
+func ParseExportDownloadToken(w http.ResponseWriter, downloadToken string) *ExportDownloadClaim {
+	parsedDownloadToken, err := jwt.ParseWithClaims(downloadToken, &ExportDownloadClaim{}, func(token *jwt.Token) (interface{}, error) {
+		return secret(), nil
+	})
+	if err != nil {
+		response.GenericUnauthenticatedError(w)
+		return nil
+	}
+
+	claims, ok := parsedDownloadToken.Claims.(*ExportDownloadClaim)
+	if ok && parsedDownloadToken.Valid && claims.VerifyAudience(ExportDownloadAudience, true) {
+		return claims
+	}
+
+	response.GenericUnauthenticatedError(w)
+	return nil
+}
+
+// NewOAuthAccessToken mints an access token for a client acting on behalf of the user, limited to the scopes of the grant
+func NewOAuthAccessToken(userID uuid.UUID, clientID uuid.UUID, grantID uuid.UUID, scopes []string) (string, int64, error) {
+	expiresIn := int64(15 * 60)
+	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, OAuthAccessClaim{
+		ClientID: clientID,
+		Scope:    FormatScope(scopes),
+		StandardClaims: jwt.StandardClaims{
+			Audience:  OAuthAccessAudience,
+			Id:        grantID.String(),
+			Subject:   userID.String(),
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(time.Duration(expiresIn) * time.Second).Unix(),
+		},
+	})
+
+	signedToken, err := accessToken.SignedString(secret())
+	if err != nil {
+		return "", 0, err
+	}
+
+	return signedToken, expiresIn, nil
+}
+
+// ParseOAuthAccessToken returns an error rather than responding since introspection reports invalid tokens as inactive
+func ParseOAuthAccessToken(accessToken string) (*OAuthAccessClaim, error) {
+	parsedAccessToken, err := jwt.ParseWithClaims(accessToken, &OAuthAccessClaim{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("Unexpected signing method")
+		}
+
+		return secret(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := parsedAccessToken.Claims.(*OAuthAccessClaim)
+	if ok && parsedAccessToken.Valid && claims.VerifyAudience(OAuthAccessAudience, true) {
+		return claims, nil
+	}
+
+	return nil, errors.New("Invalid access token")
+}
+
+func IsOAuthAccessToken(accessToken string) bool {
+	_, err := ParseOAuthAccessToken(accessToken)
+	return err == nil
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	MagicLinkLifetime = 15 * time.Minute
+
+	// MagicLinkInterval is how long a user has to wait before another link is sent to the same email
+	MagicLinkInterval = time.Minute
+)
+
+func NewMagicLinkToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// HashMagicLinkToken uses SHA-256 since only the hash is stored and tokens are random
+func HashMagicLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
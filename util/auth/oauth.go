@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strings"
+
+	"github.com/ushiradineth/koano-api/models"
+)
+
+const (
+	OAuthClientSecretPrefix = "koano_ocs_"
+	OAuthRefreshTokenPrefix = "koano_ort_"
+)
+
+const oauthGrantKey contextKey = "oauth_grant"
+
+// Scopes are shared by personal access tokens and OAuth clients
+var Scopes = map[string]string{
+	ScopeEventsRead:  "View your events",
+	ScopeEventsWrite: "Create, update and delete your events",
+	ScopeUserRead:    "View your profile",
+	ScopeUserWrite:   "Update your profile",
+}
+
+func NewOAuthClientSecret() (string, error) {
+	return newOAuthToken(OAuthClientSecretPrefix)
+}
+
+func NewOAuthRefreshToken() (string, error) {
+	return newOAuthToken(OAuthRefreshTokenPrefix)
+}
+
+func NewOAuthAuthorizationCode() (string, error) {
+	return newOAuthToken("")
+}
+
+func IsOAuthRefreshToken(token string) bool {
+	return strings.HasPrefix(token, OAuthRefreshTokenPrefix)
+}
+
+// HashOAuthToken hashes client secrets, refresh tokens and authorization codes, which are all random so SHA-256 is enough
+func HashOAuthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func CheckOAuthClientSecret(secret string, secretHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashOAuthToken(secret)), []byte(secretHash)) == 1
+}
+
+// VerifyPKCE checks the code verifier against the S256 code challenge of the authorization request
+func VerifyPKCE(codeVerifier string, codeChallenge string) bool {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(codeChallenge)) == 1
+}
+
+// ParseScope splits a space separated scope parameter, dropping duplicates
+func ParseScope(scope string) []string {
+	scopes := []string{}
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes
+}
+
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func IsValidScope(scope string) bool {
+	_, ok := Scopes[scope]
+	return ok
+}
+
+func WithOAuthGrant(ctx context.Context, grant *models.OAuthGrant) context.Context {
+	return context.WithValue(ctx, oauthGrantKey, grant)
+}
+
+// OAuthGrantFromContext returns the grant of the OAuth access token which has been checked against the scope of the route, if any
+func OAuthGrantFromContext(ctx context.Context) *models.OAuthGrant {
+	grant, _ := ctx.Value(oauthGrantKey).(*models.OAuthGrant)
+	return grant
+}
+
+func newOAuthToken(prefix string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return prefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordHasherArgon2id = "argon2id"
+	PasswordHasherBcrypt   = "bcrypt"
+)
+
+// PasswordHasher produces self describing hashes, so a hash can be checked after the policy which made it has changed
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, hash string) bool
+	// Identifies reports whether the hash was made by this algorithm
+	Identifies(hash string) bool
+	// NeedsRehash reports whether a hash made by this algorithm used other parameters than the hasher
+	NeedsRehash(hash string) bool
+}
+
+// DefaultArgon2idHasher follows the OWASP recommendation of 19 MiB, two iterations and one thread
+var DefaultArgon2idHasher = Argon2idHasher{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var DefaultBcryptHasher = BcryptHasher{
+	Cost: 12,
+}
+
+// currentHasher is set from the validated config on startup, tests which don't load the config use Argon2id
+var currentHasher PasswordHasher = DefaultArgon2idHasher
+
+// SetPasswordHasher sets the hasher new passwords are hashed with
+func SetPasswordHasher(hasher PasswordHasher) {
+	currentHasher = hasher
+}
+
+// CurrentPasswordHasher returns the hasher new passwords are hashed with, hashes made by another one are upgraded on login
+func CurrentPasswordHasher() PasswordHasher {
+	return currentHasher
+}
+
+var dummyPassword struct {
+	mu     sync.Mutex
+	hasher PasswordHasher
+	hash   string
+}
+
+// VerifyWithoutHash spends about as long as checking the password against a hash of the current hasher, so a login to an account which
+// doesn't exist or has no password can't be told apart from a wrong password by how long it takes
+func VerifyWithoutHash(password string) {
+	current := CurrentPasswordHasher()
+	current.Verify(password, dummyPasswordHash(current))
+}
+
+// dummyPasswordHash is made once for each hasher rather than on startup, as the hasher is only set once the config has been loaded
+func dummyPasswordHash(hasher PasswordHasher) string {
+	dummyPassword.mu.Lock()
+	defer dummyPassword.mu.Unlock()
+
+	if dummyPassword.hash == "" || dummyPassword.hasher != hasher {
+		hash, err := hasher.Hash("koano-dummy-password")
+		if err != nil {
+			return ""
+		}
+
+		dummyPassword.hasher, dummyPassword.hash = hasher, hash
+	}
+
+	return dummyPassword.hash
+}
+
+func HashPassword(password string) (string, error) {
+	return CurrentPasswordHasher().Hash(password)
+}
+
+// CheckPasswordHash verifies the password with whichever algorithm made the hash. When the password is valid but the hash
+// doesn't match the current policy, the password is hashed again and returned so the caller can store it.
+func CheckPasswordHash(password, hash string) (bool, string) {
+	current := CurrentPasswordHasher()
+
+	var hasher PasswordHasher
+	for _, candidate := range []PasswordHasher{current, DefaultArgon2idHasher, DefaultBcryptHasher} {
+		if candidate.Identifies(hash) {
+			hasher = candidate
+			break
+		}
+	}
+
+	if hasher == nil || !hasher.Verify(password, hash) {
+		return false, ""
+	}
+
+	if current.Identifies(hash) && !current.NeedsRehash(hash) {
+		return true, ""
+	}
+
+	// The password was valid, so failing to upgrade the hash shouldn't fail the login
+	rehashed, err := current.Hash(password)
+	if err != nil {
+		return true, ""
+	}
+
+	return true, rehashed
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+// Hash fails for passwords over 72 bytes, which bcrypt would otherwise silently truncate
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h BcryptHasher) Verify(password string, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func (h BcryptHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher encodes hashes in the PHC string format, $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(password string, hash string) bool {
+	parsed, err := parseArgon2idHash(hash)
+	if err != nil {
+		return false
+	}
+
+	key := argon2.IDKey([]byte(password), parsed.salt, parsed.iterations, parsed.memory, parsed.parallelism, uint32(len(parsed.key)))
+	return subtle.ConstantTimeCompare(key, parsed.key) == 1
+}
+
+func (h Argon2idHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	parsed, err := parseArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+
+	return parsed.memory != h.Memory || parsed.iterations != h.Iterations || parsed.parallelism != h.Parallelism || uint32(len(parsed.salt)) != h.SaltLength || uint32(len(parsed.key)) != h.KeyLength
+}
+
+func parseArgon2idHash(hash string) (*argon2idHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errors.New("hash is not in the argon2id format")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errors.New("argon2 version is not supported")
+	}
+
+	parsed := argon2idHash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &parsed.memory, &parsed.iterations, &parsed.parallelism); err != nil {
+		return nil, fmt.Errorf("argon2 parameters are malformed: %w", err)
+	}
+
+	// Bounds the work a stored hash can ask for, as argon2 panics on zero iterations or parallelism
+	if parsed.iterations == 0 || parsed.parallelism == 0 || parsed.memory > 4*1024*1024 {
+		return nil, errors.New("argon2 parameters are out of range")
+	}
+
+	var err error
+	if parsed.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("argon2 salt is malformed: %w", err)
+	}
+
+	if parsed.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(parsed.key) == 0 {
+		return nil, errors.New("argon2 key is malformed")
+	}
+
+	return &parsed, nil
+}
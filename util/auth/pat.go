@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/ushiradineth/koano-api/models"
+)
+
+const (
+	PersonalAccessTokenPrefix = "koano_pat_"
+
+	ScopeEventsRead  = "events:read"
+	ScopeEventsWrite = "events:write"
+	ScopeUserRead    = "user:read"
+	ScopeUserWrite   = "user:write"
+)
+
+type contextKey string
+
+const personalAccessTokenKey contextKey = "personal_access_token"
+
+func NewPersonalAccessToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return PersonalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// HashPersonalAccessToken uses SHA-256 rather than bcrypt since tokens are random and looked up on every request
+func HashPersonalAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// PersonalAccessTokenDisplayPrefix is the part of the token that is stored in plain text so users can tell tokens apart
+func PersonalAccessTokenDisplayPrefix(token string) string {
+	return token[:len(PersonalAccessTokenPrefix)+6]
+}
+
+func WithPersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) context.Context {
+	return context.WithValue(ctx, personalAccessTokenKey, token)
+}
+
+// PersonalAccessTokenFromContext returns the token which has been checked against the scope of the route, if any
+func PersonalAccessTokenFromContext(ctx context.Context) *models.PersonalAccessToken {
+	token, _ := ctx.Value(personalAccessTokenKey).(*models.PersonalAccessToken)
+	return token
+}
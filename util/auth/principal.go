@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/ushiradineth/koano-api/models"
+	logger "github.com/ushiradineth/koano-api/util/log"
+)
+
+// How the principal authenticated, which tells apart the user acting themselves from a token acting on their behalf
+const (
+	MethodAccessToken         = "access_token"
+	MethodPersonalAccessToken = "personal_access_token"
+	MethodOAuthAccessToken    = "oauth_access_token"
+)
+
+const principalKey contextKey = "principal"
+
+// Principal is the authenticated user of a request along with how they authenticated
+type Principal struct {
+	User   *models.User
+	Method string
+	// AuthTime is when the user signed in, zero when a token acts on their behalf
+	AuthTime time.Time
+}
+
+// SignedInSince reports whether the user has signed in themselves after the time, rather than a token acting on their behalf
+func (principal *Principal) SignedInSince(t time.Time) bool {
+	return principal.Method == MethodAccessToken && !principal.AuthTime.Before(t)
+}
+
+// WithPrincipal also names the user in the log fields of the request
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	if principal != nil && principal.User != nil {
+		logger.FieldsFromContext(ctx).SetUserID(principal.User.ID)
+	}
+
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFromContext returns the principal set by the authentication middleware, or nil on public routes
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey).(*Principal)
+	return principal
+}
+
+// MustPrincipalFromContext returns the principal of a private route. The authentication middleware always sets it on them,
+// so a missing principal means the handler was registered as public and is a programming error rather than a bad request.
+func MustPrincipalFromContext(ctx context.Context) *Principal {
+	principal := PrincipalFromContext(ctx)
+	if principal == nil {
+		panic("auth: principal is missing, the route has to be registered as private")
+	}
+
+	return principal
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"slices"
+)
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// Permissions guard routes rather than roles, so what a role can do is decided here in one place
+const (
+	PermissionUsersRead      = "users:read"
+	PermissionUsersDisable   = "users:disable"
+	PermissionUsersRole      = "users:role"
+	PermissionSessionsRevoke = "sessions:revoke"
+	PermissionMFAReset       = "mfa:reset"
+	PermissionAuditRead      = "audit:read"
+)
+
+var RolePermissions = map[string][]string{
+	RoleUser:    {},
+	RoleSupport: {PermissionUsersRead, PermissionSessionsRevoke, PermissionMFAReset},
+	RoleAdmin:   {PermissionUsersRead, PermissionUsersDisable, PermissionUsersRole, PermissionSessionsRevoke, PermissionMFAReset, PermissionAuditRead},
+}
+
+// roleRanks orders the roles, admin actions which could be turned against another admin are limited to lower roles
+var roleRanks = map[string]int{
+	RoleUser:    0,
+	RoleSupport: 1,
+	RoleAdmin:   2,
+}
+
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// HasPermission treats an empty role, as in tokens issued before roles existed, as a regular user
+func HasPermission(role string, permission string) bool {
+	if role == "" {
+		role = RoleUser
+	}
+
+	return slices.Contains(RolePermissions[role], permission)
+}
+
+// Outranks reports whether the role is above the other, treating an empty role as a regular user
+func Outranks(role string, other string) bool {
+	return roleRanks[role] > roleRanks[other]
+}
@@ -0,0 +1,181 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	logger "github.com/ushiradineth/koano-api/util/log"
+)
+
+var ErrNotFound = errors.New("Blob does not exist")
+
+// Store keeps large generated files, such as data exports, outside the database. Keys are slash separated paths.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+const (
+	// BackendFile keeps blobs on the local disk, which only suits a single instance
+	BackendFile = "file"
+	// BackendGCS keeps blobs in a Cloud Storage bucket which every instance shares
+	BackendGCS = "gcs"
+)
+
+type Options struct {
+	Backend string
+	// Dir is the directory of the file backend, a directory in the temp directory when empty
+	Dir string
+	// Bucket is the bucket of the gcs backend
+	Bucket string
+}
+
+// New returns the store of the configured backend
+func New(options Options, log *logger.Logger) Store {
+	if options.Backend == BackendGCS {
+		return NewGCSStore(options.Bucket, http.DefaultClient)
+	}
+
+	dir := options.Dir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "koano-blobs")
+		log.Warn.Printf("BLOB_DIR is not set or empty. Blobs will be stored in %s, which is not shared with other instances.", dir)
+	}
+
+	return NewFileStore(dir)
+}
+
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (s *FileStore) Put(_ context.Context, key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	// Written under a temporary name first so a reader never sees a partial file
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func (s *FileStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+func (s *FileStore) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// path keeps keys inside the store directory
+func (s *FileStore) path(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// validKey rejects keys which could escape the directory or bucket prefix they are meant for
+func validKey(key string) error {
+	if key == "" || !fs.ValidPath(key) || strings.Contains(key, `\`) {
+		return errors.New("Invalid blob key")
+	}
+
+	return nil
+}
+
+// MemoryStore keeps blobs in memory, for tests
+type MemoryStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: map[string][]byte{}}
+}
+
+func (s *MemoryStore) Put(_ context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = data
+
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+
+	return nil
+}
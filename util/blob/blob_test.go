@@ -0,0 +1,135 @@
+package blob_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/util/blob"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]blob.Store{
+		"File":   blob.NewFileStore(t.TempDir()),
+		"Memory": blob.NewMemoryStore(),
+		"GCS":    blob.NewGCSStore("koano", fakeGCS(t)),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			assert.NoError(t, store.Put(ctx, "exports/user/export.zip", strings.NewReader("contents")))
+
+			reader, err := store.Get(ctx, "exports/user/export.zip")
+			assert.NoError(t, err)
+			data, _ := io.ReadAll(reader)
+			reader.Close()
+			assert.Equal(t, "contents", string(data))
+
+			assert.NoError(t, store.Delete(ctx, "exports/user/export.zip"))
+			assert.NoError(t, store.Delete(ctx, "exports/user/export.zip"), "Deleting a missing blob should not fail")
+
+			_, err = store.Get(ctx, "exports/user/export.zip")
+			assert.ErrorIs(t, err, blob.ErrNotFound)
+		})
+	}
+
+	t.Run("Keys can not leave the directory", func(t *testing.T) {
+		store := blob.NewFileStore(t.TempDir())
+		for _, key := range []string{"../escape", "/absolute", "", `exports\..\escape`} {
+			assert.Error(t, store.Put(context.Background(), key, strings.NewReader("contents")), key)
+		}
+	})
+}
+
+func TestGCSStore(t *testing.T) {
+	client := fakeGCS(t)
+	store := blob.NewGCSStore("koano", client)
+	ctx := context.Background()
+
+	assert.NoError(t, store.Put(ctx, "exports/user/a.zip", strings.NewReader("a")))
+	assert.NoError(t, store.Put(ctx, "exports/user/b.zip", strings.NewReader("b")))
+
+	other := blob.NewGCSStore("koano", client)
+	reader, err := other.Get(ctx, "exports/user/a.zip")
+	assert.NoError(t, err, "Blobs should be visible to every instance using the bucket")
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, "a", string(data))
+
+	assert.Equal(t, 2, client.Transport.(*gcsTransport).tokens, "Access tokens should be reused until they expire")
+
+	assert.Error(t, store.Put(ctx, "../escape", strings.NewReader("contents")))
+}
+
+// gcsTransport sends the requests for Cloud Storage and the metadata server to a fake of both
+type gcsTransport struct {
+	server *httptest.Server
+	tokens int
+}
+
+func (transport *gcsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, _ := url.Parse(transport.server.URL)
+	req = req.Clone(req.Context())
+	if req.URL.Host == "metadata.google.internal" {
+		transport.tokens++
+	}
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func fakeGCS(t *testing.T) *http.Client {
+	var mu sync.Mutex
+	objects := map[string]string{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /computeMetadata/v1/instance/service-accounts/default/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+		w.Write([]byte(`{"access_token":"token","expires_in":3600,"token_type":"Bearer"}`))
+	})
+	mux.HandleFunc("POST /upload/storage/v1/b/koano/o", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "media", r.URL.Query().Get("uploadType"))
+		data, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		objects[r.URL.Query().Get("name")] = string(data)
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/storage/v1/b/koano/o/{name}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		name := r.PathValue("name")
+
+		mu.Lock()
+		defer mu.Unlock()
+		data, ok := objects[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			assert.Equal(t, "media", r.URL.Query().Get("alt"))
+			w.Write([]byte(data))
+		case http.MethodDelete:
+			delete(objects, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &http.Client{Transport: &gcsTransport{server: server}}
+}
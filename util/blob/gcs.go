@@ -0,0 +1,165 @@
+package blob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	gcsEndpoint = "https://storage.googleapis.com"
+	// The metadata server hands out tokens of the service account the instance runs as, such as on Cloud Run
+	metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// GCSStore keeps blobs in a Cloud Storage bucket through its JSON API, so every instance sees the blobs the others have written
+type GCSStore struct {
+	bucket string
+	client *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func NewGCSStore(bucket string, client *http.Client) *GCSStore {
+	return &GCSStore{bucket: bucket, client: client}
+}
+
+func (s *GCSStore) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+
+	query := url.Values{"uploadType": {"media"}, "name": {key}}
+	res, err := s.do(ctx, http.MethodPost, fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", gcsEndpoint, url.PathEscape(s.bucket), query.Encode()), r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return gcsError(res)
+	}
+
+	return nil
+}
+
+func (s *GCSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+
+	res, err := s.do(ctx, http.MethodGet, s.objectURL(key)+"?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, gcsError(res)
+	}
+
+	return res.Body, nil
+}
+
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+
+	res, err := s.do(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return gcsError(res)
+	}
+
+	return nil
+}
+
+// objectURL escapes the slashes of the key, the API takes the object name as a single path segment
+func (s *GCSStore) objectURL(key string) string {
+	return fmt.Sprintf("%s/storage/v1/b/%s/o/%s", gcsEndpoint, url.PathEscape(s.bucket), url.PathEscape(key))
+}
+
+func (s *GCSStore) do(ctx context.Context, method string, url string, body io.Reader) (*http.Response, error) {
+	accessToken, err := s.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	return s.client.Do(req)
+}
+
+// token returns the access token of the service account, fetching a new one shortly before the current one expires
+func (s *GCSStore) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && time.Now().Before(s.expiresAt) {
+		return s.accessToken, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get an access token from the metadata server: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Metadata server responded with %s", res.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.AccessToken == "" {
+		return "", errors.New("Metadata server did not return an access token")
+	}
+
+	s.accessToken = token.AccessToken
+	s.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+
+	return s.accessToken, nil
+}
+
+func gcsError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("Cloud Storage responded with %s: %s", res.Status, body)
+}
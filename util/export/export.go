@@ -0,0 +1,219 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/blob"
+	"github.com/ushiradineth/koano-api/util/lockout"
+)
+
+// An export which has been running for longer than this was lost to a restart and is failed so the user can request another
+const staleAfter = time.Hour
+
+const failedMessage = "Export failed, request a new one"
+
+type Sessions struct {
+	PersonalAccessTokens []models.PersonalAccessToken `json:"personal_access_tokens"`
+	OAuthGrants          []models.OAuthGrant          `json:"oauth_grants"`
+	Passkeys             []models.WebAuthnCredential  `json:"passkeys"`
+	Identities           []models.UserIdentity        `json:"identities"`
+}
+
+type Audit struct {
+	Log           []models.AuditLog     `json:"log"`
+	LoginAttempts []models.LoginAttempt `json:"login_attempts"`
+}
+
+// Data is everything held about a user. Secrets such as the password hash and token hashes are left out by the JSON tags of the models.
+type Data struct {
+	User     models.User    `json:"user"`
+	Events   []models.Event `json:"events"`
+	Sessions Sessions       `json:"sessions"`
+	Audit    Audit          `json:"audit"`
+}
+
+func Collect(ctx context.Context, repositories *store.Store, userID uuid.UUID) (*Data, error) {
+	user, err := repositories.Users.Find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Redact()
+
+	data := Data{User: *user}
+
+	// Deleted events are included since they are still held until the account is purged
+	if data.Events, err = repositories.Events.ListAll(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if data.Sessions.PersonalAccessTokens, err = repositories.Tokens.ListByUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if data.Sessions.OAuthGrants, err = repositories.OAuth.ListGrantsByUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if data.Sessions.Passkeys, err = repositories.Passkeys.ListByUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if data.Sessions.Identities, err = repositories.Identities.ListByUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if data.Audit.Log, err = repositories.Audit.ListByUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if data.Audit.LoginAttempts, err = repositories.LoginAttempts.List(ctx, lockout.ScopeAccount, strings.ToLower(data.User.Email)); err != nil {
+		return nil, err
+	}
+
+	for i := range data.Audit.Log {
+		data.Audit.Log[i].RedactFor(userID)
+	}
+
+	return &data, nil
+}
+
+// WriteZip writes the export archive, with a file per kind of data and the events again as a calendar
+func WriteZip(w io.Writer, data *Data, exportedAt time.Time) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name  string
+		value any
+	}{
+		{"profile.json", data.User},
+		{"events.json", data.Events},
+		{"sessions.json", data.Sessions},
+		{"audit.json", data.Audit},
+	}
+
+	for _, file := range files {
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: exportedAt})
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.value); err != nil {
+			return err
+		}
+	}
+
+	activeEvents := []models.Event{}
+	for _, event := range data.Events {
+		if event.Active {
+			activeEvents = append(activeEvents, event)
+		}
+	}
+
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: "events.ics", Method: zip.Deflate, Modified: exportedAt})
+	if err != nil {
+		return err
+	}
+
+	if err := WriteICS(writer, activeEvents, exportedAt); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// Run builds a pending export and stores the archive. Exports which have already been picked up are left alone, so it is safe to call for the same export more than once.
+func Run(ctx context.Context, repositories *store.Store, blobs blob.Store, exportID uuid.UUID, retention time.Duration) error {
+	export, err := repositories.Exports.Start(ctx, exportID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if err := build(ctx, repositories, blobs, export, retention); err != nil {
+		// The cause is logged by the caller, users only learn that the export failed. The export is marked failed even when ctx has run out.
+		if updateErr := repositories.Exports.Fail(context.WithoutCancel(ctx), export.ID, failedMessage); updateErr != nil {
+			return errors.Join(err, updateErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func build(ctx context.Context, repositories *store.Store, blobs blob.Store, export *models.DataExport, retention time.Duration) error {
+	data, err := Collect(ctx, repositories, export.UserID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	// The archive of a single user is small enough to build in memory
+	var archive bytes.Buffer
+	if err := WriteZip(&archive, data, now); err != nil {
+		return err
+	}
+
+	size := int64(archive.Len())
+	key := fmt.Sprintf("exports/%s/%s.zip", export.UserID, export.ID)
+
+	if err := blobs.Put(ctx, key, &archive); err != nil {
+		return err
+	}
+
+	return repositories.Exports.Complete(ctx, export.ID, key, size, now.Add(retention))
+}
+
+// Process is run on a schedule. It fails exports lost to a restart, builds pending exports, which can be downloaded for the retention, and removes the archives of expired exports.
+func Process(ctx context.Context, repositories *store.Store, blobs blob.Store, retention time.Duration) error {
+	if _, err := repositories.Exports.FailStale(ctx, time.Now().Add(-staleAfter), failedMessage); err != nil {
+		return err
+	}
+
+	pending, err := repositories.Exports.ListPending(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, id := range pending {
+		if err := Run(ctx, repositories, blobs, id, retention); err != nil {
+			errs = append(errs, fmt.Errorf("export %s: %w", id, err))
+		}
+	}
+
+	expired, err := repositories.Exports.ListExpired(ctx)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	for _, export := range expired {
+		if export.BlobKey != nil {
+			if err := blobs.Delete(ctx, *export.BlobKey); err != nil {
+				errs = append(errs, fmt.Errorf("export %s: %w", export.ID, err))
+				continue
+			}
+		}
+
+		if err := repositories.Exports.Expire(ctx, export.ID); err != nil {
+			errs = append(errs, fmt.Errorf("export %s: %w", export.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
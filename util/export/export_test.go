@@ -0,0 +1,119 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/util/export"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newEvent(title string, repeated string, active bool) models.Event {
+	return models.Event{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Active:    active,
+		Title:     title,
+		Start:     time.Date(2024, 5, 2, 9, 30, 0, 0, time.FixedZone("+0530", 5*60*60+30*60)),
+		End:       time.Date(2024, 5, 2, 10, 30, 0, 0, time.FixedZone("+0530", 5*60*60+30*60)),
+		Timezone:  "Asia/Colombo",
+		Repeated:  repeated,
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	weekly := newEvent("Standup; team, all\nhands", "weekly", true)
+	long := newEvent(strings.Repeat("Planning ✓ ", 12), "never", true)
+
+	var buf bytes.Buffer
+	assert.NoError(t, export.WriteICS(&buf, []models.Event{weekly, long}, now))
+	ics := buf.String()
+
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+	assert.Equal(t, 2, strings.Count(ics, "BEGIN:VEVENT"))
+
+	t.Run("Times are in UTC", func(t *testing.T) {
+		assert.Contains(t, ics, "DTSTART:20240502T040000Z\r\n")
+		assert.Contains(t, ics, "DTEND:20240502T050000Z\r\n")
+	})
+
+	t.Run("Text is escaped", func(t *testing.T) {
+		assert.Contains(t, ics, `SUMMARY:Standup\; team\, all\nhands`)
+	})
+
+	t.Run("Repeating events have a rule", func(t *testing.T) {
+		assert.Equal(t, 1, strings.Count(ics, "RRULE:FREQ=WEEKLY"))
+		assert.NotContains(t, ics, "RRULE:FREQ=NEVER")
+	})
+
+	t.Run("Long lines are folded", func(t *testing.T) {
+		for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+			assert.LessOrEqual(t, len(line), 75, line)
+			assert.True(t, strings.ToValidUTF8(line, "") == line, "Lines should not split a character")
+		}
+
+		unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+		assert.Contains(t, unfolded, "SUMMARY:"+strings.Repeat("Planning ✓ ", 12))
+	})
+}
+
+func TestWriteZip(t *testing.T) {
+	password := "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA"
+	user := models.User{ID: uuid.New(), Name: "Test User", Email: "test@example.com", Password: &password}
+	user.Redact()
+
+	data := &export.Data{
+		User:   user,
+		Events: []models.Event{newEvent("Kept", "daily", true), newEvent("Deleted", "never", false)},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, export.WriteZip(&buf, data, now))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		assert.NoError(t, err)
+		contents, _ := io.ReadAll(reader)
+		reader.Close()
+		files[file.Name] = string(contents)
+	}
+
+	assert.ElementsMatch(t, []string{"profile.json", "events.json", "events.ics", "sessions.json", "audit.json"}, keys(files))
+
+	t.Run("Profile has no password hash", func(t *testing.T) {
+		assert.NotContains(t, files["profile.json"], "argon2id")
+
+		var profile map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(files["profile.json"]), &profile))
+		assert.Equal(t, user.Email, profile["email"])
+	})
+
+	t.Run("Deleted events are only in the JSON", func(t *testing.T) {
+		assert.Contains(t, files["events.json"], "Deleted")
+		assert.Contains(t, files["events.ics"], "SUMMARY:Kept")
+		assert.NotContains(t, files["events.ics"], "Deleted")
+	})
+}
+
+func keys(files map[string]string) []string {
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	return names
+}
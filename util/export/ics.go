@@ -0,0 +1,83 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ushiradineth/koano-api/models"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+var recurrenceRules = map[string]string{
+	"daily":   "FREQ=DAILY",
+	"weekly":  "FREQ=WEEKLY",
+	"monthly": "FREQ=MONTHLY",
+	"yearly":  "FREQ=YEARLY",
+}
+
+// WriteICS writes the events as an iCalendar (RFC 5545) calendar so they can be imported into other calendar apps.
+// Times are written in UTC and the timezone the event was created in is kept in X-KOANO-TIMEZONE.
+func WriteICS(w io.Writer, events []models.Event, now time.Time) error {
+	writer := bufio.NewWriter(w)
+
+	line := func(format string, args ...any) {
+		writeFolded(writer, fmt.Sprintf(format, args...))
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Koano//Koano API//EN")
+	line("CALSCALE:GREGORIAN")
+
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:%s@koano.app", event.ID)
+		line("DTSTAMP:%s", now.UTC().Format(icsTimeFormat))
+		line("CREATED:%s", event.CreatedAt.UTC().Format(icsTimeFormat))
+		line("LAST-MODIFIED:%s", event.UpdatedAt.UTC().Format(icsTimeFormat))
+		line("DTSTART:%s", event.Start.UTC().Format(icsTimeFormat))
+		line("DTEND:%s", event.End.UTC().Format(icsTimeFormat))
+		line("SUMMARY:%s", escapeText(event.Title))
+		if rule, ok := recurrenceRules[event.Repeated]; ok {
+			line("RRULE:%s", rule)
+		}
+		if event.Timezone != "" {
+			line("X-KOANO-TIMEZONE:%s", escapeText(event.Timezone))
+		}
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+
+	return writer.Flush()
+}
+
+func escapeText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(text)
+}
+
+// writeFolded ends lines with CRLF and folds them at 75 octets without splitting a character, as RFC 5545 requires
+func writeFolded(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+
+		// The leading space of a continuation line counts towards its length
+		limit = 74
+	}
+
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
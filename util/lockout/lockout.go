@@ -0,0 +1,240 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+)
+
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+type Policy struct {
+	// Failures after which each further attempt on an account has to wait an exponentially growing delay
+	AccountDelayAfter int
+	MaxDelay          time.Duration
+
+	// Failures after which the account or IP is locked, each repeated lockout doubles the duration
+	AccountThreshold int
+	IPThreshold      int
+	LockoutDuration  time.Duration
+	MaxLockout       time.Duration
+
+	// Failures older than the window are forgotten
+	Window time.Duration
+}
+
+var DefaultPolicy = Policy{
+	AccountDelayAfter: 3,
+	MaxDelay:          30 * time.Second,
+	AccountThreshold:  10,
+	IPThreshold:       50,
+	LockoutDuration:   15 * time.Minute,
+	MaxLockout:        24 * time.Hour,
+	Window:            time.Hour,
+}
+
+type Lockout struct {
+	Scope       string
+	Identifier  string
+	FailedCount int
+	LockedUntil time.Time
+}
+
+type Hook func(lockout Lockout)
+
+type Limiter struct {
+	attempts store.LoginAttemptRepository
+	policy   Policy
+	hooks    []Hook
+}
+
+func New(attempts store.LoginAttemptRepository, policy Policy) *Limiter {
+	return &Limiter{
+		attempts: attempts,
+		policy:   policy,
+	}
+}
+
+// OnLockout registers a hook which is called whenever an account or IP gets locked
+func (l *Limiter) OnLockout(hook Hook) {
+	l.hooks = append(l.hooks, hook)
+}
+
+// Check counts a login attempt for the email from the IP before it is made, so concurrent attempts can't all pass the check before
+// the failures of the first are counted. If another attempt isn't allowed yet, it returns how long the caller has to wait instead.
+func (l *Limiter) Check(ctx context.Context, email string, ip string) (*Reservation, time.Duration, error) {
+	reservation := &Reservation{limiter: l, email: normalizeEmail(email), ip: ip}
+
+	if err := reservation.reserve(ctx, ScopeAccount, reservation.email); err != nil {
+		return l.wait(ctx, reservation, err)
+	}
+
+	if err := reservation.reserve(ctx, ScopeIP, ip); err != nil {
+		if err := l.attempts.Release(ctx, ScopeAccount, reservation.email, l.policy.scope(ScopeAccount)); err != nil {
+			return nil, 0, err
+		}
+
+		return l.wait(ctx, reservation, err)
+	}
+
+	return reservation, 0, nil
+}
+
+// Unlock clears the failed attempts and lockout of an account or IP, returning false if there was nothing to clear
+func (l *Limiter) Unlock(ctx context.Context, scope string, identifier string) (bool, error) {
+	if scope == ScopeAccount {
+		identifier = normalizeEmail(identifier)
+	}
+
+	return l.attempts.Delete(ctx, scope, identifier)
+}
+
+// Prune forgets the attempts which are outside the window and not locked, returning how many there were
+func (l *Limiter) Prune(ctx context.Context) (int64, error) {
+	return l.attempts.Prune(ctx, time.Now().Add(-l.policy.Window))
+}
+
+// wait returns how long the caller of a refused reservation has to wait, at least a second as it has just been refused
+func (l *Limiter) wait(ctx context.Context, reservation *Reservation, err error) (*Reservation, time.Duration, error) {
+	if !errors.Is(err, store.ErrConflict) {
+		return nil, 0, err
+	}
+
+	accounts, err := l.attempts.List(ctx, ScopeAccount, reservation.email)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ips, err := l.attempts.List(ctx, ScopeIP, reservation.ip)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	wait := time.Second
+	for _, attempt := range append(accounts, ips...) {
+		if retryAfter := RetryAfter(attempt, l.policy, now); retryAfter > wait {
+			wait = retryAfter
+		}
+	}
+
+	return nil, wait, nil
+}
+
+// Reservation is a login attempt which Check has counted as failed before it was made. Fail keeps it as a failure, Release and
+// Succeed take it back once the attempt hasn't failed. Only the first of them counts, so Release can be deferred.
+type Reservation struct {
+	limiter  *Limiter
+	email    string
+	ip       string
+	lockouts []Lockout
+	settled  bool
+}
+
+// Fail keeps the attempt as a failure, calling the hooks for the lockouts it triggered
+func (r *Reservation) Fail() {
+	if r.settled {
+		return
+	}
+	r.settled = true
+
+	for _, lockout := range r.lockouts {
+		for _, hook := range r.limiter.hooks {
+			hook(lockout)
+		}
+	}
+}
+
+// Release takes back the attempt without forgetting earlier failures, for attempts which neither failed nor completed a login
+func (r *Reservation) Release(ctx context.Context) error {
+	if r.settled {
+		return nil
+	}
+	r.settled = true
+
+	if err := r.limiter.attempts.Release(ctx, ScopeAccount, r.email, r.limiter.policy.scope(ScopeAccount)); err != nil {
+		return err
+	}
+
+	return r.limiter.attempts.Release(ctx, ScopeIP, r.ip, r.limiter.policy.scope(ScopeIP))
+}
+
+// Succeed forgets the failed attempts of the account. IP failures are kept so a valid login can't reset them.
+func (r *Reservation) Succeed(ctx context.Context) error {
+	if r.settled {
+		return nil
+	}
+	r.settled = true
+
+	if _, err := r.limiter.attempts.Delete(ctx, ScopeAccount, r.email); err != nil {
+		return err
+	}
+
+	return r.limiter.attempts.Release(ctx, ScopeIP, r.ip, r.limiter.policy.scope(ScopeIP))
+}
+
+// reserve counts the attempt in the scope, keeping the lockout it triggers for Fail to report
+func (r *Reservation) reserve(ctx context.Context, scope string, identifier string) error {
+	lockout := r.limiter.policy.scope(scope)
+
+	// The repository checks, counts and locks in one step
+	attempt, err := r.limiter.attempts.Reserve(ctx, scope, identifier, lockout)
+	if err != nil {
+		return err
+	}
+
+	if lockout.LockedUntil(attempt.FailedCount, time.Now()) == nil || attempt.LockedUntil == nil {
+		return nil
+	}
+
+	r.lockouts = append(r.lockouts, Lockout{
+		Scope:       scope,
+		Identifier:  identifier,
+		FailedCount: attempt.FailedCount,
+		LockedUntil: *attempt.LockedUntil,
+	})
+
+	return nil
+}
+
+// RetryAfter returns how long after now the next attempt is allowed, or zero if it is allowed right away
+func RetryAfter(attempt models.LoginAttempt, policy Policy, now time.Time) time.Duration {
+	return policy.scope(attempt.Scope).RetryAfter(attempt, now)
+}
+
+// LockedUntil returns the end of the lockout triggered by the failed count, or nil if it doesn't trigger one
+func LockedUntil(failedCount int, threshold int, policy Policy, now time.Time) *time.Time {
+	return policy.lockout(threshold).LockedUntil(failedCount, now)
+}
+
+func (policy Policy) lockout(threshold int) store.LoginLockout {
+	return store.LoginLockout{
+		Window:    policy.Window,
+		Threshold: threshold,
+		Duration:  policy.LockoutDuration,
+		Max:       policy.MaxLockout,
+	}
+}
+
+// scope returns when attempts in the scope are locked or delayed, only accounts are delayed
+func (policy Policy) scope(scope string) store.LoginLockout {
+	if scope != ScopeAccount {
+		return policy.lockout(policy.IPThreshold)
+	}
+
+	lockout := policy.lockout(policy.AccountThreshold)
+	lockout.DelayAfter = policy.AccountDelayAfter
+	lockout.MaxDelay = policy.MaxDelay
+	return lockout
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
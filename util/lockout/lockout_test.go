@@ -0,0 +1,164 @@
+package lockout_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/lockout"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+	policy := lockout.DefaultPolicy
+
+	t.Run("Below delay threshold", func(t *testing.T) {
+		lastFailedAt := now
+		attempt := models.LoginAttempt{Scope: lockout.ScopeAccount, FailedCount: policy.AccountDelayAfter - 1, LastFailedAt: &lastFailedAt}
+		assert.Zero(t, lockout.RetryAfter(attempt, policy, now))
+	})
+
+	t.Run("Progressive delay", func(t *testing.T) {
+		lastFailedAt := now
+		attempt := models.LoginAttempt{Scope: lockout.ScopeAccount, FailedCount: policy.AccountDelayAfter, LastFailedAt: &lastFailedAt}
+		assert.Equal(t, time.Second, lockout.RetryAfter(attempt, policy, now))
+
+		attempt.FailedCount = policy.AccountDelayAfter + 2
+		assert.Equal(t, 4*time.Second, lockout.RetryAfter(attempt, policy, now))
+		assert.Zero(t, lockout.RetryAfter(attempt, policy, now.Add(4*time.Second)))
+
+		attempt.FailedCount = policy.AccountDelayAfter + 20
+		assert.Equal(t, policy.MaxDelay, lockout.RetryAfter(attempt, policy, now))
+	})
+
+	t.Run("IP has no progressive delay", func(t *testing.T) {
+		lastFailedAt := now
+		attempt := models.LoginAttempt{Scope: lockout.ScopeIP, FailedCount: policy.AccountDelayAfter + 2, LastFailedAt: &lastFailedAt}
+		assert.Zero(t, lockout.RetryAfter(attempt, policy, now))
+	})
+
+	t.Run("Failures outside window", func(t *testing.T) {
+		lastFailedAt := now.Add(-policy.Window - time.Minute)
+		attempt := models.LoginAttempt{Scope: lockout.ScopeAccount, FailedCount: policy.AccountDelayAfter + 2, LastFailedAt: &lastFailedAt}
+		assert.Zero(t, lockout.RetryAfter(attempt, policy, now))
+	})
+
+	t.Run("Locked", func(t *testing.T) {
+		lockedUntil := now.Add(10 * time.Minute)
+		attempt := models.LoginAttempt{Scope: lockout.ScopeIP, LockedUntil: &lockedUntil}
+		assert.Equal(t, 10*time.Minute, lockout.RetryAfter(attempt, policy, now))
+		assert.Zero(t, lockout.RetryAfter(attempt, policy, lockedUntil))
+	})
+}
+
+func TestLockedUntil(t *testing.T) {
+	now := time.Now()
+	policy := lockout.DefaultPolicy
+
+	assert.Nil(t, lockout.LockedUntil(policy.AccountThreshold-1, policy.AccountThreshold, policy, now))
+	assert.Nil(t, lockout.LockedUntil(policy.AccountThreshold+1, policy.AccountThreshold, policy, now))
+
+	lockedUntil := lockout.LockedUntil(policy.AccountThreshold, policy.AccountThreshold, policy, now)
+	assert.NotNil(t, lockedUntil)
+	assert.Equal(t, now.Add(policy.LockoutDuration), *lockedUntil)
+
+	lockedUntil = lockout.LockedUntil(policy.AccountThreshold*2, policy.AccountThreshold, policy, now)
+	assert.Equal(t, now.Add(2*policy.LockoutDuration), *lockedUntil, "Repeated lockouts should double the duration")
+
+	lockedUntil = lockout.LockedUntil(policy.AccountThreshold*20, policy.AccountThreshold, policy, now)
+	assert.Equal(t, now.Add(policy.MaxLockout), *lockedUntil)
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Concurrent attempts are counted before they are checked", func(t *testing.T) {
+		attempts := store.NewMemoryLoginAttemptRepository()
+		limiter := lockout.New(attempts, lockout.Policy{AccountThreshold: 3, LockoutDuration: time.Hour, MaxLockout: time.Hour, Window: time.Hour})
+
+		var mu sync.Mutex
+		lockouts := []lockout.Lockout{}
+		limiter.OnLockout(func(lockout lockout.Lockout) {
+			mu.Lock()
+			defer mu.Unlock()
+			lockouts = append(lockouts, lockout)
+		})
+
+		var wg sync.WaitGroup
+		var allowed atomic.Int32
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reservation, wait, err := limiter.Check(ctx, "User@Example.com", "203.0.113.1")
+				assert.NoError(t, err)
+				if reservation == nil {
+					assert.Positive(t, wait)
+					return
+				}
+
+				allowed.Add(1)
+				reservation.Fail()
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(3), allowed.Load(), "Only as many attempts as the threshold should be allowed")
+		assert.Len(t, lockouts, 1)
+		assert.Equal(t, lockout.ScopeAccount, lockouts[0].Scope)
+		assert.Equal(t, "user@example.com", lockouts[0].Identifier)
+		assert.Equal(t, 3, lockouts[0].FailedCount)
+
+		reservation, wait, err := limiter.Check(ctx, "user@example.com", "203.0.113.2")
+		assert.NoError(t, err)
+		assert.Nil(t, reservation)
+		assert.InDelta(t, time.Hour, wait, float64(time.Second))
+	})
+
+	t.Run("Released attempts are not counted", func(t *testing.T) {
+		attempts := store.NewMemoryLoginAttemptRepository()
+		limiter := lockout.New(attempts, lockout.Policy{AccountThreshold: 1, IPThreshold: 1, LockoutDuration: time.Hour, MaxLockout: time.Hour, Window: time.Hour})
+
+		reservation, _, err := limiter.Check(ctx, "user@example.com", "203.0.113.1")
+		assert.NoError(t, err)
+		assert.NoError(t, reservation.Release(ctx))
+		reservation.Fail()
+
+		reservation, _, err = limiter.Check(ctx, "user@example.com", "203.0.113.1")
+		assert.NoError(t, err)
+		assert.NotNil(t, reservation, "The released attempt should not have locked the account")
+		assert.NoError(t, reservation.Succeed(ctx))
+
+		listed, err := attempts.List(ctx, lockout.ScopeIP, "203.0.113.1")
+		assert.NoError(t, err)
+		assert.Len(t, listed, 1)
+		assert.Zero(t, listed[0].FailedCount)
+		assert.Nil(t, listed[0].LockedUntil)
+	})
+
+	t.Run("Prune keeps recent and locked attempts", func(t *testing.T) {
+		attempts := store.NewMemoryLoginAttemptRepository()
+		limiter := lockout.New(attempts, lockout.Policy{AccountThreshold: 1, LockoutDuration: time.Hour, MaxLockout: time.Hour})
+
+		reservation, _, err := limiter.Check(ctx, "user@example.com", "203.0.113.1")
+		assert.NoError(t, err)
+		reservation.Fail()
+
+		count, err := limiter.Prune(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count, "The IP has no threshold and is outside the zero window")
+
+		listed, err := attempts.List(ctx, lockout.ScopeAccount, "user@example.com")
+		assert.NoError(t, err)
+		assert.Len(t, listed, 1, "The locked account should be kept")
+
+		ok, err := limiter.Unlock(ctx, lockout.ScopeAccount, "user@example.com")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
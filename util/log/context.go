@@ -0,0 +1,216 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type contextKey string
+
+const fieldsKey contextKey = "fields"
+
+// HTTPRequest is the request an entry belongs to, in the shape of the httpRequest field of Cloud Logging
+type HTTPRequest struct {
+	RequestMethod string `json:"requestMethod,omitempty"`
+	RequestURL    string `json:"requestUrl,omitempty"`
+	Status        int    `json:"status,omitempty"`
+	ResponseSize  string `json:"responseSize,omitempty"`
+	UserAgent     string `json:"userAgent,omitempty"`
+	RemoteIP      string `json:"remoteIp,omitempty"`
+	Referer       string `json:"referer,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+	// Latency is a duration in seconds such as 0.25s
+	Latency string `json:"latency,omitempty"`
+}
+
+// Fields are added to every entry logged with the context of a request. They are filled in as the request is handled,
+// the route once it is matched and the user once they are authenticated, so they are shared rather than copied into each context.
+type Fields struct {
+	mu          sync.RWMutex
+	requestID   string
+	route       string
+	userID      string
+	traceID     string
+	spanID      string
+	httpRequest *HTTPRequest
+}
+
+// WithFields returns a context carrying fields, reusing those already in ctx
+func WithFields(ctx context.Context) (context.Context, *Fields) {
+	if fields := FieldsFromContext(ctx); fields != nil {
+		return ctx, fields
+	}
+
+	fields := &Fields{}
+	return context.WithValue(ctx, fieldsKey, fields), fields
+}
+
+// FieldsFromContext returns nil outside of a request, the setters can still be called on it
+func FieldsFromContext(ctx context.Context) *Fields {
+	fields, _ := ctx.Value(fieldsKey).(*Fields)
+	return fields
+}
+
+func (fields *Fields) SetRequestID(id string) {
+	fields.set(func() { fields.requestID = id })
+}
+
+func (fields *Fields) SetRoute(route string) {
+	fields.set(func() { fields.route = route })
+}
+
+func (fields *Fields) SetUserID(id fmt.Stringer) {
+	fields.set(func() { fields.userID = id.String() })
+}
+
+func (fields *Fields) SetTrace(traceID string, spanID string) {
+	fields.set(func() {
+		fields.traceID = traceID
+		fields.spanID = spanID
+	})
+}
+
+func (fields *Fields) SetHTTPRequest(request HTTPRequest) {
+	fields.set(func() { fields.httpRequest = &request })
+}
+
+// SetResponse completes the request with how it was answered, for the access log
+func (fields *Fields) SetResponse(status int, size int64, latency time.Duration) {
+	fields.set(func() {
+		if fields.httpRequest == nil {
+			fields.httpRequest = &HTTPRequest{}
+		}
+
+		fields.httpRequest.Status = status
+		fields.httpRequest.ResponseSize = strconv.FormatInt(size, 10)
+		fields.httpRequest.Latency = strconv.FormatFloat(latency.Seconds(), 'f', -1, 64) + "s"
+	})
+}
+
+func (fields *Fields) RequestID() string {
+	return fields.get(func() string { return fields.requestID })
+}
+
+func (fields *Fields) Route() string {
+	return fields.get(func() string { return fields.route })
+}
+
+func (fields *Fields) get(read func() string) string {
+	if fields == nil {
+		return ""
+	}
+
+	fields.mu.RLock()
+	defer fields.mu.RUnlock()
+
+	return read()
+}
+
+func (fields *Fields) set(update func()) {
+	if fields == nil {
+		return
+	}
+
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+
+	update()
+}
+
+func (fields *Fields) attrs(projectID string) []slog.Attr {
+	fields.mu.RLock()
+	defer fields.mu.RUnlock()
+
+	attrs := []slog.Attr{}
+	if fields.requestID != "" {
+		attrs = append(attrs, slog.String("request_id", fields.requestID))
+	}
+
+	if fields.route != "" {
+		attrs = append(attrs, slog.String("route", fields.route))
+	}
+
+	if fields.userID != "" {
+		attrs = append(attrs, slog.String("user_id", fields.userID))
+	}
+
+	// Cloud Logging only links an entry to its trace when the trace is named with the project
+	if fields.traceID != "" {
+		if projectID != "" {
+			attrs = append(attrs, slog.String(traceKey, fmt.Sprintf("projects/%s/traces/%s", projectID, fields.traceID)))
+		} else {
+			attrs = append(attrs, slog.String("trace_id", fields.traceID))
+		}
+
+		if fields.spanID != "" {
+			attrs = append(attrs, slog.String(spanIDKey, fields.spanID))
+		}
+	}
+
+	if fields.httpRequest != nil {
+		attrs = append(attrs, slog.Any(httpRequestKey, *fields.httpRequest))
+	}
+
+	return attrs
+}
+
+// contextHandler adds the fields of the request to each entry
+type contextHandler struct {
+	slog.Handler
+	projectID string
+}
+
+func (handler *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if fields := FieldsFromContext(ctx); fields != nil {
+		record.AddAttrs(fields.attrs(handler.projectID)...)
+	}
+
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: handler.Handler.WithAttrs(attrs), projectID: handler.projectID}
+}
+
+func (handler *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: handler.Handler.WithGroup(name), projectID: handler.projectID}
+}
+
+// TraceFromHeader reads the trace and span of the request from traceparent, or from X-Cloud-Trace-Context which Cloud Run sets
+func TraceFromHeader(header http.Header) (string, string) {
+	if parts := strings.Split(header.Get("traceparent"), "-"); len(parts) == 4 && len(parts[1]) == 32 && len(parts[2]) == 16 {
+		return parts[1], parts[2]
+	}
+
+	// The format is TRACE_ID/SPAN_ID;o=OPTIONS where the span ID is decimal, Cloud Logging expects it in hex
+	traceID, rest, _ := strings.Cut(header.Get("X-Cloud-Trace-Context"), "/")
+	spanID, _, _ := strings.Cut(rest, ";")
+	if span, err := strconv.ParseUint(spanID, 10, 64); err == nil {
+		return traceID, fmt.Sprintf("%016x", span)
+	}
+
+	return traceID, ""
+}
+
+// RedactURL hides the values of query parameters with sensitive names, such as the token of a magic link
+func RedactURL(u *url.URL) string {
+	redactedURL := *u
+	query := redactedURL.Query()
+
+	// Without the brackets of redacted, which would be escaped
+	for key := range query {
+		if sensitive(key) {
+			query.Set(key, "REDACTED")
+		}
+	}
+
+	redactedURL.RawQuery = query.Encode()
+	return redactedURL.String()
+}
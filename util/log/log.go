@@ -1,22 +1,198 @@
 package log
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"runtime"
+	"strings"
+	"time"
 )
 
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+
+	// LevelCritical is used by Fatalf, which exits once the entry is written
+	LevelCritical = slog.Level(12)
+
+	redacted = "[REDACTED]"
+)
+
+// Keys Cloud Logging reads from JSON entries, see https://cloud.google.com/logging/docs/structured-logging
+const (
+	severityKey       = "severity"
+	messageKey        = "message"
+	sourceLocationKey = "logging.googleapis.com/sourceLocation"
+	traceKey          = "logging.googleapis.com/trace"
+	spanIDKey         = "logging.googleapis.com/spanId"
+	httpRequestKey    = "httpRequest"
+)
+
+// Attributes are redacted when the last word of their key is one of these, so access_token is redacted and token_id isn't
+var sensitiveWords = map[string]bool{
+	"password":      true,
+	"hash":          true,
+	"secret":        true,
+	"token":         true,
+	"authorization": true,
+	"cookie":        true,
+	"code":          true,
+	"verifier":      true,
+	"otp":           true,
+}
+
+type Options struct {
+	Level slog.Level
+	// Format is json for Cloud Logging or text for reading in a terminal
+	Format string
+	// ProjectID is the Google Cloud project, which Cloud Logging needs to link entries to their trace
+	ProjectID string
+	Writer    io.Writer
+}
+
+// Logger writes structured entries through slog. Info, Warn and Error keep the printf style the handlers use,
+// and PrintfContext and Log add the fields of the request, such as its ID, route and user.
 type Logger struct {
-	Info  *log.Logger
-	Warn  *log.Logger
-	Error *log.Logger
+	Info  *Printer
+	Warn  *Printer
+	Error *Printer
 }
 
+type Printer struct {
+	slog  *slog.Logger
+	level slog.Level
+}
+
+// New logs at the info level as JSON to stdout
 func New() *Logger {
-	log := &Logger{
-		Info:  log.New(os.Stdout, "[INFO]: ", log.Ldate|log.Ltime|log.Lshortfile),
-		Warn:  log.New(os.Stdout, "[WARN]: ", log.Ldate|log.Ltime|log.Lshortfile),
-		Error: log.New(os.Stdout, "[ERROR]: ", log.Ldate|log.Ltime|log.Lshortfile),
+	return NewWithOptions(Options{Level: slog.LevelInfo, Format: FormatJSON})
+}
+
+func NewWithOptions(options Options) *Logger {
+	if options.Writer == nil {
+		options.Writer = os.Stdout
 	}
 
-	return log
+	handlerOptions := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       options.Level,
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	if options.Format == FormatText {
+		handler = slog.NewTextHandler(options.Writer, handlerOptions)
+	} else {
+		handlerOptions.ReplaceAttr = cloudLogging
+		handler = slog.NewJSONHandler(options.Writer, handlerOptions)
+	}
+
+	structured := slog.New(&contextHandler{Handler: handler, projectID: options.ProjectID})
+
+	return &Logger{
+		Info:  &Printer{slog: structured, level: slog.LevelInfo},
+		Warn:  &Printer{slog: structured, level: slog.LevelWarn},
+		Error: &Printer{slog: structured, level: slog.LevelError},
+	}
+}
+
+// ParseLevel reads debug, info, warn or error
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(value))
+	return level, err
+}
+
+func (printer *Printer) Printf(format string, args ...any) {
+	printer.log(context.Background(), printer.level, fmt.Sprintf(format, args...))
+}
+
+func (printer *Printer) Println(args ...any) {
+	printer.log(context.Background(), printer.level, fmt.Sprintln(args...))
+}
+
+// PrintfContext is Printf with the fields of the request ctx belongs to
+func (printer *Printer) PrintfContext(ctx context.Context, format string, args ...any) {
+	printer.log(ctx, printer.level, fmt.Sprintf(format, args...))
+}
+
+// Log writes an entry with attributes given as key and value pairs, like slog. Attributes with sensitive names such as
+// password or access_token are redacted.
+func (printer *Printer) Log(ctx context.Context, message string, args ...any) {
+	printer.log(ctx, printer.level, message, args...)
+}
+
+func (printer *Printer) Fatalf(format string, args ...any) {
+	printer.log(context.Background(), LevelCritical, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+func (printer *Printer) log(ctx context.Context, level slog.Level, message string, args ...any) {
+	if !printer.slog.Enabled(ctx, level) {
+		return
+	}
+
+	// The source is the caller of Printf rather than this file
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	// Messages written for the standard logger can end with a newline
+	record := slog.NewRecord(time.Now(), level, strings.TrimSuffix(message, "\n"), pcs[0])
+	record.Add(args...)
+	_ = printer.slog.Handler().Handle(ctx, record)
+}
+
+// cloudLogging renames the attributes Cloud Logging gives a meaning to, along with redacting
+func cloudLogging(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) == 0 {
+		switch attr.Key {
+		case slog.LevelKey:
+			level, _ := attr.Value.Any().(slog.Level)
+			return slog.String(severityKey, severity(level))
+		case slog.MessageKey:
+			attr.Key = messageKey
+		case slog.SourceKey:
+			attr.Key = sourceLocationKey
+		}
+	}
+
+	return redact(groups, attr)
+}
+
+func severity(level slog.Level) string {
+	switch {
+	case level >= LevelCritical:
+		return "CRITICAL"
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindGroup {
+		return attr
+	}
+
+	if sensitive(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+
+	return attr
+}
+
+func sensitive(key string) bool {
+	words := strings.FieldsFunc(strings.ToLower(key), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+
+	return len(words) > 0 && sensitiveWords[words[len(words)-1]]
 }
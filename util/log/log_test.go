@@ -0,0 +1,149 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	logger "github.com/ushiradineth/koano-api/util/log"
+)
+
+func entries(t *testing.T, output *bytes.Buffer) []map[string]any {
+	entries := []map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		entry := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Entry is not JSON: %s", line)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("Cloud Logging fields", func(t *testing.T) {
+		var output bytes.Buffer
+		log := logger.NewWithOptions(logger.Options{Level: slog.LevelInfo, Writer: &output})
+
+		log.Info.Printf("User %s has been created\n", "1")
+		log.Warn.Println("SMTP_HOST is not set")
+		log.Error.Printf("Job failed")
+
+		logged := entries(t, &output)
+		assert.Len(t, logged, 3)
+		assert.Equal(t, "INFO", logged[0]["severity"])
+		assert.Equal(t, "User 1 has been created", logged[0]["message"])
+		assert.Equal(t, "WARNING", logged[1]["severity"])
+		assert.Equal(t, "ERROR", logged[2]["severity"])
+
+		source, _ := logged[0]["logging.googleapis.com/sourceLocation"].(map[string]any)
+		assert.Contains(t, source["file"], "log_test.go", "The source should be the caller")
+	})
+
+	t.Run("Level", func(t *testing.T) {
+		var output bytes.Buffer
+		log := logger.NewWithOptions(logger.Options{Level: slog.LevelWarn, Writer: &output})
+
+		log.Info.Printf("Skipped")
+		log.Warn.Printf("Logged")
+
+		logged := entries(t, &output)
+		assert.Len(t, logged, 1)
+		assert.Equal(t, "Logged", logged[0]["message"])
+	})
+
+	t.Run("Request fields", func(t *testing.T) {
+		var output bytes.Buffer
+		log := logger.NewWithOptions(logger.Options{Level: slog.LevelInfo, ProjectID: "koano", Writer: &output})
+
+		ctx, fields := logger.WithFields(context.Background())
+		userID := uuid.New()
+		fields.SetRequestID("request")
+		fields.SetRoute("GET /users/{user_id}")
+		fields.SetTrace("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+		fields.SetHTTPRequest(logger.HTTPRequest{RequestMethod: http.MethodGet, RequestURL: "/api/v1/users/1"})
+
+		// Set after the context is passed on, like the user once they are authenticated
+		logger.FieldsFromContext(ctx).SetUserID(userID)
+
+		log.Info.PrintfContext(ctx, "User has been retrieved")
+		log.Info.Printf("Outside of the request")
+
+		logged := entries(t, &output)
+		assert.Equal(t, "request", logged[0]["request_id"])
+		assert.Equal(t, "GET /users/{user_id}", logged[0]["route"])
+		assert.Equal(t, userID.String(), logged[0]["user_id"])
+		assert.Equal(t, "projects/koano/traces/4bf92f3577b34da6a3ce929d0e0e4736", logged[0]["logging.googleapis.com/trace"])
+		assert.Equal(t, "00f067aa0ba902b7", logged[0]["logging.googleapis.com/spanId"])
+		assert.Equal(t, map[string]any{"requestMethod": "GET", "requestUrl": "/api/v1/users/1"}, logged[0]["httpRequest"])
+		assert.NotContains(t, logged[1], "request_id")
+
+		// Fields are only created once per request
+		sameCtx, sameFields := logger.WithFields(ctx)
+		assert.Equal(t, ctx, sameCtx)
+		assert.Same(t, fields, sameFields)
+
+		// Setting fields outside of a request does nothing
+		logger.FieldsFromContext(context.Background()).SetRoute("GET /")
+	})
+}
+
+func TestRedaction(t *testing.T) {
+	var output bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Level: slog.LevelInfo, Writer: &output})
+
+	log.Info.Log(context.Background(), "Signed in",
+		"email", "user@koano.app",
+		"password", "hunter2",
+		"access_token", "eyJ",
+		"Set-Cookie", "session=secret",
+		"token_id", "1",
+		slog.Group("client", "client_secret", "secret"),
+	)
+
+	logged := entries(t, &output)[0]
+	assert.Equal(t, "user@koano.app", logged["email"])
+	assert.Equal(t, "[REDACTED]", logged["password"])
+	assert.Equal(t, "[REDACTED]", logged["access_token"])
+	assert.Equal(t, "[REDACTED]", logged["Set-Cookie"])
+	assert.Equal(t, "1", logged["token_id"], "Only the last word of the key should decide")
+	assert.Equal(t, map[string]any{"client_secret": "[REDACTED]"}, logged["client"])
+
+	var text bytes.Buffer
+	textLog := logger.NewWithOptions(logger.Options{Level: slog.LevelInfo, Format: logger.FormatText, Writer: &text})
+	textLog.Info.Log(context.Background(), "Text", "password", "hunter2")
+	assert.Contains(t, text.String(), "msg=Text")
+	assert.Contains(t, text.String(), "password=[REDACTED]")
+
+	u, _ := url.Parse("/api/v1/auth/magic-link/consume?token=secret&redirect=%2Fcalendar")
+	assert.Equal(t, "/api/v1/auth/magic-link/consume?redirect=%2Fcalendar&token=REDACTED", logger.RedactURL(u))
+}
+
+func TestTraceFromHeader(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	traceID, spanID := logger.TraceFromHeader(header)
+	assert.Equal(t, "105445aa7843bc8bf206b12000100000", traceID)
+	assert.Equal(t, "0000000000000001", spanID)
+
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	traceID, spanID = logger.TraceFromHeader(header)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID, "traceparent should take precedence")
+	assert.Equal(t, "00f067aa0ba902b7", spanID)
+
+	traceID, spanID = logger.TraceFromHeader(http.Header{})
+	assert.Empty(t, traceID)
+	assert.Empty(t, spanID)
+}
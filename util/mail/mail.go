@@ -0,0 +1,124 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+
+	logger "github.com/ushiradineth/koano-api/util/log"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+type Options struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// New returns an SMTP mailer when a host is set, otherwise a mailer that writes messages to the log
+func New(options Options, log *logger.Logger) Mailer {
+	if options.Host == "" {
+		log.Warn.Println("SMTP_HOST is not set or empty. Emails will be written to the log.")
+		return NewLogMailer(log)
+	}
+
+	log.Info.Printf("SMTP Host: %s", options.Host)
+	return NewSMTPMailer(options.Host, strconv.Itoa(options.Port), options.Username, options.Password, options.From)
+}
+
+type LogMailer struct {
+	log *logger.Logger
+}
+
+func NewLogMailer(log *logger.Logger) *LogMailer {
+	return &LogMailer{
+		log: log,
+	}
+}
+
+func (m *LogMailer) Send(to string, subject string, body string) error {
+	m.log.Info.Printf("Mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (m *SMTPMailer) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	message := strings.Join([]string{
+		fmt.Sprintf("From: %s", m.from),
+		fmt.Sprintf("To: %s", to),
+		fmt.Sprintf("Subject: %s", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"utf-8\"",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(fmt.Sprintf("%s:%s", m.host, m.port), auth, m.from, []string{to}, []byte(message))
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// MemoryMailer keeps sent messages in memory so tests can read the links they contain
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(to string, subject string, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, Message{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+// Last returns the latest message sent to the address
+func (m *MemoryMailer) Last(to string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i], true
+		}
+	}
+
+	return Message{}, false
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "koano"
+
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	// OutcomeSkipped is a scheduled job run which another instance was already running
+	OutcomeSkipped = "skipped"
+
+	// RouteUnmatched labels requests which didn't match a route, so scanners can't create a series per path
+	RouteUnmatched = "unmatched"
+)
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Requests handled, by route pattern and status class.",
+	}, []string{"method", "route", "status_class"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to answer requests, by route pattern and status class.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "route", "status_class"})
+
+	HTTPRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Requests being handled.",
+	})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "logins_total",
+		Help:      "Sign ins, by method such as password or passkey and outcome.",
+	}, []string{"method", "outcome"})
+
+	Refreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "refreshes_total",
+		Help:      "Access token refreshes, by outcome.",
+	}, []string{"outcome"})
+
+	Lockouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "lockouts_total",
+		Help:      "Sign in lockouts after too many failed attempts, by account or IP.",
+	}, []string{"scope"})
+
+	EventsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_created_total",
+		Help:      "Events created by users.",
+	})
+
+	ActiveUsers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_users",
+		Help:      "Users who haven't deleted their account or been disabled, updated every minute.",
+	})
+
+	WorkerJobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "job_runs_total",
+		Help:      "Runs of scheduled jobs, by job and outcome. Runs are skipped while another instance holds the lock of the job.",
+	}, []string{"job", "outcome"})
+
+	WorkerJobLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "job_last_success_timestamp_seconds",
+		Help:      "Unix time a scheduled job last succeeded on this instance, alert on the newest across instances to catch stalled jobs.",
+	}, []string{"job"})
+)
+
+func init() {
+	prometheus.MustRegister(HTTPRequests, HTTPRequestDuration, HTTPRequestsInFlight, Logins, Refreshes, Lockouts, EventsCreated, ActiveUsers, WorkerJobRuns, WorkerJobLastSuccess)
+}
+
+// Handler serves the metrics in the Prometheus format, along with the Go runtime and process metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterDB exposes the connection pool stats of db, such as open, idle and waiting connections
+func RegisterDB(db *sqlx.DB, name string) error {
+	err := prometheus.Register(collectors.NewDBStatsCollector(db.DB, name))
+
+	// The pool is already exposed when the API has been set up before, as in tests
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		return nil
+	}
+
+	return err
+}
+
+func ObserveRequest(method string, route string, status int, duration time.Duration) {
+	statusClass := StatusClass(status)
+	HTTPRequests.WithLabelValues(method, route, statusClass).Inc()
+	HTTPRequestDuration.WithLabelValues(method, route, statusClass).Observe(duration.Seconds())
+}
+
+// StatusClass groups statuses such as 404 into 4xx, which keeps the number of series down
+func StatusClass(status int) string {
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+func Login(method string, outcome string) {
+	Logins.WithLabelValues(method, outcome).Inc()
+}
+
+func Refresh(outcome string) {
+	Refreshes.WithLabelValues(outcome).Inc()
+}
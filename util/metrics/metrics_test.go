@@ -0,0 +1,28 @@
+package metrics_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/util/metrics"
+)
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", metrics.StatusClass(http.StatusCreated))
+	assert.Equal(t, "4xx", metrics.StatusClass(http.StatusNotFound))
+	assert.Equal(t, "4xx", metrics.StatusClass(499))
+	assert.Equal(t, "5xx", metrics.StatusClass(http.StatusServiceUnavailable))
+}
+
+func TestObserveRequest(t *testing.T) {
+	route := "GET /test/{id}"
+	before := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, "4xx"))
+
+	metrics.ObserveRequest(http.MethodGet, route, http.StatusNotFound, 20*time.Millisecond)
+	metrics.ObserveRequest(http.MethodGet, route, http.StatusBadRequest, 30*time.Millisecond)
+
+	assert.Equal(t, before+2, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, "4xx")))
+}
@@ -0,0 +1,404 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/sync/singleflight"
+)
+
+// The JWKS is refetched at most this often for unknown key IDs, so tokens with made up key IDs can't make every login fetch it
+const jwksRefetchInterval = time.Minute
+
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+type Provider struct {
+	config Config
+	client *http.Client
+
+	// Concurrent callers share a single discovery or JWKS request
+	fetches   singleflight.Group
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	return &Provider{
+		config: config,
+		client: client,
+	}
+}
+
+func NewProviders(configs []Config, client *http.Client) map[string]*Provider {
+	providers := map[string]*Provider{}
+	for _, config := range configs {
+		providers[config.Name] = NewProvider(config, client)
+	}
+
+	return providers
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthorizationURL builds the URL the user is sent to, using the authorization code flow with a S256 PKCE challenge
+func (p *Provider) AuthorizationURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         []string{"code"},
+		"client_id":             []string{p.config.ClientID},
+		"redirect_uri":          []string{p.config.RedirectURL},
+		"scope":                 []string{strings.Join(p.config.Scopes, " ")},
+		"state":                 []string{state},
+		"nonce":                 []string{nonce},
+		"code_challenge":        []string{codeChallenge},
+		"code_challenge_method": []string{"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string) (*TokenResponse, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    []string{"authorization_code"},
+		"code":          []string{code},
+		"redirect_uri":  []string{p.config.RedirectURL},
+		"client_id":     []string{p.config.ClientID},
+		"code_verifier": []string{codeVerifier},
+	}
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokenResponse TokenResponse
+	if err := p.do(req, &tokenResponse); err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+
+	if tokenResponse.IDToken == "" {
+		return nil, errors.New("token response did not include an id_token")
+	}
+
+	return &tokenResponse, nil
+}
+
+// VerifyIDToken checks the signature against the provider's JWKS along with the issuer, audience, expiry and nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*IDTokenClaims, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != discovery.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %s", claims.Issuer)
+	}
+
+	if !slices.Contains(claims.Audience, p.config.ClientID) {
+		return nil, errors.New("id token was not issued for this client")
+	}
+
+	if claims.Nonce != nonce {
+		return nil, errors.New("nonce does not match")
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("id token is missing the subject")
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	discovery := p.discovery
+	p.mu.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	// The request is shared, so it isn't cancelled with the caller which happens to make it
+	result, err, _ := p.fetches.Do("discovery", func() (interface{}, error) {
+		return p.discover(context.WithoutCancel(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*Discovery), nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*Discovery, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery Discovery
+	if err := p.do(req, &discovery); err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+
+	if discovery.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovered issuer %s does not match %s", discovery.Issuer, p.config.Issuer)
+	}
+
+	p.mu.Lock()
+	p.discovery = &discovery
+	p.mu.Unlock()
+
+	return &discovery, nil
+}
+
+// key returns the signing key by ID, refetching the JWKS when the key is unknown to pick up rotated keys. Refetches are shared
+// between concurrent callers and happen at most once every jwksRefetchInterval.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	recent := time.Since(p.fetchedAt) < jwksRefetchInterval
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	if !recent {
+		if _, err, _ := p.fetches.Do("jwks", func() (interface{}, error) {
+			return nil, p.fetchKeys(context.WithoutCancel(ctx))
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	p.mu.Lock()
+	key, ok = p.keys[kid]
+	p.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("signing key %s not found", kid)
+	}
+
+	return key, nil
+}
+
+// fetchKeys replaces the keys with those of the JWKS, unless another caller has just fetched it
+func (p *Provider) fetchKeys(ctx context.Context) error {
+	p.mu.Lock()
+	recent := time.Since(p.fetchedAt) < jwksRefetchInterval
+	p.mu.Unlock()
+	if recent {
+		return nil
+	}
+
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.do(req, &jwks); err != nil {
+		return fmt.Errorf("fetching jwks failed: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %d: %s", req.URL.Host, res.StatusCode, body)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+type IDTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+func (c *IDTokenClaims) Valid() error {
+	now := time.Now().Unix()
+	if c.ExpiresAt == 0 || now > c.ExpiresAt {
+		return errors.New("id token is expired")
+	}
+
+	// Allow for a little clock skew between us and the provider
+	if c.IssuedAt > now+60 {
+		return errors.New("id token is used before issued")
+	}
+
+	return nil
+}
+
+// audience accepts both the single string and array forms of the aud claim
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+
+	*a = multiple
+	return nil
+}
+
+// flexBool accepts "true" as well as true, since some providers send email_verified as a string
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	*b = flexBool(strings.Trim(string(data), `"`) == "true")
+	return nil
+}
+
+// NewPKCE returns a code verifier and its S256 code challenge
+func NewPKCE() (string, string, error) {
+	verifier, err := RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func RandomString(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
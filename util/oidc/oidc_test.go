@@ -0,0 +1,131 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/util/oidc"
+	"github.com/ushiradineth/koano-api/util/test"
+)
+
+func newProvider(server *test.MockOIDCServer, clientID string) *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Name:        "mock",
+		Issuer:      server.URL,
+		ClientID:    clientID,
+		RedirectURL: "http://localhost:3000/auth/callback/mock",
+		Scopes:      []string{"openid", "email"},
+	}, http.DefaultClient)
+}
+
+func login(t *testing.T, server *test.MockOIDCServer, provider *oidc.Provider, nonce string) (*oidc.IDTokenClaims, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	verifier, challenge, err := oidc.NewPKCE()
+	assert.NoError(t, err)
+
+	authorizationURL, err := provider.AuthorizationURL(ctx, "state", nonce, challenge)
+	assert.NoError(t, err)
+
+	code, state, err := server.Authorize(authorizationURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "state", state)
+
+	tokenResponse, err := provider.Exchange(ctx, code, verifier)
+	assert.NoError(t, err)
+
+	return provider.VerifyIDToken(ctx, tokenResponse.IDToken, nonce)
+}
+
+func TestLogin(t *testing.T) {
+	server := test.NewMockOIDCServer("koano")
+	defer server.Close()
+
+	server.Claims = jwt.MapClaims{
+		"sub":            "subject",
+		"email":          "user@example.com",
+		"email_verified": "true",
+		"name":           "Mock User",
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		claims, err := login(t, server, newProvider(server, "koano"), "nonce")
+		assert.NoError(t, err)
+		assert.Equal(t, "subject", claims.Subject)
+		assert.Equal(t, "user@example.com", claims.Email)
+		assert.True(t, bool(claims.EmailVerified))
+		assert.Equal(t, "Mock User", claims.Name)
+	})
+
+	t.Run("Nonce does not match", func(t *testing.T) {
+		ctx := context.Background()
+		provider := newProvider(server, "koano")
+
+		verifier, challenge, _ := oidc.NewPKCE()
+		authorizationURL, _ := provider.AuthorizationURL(ctx, "state", "nonce", challenge)
+		code, _, _ := server.Authorize(authorizationURL)
+		tokenResponse, err := provider.Exchange(ctx, code, verifier)
+		assert.NoError(t, err)
+
+		_, err = provider.VerifyIDToken(ctx, tokenResponse.IDToken, "other-nonce")
+		assert.Error(t, err)
+	})
+
+	t.Run("Code verifier does not match", func(t *testing.T) {
+		ctx := context.Background()
+		provider := newProvider(server, "koano")
+
+		_, challenge, _ := oidc.NewPKCE()
+		authorizationURL, _ := provider.AuthorizationURL(ctx, "state", "nonce", challenge)
+		code, _, _ := server.Authorize(authorizationURL)
+
+		otherVerifier, _, _ := oidc.NewPKCE()
+		_, err := provider.Exchange(ctx, code, otherVerifier)
+		assert.Error(t, err)
+	})
+
+	t.Run("Audience does not match", func(t *testing.T) {
+		ctx := context.Background()
+		provider := newProvider(server, "koano")
+		otherProvider := newProvider(server, "other")
+
+		verifier, challenge, _ := oidc.NewPKCE()
+		authorizationURL, _ := provider.AuthorizationURL(ctx, "state", "nonce", challenge)
+		code, _, _ := server.Authorize(authorizationURL)
+		tokenResponse, err := provider.Exchange(ctx, code, verifier)
+		assert.NoError(t, err)
+
+		_, err = otherProvider.VerifyIDToken(ctx, tokenResponse.IDToken, "nonce")
+		assert.Error(t, err)
+	})
+
+	t.Run("Token is expired", func(t *testing.T) {
+		server.Claims["exp"] = time.Now().Add(-time.Minute).Unix()
+		defer delete(server.Claims, "exp")
+
+		_, err := login(t, server, newProvider(server, "koano"), "nonce")
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown key doesn't refetch the JWKS more than once a minute", func(t *testing.T) {
+		provider := newProvider(server, "koano")
+
+		_, err := login(t, server, provider, "nonce")
+		assert.NoError(t, err)
+		fetched := server.JWKSRequests.Load()
+
+		server.KeyID = "unknown"
+		defer func() { server.KeyID = "mock" }()
+
+		for range 3 {
+			_, err = login(t, server, provider, "nonce")
+			assert.Error(t, err)
+		}
+		assert.Equal(t, fetched, server.JWKSRequests.Load())
+	})
+}
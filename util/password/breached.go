@@ -0,0 +1,150 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachedList looks passwords up in a local copy of the Pwned Passwords SHA-1 list, so no part of a password leaves the server.
+//
+// The path is either a directory of range files named by the first 5 characters of the hash (ABCDE.txt) holding SUFFIX:COUNT lines,
+// which is the k-anonymity layout of the range API, or a single file of HASH:COUNT lines sorted by hash, as the list is downloaded.
+type BreachedList struct {
+	path string
+}
+
+func NewBreachedList(path string) *BreachedList {
+	return &BreachedList{path: path}
+}
+
+// Count returns how many times the password has appeared in breaches, zero when it hasn't
+func (b *BreachedList) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return 0, err
+	}
+
+	if info.IsDir() {
+		return countInRange(filepath.Join(b.path, hash[:5]+".txt"), hash[5:])
+	}
+
+	return countInSortedFile(b.path, hash)
+}
+
+func countInRange(path string, suffix string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		// A prefix without a range file has no breached passwords
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if lineSuffix, count, ok := parseHashLine(scanner.Text()); ok && lineSuffix == suffix {
+			return count, nil
+		}
+	}
+
+	return 0, scanner.Err()
+}
+
+// countInSortedFile binary searches the file by byte offset, so the multi gigabyte full list doesn't need to be loaded
+func countInSortedFile(path string, hash string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+
+	// Finds the offset of the first line whose hash isn't less than the one looked up
+	low, high := int64(0), size
+	for low < high {
+		middle := low + (high-low)/2
+
+		line, next, err := lineFrom(file, middle, size)
+		if err != nil {
+			return 0, err
+		}
+
+		if lineHash, _, ok := parseHashLine(line); ok && lineHash < hash && next > middle {
+			low = next
+		} else {
+			high = middle
+		}
+	}
+
+	line, _, err := lineFrom(file, low, size)
+	if err != nil {
+		return 0, err
+	}
+
+	if lineHash, count, ok := parseHashLine(line); ok && lineHash == hash {
+		return count, nil
+	}
+
+	return 0, nil
+}
+
+// lineFrom reads the first line starting at or after the offset, returning it with the offset of the line after it
+func lineFrom(file io.ReaderAt, offset int64, size int64) (string, int64, error) {
+	start := offset
+	if offset > 0 {
+		// Starting a byte early tells whether the offset is already at the start of a line
+		start = offset - 1
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, start, size-start))
+
+	if offset > 0 {
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return "", size, nil
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+
+	return strings.TrimRight(line, "\r\n"), start + int64(len(line)), nil
+}
+
+func parseHashLine(line string) (string, int, bool) {
+	hash, rawCount, found := strings.Cut(strings.TrimSpace(line), ":")
+	if !found {
+		return "", 0, false
+	}
+
+	count, err := strconv.Atoi(rawCount)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return strings.ToUpper(hash), count, true
+}
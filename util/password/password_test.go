@@ -0,0 +1,171 @@
+package password_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/util/password"
+)
+
+func hashPassword(plain string) string {
+	sum := sha1.Sum([]byte(plain))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func codes(violations []password.Violation) []string {
+	codes := []string{}
+	for _, violation := range violations {
+		codes = append(codes, violation.Code)
+	}
+	return codes
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := password.DefaultPolicy
+
+	tests := []struct {
+		name       string
+		password   string
+		userInputs []string
+		expected   []string
+	}{
+		{name: "Valid", password: "UPlow1234!@#", expected: []string{}},
+		{name: "Passphrase longer than 20 characters", password: "Correct-Horse-Battery-Staple-9", expected: []string{}},
+		{name: "Too short", password: "Ab1!xyz", expected: []string{password.ViolationTooShort}},
+		{name: "Too long", password: strings.Repeat("Ab1!", 33), expected: []string{password.ViolationTooLong}},
+		{name: "Missing classes", password: "zqxjkvbwmpfh", expected: []string{password.ViolationMissingUppercase, password.ViolationMissingDigit, password.ViolationMissingSpecial}},
+		{name: "Common password", password: "Password1!", expected: []string{password.ViolationTooWeak}},
+		{name: "Leet common password", password: "P@ssw0rd!1", expected: []string{password.ViolationTooWeak}},
+		{name: "Contains user input", password: "Ushiradineth1!", userInputs: []string{"Ushira Dineth", "ushiradineth@koano.app"}, expected: []string{password.ViolationTooWeak}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			violations, err := policy.Check(tc.password, tc.userInputs...)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, codes(violations))
+		})
+	}
+
+	t.Run("Classes are optional", func(t *testing.T) {
+		relaxed := password.Policy{MinLength: 12, MinStrength: 3}
+
+		violations, err := relaxed.Check("purple tulips dance slowly")
+		assert.NoError(t, err)
+		assert.Empty(t, violations)
+	})
+}
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		minScore int
+		maxScore int
+	}{
+		{password: "password", minScore: 0, maxScore: 0},
+		{password: "aaaaaaaaaa", minScore: 0, maxScore: 0},
+		{password: "abcdefgh", minScore: 0, maxScore: 0},
+		{password: "87654321", minScore: 0, maxScore: 0},
+		{password: "qwertyuiop", minScore: 0, maxScore: 1},
+		{password: "Tr0ub4dor&3", minScore: 2, maxScore: 4},
+		{password: "UPlow1234!@#", minScore: 3, maxScore: 4},
+		{password: "correct horse battery staple", minScore: 4, maxScore: 4},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.password, func(t *testing.T) {
+			score := password.Strength(tc.password)
+			assert.GreaterOrEqual(t, score, tc.minScore)
+			assert.LessOrEqual(t, score, tc.maxScore)
+		})
+	}
+
+	t.Run("Long input is bounded", func(t *testing.T) {
+		assert.Equal(t, 4, password.Strength(strings.Repeat("xK7#", 1000)))
+	})
+}
+
+func TestBreachedList(t *testing.T) {
+	breached := map[string]int{
+		"UPlow1234!@#": 3,
+		"P@ssw0rd":     52000,
+		"hunter2":      17000,
+	}
+
+	lines := []string{}
+	for plain, count := range breached {
+		lines = append(lines, fmt.Sprintf("%s:%d", hashPassword(plain), count))
+	}
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("%s:%d", hashPassword(fmt.Sprintf("filler-%d", i)), i+1))
+	}
+	sort.Strings(lines)
+
+	t.Run("Sorted file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+		assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600))
+
+		list := password.NewBreachedList(path)
+		for plain, want := range breached {
+			count, err := list.Count(plain)
+			assert.NoError(t, err)
+			assert.Equal(t, want, count, plain)
+		}
+
+		for _, plain := range []string{"filler-0", "filler-199"} {
+			count, err := list.Count(plain)
+			assert.NoError(t, err)
+			assert.NotZero(t, count, plain)
+		}
+
+		count, err := list.Count("not breached at all")
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("Range directory", func(t *testing.T) {
+		dir := t.TempDir()
+		ranges := map[string][]string{}
+		for _, line := range lines {
+			ranges[line[:5]] = append(ranges[line[:5]], line[5:])
+		}
+		for prefix, suffixes := range ranges {
+			assert.NoError(t, os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(strings.Join(suffixes, "\n")), 0o600))
+		}
+
+		list := password.NewBreachedList(dir)
+		for plain, want := range breached {
+			count, err := list.Count(plain)
+			assert.NoError(t, err)
+			assert.Equal(t, want, count, plain)
+		}
+
+		count, err := list.Count("not breached at all")
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("Missing list is an error", func(t *testing.T) {
+		_, err := password.NewBreachedList(filepath.Join(t.TempDir(), "missing.txt")).Count("hunter2")
+		assert.Error(t, err)
+	})
+
+	t.Run("Policy reports breached passwords", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "breached.txt")
+		assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600))
+
+		policy := password.DefaultPolicy
+		policy.Breached = password.NewBreachedList(path)
+
+		violations, err := policy.Check("UPlow1234!@#")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{password.ViolationBreached}, codes(violations))
+	})
+}
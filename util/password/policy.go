@@ -0,0 +1,112 @@
+package password
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	ViolationTooShort         = "too_short"
+	ViolationTooLong          = "too_long"
+	ViolationMissingLowercase = "missing_lowercase"
+	ViolationMissingUppercase = "missing_uppercase"
+	ViolationMissingDigit     = "missing_digit"
+	ViolationMissingSpecial   = "missing_special_character"
+	ViolationTooWeak          = "too_weak"
+	ViolationBreached         = "breached"
+)
+
+// Violation is a reason a password was rejected, the code is stable for clients to translate
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Policy is applied when a password is set or changed. Logins only compare against the stored hash, so tightening the policy doesn't lock anyone out.
+type Policy struct {
+	MinLength int
+	// MaxLength is in bytes, which is what hashing cost and bcrypt's 72 byte limit depend on
+	MaxLength        int
+	RequireLowercase bool
+	RequireUppercase bool
+	RequireDigit     bool
+	RequireSpecial   bool
+	// MinStrength is the lowest accepted score from Strength, between 0 and 4
+	MinStrength int
+	// Breached is checked when set
+	Breached *BreachedList
+}
+
+var DefaultPolicy = Policy{
+	MinLength:        8,
+	MaxLength:        128,
+	RequireLowercase: true,
+	RequireUppercase: true,
+	RequireDigit:     true,
+	RequireSpecial:   true,
+	MinStrength:      2,
+}
+
+// Check returns every rule the password breaks. The user inputs, such as the name and email, count against the strength of passwords containing them.
+// An error is only returned when the breached password list can't be read.
+func (p Policy) Check(password string, userInputs ...string) ([]Violation, error) {
+	violations := []Violation{}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{ViolationTooShort, fmt.Sprintf("password must be at least %d characters long", p.MinLength)})
+	}
+
+	// Nothing else is checked so an oversized password can't make the strength estimate expensive
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, Violation{ViolationTooLong, fmt.Sprintf("password can't be longer than %d bytes", p.MaxLength)})
+		return violations, nil
+	}
+
+	var hasLowercase, hasUppercase, hasDigit, hasSpecial bool
+	for _, char := range password {
+		switch {
+		case unicode.IsLower(char):
+			hasLowercase = true
+		case unicode.IsUpper(char):
+			hasUppercase = true
+		case unicode.IsDigit(char):
+			hasDigit = true
+		case unicode.IsPunct(char) || unicode.IsSymbol(char):
+			hasSpecial = true
+		}
+	}
+
+	if p.RequireLowercase && !hasLowercase {
+		violations = append(violations, Violation{ViolationMissingLowercase, "password must contain at least one lowercase character"})
+	}
+
+	if p.RequireUppercase && !hasUppercase {
+		violations = append(violations, Violation{ViolationMissingUppercase, "password must contain at least one uppercase character"})
+	}
+
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, Violation{ViolationMissingDigit, "password must contain at least one digit"})
+	}
+
+	if p.RequireSpecial && !hasSpecial {
+		violations = append(violations, Violation{ViolationMissingSpecial, "password must contain at least one special character"})
+	}
+
+	if score := Strength(password, userInputs...); score < p.MinStrength {
+		violations = append(violations, Violation{ViolationTooWeak, fmt.Sprintf("password is too easy to guess, it scored %d out of 4 and needs at least %d", score, p.MinStrength)})
+	}
+
+	if p.Breached != nil {
+		count, err := p.Breached.Count(password)
+		if err != nil {
+			return nil, err
+		}
+
+		if count > 0 {
+			violations = append(violations, Violation{ViolationBreached, fmt.Sprintf("password has appeared in %d data breaches", count)})
+		}
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,202 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords are ranked by how early an attacker would try them
+var commonPasswords = []string{
+	"password", "123456", "qwerty", "letmein", "welcome", "admin", "iloveyou", "monkey", "dragon", "football",
+	"baseball", "sunshine", "princess", "shadow", "master", "superman", "michael", "login", "abc123", "trustno1",
+	"hello", "freedom", "whatever", "qazwsx", "starwars", "secret", "computer", "internet", "changeme", "default",
+	"summer", "winter", "spring", "autumn", "love", "pass", "test", "user", "guest", "root",
+	"charlie", "jordan", "hunter", "ranger", "buster", "soccer", "hockey", "killer", "batman", "thomas",
+	"tigger", "robert", "access", "flower", "cookie", "orange", "pepper", "cheese", "ginger", "silver",
+	"koano", "calendar", "schedule", "event",
+}
+
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+	"~!@#$%^&*()_+", "qwertyuiop{}|", "asdfghjkl:\"", "zxcvbnm<>?",
+	"qaz", "wsx", "edc", "rfv", "tgb", "yhn", "ujm",
+}
+
+// maxMatchLength bounds the work per character, longer repeats and sequences are matched in pieces
+const maxMatchLength = 32
+
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '3': 'e', '1': 'i', '!': 'i', '0': 'o', '5': 's', '$': 's', '7': 't', '+': 't',
+}
+
+// Strength scores how guessable a password is from 0 (too guessable) to 4 (very unguessable), using the thresholds of zxcvbn
+func Strength(password string, userInputs ...string) int {
+	guesses := EstimateGuesses(password, userInputs...)
+
+	switch {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// EstimateGuesses finds the cheapest way to build the password out of dictionary words, user inputs, repeats, sequences,
+// keyboard walks and single characters, in the spirit of zxcvbn
+func EstimateGuesses(password string, userInputs ...string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 1
+	}
+
+	// Lowered rune by rune so indexes line up with the password
+	lower := make([]rune, len(runes))
+	unleet := make([]rune, len(runes))
+	for i, char := range runes {
+		lower[i] = unicode.ToLower(char)
+		unleet[i] = lower[i]
+		if substitute, ok := leetSubstitutions[lower[i]]; ok {
+			unleet[i] = substitute
+		}
+	}
+
+	dictionary := map[string]float64{}
+	for rank, word := range commonPasswords {
+		dictionary[word] = float64(rank + 1)
+	}
+	for _, input := range userInputs {
+		for _, part := range strings.FieldsFunc(strings.ToLower(input), func(char rune) bool {
+			return !unicode.IsLetter(char) && !unicode.IsDigit(char)
+		}) {
+			if len([]rune(part)) >= 3 {
+				dictionary[part] = 1
+			}
+		}
+	}
+
+	// best[i] is the fewest guesses needed for the first i characters
+	best := make([]float64, len(runes)+1)
+	for i := range best {
+		best[i] = math.Inf(1)
+	}
+	best[0] = 1
+
+	relax := func(from int, to int, guesses float64) {
+		if candidate := best[from] * math.Max(guesses, 1); candidate < best[to] {
+			best[to] = candidate
+		}
+	}
+
+	for i := 0; i < len(runes); i++ {
+		relax(i, i+1, cardinality(runes[i]))
+
+		for j := i + 3; j <= len(runes) && j-i <= maxMatchLength; j++ {
+			segment := runes[i:j]
+
+			if rank, ok := dictionary[string(lower[i:j])]; ok {
+				relax(i, j, math.Max(rank*uppercaseVariations(segment), 10))
+			}
+
+			if rank, ok := dictionary[string(unleet[i:j])]; ok && string(unleet[i:j]) != string(lower[i:j]) {
+				relax(i, j, math.Max(rank*uppercaseVariations(segment)*2, 10))
+			}
+
+			if isRepeat(segment) {
+				relax(i, j, cardinality(segment[0])*float64(len(segment)))
+			}
+
+			if isSequence(segment) {
+				base := cardinality(segment[0])
+				if strings.ContainsRune("aAzZ019", segment[0]) {
+					base = 4
+				}
+				relax(i, j, base*float64(len(segment)))
+			}
+
+			if len(segment) >= 4 && isKeyboardWalk(string(lower[i:j])) {
+				relax(i, j, 100*float64(len(segment)))
+			}
+		}
+	}
+
+	return best[len(runes)]
+}
+
+func cardinality(char rune) float64 {
+	switch {
+	case unicode.IsDigit(char):
+		return 10
+	case unicode.IsLower(char), unicode.IsUpper(char):
+		return 26
+	case char < unicode.MaxASCII:
+		return 33
+	default:
+		return 100
+	}
+}
+
+// uppercaseVariations counts the capitalisations an attacker would try, an all lowercase or only first letter capitalised word costs little extra
+func uppercaseVariations(segment []rune) float64 {
+	var upper, lower int
+	for _, char := range segment {
+		if unicode.IsUpper(char) {
+			upper++
+		} else if unicode.IsLower(char) {
+			lower++
+		}
+	}
+
+	if upper == 0 {
+		return 1
+	}
+
+	if lower == 0 || (upper == 1 && unicode.IsUpper(segment[0])) {
+		return 2
+	}
+
+	return math.Pow(2, float64(upper+lower)) / 2
+}
+
+func isRepeat(segment []rune) bool {
+	for _, char := range segment[1:] {
+		if char != segment[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func isSequence(segment []rune) bool {
+	delta := segment[1] - segment[0]
+	if delta != 1 && delta != -1 {
+		return false
+	}
+
+	for i := 2; i < len(segment); i++ {
+		if segment[i]-segment[i-1] != delta {
+			return false
+		}
+	}
+	return true
+}
+
+func isKeyboardWalk(segment string) bool {
+	reversed := []rune(segment)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+
+	for _, row := range keyboardRows {
+		if strings.Contains(row, segment) || strings.Contains(row, string(reversed)) {
+			return true
+		}
+	}
+	return false
+}
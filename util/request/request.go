@@ -0,0 +1,34 @@
+package request
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustProxy is set from the validated config on startup
+var trustProxy bool
+
+// SetTrustProxy sets whether requests arrive through a proxy, such as on Cloud Run
+func SetTrustProxy(trust bool) {
+	trustProxy = trust
+}
+
+// ClientIP returns the address of the caller. Behind a proxy the rightmost X-Forwarded-For entry is used
+// since it is the one appended by the proxy and can't be spoofed by the client.
+func ClientIP(r *http.Request) string {
+	if trustProxy {
+		forwardedFor := r.Header.Get("X-Forwarded-For")
+		if forwardedFor != "" {
+			parts := strings.Split(forwardedFor, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -1,19 +1,43 @@
 package response
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
+	"github.com/ushiradineth/koano-api/util/password"
 	validatorUtil "github.com/ushiradineth/koano-api/util/validator"
 )
 
+// StatusClientClosedRequest is the nginx convention for a request the client gave up on before the response
+const StatusClientClosedRequest = 499
+
+// Postgres cancels a statement with query_canceled both when it runs past statement_timeout and when the context of the query is done
+const queryCanceled = "57014"
+
+// GenericServerError answers requests whose context was cancelled or ran out of time with 499 and 503, which unlike a 500 don't point at a bug
 func GenericServerError(w http.ResponseWriter, err error) {
-	HTTPError(w, http.StatusInternalServerError, err.Error(), StatusError)
+	var sqlErr interface{ SQLState() string }
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		HTTPError(w, StatusClientClosedRequest, "Request has been cancelled", StatusFail)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &sqlErr) && sqlErr.SQLState() == queryCanceled:
+		HTTPError(w, http.StatusServiceUnavailable, "Request has timed out", StatusError)
+	default:
+		HTTPError(w, http.StatusInternalServerError, err.Error(), StatusError)
+	}
 }
 
 func GenericValidationError(w http.ResponseWriter, err error) {
 	HTTPError(w, http.StatusBadRequest, validatorUtil.ValidationError(err), StatusFail)
 }
 
+// GenericPasswordPolicyError lists every rule the password broke, each with a code clients can translate
+func GenericPasswordPolicyError(w http.ResponseWriter, violations []password.Violation) {
+	HTTPError(w, http.StatusBadRequest, violations, StatusFail)
+}
+
 func GenericBadRequestError(w http.ResponseWriter, err error) {
 	HTTPError(w, http.StatusBadRequest, err.Error(), StatusFail)
 }
@@ -21,3 +45,7 @@ func GenericBadRequestError(w http.ResponseWriter, err error) {
 func GenericUnauthenticatedError(w http.ResponseWriter) {
 	HTTPError(w, http.StatusUnauthorized, "Unauthorized", StatusFail)
 }
+
+func GenericForbiddenError(w http.ResponseWriter, err error) {
+	HTTPError(w, http.StatusForbidden, err.Error(), StatusFail)
+}
@@ -11,10 +11,15 @@ const (
 	StatusError   = "error"   // 5XX
 )
 
+// RequestIDHeader is set on the response before the handler runs, which is where errors read the request ID from
+const RequestIDHeader = "X-Request-ID"
+
 type Error struct {
 	Code   int         `json:"code"`
 	Status string      `json:"status"`
 	Error  interface{} `json:"error"`
+	// RequestID lets a user reporting an error point at its log entries
+	RequestID string `json:"request_id,omitempty"`
 }
 
 func HTTPError(w http.ResponseWriter, code int, message interface{}, status string) {
@@ -35,6 +40,8 @@ func HTTPError(w http.ResponseWriter, code int, message interface{}, status stri
 		}
 	}
 
+	error.RequestID = w.Header().Get(RequestIDHeader)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(error.Code)
 
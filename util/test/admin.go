@@ -0,0 +1,106 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/api/resource/admin"
+)
+
+func SearchUsersHelper(adminAPI *admin.API, t testing.TB, query admin.SearchQueryParams, want_code int, want_status string, want_count int, accessToken string) {
+	t.Helper()
+
+	values := url.Values{}
+	values.Set("query", query.Query)
+	values.Set("role", query.Role)
+	values.Set("status", query.Status)
+	values.Set("limit", query.Limit)
+	values.Set("offset", query.Offset)
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/users?"+values.Encode(), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(adminAPI.Search, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		data, ok := responseBody.Data.([]interface{})
+		assert.True(t, ok)
+		assert.Len(t, data, want_count)
+
+		for _, user := range data {
+			userMap, ok := user.(map[string]interface{})
+			assert.True(t, ok)
+			assert.NotEqual(t, "", userMap["id"])
+			if userMap["password"] != nil {
+				assert.Equal(t, "redacted", userMap["password"], "Password hash should not be returned")
+			}
+		}
+	}
+}
+
+func AdminGetUserHelper(adminAPI *admin.API, t testing.TB, want_code int, want_status string, want_actions []string, userId string, accessToken string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/users/{user_id}", nil)
+	req.SetPathValue("user_id", userId)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(adminAPI.Get, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		var data admin.GetResponse
+		decodeData(t, responseBody.Data, &data)
+
+		assert.Equal(t, userId, data.User.ID.String())
+
+		actions := []string{}
+		for _, action := range data.Actions {
+			actions = append(actions, action.Action)
+		}
+		assert.Equal(t, want_actions, actions)
+	}
+}
+
+func AdminActionHelper(handler http.HandlerFunc, t testing.TB, target string, want_code int, want_status string, userId string, accessToken string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, target, nil)
+	req.SetPathValue("user_id", userId)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(handler, res, req)
+
+	GenericAssert(t, want_code, want_status, res)
+}
+
+func PutRoleHelper(adminAPI *admin.API, t testing.TB, body admin.PutRoleBodyParams, want_code int, want_status string, userId string, accessToken string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, "/admin/users/{user_id}/role", bytes.NewBuffer(requestBody))
+	req.SetPathValue("user_id", userId)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(adminAPI.PutRole, res, req)
+
+	GenericAssert(t, want_code, want_status, res)
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/api/resource/audit"
+	"github.com/ushiradineth/koano-api/models"
+	auditUtil "github.com/ushiradineth/koano-api/util/audit"
+)
+
+func GetUserAuditHelper(auditAPI *audit.API, t testing.TB, action string, want_code int, want_status string, accessToken string) []models.AuditLog {
+	t.Helper()
+
+	values := url.Values{}
+	values.Set("action", action)
+
+	req, _ := http.NewRequest(http.MethodGet, "/audit?"+values.Encode(), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(auditAPI.GetUserAudit, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	entries := []models.AuditLog{}
+	if res.Code == http.StatusOK {
+		decodeData(t, responseBody.Data, &entries)
+
+		for _, entry := range entries {
+			assert.NotEmpty(t, entry.Hash, "Entry hash is missing")
+		}
+	}
+
+	return entries
+}
+
+func SearchAuditHelper(handler http.HandlerFunc, t testing.TB, query audit.SearchQueryParams, want_code int, want_status string, accessToken string) []models.AuditLog {
+	t.Helper()
+
+	values := url.Values{}
+	values.Set("user_id", query.UserID)
+	values.Set("actor_id", query.ActorID)
+	values.Set("action", query.Action)
+	values.Set("target_type", query.TargetType)
+	values.Set("limit", query.Limit)
+	values.Set("offset", query.Offset)
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/audit?"+values.Encode(), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	handler(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	entries := []models.AuditLog{}
+	if res.Code == http.StatusOK {
+		decodeData(t, responseBody.Data, &entries)
+	}
+
+	return entries
+}
+
+func VerifyAuditHelper(handler http.HandlerFunc, t testing.TB, want_code int, want_status string, want_valid bool, accessToken string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/audit/verify", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	handler(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		var data auditUtil.Verification
+		decodeData(t, responseBody.Data, &data)
+
+		assert.Equal(t, want_valid, data.Valid)
+		if want_valid {
+			assert.Nil(t, data.BrokenAt)
+			assert.NotEmpty(t, data.Head, "Head hash is missing")
+		} else {
+			assert.NotNil(t, data.BrokenAt, "Broken entry is missing")
+		}
+	}
+}
@@ -6,10 +6,16 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ushiradineth/koano-api/api/resource/auth"
+	authUtil "github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/mail"
+	"github.com/ushiradineth/koano-api/util/password"
+	"github.com/ushiradineth/koano-api/util/response"
+	"github.com/ushiradineth/koano-api/util/webauthn"
 )
 
 func AuthenticateUserHelper(authAPI *auth.API, t testing.TB, body auth.AuthenticateBodyParams, want_code int, want_status string, userId *string, accessToken *string, refreshToken *string) {
@@ -53,6 +59,75 @@ func AuthenticateUserHelper(authAPI *auth.API, t testing.TB, body auth.Authentic
 	}
 }
 
+func AuthenticateCookieSessionHelper(authAPI *auth.API, t testing.TB, body auth.AuthenticateBodyParams, want_code int, want_status string) []*http.Cookie {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(authUtil.SessionModeHeader, authUtil.SessionModeCookie)
+	res := httptest.NewRecorder()
+
+	authAPI.Authenticate(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		assertSessionCookies(t, responseBody, res)
+	}
+
+	return res.Result().Cookies()
+}
+
+func RefreshCookieSessionHelper(authAPI *auth.API, t testing.TB, cookies []*http.Cookie, want_code int, want_status string) []*http.Cookie {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/refresh", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	res := httptest.NewRecorder()
+
+	authAPI.RefreshToken(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		assertSessionCookies(t, responseBody, res)
+	}
+
+	return res.Result().Cookies()
+}
+
+func assertSessionCookies(t testing.TB, responseBody response.Response, res *httptest.ResponseRecorder) {
+	t.Helper()
+
+	dataMap, ok := responseBody.Data.(map[string]interface{})
+	assert.True(t, ok)
+	assert.Nil(t, dataMap["access_token"], "Access Token should only be set as a cookie")
+	assert.Nil(t, dataMap["refresh_token"], "Refresh Token should only be set as a cookie")
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range res.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	for _, name := range []string{authUtil.AccessTokenCookie, authUtil.RefreshTokenCookie} {
+		if assert.Contains(t, cookies, name) {
+			assert.NotEmpty(t, cookies[name].Value)
+			assert.True(t, cookies[name].HttpOnly, "Token cookies should not be readable by scripts")
+		}
+	}
+
+	if assert.Contains(t, cookies, authUtil.CSRFCookie) {
+		assert.False(t, cookies[authUtil.CSRFCookie].HttpOnly, "CSRF cookie should be readable by the client")
+	}
+}
+
 func UpdateUserPasswordHelper(authAPI *auth.API, t testing.TB, body auth.PutPasswordBodyParams, want_code int, want_status string, accessToken string) {
 	t.Helper()
 
@@ -66,11 +141,45 @@ func UpdateUserPasswordHelper(authAPI *auth.API, t testing.TB, body auth.PutPass
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
 	res := httptest.NewRecorder()
 
-	authAPI.PutPassword(res, req)
+	private(authAPI.PutPassword, res, req)
 
 	GenericAssert(t, want_code, want_status, res)
 }
 
+// PasswordPolicyViolationHelper changes the password expecting it to be rejected for exactly the given violation codes
+func PasswordPolicyViolationHelper(authAPI *auth.API, t testing.TB, body auth.PutPasswordBodyParams, accessToken string, want_codes []string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, "/auth/reset-password", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(authAPI.PutPassword, res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	var responseBody struct {
+		Status string               `json:"status"`
+		Error  []password.Violation `json:"error"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&responseBody)
+	assert.NoError(t, err)
+	assert.Equal(t, response.StatusFail, responseBody.Status)
+
+	codes := []string{}
+	for _, violation := range responseBody.Error {
+		codes = append(codes, violation.Code)
+		assert.NotEmpty(t, violation.Message)
+	}
+	assert.Equal(t, want_codes, codes)
+}
+
 func RefreshTokenHelper(authAPI *auth.API, t testing.TB, body auth.RefreshTokenBodyParams, access_token string, want_code int, want_status string) {
 	t.Helper()
 
@@ -99,3 +208,547 @@ func RefreshTokenHelper(authAPI *auth.API, t testing.TB, body auth.RefreshTokenB
 		assert.NotEmpty(t, dataMap["refresh_token"], "Refresh Token is missing")
 	}
 }
+
+func LogoutHelper(authAPI *auth.API, t testing.TB, body auth.RefreshTokenBodyParams, want_code int, want_status string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/logout", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	authAPI.Logout(res, req)
+
+	GenericAssert(t, want_code, want_status, res)
+}
+
+func VerifyEmailHelper(authAPI *auth.API, t testing.TB, body auth.VerifyEmailBodyParams, want_code int, want_status string, email string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/verify-email", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	authAPI.VerifyEmail(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.Equal(t, email, dataMap["email"])
+		assert.Equal(t, true, dataMap["email_verified"])
+		assert.Equal(t, nil, dataMap["pending_email"])
+		assert.Equal(t, "redacted", dataMap["password"], "Password in response should be redacted")
+	}
+}
+
+func AuthenticateMFAChallengeHelper(authAPI *auth.API, t testing.TB, body auth.AuthenticateBodyParams, mfaToken *string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	authAPI.Authenticate(res, req)
+
+	responseBody := GenericAssert(t, http.StatusOK, response.StatusSuccess, res)
+
+	dataMap, ok := responseBody.Data.(map[string]interface{})
+	assert.True(t, true, ok)
+
+	assert.Equal(t, true, dataMap["mfa_required"], "MFA should be required")
+	assert.NotEmpty(t, dataMap["mfa_token"], "MFA Token is missing")
+	assert.Empty(t, dataMap["access_token"], "Access Token should not be issued before MFA")
+
+	*mfaToken, _ = dataMap["mfa_token"].(string)
+}
+
+func EnrollTOTPHelper(authAPI *auth.API, t testing.TB, want_code int, want_status string, accessToken string, secret *string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/mfa/totp", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(authAPI.EnrollTOTP, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.NotEmpty(t, dataMap["secret"], "Secret is missing")
+		assert.Contains(t, dataMap["uri"], "otpauth://totp/")
+
+		*secret, _ = dataMap["secret"].(string)
+	}
+}
+
+func ConfirmTOTPHelper(authAPI *auth.API, t testing.TB, body auth.TOTPCodeBodyParams, want_code int, want_status string, accessToken string, recoveryCodes *[]string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/mfa/totp/confirm", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(authAPI.ConfirmTOTP, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		codes, ok := dataMap["recovery_codes"].([]interface{})
+		assert.True(t, ok, "Recovery codes are missing")
+
+		*recoveryCodes = []string{}
+		for _, code := range codes {
+			*recoveryCodes = append(*recoveryCodes, code.(string))
+		}
+	}
+}
+
+func DisableTOTPHelper(authAPI *auth.API, t testing.TB, body auth.TOTPCodeBodyParams, want_code int, want_status string, accessToken string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, "/auth/mfa/totp", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(authAPI.DisableTOTP, res, req)
+
+	GenericAssert(t, want_code, want_status, res)
+}
+
+func VerifyMFAHelper(authAPI *auth.API, t testing.TB, body auth.VerifyMFABodyParams, want_code int, want_status string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/mfa/verify", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	authAPI.VerifyMFA(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.NotEmpty(t, dataMap["access_token"], "Access Token is missing")
+		assert.NotEmpty(t, dataMap["refresh_token"], "Refresh Token is missing")
+	}
+}
+
+func UnlockHelper(handler http.HandlerFunc, t testing.TB, body auth.UnlockBodyParams, want_code int, want_status string, accessToken string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/admin/lockouts/unlock", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(handler, res, req)
+
+	GenericAssert(t, want_code, want_status, res)
+}
+
+func OIDCAuthorizeHelper(authAPI *auth.API, t testing.TB, provider string, want_code int, want_status string, authorizationURL *string, stateCookie *string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, "/auth/oidc/{provider}/authorize", nil)
+	req.SetPathValue("provider", provider)
+	res := httptest.NewRecorder()
+
+	authAPI.OIDCAuthorize(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.NotEmpty(t, dataMap["state"], "State is missing")
+		assert.NotEmpty(t, dataMap["authorization_url"], "Authorization URL is missing")
+
+		*authorizationURL, _ = dataMap["authorization_url"].(string)
+
+		for _, cookie := range res.Result().Cookies() {
+			if cookie.Name == authUtil.OIDCStateCookie {
+				*stateCookie = cookie.Value
+			}
+		}
+		assert.Equal(t, dataMap["state"], *stateCookie, "State cookie should hold the state")
+	}
+}
+
+func OIDCCallbackHelper(authAPI *auth.API, t testing.TB, provider string, body auth.OIDCCallbackBodyParams, stateCookie string, want_code int, want_status string, email string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/oidc/{provider}/callback", bytes.NewBuffer(requestBody))
+	req.SetPathValue("provider", provider)
+	req.Header.Set("Content-Type", "application/json")
+	if stateCookie != "" {
+		req.AddCookie(&http.Cookie{Name: authUtil.OIDCStateCookie, Value: stateCookie})
+	}
+	res := httptest.NewRecorder()
+
+	authAPI.OIDCCallback(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		userMap, ok := dataMap["user"].(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.Equal(t, email, userMap["email"])
+		assert.Equal(t, true, userMap["email_verified"])
+		assert.NotEmpty(t, dataMap["access_token"], "Access Token is missing")
+		assert.NotEmpty(t, dataMap["refresh_token"], "Refresh Token is missing")
+	}
+}
+
+func SendMagicLinkHelper(authAPI *auth.API, t testing.TB, body auth.MagicLinkBodyParams, want_code int, want_status string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/magic-link", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	authAPI.SendMagicLink(res, req)
+
+	GenericAssert(t, want_code, want_status, res)
+}
+
+func ConsumeMagicLinkHelper(authAPI *auth.API, t testing.TB, body auth.ConsumeMagicLinkBodyParams, want_code int, want_status string, email string, hasPassword bool) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/magic-link/consume", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	authAPI.ConsumeMagicLink(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		userMap, ok := dataMap["user"].(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.Equal(t, email, userMap["email"])
+		assert.Equal(t, true, userMap["email_verified"])
+		if hasPassword {
+			assert.Equal(t, "redacted", userMap["password"], "Password in response should be redacted")
+		} else {
+			assert.Nil(t, userMap["password"], "Password should be null for users without one")
+		}
+		assert.NotEmpty(t, dataMap["access_token"], "Access Token is missing")
+		assert.NotEmpty(t, dataMap["refresh_token"], "Refresh Token is missing")
+	}
+}
+
+func AuthenticateRestoreChallengeHelper(authAPI *auth.API, t testing.TB, body auth.AuthenticateBodyParams, restoreToken *string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	authAPI.Authenticate(res, req)
+
+	responseBody := GenericAssert(t, http.StatusOK, response.StatusSuccess, res)
+
+	dataMap, ok := responseBody.Data.(map[string]interface{})
+	assert.True(t, true, ok)
+
+	assert.Equal(t, true, dataMap["restore_required"], "Restore should be required")
+	assert.NotEmpty(t, dataMap["restore_token"], "Restore Token is missing")
+	assert.NotEmpty(t, dataMap["purge_at"], "Purge date is missing")
+	assert.Empty(t, dataMap["access_token"], "Access Token should not be issued before the account is restored")
+
+	*restoreToken, _ = dataMap["restore_token"].(string)
+}
+
+func RestoreAccountHelper(authAPI *auth.API, t testing.TB, body auth.RestoreAccountBodyParams, want_code int, want_status string, email string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/restore", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	authAPI.RestoreAccount(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		userMap, ok := dataMap["user"].(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.Equal(t, email, userMap["email"])
+		assert.Equal(t, true, userMap["active"])
+		assert.Nil(t, userMap["deleted_at"])
+		assert.NotEmpty(t, dataMap["access_token"], "Access Token is missing")
+		assert.NotEmpty(t, dataMap["refresh_token"], "Refresh Token is missing")
+	}
+}
+
+func SendRestoreLinkHelper(authAPI *auth.API, t testing.TB, body auth.RestoreLinkBodyParams, want_code int, want_status string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/restore/email", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	authAPI.SendRestoreLink(res, req)
+
+	GenericAssert(t, want_code, want_status, res)
+}
+
+// RestoreLinkToken returns the token of the latest restore link mailed to the email
+func RestoreLinkToken(t testing.TB, mailer *mail.MemoryMailer, email string) string {
+	t.Helper()
+
+	message, ok := mailer.Last(email)
+	if !ok {
+		t.Fatalf("No mail has been sent to %s", email)
+	}
+
+	_, token, found := strings.Cut(message.Body, "restore-account?token=")
+	if !found {
+		t.Fatalf("Mail to %s does not contain a restore link", email)
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// MagicLinkToken returns the token of the latest magic link mailed to the email
+func MagicLinkToken(t testing.TB, mailer *mail.MemoryMailer, email string) string {
+	t.Helper()
+
+	message, ok := mailer.Last(email)
+	if !ok {
+		t.Fatalf("No mail has been sent to %s", email)
+	}
+
+	_, token, found := strings.Cut(message.Body, "magic-link?token=")
+	if !found {
+		t.Fatalf("Mail to %s does not contain a magic link", email)
+	}
+
+	return strings.TrimSpace(token)
+}
+
+func PasskeyRegistrationOptionsHelper(authAPI *auth.API, t testing.TB, body auth.PasskeyRegistrationOptionsBodyParams, want_code int, want_status string, accessToken string, options *webauthn.CreationOptions) {
+	t.Helper()
+
+	reqBody, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, "/auth/passkeys/register/options", bytes.NewBuffer(reqBody))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(authAPI.PasskeyRegistrationOptions, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		decodeData(t, responseBody.Data, options)
+		assert.NotEmpty(t, options.Challenge, "Challenge is missing")
+		assert.NotEmpty(t, options.User.ID, "User handle is missing")
+	}
+}
+
+func RegisterPasskeyHelper(authAPI *auth.API, t testing.TB, body auth.RegisterPasskeyBodyParams, want_code int, want_status string, accessToken string, passkeyId *string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/passkeys/register", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(authAPI.RegisterPasskey, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, ok)
+
+		assert.Equal(t, body.Name, dataMap["name"])
+		assert.Equal(t, body.Credential.ID, dataMap["credential_id"])
+		assert.Nil(t, dataMap["public_key"], "Public key should not be in the response")
+
+		*passkeyId, _ = dataMap["id"].(string)
+	}
+}
+
+func GetPasskeysHelper(authAPI *auth.API, t testing.TB, want_code int, want_status string, want_count int, accessToken string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, "/auth/passkeys", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(authAPI.GetPasskeys, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		data, ok := responseBody.Data.([]interface{})
+		assert.True(t, ok)
+		assert.Len(t, data, want_count)
+	}
+}
+
+func DeletePasskeyHelper(authAPI *auth.API, t testing.TB, want_code int, want_status string, passkeyId string, accessToken string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodDelete, "/auth/passkeys/{passkey_id}", nil)
+	req.SetPathValue("passkey_id", passkeyId)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(authAPI.DeletePasskey, res, req)
+
+	GenericAssert(t, want_code, want_status, res)
+}
+
+func PasskeyLoginOptionsHelper(authAPI *auth.API, t testing.TB, options *webauthn.RequestOptions) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/passkeys/login/options", nil)
+	res := httptest.NewRecorder()
+
+	authAPI.PasskeyLoginOptions(res, req)
+
+	responseBody := GenericAssert(t, http.StatusOK, response.StatusSuccess, res)
+
+	decodeData(t, responseBody.Data, options)
+	assert.NotEmpty(t, options.Challenge, "Challenge is missing")
+}
+
+func PasskeyLoginHelper(authAPI *auth.API, t testing.TB, body auth.PasskeyLoginBodyParams, want_code int, want_status string, email string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/auth/passkeys/login", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	authAPI.PasskeyLogin(res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, ok)
+
+		userMap, ok := dataMap["user"].(map[string]interface{})
+		assert.True(t, ok)
+
+		assert.Equal(t, email, userMap["email"])
+		assert.NotEmpty(t, dataMap["access_token"], "Access Token is missing")
+		assert.NotEmpty(t, dataMap["refresh_token"], "Refresh Token is missing")
+	}
+}
+
+// decodeData converts the data of a response envelope into a typed value
+func decodeData(t testing.TB, data interface{}, value interface{}) {
+	t.Helper()
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Failed to marshal data: %v", err)
+	}
+
+	if err := json.Unmarshal(raw, value); err != nil {
+		t.Fatalf("Failed to unmarshal data: %v", err)
+	}
+}
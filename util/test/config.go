@@ -0,0 +1,25 @@
+package test
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ushiradineth/koano-api/config"
+	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/oidc"
+	"github.com/ushiradineth/koano-api/util/password"
+	"github.com/ushiradineth/koano-api/util/webauthn"
+)
+
+// NewConfig returns the settings the APIs are built with, as they are when nothing is configured beyond the frontend at localhost:3000
+func NewConfig() *config.Config {
+	return &config.Config{
+		AppURL:               "http://localhost:3000",
+		AccountRestorePeriod: 30 * 24 * time.Hour,
+		ExportRetention:      72 * time.Hour,
+		Cookies:              auth.CookieConfig{Secure: true, SameSite: http.SameSiteLaxMode},
+		Password:             config.Password{Hasher: auth.DefaultArgon2idHasher, Policy: password.DefaultPolicy},
+		WebAuthn:             webauthn.Config{RPID: "localhost", RPName: "Koano", Origins: []string{"http://localhost:3000"}},
+		OIDC:                 []oidc.Config{},
+	}
+}
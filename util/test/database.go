@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os/exec"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -12,9 +11,11 @@ import (
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/ushiradineth/koano-api/database"
+	"github.com/ushiradineth/koano-api/database/migration"
 )
 
-func NewDB(migrationPath string) *sqlx.DB {
+func NewDB() *sqlx.DB {
 	ctx := context.Background()
 	pgContainer, err := postgres.Run(ctx,
 		"postgres:16-alpine",
@@ -43,7 +44,7 @@ func NewDB(migrationPath string) *sqlx.DB {
 		log.Fatalf("Error pinging database: %v", err)
 	}
 
-	if err := RunMigrations(connectionString, migrationPath); err != nil {
+	if err := RunMigrations(db); err != nil {
 		log.Fatalf("Error running migrations: %v", err)
 	}
 
@@ -51,20 +52,18 @@ func NewDB(migrationPath string) *sqlx.DB {
 	return db
 }
 
-func RunMigrations(connectionString string, migrationPath string) error {
-	// Build the migration command
-	cmd := exec.Command("migrate", "-path", migrationPath, "-database", connectionString, "-verbose", "up")
-
-	// Capture standard output and error
-	cmd.Stdout = log.Writer()
-	cmd.Stderr = log.Writer()
+// RunMigrations applies the embedded migrations the same way the migrate command and the API do
+func RunMigrations(db *sqlx.DB) error {
+	migrator, err := database.NewMigrator(db, migration.FS)
+	if err != nil {
+		return fmt.Errorf("could not load migrations: %w", err)
+	}
 
-	// Run the command
-	err := cmd.Run()
+	applied, err := migrator.Up(context.Background())
 	if err != nil {
 		return fmt.Errorf("could not run migrations: %w", err)
 	}
 
-	fmt.Println("Migrations applied successfully")
+	fmt.Printf("Applied %d migrations\n", applied)
 	return nil
 }
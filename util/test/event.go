@@ -26,7 +26,7 @@ func CreateEventHelper(eventAPI *event.API, t testing.TB, body event.EventBodyPa
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
 	res := httptest.NewRecorder()
 
-	eventAPI.Post(res, req)
+	private(eventAPI.Post, res, req)
 
 	responseBody := GenericAssert(t, want_code, want_status, res)
 
@@ -53,7 +53,7 @@ func GetEventHelper(eventAPI *event.API, t testing.TB, want_code int, want_statu
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
 	res := httptest.NewRecorder()
 
-	eventAPI.Get(res, req)
+	private(eventAPI.Get, res, req)
 
 	responseBody := GenericAssert(t, want_code, want_status, res)
 
@@ -84,7 +84,7 @@ func UpdateEventHelper(eventAPI *event.API, t testing.TB, body event.EventBodyPa
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
 	res := httptest.NewRecorder()
 
-	eventAPI.Put(res, req)
+	private(eventAPI.Put, res, req)
 
 	responseBody := GenericAssert(t, want_code, want_status, res)
 
@@ -109,7 +109,7 @@ func DeleteEventHelper(eventAPI *event.API, t testing.TB, want_code int, want_st
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
 	res := httptest.NewRecorder()
 
-	eventAPI.Delete(res, req)
+	private(eventAPI.Delete, res, req)
 
 	GenericAssert(t, want_code, want_status, res)
 }
@@ -127,7 +127,7 @@ func GetUserEventsHelper(eventAPI *event.API, t testing.TB, queryParams event.Ge
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
 	res := httptest.NewRecorder()
 
-	eventAPI.GetUserEvents(res, req)
+	private(eventAPI.GetUserEvents, res, req)
 
 	GenericAssert(t, want_code, want_status, res)
 }
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/api/resource/export"
+)
+
+func RequestExportHelper(exportAPI *export.API, t testing.TB, want_code int, want_status string, accessToken string, exportId *string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, "/exports", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(exportAPI.Post, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		var data export.ExportResponse
+		decodeData(t, responseBody.Data, &data)
+
+		assert.NotEmpty(t, data.ID, "Export ID is missing")
+		assert.Nil(t, data.DownloadURL, "Download link should not be issued before the export is built")
+
+		*exportId = data.ID.String()
+	}
+}
+
+func GetExportHelper(exportAPI *export.API, t testing.TB, want_code int, want_status string, exportId string, accessToken string) export.ExportResponse {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, "/exports/{export_id}", nil)
+	req.SetPathValue("export_id", exportId)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(exportAPI.Get, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	var data export.ExportResponse
+	if res.Code == http.StatusOK {
+		decodeData(t, responseBody.Data, &data)
+		assert.Equal(t, exportId, data.ID.String())
+	}
+
+	return data
+}
+
+// DownloadExportHelper returns the archive when the download succeeds
+func DownloadExportHelper(exportAPI *export.API, t testing.TB, want_code int, exportId string, downloadURL string) []byte {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, downloadURL, nil)
+	req.SetPathValue("export_id", exportId)
+	res := httptest.NewRecorder()
+
+	exportAPI.Download(res, req)
+
+	assert.Equal(t, want_code, res.Code)
+
+	if res.Code != http.StatusOK {
+		return nil
+	}
+
+	assert.Equal(t, "application/zip", res.Header().Get("Content-Type"))
+	assert.Contains(t, res.Header().Get("Content-Disposition"), "attachment")
+
+	archive, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+
+	return archive
+}
@@ -0,0 +1,135 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/api/resource/oauth"
+)
+
+func CreateOAuthClientHelper(oauthAPI *oauth.API, t testing.TB, body oauth.PostClientBodyParams, want_code int, want_status string, accessToken string, clientID *string, clientSecret *string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/oauth/clients", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(oauthAPI.PostClient, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.NotEmpty(t, dataMap["client_id"], "Client ID is missing")
+		assert.Nil(t, dataMap["secret_hash"], "Secret hash should not be returned")
+		assert.Equal(t, body.Name, dataMap["name"])
+		assert.Len(t, dataMap["redirect_uris"], len(body.RedirectURIs))
+
+		if body.Confidential {
+			assert.NotEmpty(t, dataMap["client_secret"], "Client secret is missing")
+		} else {
+			assert.Nil(t, dataMap["client_secret"], "Public clients should not have a secret")
+		}
+
+		*clientID, _ = dataMap["client_id"].(string)
+		*clientSecret, _ = dataMap["client_secret"].(string)
+	}
+}
+
+func GetOAuthConsentHelper(oauthAPI *oauth.API, t testing.TB, query oauth.AuthorizeQueryParams, want_code int, want_status string, accessToken string) {
+	t.Helper()
+
+	params := url.Values{
+		"response_type":         []string{query.ResponseType},
+		"client_id":             []string{query.ClientID},
+		"redirect_uri":          []string{query.RedirectURI},
+		"scope":                 []string{query.Scope},
+		"state":                 []string{query.State},
+		"code_challenge":        []string{query.CodeChallenge},
+		"code_challenge_method": []string{query.CodeChallengeMethod},
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/oauth/authorize?"+params.Encode(), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(oauthAPI.GetConsent, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		clientMap, ok := dataMap["client"].(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.Equal(t, query.ClientID, clientMap["client_id"])
+		assert.Len(t, dataMap["scopes"], len(strings.Fields(query.Scope)))
+		assert.Equal(t, query.State, dataMap["state"])
+	}
+}
+
+func AuthorizeOAuthClientHelper(oauthAPI *oauth.API, t testing.TB, body oauth.AuthorizeBodyParams, want_code int, want_status string, accessToken string, redirectURI *string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/oauth/authorize", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(oauthAPI.Authorize, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.True(t, strings.HasPrefix(dataMap["redirect_uri"].(string), body.RedirectURI), "Redirect URI should be the one of the request")
+
+		*redirectURI, _ = dataMap["redirect_uri"].(string)
+	}
+}
+
+// OAuthFormHelper posts a form to the token, revocation or introspection endpoint, returning the decoded body for the caller to assert
+func OAuthFormHelper(handler http.HandlerFunc, t testing.TB, form url.Values, want_code int) map[string]interface{} {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, "/oauth", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res := httptest.NewRecorder()
+
+	handler(res, req)
+
+	assert.Equal(t, want_code, res.Code)
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+
+	responseBody := map[string]interface{}{}
+	if res.Body.Len() > 0 {
+		err := json.NewDecoder(res.Body).Decode(&responseBody)
+		assert.NoError(t, err)
+	}
+
+	return responseBody
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// MockOIDCServer is a local OpenID Connect provider which signs ID tokens with a generated key
+type MockOIDCServer struct {
+	*httptest.Server
+	ClientID string
+	Claims   jwt.MapClaims
+	// KeyID is put in the header of the ID tokens, the JWKS only has the key "mock"
+	KeyID string
+	// JWKSRequests counts the requests for the JWKS
+	JWKSRequests atomic.Int32
+
+	key            *rsa.PrivateKey
+	mu             sync.Mutex
+	authorizations map[string]mockAuthorization
+}
+
+type mockAuthorization struct {
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+func NewMockOIDCServer(clientID string) *MockOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &MockOIDCServer{
+		ClientID:       clientID,
+		Claims:         jwt.MapClaims{},
+		KeyID:          "mock",
+		key:            key,
+		authorizations: map[string]mockAuthorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("POST /token", s.token)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Authorize stands in for the user approving the login at the authorization URL, returning the code and state the provider redirects back with
+func (s *MockOIDCServer) Authorize(authorizationURL string) (string, string, error) {
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	query := parsed.Query()
+	if query.Get("client_id") != s.ClientID || query.Get("code_challenge_method") != "S256" {
+		return "", "", fmt.Errorf("invalid authorization request %s", authorizationURL)
+	}
+
+	code := fmt.Sprintf("code-%d", time.Now().UnixNano())
+
+	s.mu.Lock()
+	s.authorizations[code] = mockAuthorization{
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+	}
+	s.mu.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+func (s *MockOIDCServer) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *MockOIDCServer) jwks(w http.ResponseWriter, _ *http.Request) {
+	s.JWKSRequests.Add(1)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": "mock",
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *MockOIDCServer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	authorization, ok := s.authorizations[r.PostForm.Get("code")]
+	delete(s.authorizations, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.codeChallenge || r.PostForm.Get("redirect_uri") != authorization.redirectURI || r.PostForm.Get("client_id") != s.ClientID {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   s.URL,
+		"aud":   s.ClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": authorization.nonce,
+	}
+	for key, value := range s.Claims {
+		claims[key] = value
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = s.KeyID
+
+	signedIDToken, err := idToken.SignedString(s.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"id_token":     signedIDToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(data)
+}
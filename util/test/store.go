@@ -0,0 +1,43 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ushiradineth/koano-api/api/router"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/auth"
+)
+
+var repositories *store.Store
+
+// NewStore returns an in-memory store, which the helpers authenticate requests to private routes against
+func NewStore() *store.Store {
+	repositories = store.NewMemory()
+	return repositories
+}
+
+// private runs the handler behind the authentication middleware, as the router does for private routes
+func private(handler http.HandlerFunc, res http.ResponseWriter, req *http.Request) {
+	router.Authenticated(repositories.Users, handler)(res, req)
+}
+
+// AuthenticateMemoryUserHelper issues an access token for a user in the store, standing in for signing in through the auth API which needs Postgres
+func AuthenticateMemoryUserHelper(repositories *store.Store, t testing.TB, email string, userID *string, accessToken *string) {
+	t.Helper()
+
+	user, err := repositories.Users.GetByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("Failed to get user %s: %v", email, err)
+	}
+
+	token, _, _, err := auth.NewAccessToken(user.ID, user.Name, user.Email, user.Role, user.TokenVersion, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to create access token: %v", err)
+	}
+
+	*userID = user.ID.String()
+	*accessToken = token
+}
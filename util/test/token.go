@@ -0,0 +1,89 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/api/resource/token"
+)
+
+func CreateTokenHelper(tokenAPI *token.API, t testing.TB, body token.PostBodyParams, want_code int, want_status string, accessToken string, tokenId *string, plainToken *string) {
+	t.Helper()
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/tokens", bytes.NewBuffer(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(tokenAPI.Post, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		dataMap, ok := responseBody.Data.(map[string]interface{})
+		assert.True(t, true, ok)
+
+		assert.NotEmpty(t, dataMap["id"], "Token ID is missing")
+		assert.NotEmpty(t, dataMap["token"], "Token is missing")
+		assert.Nil(t, dataMap["token_hash"], "Token hash should not be returned")
+		assert.Equal(t, body.Name, dataMap["name"])
+		assert.Len(t, dataMap["scopes"], len(body.Scopes))
+		assert.Nil(t, dataMap["revoked_at"])
+
+		*tokenId, _ = dataMap["id"].(string)
+		*plainToken, _ = dataMap["token"].(string)
+	}
+}
+
+func GetUserTokensHelper(tokenAPI *token.API, t testing.TB, want_code int, want_status string, want_count int, accessToken string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, "/tokens", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(tokenAPI.GetUserTokens, res, req)
+
+	responseBody := GenericAssert(t, want_code, want_status, res)
+
+	if res.Code == http.StatusOK {
+		data, ok := responseBody.Data.([]interface{})
+		assert.True(t, ok)
+		assert.Len(t, data, want_count)
+	}
+}
+
+func RevokeTokenHelper(tokenAPI *token.API, t testing.TB, want_code int, want_status string, tokenId string, accessToken string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodDelete, "/tokens/{token_id}", nil)
+	req.SetPathValue("token_id", tokenId)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	res := httptest.NewRecorder()
+
+	private(tokenAPI.Delete, res, req)
+
+	GenericAssert(t, want_code, want_status, res)
+}
+
+func ScopedRequestHelper(handler http.HandlerFunc, t testing.TB, method string, target string, want_code int, want_status string, bearerToken string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", bearerToken))
+	res := httptest.NewRecorder()
+
+	handler(res, req)
+
+	GenericAssert(t, want_code, want_status, res)
+}
@@ -0,0 +1,153 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/ushiradineth/koano-api/util/webauthn"
+)
+
+// SoftwareAuthenticator stands in for a passkey provider, holding a single ES256 discoverable credential
+type SoftwareAuthenticator struct {
+	Origin       string
+	SignCount    uint32
+	UserVerified bool
+
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+}
+
+func NewSoftwareAuthenticator(origin string) *SoftwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		panic(err)
+	}
+
+	return &SoftwareAuthenticator{
+		Origin:       origin,
+		UserVerified: true,
+		key:          key,
+		credentialID: credentialID,
+	}
+}
+
+func (a *SoftwareAuthenticator) CredentialID() string {
+	return base64.RawURLEncoding.EncodeToString(a.credentialID)
+}
+
+// Create answers navigator.credentials.create with a none attestation
+func (a *SoftwareAuthenticator) Create(options webauthn.CreationOptions) webauthn.CredentialCreation {
+	a.userHandle, _ = base64.RawURLEncoding.DecodeString(options.User.ID)
+
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         int64(webauthncose.P256),
+		XCoord:        padTo32(a.key.X.Bytes()),
+		YCoord:        padTo32(a.key.Y.Bytes()),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	attestedCredentialData := make([]byte, 16, 18+len(a.credentialID)+len(coseKey))
+	attestedCredentialData = binary.BigEndian.AppendUint16(attestedCredentialData, uint16(len(a.credentialID)))
+	attestedCredentialData = append(attestedCredentialData, a.credentialID...)
+	attestedCredentialData = append(attestedCredentialData, coseKey...)
+
+	authenticatorData := append(a.authenticatorData(options.RP.ID, 0x40), attestedCredentialData...)
+
+	attestationObject, err := webauthncbor.Marshal(noneAttestation{
+		Format:    "none",
+		Statement: map[string]interface{}{},
+		AuthData:  authenticatorData,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return webauthn.CredentialCreation{
+		ID:    a.CredentialID(),
+		RawID: a.CredentialID(),
+		Type:  "public-key",
+		Response: webauthn.AttestationResponse{
+			ClientDataJSON:    a.clientData("webauthn.create", options.Challenge),
+			AttestationObject: base64.RawURLEncoding.EncodeToString(attestationObject),
+			Transports:        []string{"internal", "hybrid"},
+		},
+	}
+}
+
+// Get answers navigator.credentials.get, bumping the sign count like a hardware authenticator would
+func (a *SoftwareAuthenticator) Get(options webauthn.RequestOptions) webauthn.CredentialAssertion {
+	a.SignCount++
+
+	clientDataJSON := a.clientData("webauthn.get", options.Challenge)
+	rawClientDataJSON, _ := base64.RawURLEncoding.DecodeString(clientDataJSON)
+	clientDataHash := sha256.Sum256(rawClientDataJSON)
+
+	authenticatorData := a.authenticatorData(options.RPID, 0)
+	digest := sha256.Sum256(append(authenticatorData, clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return webauthn.CredentialAssertion{
+		ID:    a.CredentialID(),
+		RawID: a.CredentialID(),
+		Type:  "public-key",
+		Response: webauthn.AssertionResponse{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: base64.RawURLEncoding.EncodeToString(authenticatorData),
+			Signature:         base64.RawURLEncoding.EncodeToString(signature),
+			UserHandle:        base64.RawURLEncoding.EncodeToString(a.userHandle),
+		},
+	}
+}
+
+func (a *SoftwareAuthenticator) authenticatorData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	flags |= 0x01
+	if a.UserVerified {
+		flags |= 0x04
+	}
+
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.SignCount)
+}
+
+func (a *SoftwareAuthenticator) clientData(ceremonyType string, challenge string) string {
+	clientDataJSON, _ := json.Marshal(webauthn.ClientData{
+		Type:      ceremonyType,
+		Challenge: challenge,
+		Origin:    a.Origin,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(clientDataJSON)
+}
+
+func padTo32(raw []byte) []byte {
+	return append(make([]byte, 32-len(raw)), raw...)
+}
+
+// noneAttestation is an attestation object of the none format, which has an empty statement
+type noneAttestation struct {
+	Format    string                 `cbor:"fmt"`
+	Statement map[string]interface{} `cbor:"attStmt"`
+	AuthData  []byte                 `cbor:"authData"`
+}
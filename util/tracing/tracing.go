@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ServiceName = "koano-api"
+
+	// ExporterNone still propagates the trace of the caller, so logs are linked to it, without recording spans
+	ExporterNone = "none"
+	// ExporterOTLP sends spans over HTTP to the collector in OTEL_EXPORTER_OTLP_ENDPOINT
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as JSON, for reading them locally
+	ExporterStdout = "stdout"
+)
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`(^|[^\w$.])-?\d+(?:\.\d+)?`)
+)
+
+type Options struct {
+	Exporter string
+	// SampleRatio is the share of new traces which are recorded, requests continuing a sampled trace are always recorded
+	SampleRatio float64
+	// Writer is where the stdout exporter writes, stdout unless set
+	Writer io.Writer
+}
+
+// Setup installs the tracer provider and the W3C trace context propagator. The returned shutdown exports the spans
+// which haven't been sent yet, so it has to be called before exiting.
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch options.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		writer := options.Writer
+		if writer == nil {
+			writer = os.Stdout
+		}
+
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(writer))
+	default:
+		return nil, fmt.Errorf("Unknown trace exporter %q", options.Exporter)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Error creating the %s trace exporter: %w", options.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Memory installs a provider which records every span in memory, for tests to read
+func Memory() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	return exporter
+}
+
+// Tracer is the tracer of the API, for spans around work which isn't an HTTP request or a query
+func Tracer() trace.Tracer {
+	return otel.Tracer(ServiceName)
+}
+
+// SanitizeSQL replaces the literals in a query with ?, so values written into a query rather than passed as
+// arguments don't end up in the trace. Placeholders such as $1 and identifiers such as v1 are kept.
+func SanitizeSQL(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	query = numericLiteral.ReplaceAllString(query, "${1}?")
+
+	// Queries are indented to be read in the code, which is noise in a span
+	return strings.Join(strings.Fields(query), " ")
+}
@@ -0,0 +1,50 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/util/tracing"
+)
+
+func TestSanitizeSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{"Placeholders are kept", "SELECT * FROM users WHERE id = $1", "SELECT * FROM users WHERE id = $1"},
+		{"Strings are removed", "SELECT * FROM users WHERE email = 'user@koano.app'", "SELECT * FROM users WHERE email = ?"},
+		{"Escaped quotes are removed", "UPDATE users SET name = 'O''Brien'", "UPDATE users SET name = ?"},
+		{"Numbers are removed", "SELECT * FROM events LIMIT 10 OFFSET -2.5", "SELECT * FROM events LIMIT ? OFFSET ?"},
+		{"Identifiers are kept", "SELECT v1.id FROM oauth2_clients v1", "SELECT v1.id FROM oauth2_clients v1"},
+		{"Whitespace is collapsed", "SELECT id\n\t\tFROM users\n\t\tWHERE deleted = false", "SELECT id FROM users WHERE deleted = false"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, tracing.SanitizeSQL(test.query))
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	t.Run("Stdout", func(t *testing.T) {
+		var output bytes.Buffer
+		shutdown, err := tracing.Setup(context.Background(), tracing.Options{Exporter: tracing.ExporterStdout, SampleRatio: 1, Writer: &output})
+		assert.NoError(t, err)
+
+		_, span := tracing.Tracer().Start(context.Background(), "purge deleted users")
+		span.End()
+
+		assert.NoError(t, shutdown(context.Background()))
+		assert.Contains(t, output.String(), `"Name":"purge deleted users"`, "Shutdown should export the remaining spans")
+	})
+
+	t.Run("Unknown exporter", func(t *testing.T) {
+		_, err := tracing.Setup(context.Background(), tracing.Options{Exporter: "jaeger"})
+		assert.ErrorContains(t, err, "Unknown trace exporter")
+	})
+}
@@ -1,81 +1,170 @@
 package user
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
-	"github.com/jmoiron/sqlx"
+	"github.com/google/uuid"
 
 	"github.com/ushiradineth/koano-api/models"
+	"github.com/ushiradineth/koano-api/store"
+	"github.com/ushiradineth/koano-api/util/audit"
 	"github.com/ushiradineth/koano-api/util/auth"
+	"github.com/ushiradineth/koano-api/util/mail"
 	"github.com/ushiradineth/koano-api/util/response"
 )
 
-func GetUserById(id string, db *sqlx.DB) (*models.User, error) {
-	user := models.User{}
+// PurgeDeletedUsers hard deletes users deleted longer than the restore period ago. Their events and other rows cascade and the email becomes free to register again.
+// The audit log is kept, with an entry recording the purge.
+func PurgeDeletedUsers(ctx context.Context, repositories *store.Store, restorePeriod time.Duration) (int64, error) {
+	var purged []uuid.UUID
 
-	err := db.Get(&user, "SELECT * FROM users WHERE id=$1 AND active=true", id)
+	err := repositories.Tx(ctx, func(tx *store.Store) error {
+		var err error
+		if purged, err = tx.Users.PurgeDeleted(ctx, time.Now().Add(-restorePeriod)); err != nil {
+			return err
+		}
+
+		for _, id := range purged {
+			if err := tx.Audit.Append(ctx, audit.Record{UserID: &id, Action: audit.ActionUserPurge, TargetType: audit.TargetUser, TargetID: &id}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return &user, nil
+	return int64(len(purged)), nil
 }
 
-func GetUserByEmail(email string, db *sqlx.DB) (*models.User, error) {
-	user := models.User{}
+var (
+	ErrUnauthenticated               = errors.New("Unauthorized")
+	ErrPersonalAccessTokenNotAllowed = errors.New("Personal access tokens are not allowed on this route")
+	ErrOAuthAccessTokenNotAllowed    = errors.New("OAuth access tokens are not allowed on this route")
+)
 
-	err := db.Get(&user, "SELECT * FROM users WHERE email=$1 AND active=true", email)
+// Authenticate resolves the user of the bearer token or session cookie. Errors other than the ones above are server errors.
+func Authenticate(r *http.Request, users store.UserRepository) (*auth.Principal, error) {
+	accessToken, err := auth.GetJWT(r)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	if auth.IsPersonalAccessToken(accessToken) {
+		return getPrincipalFromPersonalAccessToken(r, users)
+	}
+
+	if auth.IsOAuthAccessToken(accessToken) {
+		return getPrincipalFromOAuthGrant(r, users)
+	}
+
+	JWT, err := auth.VerifyAccessToken(accessToken)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	user, err := getAuthenticatedUser(r, JWT.Id, users)
 	if err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	// Bumping the token version, as a forced logout does, invalidates every access token issued before it
+	if JWT.TokenVersion != user.TokenVersion {
+		return nil, ErrUnauthenticated
+	}
+
+	return &auth.Principal{User: user, Method: auth.MethodAccessToken, AuthTime: time.Unix(JWT.AuthTime, 0)}, nil
 }
 
-func GetUserFromJWT(r *http.Request, w http.ResponseWriter, db *sqlx.DB) *models.User {
-	accessToken, err := auth.GetJWT(r)
+// AuthenticationError writes the response for an error returned by Authenticate
+func AuthenticationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		response.GenericUnauthenticatedError(w)
+	case errors.Is(err, ErrPersonalAccessTokenNotAllowed), errors.Is(err, ErrOAuthAccessTokenNotAllowed):
+		response.GenericForbiddenError(w, err)
+	default:
+		response.GenericServerError(w, err)
+	}
+}
+
+// Personal access tokens are resolved by the scope check of the route, routes without one don't accept them
+func getPrincipalFromPersonalAccessToken(r *http.Request, users store.UserRepository) (*auth.Principal, error) {
+	personalAccessToken := auth.PersonalAccessTokenFromContext(r.Context())
+	if personalAccessToken == nil {
+		return nil, ErrPersonalAccessTokenNotAllowed
+	}
+
+	user, err := getAuthenticatedUser(r, personalAccessToken.UserID, users)
 	if err != nil {
-		response.GenericBadRequestError(w, err)
-		return nil
+		return nil, err
 	}
 
-	JWT := auth.ParseAccessToken(w, accessToken)
-	if JWT == nil {
-		return nil
+	return &auth.Principal{User: user, Method: auth.MethodPersonalAccessToken}, nil
+}
+
+// OAuth access tokens are resolved the same way as personal access tokens
+func getPrincipalFromOAuthGrant(r *http.Request, users store.UserRepository) (*auth.Principal, error) {
+	grant := auth.OAuthGrantFromContext(r.Context())
+	if grant == nil {
+		return nil, ErrOAuthAccessTokenNotAllowed
 	}
 
-	user, err := GetUserById(JWT.Id.String(), db)
+	user, err := getAuthenticatedUser(r, grant.UserID, users)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Principal{User: user, Method: auth.MethodOAuthAccessToken}, nil
+}
+
+// Tokens of deleted and disabled users are rejected as if they were invalid
+func getAuthenticatedUser(r *http.Request, id uuid.UUID, users store.UserRepository) (*models.User, error) {
+	user, err := users.GetByID(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			response.GenericBadRequestError(w, fmt.Errorf("User by id %s not found", JWT.Id.String()))
-			return nil
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrUnauthenticated
 		}
 
-		response.GenericBadRequestError(w, err)
-		return nil
+		return nil, err
 	}
 
-	return user
+	return user, nil
 }
 
-func IsEmailInUse(email string, id string, db *sqlx.DB) (bool, error) {
-	var count int
-
-	// Not checking active=true since deleted users can be restored
-	err := db.Get(&count, "SELECT COUNT(*) FROM users WHERE email=$1 AND id!=$2", email, id)
+func SendEmailVerification(appURL string, id uuid.UUID, email string, mailer mail.Mailer) error {
+	verificationToken, err := auth.NewEmailVerificationToken(id, email)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, nil
-		}
-		return false, err
+		return err
 	}
 
-	if count > 0 {
-		return true, nil
+	link := fmt.Sprintf("%s/verify-email?token=%s", appURL, verificationToken)
+	body := fmt.Sprintf("Confirm your email address for Koano by opening the link below. The link expires in 24 hours.\n\n%s", link)
+
+	return mailer.Send(email, "Verify your email address", body)
+}
+
+func SendMagicLink(appURL string, email string, token string, mailer mail.Mailer) error {
+	link := fmt.Sprintf("%s/magic-link?token=%s", appURL, token)
+	body := fmt.Sprintf("Sign in to Koano by opening the link below. The link can only be used once and expires in %d minutes.\n\nIf you didn't ask for this link, you can ignore this email.\n\n%s", int(auth.MagicLinkLifetime.Minutes()), link)
+
+	return mailer.Send(email, "Your Koano sign in link", body)
+}
+
+func SendAccountRestore(appURL string, user *models.User, restorePeriod time.Duration, mailer mail.Mailer) error {
+	restoreToken, _, err := auth.NewAccountRestoreToken(user.ID, *user.DeletedAt)
+	if err != nil {
+		return err
 	}
 
-	return false, nil
+	link := fmt.Sprintf("%s/restore-account?token=%s", appURL, restoreToken)
+	body := fmt.Sprintf("Restore your deleted Koano account by opening the link below. The link expires in 1 hour, and your account will be permanently deleted on %s.\n\nIf you didn't ask for this link, you can ignore this email.\n\n%s", user.DeletedAt.Add(restorePeriod).Format("January 2, 2006"), link)
+
+	return mailer.Send(user.Email, "Restore your Koano account", body)
 }
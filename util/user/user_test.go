@@ -1,24 +1,23 @@
 package user_test
 
 import (
-	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
-	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/go-faker/faker/v4"
 	"github.com/golang-jwt/jwt"
-	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 	"github.com/ushiradineth/koano-api/api/resource/auth"
 	"github.com/ushiradineth/koano-api/api/resource/user"
+	"github.com/ushiradineth/koano-api/store"
+	authUtil "github.com/ushiradineth/koano-api/util/auth"
 	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/mail"
 	"github.com/ushiradineth/koano-api/util/response"
 	"github.com/ushiradineth/koano-api/util/test"
 	userUtil "github.com/ushiradineth/koano-api/util/user"
@@ -26,15 +25,13 @@ import (
 )
 
 var (
-	accessToken         string
-	refreshToken        string
-	user1ID             string
-	user2ID             string
-	expiredAccessToken  string
-	expiredRefreshToken string
-	db                  *sqlx.DB
-	userAPI             *user.API
-	authAPI             *auth.API
+	accessToken        string
+	refreshToken       string
+	user1ID            string
+	expiredAccessToken string
+	repositories       *store.Store
+	userAPI            *user.API
+	authAPI            *auth.API
 )
 
 var user1 user.PostBodyParams = user.PostBodyParams{
@@ -48,17 +45,6 @@ var user1Auth auth.AuthenticateBodyParams = auth.AuthenticateBodyParams{
 	Password: user1.Password,
 }
 
-var user2 user.PostBodyParams = user.PostBodyParams{
-	Name:     faker.Name(),
-	Email:    faker.Email(),
-	Password: "UPlow1234!@#",
-}
-
-var user2Auth auth.AuthenticateBodyParams = auth.AuthenticateBodyParams{
-	Email:    user2.Email,
-	Password: user2.Password,
-}
-
 func TestInit(t *testing.T) {
 	t.Run("Initiate Dependencies", func(t *testing.T) {
 		err := godotenv.Load("../../.env")
@@ -66,30 +52,18 @@ func TestInit(t *testing.T) {
 			log.Println("Failed to load env")
 		}
 
-		db = test.NewDB("../../database/migration")
+		repositories = test.NewStore()
 		v := validator.New()
 		l := logger.New()
+		m := mail.NewLogMailer(l)
 
-		userAPI = user.New(db, v, l)
-		authAPI = auth.New(db, v, l)
+		userAPI = user.New(repositories, v, l, m, test.NewConfig())
+		authAPI = auth.New(repositories, v, l, m, test.NewConfig())
 
 		expiredAccessToken = func() string {
 			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1234567890", "iat": time.Now().Unix(), "exp": time.Now().Add(-1 * time.Hour).Unix()}).SignedString([]byte(os.Getenv("JWT_SECRET")))
 			return token
 		}()
-
-		expiredRefreshToken = func() string {
-			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1234567890", "iat": time.Now().Unix(), "exp": time.Now().Add(-1 * time.Hour).Unix()}).SignedString([]byte(os.Getenv("JWT_SECRET")))
-			return token
-		}()
-	})
-
-	t.Run("Create User 2", func(t *testing.T) {
-		test.CreateUserHelper(userAPI, t, user2, http.StatusOK, response.StatusSuccess)
-	})
-
-	t.Run("Authenticates User 2", func(t *testing.T) {
-		test.AuthenticateUserHelper(authAPI, t, user2Auth, http.StatusOK, response.StatusSuccess, &user2ID, &accessToken, &refreshToken)
 	})
 
 	t.Run("Create User 1", func(t *testing.T) {
@@ -101,94 +75,28 @@ func TestInit(t *testing.T) {
 	})
 }
 
-func TestGetUserByEmailHelper(t *testing.T) {
-	t.Run("Get User 1", func(t *testing.T) {
-		user, err := userUtil.GetUserByEmail(user1.Email, db)
-		assert.NotNil(t, user, "Error getting user")
-		assert.NoError(t, err, "Error getting user")
-
-		assert.Equal(t, user1.Name, user.Name)
-		assert.Equal(t, user1.Email, user.Email)
-	})
-
-	t.Run("Email does not Exist", func(t *testing.T) {
-		user, err := userUtil.GetUserByEmail("not_an_user@email.com", db)
-		assert.Nil(t, user, "User should be empty")
-		assert.Equal(t, err, sql.ErrNoRows, "Error should be sql.ErrNoRows")
-	})
-}
-
-func TestGetUserByIdHelper(t *testing.T) {
-	t.Run("Get User 1", func(t *testing.T) {
-		user, err := userUtil.GetUserById(user1ID, db)
-		assert.NotNil(t, user, "Error getting user")
-		assert.NoError(t, err, "Error getting user")
-
-		assert.Equal(t, user1.Name, user.Name)
-		assert.Equal(t, user1.Email, user.Email)
-	})
-
-	t.Run("ID does not Exist", func(t *testing.T) {
-		user, err := userUtil.GetUserById(uuid.New().String(), db)
-		assert.Nil(t, user, "User should be empty")
-		assert.Equal(t, err, sql.ErrNoRows, "Error should be sql.ErrNoRows")
-	})
-
-	t.Run("ID is invalid", func(t *testing.T) {
-		user, err := userUtil.GetUserById("not_an_uuid", db)
-		assert.Nil(t, user, "User should be empty")
-		assert.Error(t, err, "This action should error")
-	})
-}
-
-func TestIsEmailInUseHelper(t *testing.T) {
-	t.Run("Email in use by a different user", func(t *testing.T) {
-		exists, err := userUtil.IsEmailInUse(user2.Email, user1ID, db)
-
-		assert.NoError(t, err, "Error getting user")
-		assert.True(t, exists, "Email should be in use by a different user")
-	})
-
-	t.Run("Email in use by the same user", func(t *testing.T) {
-		exists, err := userUtil.IsEmailInUse(user1.Email, user1ID, db)
-
-		assert.NoError(t, err, "Error getting user")
-		assert.False(t, exists, "Email should be in use by the same user")
-	})
-
-	t.Run("Email is not in use", func(t *testing.T) {
-		exists, err := userUtil.IsEmailInUse("not_in_use@email.com", user1ID, db)
-
-		assert.NoError(t, err, "Error getting user")
-		assert.False(t, exists, "Email should not be in use")
-	})
-}
-
-func TestGetUserFromJWTHelper(t *testing.T) {
-	t.Run("Get User with JWT", func(t *testing.T) {
+func TestAuthenticateHelper(t *testing.T) {
+	t.Run("Authenticate with JWT", func(t *testing.T) {
 		request, _ := http.NewRequest(http.MethodGet, "/non-existent-path", nil)
 		request.Header.Set("Content-Type", "application/json")
 		request.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
 
-		response := httptest.NewRecorder()
-
-		user := userUtil.GetUserFromJWT(request, response, db)
+		principal, err := userUtil.Authenticate(request, repositories.Users)
 
-		assert.Equal(t, response.Code, http.StatusOK)
-		assert.Equal(t, user1.Name, user.Name)
-		assert.Equal(t, user1.Email, user.Email)
+		assert.NoError(t, err)
+		assert.Equal(t, user1.Name, principal.User.Name)
+		assert.Equal(t, user1.Email, principal.User.Email)
+		assert.Equal(t, authUtil.MethodAccessToken, principal.Method)
 	})
 
-	t.Run("User does not exist", func(t *testing.T) {
+	t.Run("JWT is expired", func(t *testing.T) {
 		request, _ := http.NewRequest(http.MethodGet, "/non-existent-path", nil)
 		request.Header.Set("Content-Type", "application/json")
 		request.Header.Set("Authorization", fmt.Sprintf("Bearer %v", expiredAccessToken))
 
-		response := httptest.NewRecorder()
-
-		userUtil.GetUserFromJWT(request, response, db)
+		_, err := userUtil.Authenticate(request, repositories.Users)
 
-		assert.Equal(t, response.Code, http.StatusUnauthorized)
+		assert.ErrorIs(t, err, userUtil.ErrUnauthenticated)
 	})
 
 	t.Run("JWT is invalid", func(t *testing.T) {
@@ -196,11 +104,9 @@ func TestGetUserFromJWTHelper(t *testing.T) {
 		request.Header.Set("Content-Type", "application/json")
 		request.Header.Set("Authorization", fmt.Sprintf("Bearer %v", "not_an_jwt"))
 
-		response := httptest.NewRecorder()
+		_, err := userUtil.Authenticate(request, repositories.Users)
 
-		userUtil.GetUserFromJWT(request, response, db)
-
-		assert.Equal(t, response.Code, http.StatusUnauthorized)
+		assert.ErrorIs(t, err, userUtil.ErrUnauthenticated)
 	})
 
 	t.Run("Authorization header is invalid", func(t *testing.T) {
@@ -208,11 +114,18 @@ func TestGetUserFromJWTHelper(t *testing.T) {
 		request.Header.Set("Content-Type", "application/json")
 		request.Header.Set("Authorization", fmt.Sprintf("invalid %v", "not_an_jwt"))
 
-		response := httptest.NewRecorder()
+		_, err := userUtil.Authenticate(request, repositories.Users)
+
+		assert.ErrorIs(t, err, userUtil.ErrUnauthenticated)
+	})
+
+	t.Run("Personal access token is not allowed without a scope check", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/non-existent-path", nil)
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %v", authUtil.PersonalAccessTokenPrefix+"not_a_token"))
 
-		userUtil.GetUserFromJWT(request, response, db)
+		_, err := userUtil.Authenticate(request, repositories.Users)
 
-		assert.Equal(t, response.Code, http.StatusBadRequest)
+		assert.ErrorIs(t, err, userUtil.ErrPersonalAccessTokenNotAllowed)
 	})
 }
 
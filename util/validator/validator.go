@@ -3,6 +3,8 @@ package validator
 import (
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"reflect"
 	"strings"
 	"unicode"
@@ -46,6 +48,12 @@ func New() *validator.Validate {
 		return nil
 	}
 
+	err = validate.RegisterValidation("redirectURI", redirectURI)
+	if err != nil {
+		log.Fatal(err)
+		return nil
+	}
+
 	return validate
 }
 
@@ -79,6 +87,16 @@ func ValidationError(err error) []string {
 				resp[i] = fmt.Sprintf("%s must contain at least one digit", err.Field())
 			case "hasSpecialCharacter":
 				resp[i] = fmt.Sprintf("%s must contain at least one special character", err.Field())
+			case "numeric":
+				resp[i] = fmt.Sprintf("%s must be numeric", err.Field())
+			case "len":
+				resp[i] = fmt.Sprintf("%s must be exactly %s characters length", err.Field(), err.Param())
+			case "required_without":
+				resp[i] = fmt.Sprintf("%s field is required when %s is not provided", err.Field(), err.Param())
+			case "url":
+				resp[i] = fmt.Sprintf("%s must be a valid URL", err.Field())
+			case "redirectURI":
+				resp[i] = fmt.Sprintf("%s must be an https URL, or http on a loopback host, without a fragment", err.Field())
 			case "oneof":
 				resp[i] = fmt.Sprintf("%s field can only be one of the following `%s`", err.Field(), err.Param())
 			default:
@@ -126,3 +144,31 @@ func hasSpecialCharacter(fl validator.FieldLevel) bool {
 	}
 	return false
 }
+
+// redirectURI only allows URLs the authorization code can't leak from, https or http on the loopback for native apps.
+// A fragment is not allowed since the code is appended to the query and the fragment would come after it.
+func redirectURI(fl validator.FieldLevel) bool {
+	raw := fl.Field().String()
+	if strings.Contains(raw, "#") {
+		return false
+	}
+
+	uri, err := url.Parse(raw)
+	if err != nil || uri.Hostname() == "" || uri.Opaque != "" {
+		return false
+	}
+
+	switch uri.Scheme {
+	case "https":
+		return true
+	case "http":
+		if uri.Hostname() == "localhost" {
+			return true
+		}
+
+		ip := net.ParseIP(uri.Hostname())
+		return ip != nil && ip.IsLoopback()
+	default:
+		return false
+	}
+}
@@ -114,11 +114,46 @@ var errorTests = []*testCase{
 		expected: "repeated field can only be one of the following `never daily weekly monthly yearly`",
 	},
 	{
-		name: `default`,
+		name: `url`,
 		input: struct {
 			URL string `json:"url" validate:"url"`
 		}{URL: "image.png"},
-		expected: "something is wrong with url; url",
+		expected: "url must be a valid URL",
+	},
+	{
+		name: `redirectURI`,
+		input: struct {
+			URI string `json:"uri" validate:"redirectURI"`
+		}{URI: "http://partner.example.com/callback"},
+		expected: "uri must be an https URL, or http on a loopback host, without a fragment",
+	},
+	{
+		name: `redirectURIWithFragment`,
+		input: struct {
+			URI string `json:"uri" validate:"redirectURI"`
+		}{URI: "https://partner.example.com/callback#code"},
+		expected: "uri must be an https URL, or http on a loopback host, without a fragment",
+	},
+	{
+		name: `redirectURIJavascript`,
+		input: struct {
+			URI string `json:"uri" validate:"redirectURI"`
+		}{URI: "javascript://partner.example.com/%0Aalert(document.cookie)"},
+		expected: "uri must be an https URL, or http on a loopback host, without a fragment",
+	},
+	{
+		name: `redirectURIData`,
+		input: struct {
+			URI string `json:"uri" validate:"redirectURI"`
+		}{URI: "data:text/html,<script>alert(1)</script>"},
+		expected: "uri must be an https URL, or http on a loopback host, without a fragment",
+	},
+	{
+		name: `default`,
+		input: struct {
+			IP string `json:"ip" validate:"ip"`
+		}{IP: "localhost"},
+		expected: "something is wrong with ip; ip",
 	},
 }
 
@@ -224,6 +259,27 @@ var successTests = []*testCase{
 		}{Repeated: "never"},
 		expected: "",
 	},
+	{
+		name: `redirectURI`,
+		input: struct {
+			URI string `json:"uri" validate:"redirectURI"`
+		}{URI: "https://partner.example.com/callback"},
+		expected: "",
+	},
+	{
+		name: `redirectURILoopback`,
+		input: struct {
+			URI string `json:"uri" validate:"redirectURI"`
+		}{URI: "http://127.0.0.1:8080/callback"},
+		expected: "",
+	},
+	{
+		name: `redirectURILocalhost`,
+		input: struct {
+			URI string `json:"uri" validate:"redirectURI"`
+		}{URI: "http://localhost:8080/callback"},
+		expected: "",
+	},
 	{
 		name: `default`,
 		input: struct {
@@ -0,0 +1,309 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+
+	ChallengeLifetime = 5 * time.Minute
+)
+
+// COSE algorithm identifiers offered to authenticators, in order of preference
+const (
+	AlgorithmES256 = int(webauthncose.AlgES256)
+	AlgorithmEdDSA = int(webauthncose.AlgEdDSA)
+	AlgorithmRS256 = int(webauthncose.AlgRS256)
+)
+
+var Algorithms = []int{AlgorithmES256, AlgorithmEdDSA, AlgorithmRS256}
+
+var ErrSignCount = errors.New("sign count did not increase, the credential may have been cloned")
+
+type Config struct {
+	RPID    string
+	RPName  string
+	Origins []string
+}
+
+// Options and credentials use the field names of the WebAuthn JSON serialization so browsers can pass them to and from navigator.credentials as is
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type AttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON" validate:"required"`
+	AttestationObject string   `json:"attestationObject" validate:"required"`
+	Transports        []string `json:"transports"`
+}
+
+type CredentialCreation struct {
+	ID       string              `json:"id" validate:"required"`
+	RawID    string              `json:"rawId" validate:"required"`
+	Type     string              `json:"type" validate:"required,eq=public-key"`
+	Response AttestationResponse `json:"response" validate:"required"`
+}
+
+type AssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" validate:"required"`
+	AuthenticatorData string `json:"authenticatorData" validate:"required"`
+	Signature         string `json:"signature" validate:"required"`
+	UserHandle        string `json:"userHandle"`
+}
+
+type CredentialAssertion struct {
+	ID       string            `json:"id" validate:"required"`
+	RawID    string            `json:"rawId" validate:"required"`
+	Type     string            `json:"type" validate:"required,eq=public-key"`
+	Response AssertionResponse `json:"response" validate:"required"`
+}
+
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Credential is what is stored after a successful registration
+type Credential struct {
+	ID           string
+	PublicKey    []byte
+	SignCount    uint32
+	AAGUID       []byte
+	Transports   []string
+	UserVerified bool
+}
+
+func NewChallenge() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func (c Config) NewCreationOptions(challenge string, userHandle []byte, name string, displayName string, exclude []CredentialDescriptor) CreationOptions {
+	parameters := make([]CredentialParameter, len(Algorithms))
+	for i, algorithm := range Algorithms {
+		parameters[i] = CredentialParameter{Type: "public-key", Alg: algorithm}
+	}
+
+	return CreationOptions{
+		Challenge: challenge,
+		RP: RelyingParty{
+			ID:   c.RPID,
+			Name: c.RPName,
+		},
+		User: UserEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(userHandle),
+			Name:        name,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams:   parameters,
+		Timeout:            ChallengeLifetime.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// NewRequestOptions leaves allowCredentials empty so the authenticator offers its discoverable credentials and no email has to be entered
+func (c Config) NewRequestOptions(challenge string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          ChallengeLifetime.Milliseconds(),
+		RPID:             c.RPID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "preferred",
+	}
+}
+
+// Challenge returns the challenge the client data was signed for, so the ceremony it belongs to can be looked up before verifying it
+func Challenge(clientDataJSON string) (string, error) {
+	_, clientData, err := parseClientData(clientDataJSON)
+	if err != nil {
+		return "", err
+	}
+
+	return clientData.Challenge, nil
+}
+
+// VerifyRegistration checks an attestation against the challenge it was created for. Parsing and verifying the attestation is left to
+// go-webauthn, only credentials with one of the offered algorithms are accepted.
+func (c Config) VerifyRegistration(creation CredentialCreation, challenge string) (*Credential, error) {
+	raw, err := json.Marshal(creation)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rejectCrossOrigin(creation.Response.ClientDataJSON); err != nil {
+		return nil, err
+	}
+
+	if err := parsed.Verify(challenge, false, c.RPID, c.Origins); err != nil {
+		return nil, err
+	}
+
+	attestedCredential := parsed.Response.AttestationObject.AuthData.AttData
+	if len(attestedCredential.CredentialID) == 0 {
+		return nil, errors.New("attested credential data is missing")
+	}
+
+	if !bytes.Equal(parsed.RawID, attestedCredential.CredentialID) {
+		return nil, errors.New("credential ID does not match the attested credential")
+	}
+
+	var key webauthncose.PublicKeyData
+	if err := webauthncbor.Unmarshal(attestedCredential.CredentialPublicKey, &key); err != nil {
+		return nil, fmt.Errorf("credential public key is malformed: %w", err)
+	}
+
+	if !slices.Contains(Algorithms, int(key.Algorithm)) {
+		return nil, fmt.Errorf("algorithm %d is not supported", key.Algorithm)
+	}
+
+	if _, err := webauthncose.ParsePublicKey(attestedCredential.CredentialPublicKey); err != nil {
+		return nil, fmt.Errorf("credential public key is malformed: %w", err)
+	}
+
+	return &Credential{
+		ID:           base64.RawURLEncoding.EncodeToString(attestedCredential.CredentialID),
+		PublicKey:    attestedCredential.CredentialPublicKey,
+		SignCount:    parsed.Response.AttestationObject.AuthData.Counter,
+		AAGUID:       attestedCredential.AAGUID,
+		Transports:   creation.Response.Transports,
+		UserVerified: parsed.Response.AttestationObject.AuthData.Flags.UserVerified(),
+	}, nil
+}
+
+// VerifyAssertion checks an assertion against the challenge and the stored credential, returning the new sign count and whether the user was verified
+func (c Config) VerifyAssertion(assertion CredentialAssertion, challenge string, publicKey []byte, signCount uint32) (uint32, bool, error) {
+	raw, err := json.Marshal(assertion)
+	if err != nil {
+		return 0, false, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(raw))
+	if err != nil {
+		return 0, false, err
+	}
+
+	if err := rejectCrossOrigin(assertion.Response.ClientDataJSON); err != nil {
+		return 0, false, err
+	}
+
+	if err := parsed.Verify(challenge, c.RPID, c.Origins, "", false, publicKey); err != nil {
+		return 0, false, err
+	}
+
+	authenticatorData := parsed.Response.AuthenticatorData
+
+	// Authenticators which don't keep a counter always report zero
+	if (authenticatorData.Counter != 0 || signCount != 0) && authenticatorData.Counter <= signCount {
+		return 0, false, ErrSignCount
+	}
+
+	return authenticatorData.Counter, authenticatorData.Flags.UserVerified(), nil
+}
+
+// rejectCrossOrigin refuses ceremonies run in a frame of another origin, which go-webauthn doesn't check
+func rejectCrossOrigin(encoded string) error {
+	_, clientData, err := parseClientData(encoded)
+	if err != nil {
+		return err
+	}
+
+	if clientData.CrossOrigin {
+		return errors.New("cross origin ceremonies are not allowed")
+	}
+
+	return nil
+}
+
+func parseClientData(encoded string) ([]byte, *ClientData, error) {
+	clientDataJSON, err := decodeBase64URL(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client data is not base64url: %w", err)
+	}
+
+	var clientData ClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return nil, nil, fmt.Errorf("client data is malformed: %w", err)
+	}
+
+	return clientDataJSON, &clientData, nil
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers differ
+func decodeBase64URL(encoded string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+}
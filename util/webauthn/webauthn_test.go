@@ -0,0 +1,150 @@
+package webauthn_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/ushiradineth/koano-api/util/test"
+	"github.com/ushiradineth/koano-api/util/webauthn"
+)
+
+var config = webauthn.Config{
+	RPID:    "koano.app",
+	RPName:  "Koano",
+	Origins: []string{"https://koano.app"},
+}
+
+func register(t *testing.T, authenticator *test.SoftwareAuthenticator) (*webauthn.Credential, webauthn.CredentialCreation, string) {
+	t.Helper()
+
+	challenge, err := webauthn.NewChallenge()
+	assert.NoError(t, err)
+
+	userID := uuid.New()
+	options := config.NewCreationOptions(challenge, userID[:], "user@koano.app", "User", nil)
+	creation := authenticator.Create(options)
+
+	credential, err := config.VerifyRegistration(creation, challenge)
+	return credential, creation, challenge
+}
+
+func TestRegistration(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		authenticator := test.NewSoftwareAuthenticator("https://koano.app")
+
+		credential, creation, challenge := register(t, authenticator)
+		assert.NotNil(t, credential)
+		assert.Equal(t, authenticator.CredentialID(), credential.ID)
+		assert.Equal(t, []string{"internal", "hybrid"}, credential.Transports)
+		assert.True(t, credential.UserVerified)
+
+		challengeFromClientData, err := webauthn.Challenge(creation.Response.ClientDataJSON)
+		assert.NoError(t, err)
+		assert.Equal(t, challenge, challengeFromClientData)
+	})
+
+	t.Run("Challenge mismatch", func(t *testing.T) {
+		authenticator := test.NewSoftwareAuthenticator("https://koano.app")
+		_, creation, _ := register(t, authenticator)
+
+		other, _ := webauthn.NewChallenge()
+		_, err := config.VerifyRegistration(creation, other)
+		assert.Error(t, err)
+	})
+
+	t.Run("Origin mismatch", func(t *testing.T) {
+		authenticator := test.NewSoftwareAuthenticator("https://evil.example.com")
+		_, creation, challenge := register(t, authenticator)
+
+		_, err := config.VerifyRegistration(creation, challenge)
+		assert.ErrorContains(t, err, "origin")
+	})
+
+	t.Run("Relying party mismatch", func(t *testing.T) {
+		authenticator := test.NewSoftwareAuthenticator("https://koano.app")
+
+		challenge, _ := webauthn.NewChallenge()
+		userID := uuid.New()
+		options := config.NewCreationOptions(challenge, userID[:], "user@koano.app", "User", nil)
+		options.RP.ID = "evil.example.com"
+
+		_, err := config.VerifyRegistration(authenticator.Create(options), challenge)
+		assert.Error(t, err)
+	})
+
+	t.Run("Credential ID mismatch", func(t *testing.T) {
+		authenticator := test.NewSoftwareAuthenticator("https://koano.app")
+		_, creation, challenge := register(t, authenticator)
+
+		creation.RawID = base64.RawURLEncoding.EncodeToString([]byte("another-credential"))
+		_, err := config.VerifyRegistration(creation, challenge)
+		assert.Error(t, err)
+	})
+
+	t.Run("Attestation object is truncated", func(t *testing.T) {
+		authenticator := test.NewSoftwareAuthenticator("https://koano.app")
+		_, creation, challenge := register(t, authenticator)
+
+		raw, _ := base64.RawURLEncoding.DecodeString(creation.Response.AttestationObject)
+		creation.Response.AttestationObject = base64.RawURLEncoding.EncodeToString(raw[:len(raw)/2])
+		_, err := config.VerifyRegistration(creation, challenge)
+		assert.Error(t, err)
+	})
+}
+
+func TestAssertion(t *testing.T) {
+	authenticator := test.NewSoftwareAuthenticator("https://koano.app")
+	credential, _, _ := register(t, authenticator)
+
+	login := func() (webauthn.CredentialAssertion, string) {
+		challenge, _ := webauthn.NewChallenge()
+		return authenticator.Get(config.NewRequestOptions(challenge)), challenge
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		assertion, challenge := login()
+
+		signCount, userVerified, err := config.VerifyAssertion(assertion, challenge, credential.PublicKey, credential.SignCount)
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(1), signCount)
+		assert.True(t, userVerified)
+
+		credential.SignCount = signCount
+	})
+
+	t.Run("Signature is invalid", func(t *testing.T) {
+		assertion, challenge := login()
+		assertion.Response.Signature = base64.RawURLEncoding.EncodeToString([]byte("not-a-signature"))
+
+		_, _, err := config.VerifyAssertion(assertion, challenge, credential.PublicKey, credential.SignCount)
+		assert.Error(t, err)
+	})
+
+	t.Run("Registration client data is not accepted", func(t *testing.T) {
+		assertion, challenge := login()
+		_, creation, _ := register(t, authenticator)
+		assertion.Response.ClientDataJSON = creation.Response.ClientDataJSON
+
+		_, _, err := config.VerifyAssertion(assertion, challenge, credential.PublicKey, credential.SignCount)
+		assert.Error(t, err)
+	})
+
+	t.Run("Sign count did not increase", func(t *testing.T) {
+		assertion, challenge := login()
+
+		_, _, err := config.VerifyAssertion(assertion, challenge, credential.PublicKey, authenticator.SignCount)
+		assert.ErrorIs(t, err, webauthn.ErrSignCount)
+	})
+
+	t.Run("User was not verified", func(t *testing.T) {
+		authenticator.UserVerified = false
+		defer func() { authenticator.UserVerified = true }()
+
+		assertion, challenge := login()
+		_, userVerified, err := config.VerifyAssertion(assertion, challenge, credential.PublicKey, credential.SignCount)
+		assert.NoError(t, err)
+		assert.False(t, userVerified)
+	})
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/metrics"
+)
+
+// A job is stalled once it hasn't finished a run in this many intervals, such as one stuck on a query
+const stalledAfter = 3
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+// Locker keeps a job from running on more than one instance at a time
+type Locker interface {
+	// TryLock returns without waiting, locked is false while another instance holds the lock of the job
+	TryLock(ctx context.Context, name string) (unlock func(), locked bool, err error)
+}
+
+// Worker runs scheduled jobs in the background of the API process. Each job runs once on start and then on its interval until the context is cancelled.
+type Worker struct {
+	log    *logger.Logger
+	locker Locker
+	jobs   []job
+
+	mu         sync.Mutex
+	started    time.Time
+	heartbeats map[string]time.Time
+}
+
+// New runs each job under its lock from locker, or on every instance when locker is nil
+func New(log *logger.Logger, locker Locker) *Worker {
+	return &Worker{
+		log:        log,
+		locker:     locker,
+		heartbeats: map[string]time.Time{},
+	}
+}
+
+func (w *Worker) Every(name string, interval time.Duration, run func(ctx context.Context) error) {
+	w.jobs = append(w.jobs, job{name: name, interval: interval, run: run})
+}
+
+func (w *Worker) Start(ctx context.Context) {
+	w.mu.Lock()
+	w.started = time.Now()
+	w.mu.Unlock()
+
+	for _, j := range w.jobs {
+		go w.loop(ctx, j)
+	}
+}
+
+func (w *Worker) loop(ctx context.Context, j job) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		metrics.WorkerJobRuns.WithLabelValues(j.name, w.run(ctx, j)).Inc()
+		w.beat(j.name)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check fails when the worker hasn't been started or the heartbeat of one of its jobs is older than a few intervals. Runs which fail
+// or are skipped while another instance holds the lock still beat, they are retried on the next interval.
+func (w *Worker) Check(_ context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.started.IsZero() {
+		return errors.New("Worker has not been started")
+	}
+
+	for _, j := range w.jobs {
+		last, ok := w.heartbeats[j.name]
+		if !ok {
+			last = w.started
+		}
+
+		if since := time.Since(last); since > stalledAfter*j.interval {
+			return fmt.Errorf("Job %s has not finished a run in %s", j.name, since.Round(time.Second))
+		}
+	}
+
+	return nil
+}
+
+func (w *Worker) beat(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.heartbeats[name] = time.Now()
+}
+
+// run runs the job once and returns the outcome. Failed runs are logged and retried on the next interval.
+func (w *Worker) run(ctx context.Context, j job) string {
+	if w.locker != nil {
+		unlock, locked, err := w.locker.TryLock(ctx, j.name)
+		if err != nil {
+			w.log.Error.Printf("Job %s failed to take its lock: %v", j.name, err)
+			return metrics.OutcomeFailure
+		}
+
+		if !locked {
+			return metrics.OutcomeSkipped
+		}
+		defer unlock()
+	}
+
+	if err := j.run(ctx); err != nil {
+		w.log.Error.Printf("Job %s failed: %v", j.name, err)
+		return metrics.OutcomeFailure
+	}
+
+	metrics.WorkerJobLastSuccess.WithLabelValues(j.name).SetToCurrentTime()
+	return metrics.OutcomeSuccess
+}
@@ -0,0 +1,130 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	logger "github.com/ushiradineth/koano-api/util/log"
+	"github.com/ushiradineth/koano-api/util/metrics"
+	"github.com/ushiradineth/koano-api/util/worker"
+)
+
+func TestWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var runs, failures atomic.Int32
+
+	w := worker.New(logger.New(), nil)
+	w.Every("count", 10*time.Millisecond, func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	w.Every("fail", 10*time.Millisecond, func(ctx context.Context) error {
+		failures.Add(1)
+		return errors.New("failed")
+	})
+	w.Start(ctx)
+
+	assert.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, 5*time.Millisecond, "Job should run repeatedly")
+	assert.Eventually(t, func() bool { return failures.Load() >= 3 }, time.Second, 5*time.Millisecond, "Failing job should keep running")
+
+	cancel()
+	time.Sleep(30 * time.Millisecond)
+	stopped := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, stopped, runs.Load(), "Job should stop once the context is cancelled")
+}
+
+// locker stands in for the advisory locks, holding a job's lock as another instance would
+type locker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func (l *locker) TryLock(_ context.Context, name string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.held[name] {
+		return nil, false, nil
+	}
+
+	l.held[name] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, name)
+	}, true, nil
+}
+
+func (l *locker) set(name string, held bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held[name] = held
+}
+
+func TestLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs atomic.Int32
+	locks := &locker{held: map[string]bool{"locked": true}}
+
+	w := worker.New(logger.New(), locks)
+	w.Every("locked", 10*time.Millisecond, func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	w.Start(ctx)
+
+	skipped := func() float64 {
+		return testutil.ToFloat64(metrics.WorkerJobRuns.WithLabelValues("locked", metrics.OutcomeSkipped))
+	}
+	assert.Eventually(t, func() bool { return skipped() >= 2 }, time.Second, 5*time.Millisecond, "Runs should be skipped while another instance holds the lock")
+	assert.Zero(t, runs.Load())
+
+	locks.set("locked", false)
+	assert.Eventually(t, func() bool { return runs.Load() >= 2 }, time.Second, 5*time.Millisecond, "The job should run once the lock is free")
+	assert.NotZero(t, testutil.ToFloat64(metrics.WorkerJobLastSuccess.WithLabelValues("locked")))
+}
+
+func TestCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+
+	w := worker.New(logger.New(), nil)
+	w.Every("stuck", 10*time.Millisecond, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	assert.ErrorContains(t, w.Check(ctx), "not been started")
+
+	w.Start(ctx)
+	assert.NoError(t, w.Check(ctx), "A job which only just started should not be stalled")
+
+	assert.Eventually(t, func() bool { return w.Check(ctx) != nil }, time.Second, 5*time.Millisecond, "A job stuck for a few intervals should be stalled")
+	assert.ErrorContains(t, w.Check(ctx), "Job stuck has not finished a run")
+
+	close(release)
+	assert.Eventually(t, func() bool { return w.Check(ctx) == nil }, time.Second, 5*time.Millisecond, "The job should recover once it finishes")
+}
+
+func TestCheckSkipped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := worker.New(logger.New(), &locker{held: map[string]bool{"elsewhere": true}})
+	w.Every("elsewhere", 10*time.Millisecond, func(ctx context.Context) error { return nil })
+	w.Start(ctx)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, w.Check(ctx), "A job running on another instance should not be stalled")
+}